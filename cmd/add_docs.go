@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/dontizi/rlama/internal/service"
 	"github.com/spf13/cobra"
@@ -11,26 +14,51 @@ var (
 	addDocsExcludeDirs      []string
 	addDocsExcludeExts      []string
 	addDocsProcessExts      []string
+	addDocsIncludePatterns  []string
+	addDocsExcludePatterns  []string
+	addDocsUseGitignore     bool
 	addDocsChunkSize        int
 	addDocsChunkOverlap     int
+	addDocsRowsPerChunk     int
+	addDocsChunkTokens      int
+	addDocsOverlapTokens    int
 	addDocsChunkingStrategy string
 	addDocsDisableReranker  bool
 	addDocsRerankerModel    string
 	addDocsRerankerWeight   float64
+	addDocsWorkers          int
+	addDocsFileTimeout      time.Duration
+	addDocsArchiveDepth     int
+	addDocsMaxArchiveMB     int64
+	addDocsDedupPolicy      string
+	addDocsDedupThreshold   float64
+	addDocsBoilerplateDocs  int
+	addDocsBoilerplateRatio float64
+	addDocsRedactMode       string
+	addDocsRedactDetectors  []string
+	addDocsRedactPatterns   []string
+	addDocsContextHeaders   bool
+	addDocsContextSummaries bool
+	addDocsContextModel     string
+	addDocsEvalQuestions    string
+	addDocsStdinName        string
+	addDocsStdinContentType string
 )
 
 var addDocsCmd = &cobra.Command{
-	Use:   "add-docs [rag-name] [folder-path]",
+	Use:   "add-docs [rag-name] [path...]",
 	Short: "Add documents to an existing RAG system",
-	Long: `Add documents from a folder to an existing RAG system.
+	Long: `Add documents from folders, files or glob patterns to an existing RAG system.
 Example: rlama add-docs my-docs ./new-documents
 	
-This will load documents from the specified folder, generate embeddings,
-and add them to the existing RAG system.`,
-	Args: cobra.ExactArgs(2),
+This will load documents from the specified paths, generate embeddings,
+and add them to the existing RAG system. "-" reads a document from standard input:
+  rlama add-docs my-docs ./CHANGELOG.md 'notes/**/*.md'
+  pbpaste | rlama add-docs my-docs - --name meeting-notes.md`,
+	Args: cobra.MinimumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ragName := args[0]
-		folderPath := args[1]
+		sources := args[1:]
 
 		// Get Ollama client from root command
 		ollamaClient := GetOllamaClient()
@@ -43,21 +71,60 @@ and add them to the existing RAG system.`,
 			ExcludeDirs:      addDocsExcludeDirs,
 			ExcludeExts:      addDocsExcludeExts,
 			ProcessExts:      addDocsProcessExts,
+			IncludePatterns:  addDocsIncludePatterns,
+			ExcludePatterns:  addDocsExcludePatterns,
+			UseGitignore:     addDocsUseGitignore,
 			ChunkSize:        addDocsChunkSize,
 			ChunkOverlap:     addDocsChunkOverlap,
 			ChunkingStrategy: addDocsChunkingStrategy,
+			RowsPerChunk:     addDocsRowsPerChunk,
+			ChunkTokens:      addDocsChunkTokens,
+			OverlapTokens:    addDocsOverlapTokens,
 			EnableReranker:   !addDocsDisableReranker,
 			RerankerModel:    addDocsRerankerModel,
 			RerankerWeight:   addDocsRerankerWeight,
+			Workers:          addDocsWorkers,
+			FileTimeout:      addDocsFileTimeout,
+			ArchiveDepth:     addDocsArchiveDepth,
+			MaxArchiveSize:   addDocsMaxArchiveMB << 20,
+			BoilerplateDocs:  addDocsBoilerplateDocs,
+			BoilerplateRatio: addDocsBoilerplateRatio,
+		}
+		dedup, err := service.NewDedupSettings(addDocsDedupPolicy, addDocsDedupThreshold)
+		if err != nil {
+			return err
+		}
+		loaderOptions.Dedup = dedup
+		if addDocsRedactMode != "" {
+			redaction, err := service.NewRedactionSettings(addDocsRedactMode, addDocsRedactDetectors, addDocsRedactPatterns)
+			if err != nil {
+				return err
+			}
+			loaderOptions.Redaction = redaction
+		}
+		loaderOptions.ContextualHeaders = service.NewContextualHeaderSettings(addDocsContextHeaders, addDocsContextSummaries, addDocsContextModel)
+		if addDocsEvalQuestions != "" {
+			questions, err := service.LoadRetrievalQuestions(addDocsEvalQuestions)
+			if err != nil {
+				return err
+			}
+			loaderOptions.EvalQuestions = questions
 		}
 
 		// Pass the options to the service
-		err := ragService.AddDocsWithOptions(ragName, folderPath, loaderOptions)
+		if isSingleFolder(sources) {
+			err = ragService.AddDocsWithOptions(ragName, sources[0], loaderOptions)
+		} else {
+			loaderOptions.Stdin = os.Stdin
+			loaderOptions.StdinName = addDocsStdinName
+			loaderOptions.StdinContentType = addDocsStdinContentType
+			err = ragService.AddDocsFromSources(ragName, sources, loaderOptions)
+		}
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("Documents from '%s' added to RAG '%s' successfully.\n", folderPath, ragName)
+		fmt.Printf("Documents from '%s' added to RAG '%s' successfully.\n", strings.Join(sources, "', '"), ragName)
 		return nil
 	},
 }
@@ -69,13 +136,43 @@ func init() {
 	addDocsCmd.Flags().StringSliceVar(&addDocsExcludeDirs, "exclude-dir", []string{}, "Directories to exclude (comma-separated)")
 	addDocsCmd.Flags().StringSliceVar(&addDocsExcludeExts, "exclude-ext", []string{}, "File extensions to exclude (comma-separated)")
 	addDocsCmd.Flags().StringSliceVar(&addDocsProcessExts, "process-ext", []string{}, "Only process these file extensions (comma-separated)")
+	addDocsCmd.Flags().StringSliceVar(&addDocsIncludePatterns, "include", []string{}, "Only add files matching these glob patterns (gitignore syntax, comma-separated)")
+	addDocsCmd.Flags().StringSliceVar(&addDocsExcludePatterns, "exclude", []string{}, "Exclude paths matching these glob patterns (gitignore syntax, comma-separated)")
+	addDocsCmd.Flags().BoolVar(&addDocsUseGitignore, "gitignore", false, "Honour .gitignore files in addition to .rlamaignore")
 
 	// Add chunking options
 	addDocsCmd.Flags().IntVar(&addDocsChunkSize, "chunk-size", 1000, "Character count per chunk")
 	addDocsCmd.Flags().IntVar(&addDocsChunkOverlap, "chunk-overlap", 200, "Overlap between chunks in characters")
 	addDocsCmd.Flags().StringVar(&addDocsChunkingStrategy, "chunking-strategy", "hybrid",
-		"Chunking strategy to use (options: \"fixed\", \"semantic\", \"hybrid\", \"hierarchical\", \"auto\"). "+
+		"Chunking strategy to use (options: \"fixed\", \"semantic\", \"hybrid\", \"hierarchical\", \"embedding\", \"auto\"). "+
 			"The \"auto\" strategy will analyze each document and apply the optimal strategy automatically.")
+	addDocsCmd.Flags().IntVar(&addDocsChunkTokens, "chunk-tokens", 0, "Token count per chunk, replaces --chunk-size (default: the RAG's setting)")
+	addDocsCmd.Flags().IntVar(&addDocsOverlapTokens, "chunk-overlap-tokens", 0, "Overlap between chunks in tokens when --chunk-tokens is set")
+	addDocsCmd.Flags().IntVar(&addDocsRowsPerChunk, "rows-per-chunk", 0, "Table rows per chunk for CSV and spreadsheet files (default: the RAG's setting)")
+
+	// Add document loading options
+	addDocsCmd.Flags().IntVar(&addDocsWorkers, "workers", 0, "Number of files extracted in parallel (0 = number of CPUs)")
+	addDocsCmd.Flags().DurationVar(&addDocsFileTimeout, "file-timeout", service.DefaultFileTimeout, "Maximum extraction time per file (e.g. 90s, 5m)")
+	addDocsCmd.Flags().IntVar(&addDocsArchiveDepth, "archive-depth", 0, "How deep nested zip/tar archives are opened as folders (-1 = never open archives, 0 = the RAG's setting)")
+	addDocsCmd.Flags().Int64Var(&addDocsMaxArchiveMB, "max-archive-size", 0, "Maximum megabytes extracted from each archive, nested archives included (0 = the RAG's setting)")
+	addDocsCmd.Flags().StringVar(&addDocsDedupPolicy, "duplicates", "", "What to do with near-duplicates of indexed or new documents, saved on the RAG (options: \"skip\", \"keep-newest\", \"alias\", \"off\"; default: the RAG setting)")
+	addDocsCmd.Flags().Float64Var(&addDocsDedupThreshold, "duplicate-threshold", service.DefaultDedupThreshold, "Similarity (0-1) above which two documents are near-duplicates, used with --duplicates")
+	addDocsCmd.Flags().IntVar(&addDocsBoilerplateDocs, "boilerplate-min-docs", service.DefaultBoilerplateMinDocs, "Minimum number of documents a repeated line must appear in to be removed as boilerplate (-1 = keep boilerplate)")
+	addDocsCmd.Flags().Float64Var(&addDocsBoilerplateRatio, "boilerplate-ratio", service.DefaultBoilerplateRatio, "Minimum share of the documents (0-1) a repeated line must appear in to be removed as boilerplate")
+
+	addDocsCmd.Flags().StringVar(&addDocsStdinName, "name", "", "Name of the document read from standard input with \"-\" (default: stdin- and a hash of its content)")
+	addDocsCmd.Flags().StringVar(&addDocsStdinContentType, "content-type", "", "Content type of the document read from standard input (e.g. text/markdown, application/pdf)")
+
+	// Add personal data redaction options
+	addDocsCmd.Flags().StringVar(&addDocsRedactMode, "redact", "", "Redact personal data before indexing (options: \"mask\", \"hash\", \"drop\"); saved with the RAG")
+	addDocsCmd.Flags().StringSliceVar(&addDocsRedactDetectors, "redact-detectors", []string{}, "Built-in PII detectors to use (comma-separated, default all: "+strings.Join(service.BuiltinDetectorNames(), ", ")+")")
+	addDocsCmd.Flags().StringArrayVar(&addDocsRedactPatterns, "redact-pattern", []string{}, "Additional detector as name=regex (repeatable)")
+
+	// Add contextual chunk header options
+	addDocsCmd.Flags().BoolVar(&addDocsContextHeaders, "context-headers", false, "Prepend the document title and section breadcrumb to each chunk before embedding; saved with the RAG")
+	addDocsCmd.Flags().BoolVar(&addDocsContextSummaries, "context-summaries", false, "Also add a sentence situating each chunk in its document, written by an LLM (one call per chunk)")
+	addDocsCmd.Flags().StringVar(&addDocsContextModel, "context-model", "", "LLM writing the context summaries (defaults to the RAG model)")
+	addDocsCmd.Flags().StringVar(&addDocsEvalQuestions, "eval-questions", "", "Question set (JSON or JSON lines, see chunk-eval) the \"auto\" strategy uses to pick chunking configurations by retrieval")
 
 	// Add reranking options
 	addDocsCmd.Flags().BoolVar(&addDocsDisableReranker, "disable-reranker", false, "Disable reranking for this RAG")
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dontizi/rlama/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addGitRef              string
+	addGitExcludeDirs      []string
+	addGitExcludeExts      []string
+	addGitProcessExts      []string
+	addGitIncludePatterns  []string
+	addGitExcludePatterns  []string
+	addGitUseGitignore     bool
+	addGitChunkSize        int
+	addGitChunkOverlap     int
+	addGitChunkingStrategy string
+	addGitWorkers          int
+	addGitFileTimeout      time.Duration
+)
+
+var addGitCmd = &cobra.Command{
+	Use:   "add-git [rag-name] [repo-path]",
+	Short: "Add the files of a local git repository to a RAG system",
+	Long: `Index the files of a local git repository, as committed at a given ref,
+into an existing RAG system. The working tree is never read.
+Example: rlama add-git my-docs ./my-repo --ref main
+
+Each document records the repository, the indexed commit and the last commit
+that modified the file (hash, author and date). The indexed commit is stored on
+the RAG: running the command again only re-indexes the files changed since then,
+and removes the files that were deleted or renamed.
+
+The .rlamaignore files committed in the repository are honoured, as well as the
+.gitignore files with --gitignore.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ragName := args[0]
+		repoPath := args[1]
+
+		// Get Ollama client from root command
+		ollamaClient := GetOllamaClient()
+
+		// Create necessary services
+		ragService := service.NewRagService(ollamaClient)
+		gitIngester := service.NewGitIngester(ragService)
+
+		loaderOptions := service.DocumentLoaderOptions{
+			ExcludeDirs:      addGitExcludeDirs,
+			ExcludeExts:      addGitExcludeExts,
+			ProcessExts:      addGitProcessExts,
+			IncludePatterns:  addGitIncludePatterns,
+			ExcludePatterns:  addGitExcludePatterns,
+			UseGitignore:     addGitUseGitignore,
+			ChunkSize:        addGitChunkSize,
+			ChunkOverlap:     addGitChunkOverlap,
+			ChunkingStrategy: addGitChunkingStrategy,
+			Workers:          addGitWorkers,
+			FileTimeout:      addGitFileTimeout,
+		}
+
+		result, err := gitIngester.IngestRepository(ragName, repoPath, addGitRef, loaderOptions)
+		if err != nil {
+			return err
+		}
+
+		commit := result.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		fmt.Printf("Repository '%s' indexed at %s in RAG '%s': %d added, %d updated, %d removed.\n",
+			result.Repository, commit, ragName, result.Added, result.Updated, result.Removed)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addGitCmd)
+
+	addGitCmd.Flags().StringVar(&addGitRef, "ref", "HEAD", "Branch, tag or commit to index")
+
+	// Add exclusion and processing flags
+	addGitCmd.Flags().StringSliceVar(&addGitExcludeDirs, "exclude-dir", []string{}, "Directories to exclude (comma-separated)")
+	addGitCmd.Flags().StringSliceVar(&addGitExcludeExts, "exclude-ext", []string{}, "File extensions to exclude (comma-separated)")
+	addGitCmd.Flags().StringSliceVar(&addGitProcessExts, "process-ext", []string{}, "Only process these file extensions (comma-separated)")
+	addGitCmd.Flags().StringSliceVar(&addGitIncludePatterns, "include", []string{}, "Only add files matching these glob patterns (gitignore syntax, comma-separated)")
+	addGitCmd.Flags().StringSliceVar(&addGitExcludePatterns, "exclude", []string{}, "Exclude paths matching these glob patterns (gitignore syntax, comma-separated)")
+	addGitCmd.Flags().BoolVar(&addGitUseGitignore, "gitignore", false, "Honour .gitignore files in addition to .rlamaignore")
+
+	// Add chunking options (0/empty keeps the RAG settings)
+	addGitCmd.Flags().IntVar(&addGitChunkSize, "chunk-size", 0, "Character count per chunk (default: the RAG's setting)")
+	addGitCmd.Flags().IntVar(&addGitChunkOverlap, "chunk-overlap", 0, "Overlap between chunks in characters (default: the RAG's setting)")
+	addGitCmd.Flags().StringVar(&addGitChunkingStrategy, "chunking-strategy", "", "Chunking strategy to use (default: the RAG's strategy)")
+
+	// Add document loading options
+	addGitCmd.Flags().IntVar(&addGitWorkers, "workers", 0, "Number of files extracted in parallel (0 = number of CPUs)")
+	addGitCmd.Flags().DurationVar(&addGitFileTimeout, "file-timeout", service.DefaultFileTimeout, "Maximum extraction time per file (e.g. 90s, 5m)")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dontizi/rlama/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var boilerplateForget []int
+
+var boilerplateCmd = &cobra.Command{
+	Use:   "boilerplate [rag-name]",
+	Short: "Show the repeated lines removed from the documents of a RAG",
+	Long: `Display the lines (page headers, footers, disclaimers, menus) found repeated
+across the documents of a RAG and removed before chunking.
+Example: rlama boilerplate my-docs
+
+Use --forget with the numbers shown in the list to stop removing some lines
+from documents added later:
+rlama boilerplate my-docs --forget 2,5`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ragName := args[0]
+
+		// Get Ollama client from root command
+		ollamaClient := GetOllamaClient()
+
+		// Create necessary services
+		ragService := service.NewRagService(ollamaClient)
+
+		// Load the RAG
+		rag, err := ragService.LoadRag(ragName)
+		if err != nil {
+			return err
+		}
+
+		if len(boilerplateForget) > 0 {
+			forget := make(map[int]bool)
+			for _, n := range boilerplateForget {
+				if n < 1 || n > len(rag.Boilerplate) {
+					return fmt.Errorf("no boilerplate line number %d in RAG '%s'", n, ragName)
+				}
+				forget[n-1] = true
+			}
+
+			kept := rag.Boilerplate[:0]
+			for i, line := range rag.Boilerplate {
+				if !forget[i] {
+					kept = append(kept, line)
+				}
+			}
+			rag.Boilerplate = kept
+
+			if err := ragService.UpdateRag(rag); err != nil {
+				return err
+			}
+			fmt.Printf("Forgot %d boilerplate line(s) of RAG '%s'.\n", len(forget), ragName)
+			return nil
+		}
+
+		if len(rag.Boilerplate) == 0 {
+			fmt.Printf("No boilerplate found in RAG '%s'.\n", ragName)
+			return nil
+		}
+
+		fmt.Printf("Boilerplate removed from RAG '%s' (%d lines):\n\n", ragName, len(rag.Boilerplate))
+
+		// Use tabwriter for aligned display
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tDOCUMENTS\tREMOVED\tLINE")
+		for i, line := range rag.Boilerplate {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%s\n", i+1, line.Documents, line.Occurrences, truncateString(line.Example, 80))
+		}
+		w.Flush()
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(boilerplateCmd)
+	boilerplateCmd.Flags().IntSliceVar(&boilerplateForget, "forget", nil, "Numbers of the lines to stop removing (comma-separated)")
+}
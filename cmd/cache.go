@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dontizi/rlama/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cachePruneMaxSize int
+	cachePruneMaxAge  time.Duration
+	cacheClearModel   string
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the embedding cache",
+	Long: `Embeddings of chunks and queries are cached on disk, by embedding model and text,
+so that re-creating a RAG or adding the same documents again doesn't embed them again.
+The least recently used embeddings are evicted when the cache grows past
+--embedding-cache-size megabytes.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the size of the embedding cache by model",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache := openEmbeddingCache()
+		entries, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Printf("The embedding cache in %s is empty.\n", cache.Dir())
+			return nil
+		}
+
+		fmt.Printf("Embedding cache in %s:\n\n", cache.Dir())
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODEL\tEMBEDDINGS\tSIZE\tLAST USED")
+		var embeddings int
+		var size int64
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", entry.Model, entry.Embeddings, formatSize(entry.Bytes), entry.LastUsed.Format("2006-01-02 15:04:05"))
+			embeddings += entry.Embeddings
+			size += entry.Bytes
+		}
+		fmt.Fprintf(w, "TOTAL\t%d\t%s\t\n", embeddings, formatSize(size))
+		w.Flush()
+
+		if service.EmbeddingCacheMaxBytes > 0 {
+			fmt.Printf("\nSize limit: %s\n", formatSize(service.EmbeddingCacheMaxBytes))
+		}
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Evict the least recently used embeddings from the cache",
+	Long: `Remove the embeddings unused for longer than --max-age, then the least recently
+used ones until the cache takes at most --max-size megabytes (by default the
+--embedding-cache-size limit).
+Example: rlama cache prune --max-size 200 --max-age 720h`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		maxBytes := service.EmbeddingCacheMaxBytes
+		if cmd.Flags().Changed("max-size") {
+			maxBytes = int64(cachePruneMaxSize) << 20
+		}
+
+		removed, freed, err := openEmbeddingCache().Prune(maxBytes, cachePruneMaxAge)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached embedding(s), freeing %s.\n", removed, formatSize(freed))
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all the cached embeddings",
+	Long: `Remove all the cached embeddings, or only those of one model with --model,
+whatever the embedding profile they were made through.
+Example: rlama cache clear --model bge-m3`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := openEmbeddingCache().Clear(cacheClearModel); err != nil {
+			return err
+		}
+		if cacheClearModel != "" {
+			fmt.Printf("Cleared the cached embeddings of %s.\n", cacheClearModel)
+		} else {
+			fmt.Println("Cleared the embedding cache.")
+		}
+		return nil
+	},
+}
+
+// openEmbeddingCache returns the embedding cache of the data directory, even
+// when caching is disabled
+func openEmbeddingCache() *service.EmbeddingCache {
+	if cache := service.DefaultEmbeddingCache(); cache != nil {
+		return cache
+	}
+	return service.NewEmbeddingCache(service.EmbeddingCacheDir(), 0)
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+
+	cachePruneCmd.Flags().IntVar(&cachePruneMaxSize, "max-size", 0, "Size to shrink the cache to, in megabytes (default: the --embedding-cache-size limit)")
+	cachePruneCmd.Flags().DurationVar(&cachePruneMaxAge, "max-age", 0, "Remove the embeddings unused for longer than this (e.g. 720h)")
+	cacheClearCmd.Flags().StringVar(&cacheClearModel, "model", "", "Only clear the embeddings of this embedding model")
+}
@@ -18,6 +18,12 @@ var (
 	customChunkSize int
 	customOverlap   int
 	customStrategy  string
+	evalEmbedModel  string
+	evalPercentile  float64
+	evalMinSize     int
+	evalFolder      string
+	evalQuestions   string
+	evalK           int
 )
 
 // chunkEvalCmd represents the command to evaluate chunking strategies
@@ -33,8 +39,25 @@ This command allows you to:
 Examples:
   rlama chunk-eval --file=document.md
   rlama chunk-eval --file=code.go --strategy=semantic --size=1000 --overlap=100
-  rlama chunk-eval --file=document.txt --compare-all --detailed`,
+  rlama chunk-eval --file=document.txt --compare-all --detailed
+  rlama chunk-eval --file=document.txt --compare-all --embedding-model=llama3
+
+With a question set, each configuration is judged by retrieval instead: the
+documents are chunked, embedded into a throwaway store and searched with each
+question, reporting how often the chunk holding the expected passage is in the
+top k (recall@k) and its mean reciprocal rank (MRR). The question set is a JSON
+array or JSON lines of {"question": ..., "expected": ..., "document": ...}:
+  rlama chunk-eval --folder=./docs --questions=qa.jsonl --embedding-model=llama3
+  rlama chunk-eval --folder=./docs --questions=qa.jsonl --embedding-model=llama3 --strategy=semantic --size=1000`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// With a question set, chunking is judged by what retrieval finds
+		if evalQuestions != "" {
+			return runRetrievalEvaluation()
+		}
+		if evalFolder != "" {
+			return fmt.Errorf("--folder needs a question set given with --questions")
+		}
+
 		// Check if file exists
 		if targetFile == "" {
 			return fmt.Errorf("please specify a file with --file")
@@ -63,8 +86,19 @@ Examples:
 			Content: string(content),
 		}
 
+		// Sentences are embedded for the embedding strategy only when a model is given
+		evalConfig := service.DefaultChunkingConfig()
+		evalConfig.BreakpointPercentile = evalPercentile
+		evalConfig.MinChunkSize = evalMinSize
+		if evalEmbedModel != "" {
+			embeddingService := service.NewEmbeddingService(GetOllamaClient())
+			evalConfig.Embedder = service.NewModelEmbedder(embeddingService, evalEmbedModel)
+		} else if customStrategy == "embedding" {
+			return fmt.Errorf("the embedding strategy requires --embedding-model")
+		}
+
 		// Create evaluator
-		chunkerService := service.NewChunkerService(service.DefaultChunkingConfig())
+		chunkerService := service.NewChunkerService(evalConfig)
 		evaluator := service.NewChunkingEvaluator(chunkerService)
 
 		fmt.Printf("Analyzing document: %s (%d characters)\n", doc.Name, len(doc.Content))
@@ -117,7 +151,7 @@ Examples:
 		}
 
 		// Otherwise, evaluate a specific configuration
-		config := service.DefaultChunkingConfig()
+		config := evalConfig
 
 		// Use custom parameters if specified
 		if customStrategy != "" {
@@ -176,5 +210,118 @@ func init() {
 	chunkEvalCmd.Flags().IntVar(&customChunkSize, "size", 0, "Custom chunk size")
 	chunkEvalCmd.Flags().IntVar(&customOverlap, "overlap", -1, "Custom overlap")
 	chunkEvalCmd.Flags().StringVar(&customStrategy, "strategy", "",
-		"Chunking strategy to use (fixed, semantic, hybrid, hierarchical)")
+		"Chunking strategy to use (fixed, semantic, hybrid, hierarchical, embedding)")
+	chunkEvalCmd.Flags().StringVar(&evalEmbedModel, "embedding-model", "", "Embedding model used to embed sentences and chunks, enables the embedding strategy")
+	chunkEvalCmd.Flags().Float64Var(&evalPercentile, "percentile", service.DefaultBreakpointPercentile, "Embedding strategy: percentile of sentence similarities below which a chunk ends")
+	chunkEvalCmd.Flags().IntVar(&evalMinSize, "min-size", 0, "Embedding strategy: minimum chunk size before a topic shift can end it (default: a quarter of the size)")
+	chunkEvalCmd.Flags().StringVar(&evalFolder, "folder", "", "Folder of documents to evaluate retrieval on, with --questions")
+	chunkEvalCmd.Flags().StringVar(&evalQuestions, "questions", "", "Question set (JSON or JSON lines) scoring configurations by recall@k and MRR")
+	chunkEvalCmd.Flags().IntVar(&evalK, "k", service.DefaultRetrievalK, "Chunks retrieved per question for recall@k")
+}
+
+// runRetrievalEvaluation scores chunking configurations by the retrieval of
+// the passages answering a question set
+func runRetrievalEvaluation() error {
+	if evalEmbedModel == "" {
+		return fmt.Errorf("retrieval evaluation requires --embedding-model")
+	}
+	questions, err := service.LoadRetrievalQuestions(evalQuestions)
+	if err != nil {
+		return err
+	}
+
+	loader := service.NewDocumentLoader()
+	var docs []*domain.Document
+	switch {
+	case evalFolder != "":
+		docs, err = loader.LoadDocumentsFromFolderWithOptions(evalFolder, service.NewDocumentLoaderOptions())
+	case targetFile != "":
+		docs, err = loader.LoadDocumentsFromSources([]string{targetFile}, service.NewDocumentLoaderOptions())
+	default:
+		return fmt.Errorf("please specify the documents with --folder or --file")
+	}
+	if err != nil {
+		return err
+	}
+
+	embeddingService := service.NewEmbeddingService(GetOllamaClient())
+	evalConfig := service.DefaultChunkingConfig()
+	evalConfig.BreakpointPercentile = evalPercentile
+	evalConfig.MinChunkSize = evalMinSize
+	evalConfig.Embedder = service.NewModelEmbedder(embeddingService, evalEmbedModel)
+	evaluation := &service.RetrievalEvaluation{
+		Questions: questions,
+		Embedder:  service.NewModelEmbedder(embeddingService, evalEmbedModel),
+		Prefixes:  service.DefaultEmbeddingPrefixes(evalEmbedModel),
+		K:         evalK,
+	}
+	evaluator := service.NewChunkingEvaluator(service.NewChunkerService(evalConfig))
+
+	fmt.Printf("Evaluating retrieval of %d questions on %d documents\n", len(questions), len(docs))
+
+	// A single configuration
+	if customStrategy != "" && !compareAll {
+		config := evalConfig
+		config.ChunkingStrategy = customStrategy
+		if customChunkSize > 0 {
+			config.ChunkSize = customChunkSize
+		}
+		if customOverlap >= 0 {
+			config.ChunkOverlap = customOverlap
+		}
+
+		metrics, err := evaluator.EvaluateRetrieval(docs, config, evaluation)
+		if err != nil {
+			return err
+		}
+		if metrics.Questions == 0 {
+			return fmt.Errorf("none of the expected passages was found in the documents")
+		}
+		printUnlocatedQuestions(metrics)
+
+		fmt.Println("\n=== Retrieval Results ===")
+		fmt.Printf("Strategy: %s (size: %d, overlap: %d)\n", config.ChunkingStrategy, config.ChunkSize, config.ChunkOverlap)
+		fmt.Printf("Number of chunks: %d\n", metrics.TotalChunks)
+		fmt.Printf("Recall@%d: %.3f\n", metrics.K, metrics.RecallAtK)
+		fmt.Printf("MRR: %.3f\n", metrics.MRR)
+		return nil
+	}
+
+	startTime := time.Now()
+	results, err := evaluator.CompareRetrieval(docs, evaluation)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("none of the expected passages was found in the documents")
+	}
+	fmt.Printf("\nAnalysis completed in %.2f seconds\n", time.Since(startTime).Seconds())
+	printUnlocatedQuestions(results[0])
+
+	fmt.Printf("\n=== Top 5 strategies for these questions ===\n")
+	fmt.Printf("Rank | Strategy        | Size   | Overlap | Recall@%-2d | MRR    | Chunks\n", results[0].K)
+	fmt.Println("-----|-----------------|--------|---------|-----------|--------|-------")
+	for i := 0; i < len(results) && i < 5; i++ {
+		fmt.Printf("%4d | %-15s | %6d | %7d | %9.3f | %.4f | %6d\n",
+			i+1,
+			results[i].Strategy,
+			results[i].ChunkSize,
+			results[i].ChunkOverlap,
+			results[i].RecallAtK,
+			results[i].MRR,
+			results[i].TotalChunks)
+	}
+
+	best := results[0]
+	fmt.Printf("\nRecommended configuration for these documents:\n")
+	fmt.Printf("  --chunking-strategy=%s --chunk-size=%d --chunk-overlap=%d\n",
+		best.Strategy, best.ChunkSize, best.ChunkOverlap)
+	return nil
+}
+
+// printUnlocatedQuestions warns about the questions left out of the scores
+func printUnlocatedQuestions(metrics service.RetrievalMetrics) {
+	if metrics.Unlocated > 0 {
+		fmt.Printf("Warning: the expected passage of %d question(s) is in none of the documents, they are not scored\n", metrics.Unlocated)
+	}
 }
@@ -26,6 +26,10 @@ var (
 	crawlRerankerThreshold float64
 	crawlRerankerWeight    float64
 	crawlRerankerModel     string
+	crawlEmbeddingModel    string
+	crawlEmbeddingProfile  string
+	crawlQueryPrefix       string
+	crawlPassagePrefix     string
 )
 
 var crawlRagCmd = &cobra.Command{
@@ -110,10 +114,13 @@ You can exclude certain paths and control other crawling parameters:
 			ChunkSize:        crawlChunkSize,
 			ChunkOverlap:     crawlChunkOverlap,
 			ChunkingStrategy: crawlChunkingStrategy,
+			EmbeddingModel:   crawlEmbeddingModel,
+			EmbeddingProfile: crawlEmbeddingProfile,
 			EnableReranker:   !crawlDisableReranker,
 			RerankerWeight:   crawlRerankerWeight,
 			RerankerModel:    crawlRerankerModel,
 		}
+		loaderOptions.EmbeddingPrefixes = embeddingPrefixFlags(cmd, crawlEmbeddingModel, crawlQueryPrefix, crawlPassagePrefix)
 
 		// Create temporary directory to store crawled content
 		tempDir := createTempDirForDocuments(docPointers)
@@ -168,6 +175,10 @@ func init() {
 	crawlRagCmd.Flags().StringSliceVar(&crawlExcludePaths, "exclude-path", nil, "Paths to exclude from crawling (comma-separated)")
 	crawlRagCmd.Flags().IntVar(&crawlChunkSize, "chunk-size", 1000, "Character count per chunk (default: 1000)")
 	crawlRagCmd.Flags().IntVar(&crawlChunkOverlap, "chunk-overlap", 200, "Overlap between chunks in characters (default: 200)")
+	crawlRagCmd.Flags().StringVar(&crawlEmbeddingModel, "embedding-model", "", "Model embedding the chunks and queries, saved with the RAG (default: "+service.DefaultEmbeddingModel+")")
+	crawlRagCmd.Flags().StringVar(&crawlEmbeddingProfile, "embedding-profile", "", "API profile of an OpenAI-compatible server embedding the chunks and queries (default: Ollama)")
+	crawlRagCmd.Flags().StringVar(&crawlQueryPrefix, "query-prefix", "", "Text prepended to queries before embedding them (default: the prefix the embedding model is known to expect)")
+	crawlRagCmd.Flags().StringVar(&crawlPassagePrefix, "passage-prefix", "", "Text prepended to chunks before embedding them (default: the prefix the embedding model is known to expect)")
 	crawlRagCmd.Flags().StringVar(&crawlChunkingStrategy, "chunking-strategy", "hybrid", "Chunking strategy to use (options: \"fixed\", \"semantic\", \"hybrid\", \"hierarchical\", \"auto\"). The \"auto\" strategy will analyze each document and apply the optimal strategy automatically.")
 	crawlRagCmd.Flags().BoolVar(&crawlUseSitemap, "use-sitemap", true, "Use sitemap.xml if available for comprehensive coverage")
 	crawlRagCmd.Flags().BoolVar(&crawlSingleURL, "single-url", false, "Process only the specified URL without following links")
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/dontizi/rlama/internal/domain"
 	"github.com/dontizi/rlama/internal/service"
 )
 
@@ -52,8 +53,18 @@ Examples:
 			fmt.Printf("\nChunk ID: %s\n", chunk.ID)
 			fmt.Printf("Document: %s\n", chunk.DocumentID)
 			fmt.Printf("Position: %d/%d\n", chunk.ChunkNumber+1, chunk.TotalChunks)
+			if chunk.TokenCount > 0 {
+				fmt.Printf("Tokens: %d\n", chunk.TokenCount)
+			}
+			if symbol := chunk.Metadata[domain.ChunkSymbol]; symbol != "" {
+				fmt.Printf("Symbol: %s %s (lines %s-%s)\n", chunk.Metadata[domain.ChunkSymbolKind], symbol,
+					chunk.Metadata[domain.ChunkStartLine], chunk.Metadata[domain.ChunkEndLine])
+			}
 			
 			if showChunkContent {
+				if chunk.ContextHeader != "" {
+					fmt.Printf("Context:\n%s\n", chunk.ContextHeader)
+				}
 				fmt.Printf("Content:\n%s\n", strings.TrimSpace(chunk.Content))
 			}
 		}
@@ -12,6 +12,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var profileBaseURL string
+
 var profileCmd = &cobra.Command{
 	Use:   "profile",
 	Short: "Manage API profiles",
@@ -22,12 +24,21 @@ var profileAddCmd = &cobra.Command{
 	Use:   "add [name] [provider] [api-key]",
 	Short: "Add a new API profile",
 	Long: `Add a new API profile for a specific provider.
-Example: rlama profile add openai-work openai sk-...your-api-key...`,
-	Args: cobra.ExactArgs(3),
+Example: rlama profile add openai-work openai sk-...your-api-key...
+
+Use --base-url for a server implementing the OpenAI API, such as llama.cpp,
+vLLM or LM Studio. The API key is then optional:
+rlama profile add lmstudio openai --base-url http://localhost:1234/v1`,
+	Args: cobra.RangeArgs(2, 3),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
 		provider := args[1]
-		apiKey := args[2]
+		apiKey := ""
+		if len(args) == 3 {
+			apiKey = args[2]
+		} else if profileBaseURL == "" {
+			return fmt.Errorf("an API key is required unless --base-url is set")
+		}
 
 		// Validate the provider
 		switch provider {
@@ -47,6 +58,7 @@ Example: rlama profile add openai-work openai sk-...your-api-key...`,
 
 		// Create and save the profile
 		profile := domain.NewAPIProfile(name, provider, apiKey)
+		profile.BaseURL = profileBaseURL
 		if err := profileRepo.Save(profile); err != nil {
 			return err
 		}
@@ -77,12 +89,12 @@ var profileListCmd = &cobra.Command{
 
 		// Use tabwriter to align the display
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "NAME\tPROVIDER\tCREATED ON\tLAST USED")
+		fmt.Fprintln(w, "NAME\tPROVIDER\tBASE URL\tCREATED ON\tLAST USED")
 
 		for _, name := range profiles {
 			profile, err := profileRepo.Load(name)
 			if err != nil {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, "error", "error", "error")
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, "error", "error", "error", "error")
 				continue
 			}
 
@@ -93,9 +105,14 @@ var profileListCmd = &cobra.Command{
 				lastUsed = profile.LastUsedAt.Format("2006-01-02 15:04:05")
 			}
 
+			baseURL := profile.BaseURL
+			if baseURL == "" {
+				baseURL = "default"
+			}
+
 			// Hide the API key
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-				profile.Name, profile.Provider, createdAt, lastUsed)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				profile.Name, profile.Provider, baseURL, createdAt, lastUsed)
 		}
 		w.Flush()
 
@@ -143,4 +160,6 @@ func init() {
 	profileCmd.AddCommand(profileAddCmd)
 	profileCmd.AddCommand(profileListCmd)
 	profileCmd.AddCommand(profileDeleteCmd)
+
+	profileAddCmd.Flags().StringVar(&profileBaseURL, "base-url", "", "Base URL of an OpenAI-compatible server (e.g. http://localhost:8080/v1)")
 }
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/dontizi/rlama/internal/client"
+	"github.com/dontizi/rlama/internal/domain"
 	"github.com/dontizi/rlama/internal/service"
 	"github.com/spf13/cobra"
 )
@@ -13,24 +16,56 @@ var (
 	excludeDirs          []string
 	excludeExts          []string
 	processExts          []string
+	includePatterns      []string
+	excludePatterns      []string
+	useGitignore         bool
 	chunkSize            int
 	chunkOverlap         int
 	chunkingStrategy     string
+	ragEmbeddingModel    string
+	ragEmbeddingProfile  string
+	ragQueryPrefix       string
+	ragPassagePrefix     string
+	rowsPerChunk         int
+	chunkTokens          int
+	overlapTokens        int
 	profileName          string
 	ragDisableReranker   bool
 	ragRerankerModel     string
 	ragRerankerWeight    float64
 	ragRerankerThreshold float64
+	loadWorkers          int
+	loadFileTimeout      time.Duration
+	loadArchiveDepth     int
+	loadMaxArchiveMB     int64
+	loadDedupPolicy      string
+	loadDedupThreshold   float64
+	loadBoilerplateDocs  int
+	loadBoilerplateRatio float64
+	loadRedactMode       string
+	loadRedactDetectors  []string
+	loadRedactPatterns   []string
+	loadContextHeaders   bool
+	loadContextSummaries bool
+	loadContextModel     string
+	loadEvalQuestions    string
+	stdinName            string
+	stdinContentType     string
 	testService          interface{} // Pour les tests
 )
 
 var ragCmd = &cobra.Command{
-	Use:   "rag [model] [rag-name] [folder-path]",
+	Use:   "rag [model] [rag-name] [path...]",
 	Short: "Create a new RAG system",
 	Long: `Create a new RAG system by indexing all documents in the specified folder.
 Example: rlama rag llama3.2 rag1 ./documents
 
 The folder will be created if it doesn't exist yet.
+
+Any mix of files, folders and glob patterns can be given ("**" matches any
+number of folders), and "-" reads a document from standard input:
+  rlama rag llama3 notes ./README.md ./docs 'specs/**/*.pdf'
+  curl -s https://example.com/page.html | rlama rag llama3 web - --name page.html
 Supported formats include: .txt, .md, .html, .json, .csv, and various source code files.
 
 You can exclude directories or file types:
@@ -38,6 +73,11 @@ You can exclude directories or file types:
   rlama rag llama3 mydocs ./docs --excludeext=.log,.tmp
   rlama rag llama3 specific ./mixed --processext=.md,.py,.js
 
+Paths can also be filtered with gitignore-style patterns. A .rlamaignore file
+in any folder is always honoured, .gitignore files only with --gitignore:
+  rlama rag llama3 myrepo ./repo --gitignore --exclude='vendor/,*.min.js'
+  rlama rag llama3 apidocs ./repo --include='docs/**/*.md'
+
 Hugging Face Models:
   You can use Hugging Face GGUF models with the format:
   rlama rag hf.co/username/repository my-rag ./docs
@@ -52,11 +92,11 @@ OpenAI Models:
   Then use any OpenAI model:
   rlama rag gpt-4-turbo my-openai-rag ./docs
   rlama rag gpt-3.5-turbo my-openai-rag ./docs`,
-	Args: cobra.ExactArgs(3),
+	Args: cobra.MinimumNArgs(3),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		modelName := args[0]
 		ragName := args[1]
-		folderPath := args[2]
+		sources := args[2:]
 
 		// Get Ollama client with configured host and port
 		ollamaClient := GetOllamaClient()
@@ -112,25 +152,67 @@ OpenAI Models:
 		}
 
 		// Display a message to indicate that the process has started
-		fmt.Printf("Creating RAG '%s' with model '%s' from folder '%s'...\n",
-			ragName, modelName, folderPath)
+		fmt.Printf("Creating RAG '%s' with model '%s' from '%s'...\n",
+			ragName, modelName, strings.Join(sources, "', '"))
 
 		// Set up loader options based on flags
 		loaderOptions := service.DocumentLoaderOptions{
 			ExcludeDirs:      excludeDirs,
 			ExcludeExts:      excludeExts,
 			ProcessExts:      processExts,
+			IncludePatterns:  includePatterns,
+			ExcludePatterns:  excludePatterns,
+			UseGitignore:     useGitignore,
 			ChunkSize:        chunkSize,
 			ChunkOverlap:     chunkOverlap,
 			ChunkingStrategy: chunkingStrategy,
+			EmbeddingModel:   ragEmbeddingModel,
+			EmbeddingProfile: ragEmbeddingProfile,
+			RowsPerChunk:     rowsPerChunk,
+			ChunkTokens:      chunkTokens,
+			OverlapTokens:    overlapTokens,
 			APIProfileName:   profileName,
 			EnableReranker:   !ragDisableReranker,
 			RerankerModel:    ragRerankerModel,
 			RerankerWeight:   ragRerankerWeight,
+			Workers:          loadWorkers,
+			FileTimeout:      loadFileTimeout,
+			ArchiveDepth:     loadArchiveDepth,
+			MaxArchiveSize:   loadMaxArchiveMB << 20,
+			BoilerplateDocs:  loadBoilerplateDocs,
+			BoilerplateRatio: loadBoilerplateRatio,
+		}
+		dedup, err := service.NewDedupSettings(loadDedupPolicy, loadDedupThreshold)
+		if err != nil {
+			return err
+		}
+		loaderOptions.Dedup = dedup
+		if loadRedactMode != "" {
+			redaction, err := service.NewRedactionSettings(loadRedactMode, loadRedactDetectors, loadRedactPatterns)
+			if err != nil {
+				return err
+			}
+			loaderOptions.Redaction = redaction
+		}
+		loaderOptions.ContextualHeaders = service.NewContextualHeaderSettings(loadContextHeaders, loadContextSummaries, loadContextModel)
+		loaderOptions.EmbeddingPrefixes = embeddingPrefixFlags(cmd, ragEmbeddingModel, ragQueryPrefix, ragPassagePrefix)
+		if loadEvalQuestions != "" {
+			questions, err := service.LoadRetrievalQuestions(loadEvalQuestions)
+			if err != nil {
+				return err
+			}
+			loaderOptions.EvalQuestions = questions
 		}
 
 		ragService := service.NewRagService(ollamaClient)
-		err := ragService.CreateRagWithOptions(modelName, ragName, folderPath, loaderOptions)
+		if isSingleFolder(sources) {
+			err = ragService.CreateRagWithOptions(modelName, ragName, sources[0], loaderOptions)
+		} else {
+			loaderOptions.Stdin = os.Stdin
+			loaderOptions.StdinName = stdinName
+			loaderOptions.StdinContentType = stdinContentType
+			err = ragService.CreateRagFromSources(modelName, ragName, sources, loaderOptions)
+		}
 		if err != nil {
 			// Improve error messages related to Ollama
 			if strings.Contains(err.Error(), "connection refused") {
@@ -170,12 +252,46 @@ func init() {
 	ragCmd.Flags().StringSliceVar(&excludeDirs, "exclude-dir", []string{}, "Directories to exclude (comma-separated)")
 	ragCmd.Flags().StringSliceVar(&excludeExts, "exclude-ext", []string{}, "File extensions to exclude (comma-separated)")
 	ragCmd.Flags().StringSliceVar(&processExts, "process-ext", []string{}, "File extensions to process (others will be ignored)")
+	ragCmd.Flags().StringSliceVar(&includePatterns, "include", []string{}, "Only index files matching these glob patterns (gitignore syntax, comma-separated)")
+	ragCmd.Flags().StringSliceVar(&excludePatterns, "exclude", []string{}, "Exclude paths matching these glob patterns (gitignore syntax, comma-separated)")
+	ragCmd.Flags().BoolVar(&useGitignore, "gitignore", false, "Honour .gitignore files in addition to .rlamaignore")
 
 	// Add flags for chunking options
 	ragCmd.Flags().IntVar(&chunkSize, "chunk-size", 1000, "Character count per chunk")
 	ragCmd.Flags().IntVar(&chunkOverlap, "chunk-overlap", 200, "Overlap between chunks in characters")
-	ragCmd.Flags().StringVar(&chunkingStrategy, "chunking", "hybrid", "Chunking strategy (options: fixed, semantic, hybrid, hierarchical)")
-	ragCmd.Flags().StringVar(&chunkingStrategy, "chunking-strategy", "hybrid", "Chunking strategy (options: fixed, semantic, hybrid, hierarchical)")
+	ragCmd.Flags().StringVar(&chunkingStrategy, "chunking", "hybrid", "Chunking strategy (options: fixed, semantic, hybrid, hierarchical, embedding)")
+	ragCmd.Flags().StringVar(&ragEmbeddingModel, "embedding-model", "", "Model embedding the chunks and queries, saved with the RAG (default: "+service.DefaultEmbeddingModel+")")
+	ragCmd.Flags().StringVar(&ragEmbeddingProfile, "embedding-profile", "", "API profile of an OpenAI-compatible server embedding the chunks and queries (default: Ollama)")
+	ragCmd.Flags().StringVar(&ragQueryPrefix, "query-prefix", "", "Text prepended to queries before embedding them (default: the prefix the embedding model is known to expect)")
+	ragCmd.Flags().StringVar(&ragPassagePrefix, "passage-prefix", "", "Text prepended to chunks before embedding them (default: the prefix the embedding model is known to expect)")
+	ragCmd.Flags().StringVar(&chunkingStrategy, "chunking-strategy", "hybrid", "Chunking strategy (options: fixed, semantic, hybrid, hierarchical, embedding, auto)")
+	ragCmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Token count per chunk, measured with the built-in tokenizer (replaces --chunk-size)")
+	ragCmd.Flags().IntVar(&overlapTokens, "chunk-overlap-tokens", 0, "Overlap between chunks in tokens when --chunk-tokens is set")
+	ragCmd.Flags().IntVar(&rowsPerChunk, "rows-per-chunk", service.DefaultRowsPerChunk, "Table rows per chunk for CSV and spreadsheet files")
+
+	// Add document loading options
+	ragCmd.Flags().IntVar(&loadWorkers, "workers", 0, "Number of files extracted in parallel (0 = number of CPUs)")
+	ragCmd.Flags().DurationVar(&loadFileTimeout, "file-timeout", service.DefaultFileTimeout, "Maximum extraction time per file (e.g. 90s, 5m)")
+	ragCmd.Flags().IntVar(&loadArchiveDepth, "archive-depth", service.DefaultMaxArchiveDepth, "How deep nested zip/tar archives are opened as folders (-1 = never open archives)")
+	ragCmd.Flags().Int64Var(&loadMaxArchiveMB, "max-archive-size", service.DefaultMaxArchiveSize>>20, "Maximum megabytes extracted from each archive, nested archives included")
+	ragCmd.Flags().StringVar(&loadDedupPolicy, "duplicates", "", "What to do with near-duplicate documents, saved for later additions and watches (options: \"skip\", \"keep-newest\", \"alias\", \"off\"; default: index them all)")
+	ragCmd.Flags().Float64Var(&loadDedupThreshold, "duplicate-threshold", service.DefaultDedupThreshold, "Similarity (0-1) above which two documents are near-duplicates, used with --duplicates")
+	ragCmd.Flags().IntVar(&loadBoilerplateDocs, "boilerplate-min-docs", service.DefaultBoilerplateMinDocs, "Minimum number of documents a repeated line must appear in to be removed as boilerplate (-1 = keep boilerplate)")
+	ragCmd.Flags().Float64Var(&loadBoilerplateRatio, "boilerplate-ratio", service.DefaultBoilerplateRatio, "Minimum share of the documents (0-1) a repeated line must appear in to be removed as boilerplate")
+
+	ragCmd.Flags().StringVar(&stdinName, "name", "", "Name of the document read from standard input with \"-\" (default: stdin- and a hash of its content)")
+	ragCmd.Flags().StringVar(&stdinContentType, "content-type", "", "Content type of the document read from standard input (e.g. text/markdown, application/pdf)")
+
+	// Add personal data redaction options
+	ragCmd.Flags().StringVar(&loadRedactMode, "redact", "", "Redact personal data before indexing (options: \"mask\", \"hash\", \"drop\"); saved with the RAG")
+	ragCmd.Flags().StringSliceVar(&loadRedactDetectors, "redact-detectors", []string{}, "Built-in PII detectors to use (comma-separated, default all: "+strings.Join(service.BuiltinDetectorNames(), ", ")+")")
+	ragCmd.Flags().StringArrayVar(&loadRedactPatterns, "redact-pattern", []string{}, "Additional detector as name=regex (repeatable)")
+
+	// Add contextual chunk header options
+	ragCmd.Flags().BoolVar(&loadContextHeaders, "context-headers", false, "Prepend the document title and section breadcrumb to each chunk before embedding; saved with the RAG")
+	ragCmd.Flags().BoolVar(&loadContextSummaries, "context-summaries", false, "Also add a sentence situating each chunk in its document, written by an LLM (one call per chunk)")
+	ragCmd.Flags().StringVar(&loadContextModel, "context-model", "", "LLM writing the context summaries (defaults to the RAG model)")
+	ragCmd.Flags().StringVar(&loadEvalQuestions, "eval-questions", "", "Question set (JSON or JSON lines, see chunk-eval) the \"auto\" strategy uses to pick chunking configurations by retrieval")
 
 	// Add reranking options - now with a flag to disable it instead
 	ragCmd.Flags().BoolVar(&ragDisableReranker, "disable-reranker", false, "Disable reranking (enabled by default)")
@@ -192,6 +308,38 @@ func init() {
 	}
 }
 
+// isSingleFolder reports whether the sources are a single folder, loaded the
+// historical way: the folder is created if it doesn't exist
+func isSingleFolder(sources []string) bool {
+	if len(sources) != 1 || sources[0] == service.StdinSource || strings.ContainsAny(sources[0], "*?[") {
+		return false
+	}
+	info, err := os.Stat(sources[0])
+	return err != nil || info.IsDir()
+}
+
+// embeddingPrefixFlags returns the prefixes set with --query-prefix and
+// --passage-prefix, completed with those the embedding model is known to
+// expect; nil when neither flag is set
+func embeddingPrefixFlags(cmd *cobra.Command, embeddingModel, queryPrefix, passagePrefix string) *domain.EmbeddingPrefixes {
+	queryChanged, passageChanged := cmd.Flags().Changed("query-prefix"), cmd.Flags().Changed("passage-prefix")
+	if !queryChanged && !passageChanged {
+		return nil
+	}
+	if embeddingModel == "" {
+		embeddingModel = service.DefaultEmbeddingModel
+	}
+
+	prefixes := service.DefaultEmbeddingPrefixes(embeddingModel)
+	if queryChanged {
+		prefixes.Query = queryPrefix
+	}
+	if passageChanged {
+		prefixes.Passage = passagePrefix
+	}
+	return &prefixes
+}
+
 // NewRagCommand returns the rag command
 func NewRagCommand() *cobra.Command {
 	return ragCmd
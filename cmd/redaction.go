@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dontizi/rlama/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var redactionCmd = &cobra.Command{
+	Use:   "redaction [rag-name]",
+	Short: "Show the redaction settings and audit report of a RAG",
+	Long: `Display the personal data redaction settings of a RAG and the audit report
+listing, for each document, which detectors found values and on which lines.
+The redacted values themselves are never stored.
+Example: rlama redaction hr-docs`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ragName := args[0]
+
+		// Get Ollama client from root command
+		ollamaClient := GetOllamaClient()
+
+		// Create necessary services
+		ragService := service.NewRagService(ollamaClient)
+
+		// Load the RAG
+		rag, err := ragService.LoadRag(ragName)
+		if err != nil {
+			return err
+		}
+
+		if rag.Redaction == nil {
+			fmt.Printf("Redaction is not enabled for RAG '%s'. Use --redact with rag or add-docs to enable it.\n", ragName)
+			return nil
+		}
+
+		detectors := "all built-in"
+		if len(rag.Redaction.Detectors) > 0 {
+			detectors = strings.Join(rag.Redaction.Detectors, ", ")
+		}
+		fmt.Printf("Redaction mode: %s\n", rag.Redaction.Mode)
+		fmt.Printf("Detectors: %s\n", detectors)
+		for _, pattern := range rag.Redaction.Patterns {
+			fmt.Printf("Pattern %s: %s\n", pattern.Name, pattern.Regex)
+		}
+
+		if len(rag.RedactionAudit) == 0 {
+			fmt.Println("\nNothing has been redacted.")
+			return nil
+		}
+
+		fmt.Printf("\nAudit report (%d entries):\n\n", len(rag.RedactionAudit))
+
+		// Use tabwriter for aligned display
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DOCUMENT\tDETECTOR\tCOUNT\tACTION\tLINES\tDATE")
+		for _, rec := range rag.RedactionAudit {
+			lines := make([]string, len(rec.Lines))
+			for i, line := range rec.Lines {
+				lines[i] = fmt.Sprint(line)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", rec.DocumentPath, rec.Detector, rec.Count, rec.Action,
+				truncateString(strings.Join(lines, ","), 40), rec.RedactedAt.Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(redactionCmd)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/dontizi/rlama/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reembedModel         string
+	reembedProfile       string
+	reembedQueryPrefix   string
+	reembedPassagePrefix string
+)
+
+var reembedCmd = &cobra.Command{
+	Use:   "reembed [rag-name]",
+	Short: "Re-embed the chunks of a RAG with another embedding model",
+	Long: `Embed the stored chunks of a RAG with another embedding model, without reading
+its sources again. The RAG keeps answering with its current embeddings until
+all chunks are embedded; the new ones then replace them at once.
+Example: rlama reembed my-docs --embedding-model bge-m3
+
+Progress is checkpointed: if the command is interrupted, running it again
+with the same model resumes where it stopped.
+Use --embedding-profile to embed with an OpenAI-compatible server instead of Ollama.
+The query and passage prefixes the new model is known to expect are applied,
+unless --query-prefix or --passage-prefix set others. Re-embedding with the same
+model and other prefixes is possible.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reembedModel == "" {
+			return fmt.Errorf("choose the new embedding model with --embedding-model")
+		}
+
+		reembedService := service.NewReembedService(GetOllamaClient())
+		prefixes := embeddingPrefixFlags(cmd, reembedModel, reembedQueryPrefix, reembedPassagePrefix)
+		return reembedService.Reembed(args[0], reembedModel, reembedProfile, prefixes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reembedCmd)
+
+	reembedCmd.Flags().StringVar(&reembedModel, "embedding-model", "", "New model embedding the chunks and queries of the RAG")
+	reembedCmd.Flags().StringVar(&reembedProfile, "embedding-profile", "", "API profile of an OpenAI-compatible server embedding the chunks (default: Ollama)")
+	reembedCmd.Flags().StringVar(&reembedQueryPrefix, "query-prefix", "", "Text prepended to queries before embedding them (default: the prefix the embedding model is known to expect)")
+	reembedCmd.Flags().StringVar(&reembedPassagePrefix, "passage-prefix", "", "Text prepended to chunks before embedding them (default: the prefix the embedding model is known to expect)")
+}
@@ -28,6 +28,11 @@ var (
 	dataDir     string
 	versionFlag bool
 	numThread   int
+
+	embeddingConcurrency   int
+	embeddingCacheSize     int
+	embeddingRetries       int
+	embeddingFailureBudget float64
 )
 
 // GlobalServices holds all global service instances
@@ -70,7 +75,10 @@ Main commands:
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	// Stop the reranker model loaded by the command, if any
+	client.ShutdownRerankerWorkers()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -84,6 +92,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&ollamaPort, "port", "", "Ollama port (overrides port in OLLAMA_HOST env var)")
 	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "", "Directory for storing RLAMA data")
 	rootCmd.PersistentFlags().IntVar(&numThread, "num-thread", 0, "Number of threads for Ollama to use (0 = use Ollama default)")
+	rootCmd.PersistentFlags().IntVar(&embeddingConcurrency, "embedding-concurrency", 0, fmt.Sprintf("Number of embedding requests sent to Ollama at once (0 = %d)", client.DefaultEmbedConcurrency))
+	rootCmd.PersistentFlags().IntVar(&embeddingCacheSize, "embedding-cache-size", int(service.DefaultEmbeddingCacheMaxBytes>>20), "Size limit of the embedding cache in megabytes (0 = no cache)")
+	rootCmd.PersistentFlags().IntVar(&embeddingRetries, "embedding-retries", service.DefaultEmbeddingRetries, "Number of times a failed embedding request is sent again, with an exponential backoff")
+	rootCmd.PersistentFlags().Float64Var(&embeddingFailureBudget, "embedding-failure-budget", service.DefaultEmbeddingFailureBudget, "Share of chunks (0-1) whose embedding may fail without aborting an ingest; they are embedded again later")
 	rootCmd.Flags().BoolVar(&versionFlag, "version", false, "Display RLAMA version")
 
 	// Set default data directory if not specified
@@ -130,10 +142,15 @@ func GetOllamaClient() *client.OllamaClient {
 
 	// Create and store the client in Services
 	Services.OllamaClient = client.NewOllamaClient(ollamaHost, ollamaPort, numThread)
+	Services.OllamaClient.EmbedConcurrency = embeddingConcurrency
 	return Services.OllamaClient
 }
 
 func initServices() {
+	service.EmbeddingCacheMaxBytes = int64(embeddingCacheSize) << 20
+	service.EmbeddingRetries = embeddingRetries
+	service.EmbeddingFailureBudget = embeddingFailureBudget
+
 	// Get or create Ollama client
 	Services.OllamaClient = GetOllamaClient()
 	if err := Services.OllamaClient.CheckLLMAndModel(modelName); err != nil {
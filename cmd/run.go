@@ -23,6 +23,7 @@ var (
 	autoRetrievalAPI bool
 	useGUI           bool
 	showContext      bool
+	metadataFilters  []string
 )
 
 var runCmd = &cobra.Command{
@@ -36,11 +37,17 @@ If the --prompt or --query flag is provided with a value, the command will run n
 process the given prompt, print the answer, and then exit.
 Examples: 
   rlama run rag1 --prompt "What is RLAMA?"
-  rlama run rag1 --query "How does RAG work?"`,
+  rlama run rag1 --query "How does RAG work?"
+  rlama run rag1 --filter author=smith --filter language=fr`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ragName := args[0]
 
+		filter, err := service.ParseMetadataFilter(metadataFilters)
+		if err != nil {
+			return err
+		}
+
 		ollamaClient := GetOllamaClient()
 		if err := ollamaClient.CheckOllamaAndModel(""); err != nil {
 			return err
@@ -69,11 +76,12 @@ Examples:
 
 			if showContext {
 				embeddingService := service.NewEmbeddingService(ollamaClient)
-				queryEmbedding, errEmb := embeddingService.GenerateQueryEmbedding(questionFromFlag, rag.ModelName)
+				queryEmbedding, errEmb := embeddingService.GenerateRagQueryEmbedding(rag, questionFromFlag)
 				if errEmb != nil {
 					fmt.Printf("Error generating embedding: %s\n", errEmb)
+				} else if results, errSearch := service.SearchChunks(rag, queryEmbedding, questionFromFlag, debugContextSize(contextSize), filter); errSearch != nil {
+					fmt.Printf("Error searching chunks: %s\n", errSearch)
 				} else {
-					results := rag.HybridStore.Search(queryEmbedding, contextSize)
 					fmt.Printf("\n--- Debug: Retrieved %d chunks ---\n", len(results))
 					for i, result := range results {
 						chunk := rag.GetChunkByID(result.ID)
@@ -88,7 +96,7 @@ Examples:
 				}
 			}
 
-			answer, errQuery := ragService.Query(rag, questionFromFlag, contextSize)
+			answer, errQuery := ragService.QueryWithFilter(rag, questionFromFlag, contextSize, filter)
 			if errQuery != nil {
 				// For non-interactive, return the error to indicate failure
 				return fmt.Errorf("error querying RAG: %w", errQuery)
@@ -147,12 +155,12 @@ Examples:
 			if showContext {
 				// Call embeddingService directly through ragService to generate embedding
 				embeddingService := service.NewEmbeddingService(ollamaClient)
-				queryEmbedding, err := embeddingService.GenerateQueryEmbedding(question, rag.ModelName)
+				queryEmbedding, err := embeddingService.GenerateRagQueryEmbedding(rag, question)
 				if err != nil {
 					fmt.Printf("Error generating embedding: %s\n", err)
+				} else if results, err := service.SearchChunks(rag, queryEmbedding, question, debugContextSize(contextSize), filter); err != nil {
+					fmt.Printf("Error searching chunks: %s\n", err)
 				} else {
-					results := rag.HybridStore.Search(queryEmbedding, contextSize)
-
 					// Show detailed results
 					fmt.Printf("\n--- Debug: Retrieved %d chunks ---\n", len(results))
 					for i, result := range results {
@@ -168,7 +176,7 @@ Examples:
 				}
 			}
 
-			answer, err := ragService.Query(rag, question, contextSize)
+			answer, err := ragService.QueryWithFilter(rag, question, contextSize, filter)
 			if err != nil {
 				fmt.Printf("Error: %s\n", err)
 				continue
@@ -183,6 +191,15 @@ Examples:
 	},
 }
 
+// debugContextSize returns the number of chunks shown by --show-context, those of
+// an automatic context size included
+func debugContextSize(contextSize int) int {
+	if contextSize <= 0 {
+		return service.DefaultRerankerOptions().TopK
+	}
+	return contextSize
+}
+
 // Helper function to truncate string for preview
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -206,6 +223,7 @@ func init() {
 	runCmd.Flags().BoolVar(&autoRetrievalAPI, "auto-retrieval", false, "Use model's built-in retrieval API if available")
 	runCmd.Flags().BoolVarP(&useGUI, "gui", "g", false, "Use GUI mode")
 	runCmd.Flags().BoolVar(&showContext, "show-context", false, "Show retrieved chunks and context information")
+	runCmd.Flags().StringArrayVar(&metadataFilters, "filter", []string{}, "Only search the chunks whose metadata matches key=value, e.g. author=smith (repeatable)")
 }
 
 func checkWatchedResources(rag *domain.RagSystem, ragService service.RagService) {
@@ -158,6 +158,14 @@ This makes it easy to set up a new RAG without remembering all command options.`
 			}
 		}
 
+		// The embedding model is saved with the RAG and embeds all its chunks and queries
+		fmt.Printf("Embedding model [%s]: ", service.DefaultEmbeddingModel)
+		embeddingModel, _ := reader.ReadString('\n')
+		embeddingModel = strings.TrimSpace(embeddingModel)
+		if embeddingModel == "" {
+			embeddingModel = service.DefaultEmbeddingModel
+		}
+
 		// New Step 3: Choose between local documents or website
 		fmt.Println("\nStep 3: Choose document source")
 		fmt.Println("1. Local document folder")
@@ -311,6 +319,7 @@ This makes it easy to set up a new RAG without remembering all command options.`
 		fmt.Println("RAG configuration:")
 		fmt.Printf("- Name: %s\n", ragName)
 		fmt.Printf("- Model: %s\n", modelName)
+		fmt.Printf("- Embedding model: %s\n", embeddingModel)
 
 		if useWebCrawler {
 			fmt.Printf("- Source: Website - %s\n", websiteURL)
@@ -404,6 +413,7 @@ This makes it easy to set up a new RAG without remembering all command options.`
 				ChunkSize:        chunkSize,
 				ChunkOverlap:     overlap,
 				ChunkingStrategy: chunkingStrategy,
+				EmbeddingModel:   embeddingModel,
 				EnableReranker:   true,
 			}
 
@@ -421,6 +431,7 @@ This makes it easy to set up a new RAG without remembering all command options.`
 				ChunkSize:        chunkSize,
 				ChunkOverlap:     overlap,
 				ChunkingStrategy: chunkingStrategy,
+				EmbeddingModel:   embeddingModel,
 				EnableReranker:   true,
 			}
 
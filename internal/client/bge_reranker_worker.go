@@ -0,0 +1,298 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dontizi/rlama/internal/utils"
+)
+
+// rerankerWorkerScript loads a reranker model once, then scores the pairs of
+// each request read from stdin, one JSON object per line, answering each with
+// a JSON line on stdout. Anything the libraries print goes to stderr.
+const rerankerWorkerScript = `
+import json
+import os
+import sys
+import warnings
+
+warnings.filterwarnings("ignore")
+os.environ["TOKENIZERS_PARALLELISM"] = "false"
+
+out = sys.stdout
+sys.stdout = sys.stderr
+
+def reply(message):
+    out.write(json.dumps(message) + "\n")
+    out.flush()
+
+try:
+    from FlagEmbedding import FlagReranker
+except ImportError:
+    reply({"error": "FlagEmbedding library is not installed. Run 'rlama install-dependencies' to install it"})
+    sys.exit(1)
+
+try:
+    reranker = FlagReranker(sys.argv[1], use_fp16=sys.argv[2] == "true")
+except Exception as e:
+    reply({"error": "could not load reranker model %s: %s" % (sys.argv[1], e)})
+    sys.exit(1)
+reply({"ready": True})
+
+for line in sys.stdin:
+    if not line.strip():
+        continue
+    request = json.loads(line)
+    try:
+        scores = reranker.compute_score(request["pairs"], normalize=request["normalize"])
+        if not isinstance(scores, list):
+            scores = [scores]
+        reply({"id": request["id"], "scores": [float(score) for score in scores]})
+    except Exception as e:
+        reply({"id": request["id"], "error": str(e)})
+`
+
+// rerankerWorkerStopTimeout is how long a worker gets to exit once its stdin is
+// closed before it is killed
+const rerankerWorkerStopTimeout = 5 * time.Second
+
+// errRerankerWorkerExited is returned for the requests of a worker that exited
+var errRerankerWorkerExited = errors.New("reranker worker exited")
+
+// newRerankerWorkerCmd returns the command starting the worker of a model
+var newRerankerWorkerCmd = func(modelName string, useFP16 bool) *exec.Cmd {
+	return utils.NewPythonExecutor().Command(rerankerWorkerScript, modelName, strconv.FormatBool(useFP16))
+}
+
+// rerankerRequest is a line sent to a worker
+type rerankerRequest struct {
+	ID        int        `json:"id"`
+	Pairs     [][]string `json:"pairs"`
+	Normalize bool       `json:"normalize"`
+}
+
+// rerankerResponse is a line received from a worker
+type rerankerResponse struct {
+	ID     int       `json:"id"`
+	Ready  bool      `json:"ready,omitempty"`
+	Scores []float64 `json:"scores,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// rerankerWorker is a Python process keeping a reranker model loaded. Requests
+// from concurrent queries are written to it as they come and matched with the
+// responses by their ID.
+type rerankerWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan rerankerResponse
+
+	done chan struct{} // Closed once the process exited
+	err  error         // Why the process exited, set before done is closed
+}
+
+// startRerankerWorker starts a worker and waits until its model is loaded
+func startRerankerWorker(cmd *exec.Cmd) (*rerankerWorker, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	w := &rerankerWorker{
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tailBuffer{max: 4096},
+		pending: make(map[int]chan rerankerResponse),
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = w.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting reranker worker: %w", err)
+	}
+
+	// The first line tells whether the model could be loaded
+	lines := bufio.NewScanner(stdout)
+	lines.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var ready rerankerResponse
+	if !lines.Scan() || json.Unmarshal(lines.Bytes(), &ready) != nil || !ready.Ready {
+		stdin.Close()
+		waitErr := cmd.Wait()
+		if ready.Error != "" {
+			return nil, errors.New(ready.Error)
+		}
+		return nil, fmt.Errorf("reranker worker failed to start: %v%s", waitErr, w.stderr.suffix())
+	}
+
+	go w.readResponses(lines)
+	return w, nil
+}
+
+// readResponses hands the responses to the requests waiting for them until the
+// process exits, then fails the requests left
+func (w *rerankerWorker) readResponses(lines *bufio.Scanner) {
+	for lines.Scan() {
+		var response rerankerResponse
+		if err := json.Unmarshal(lines.Bytes(), &response); err != nil {
+			continue
+		}
+		w.mu.Lock()
+		if ch, ok := w.pending[response.ID]; ok {
+			delete(w.pending, response.ID)
+			ch <- response
+		}
+		w.mu.Unlock()
+	}
+
+	waitErr := w.cmd.Wait()
+	w.mu.Lock()
+	w.err = fmt.Errorf("%w: %v%s", errRerankerWorkerExited, waitErr, w.stderr.suffix())
+	w.pending = nil
+	w.mu.Unlock()
+	close(w.done)
+}
+
+// alive tells whether the process is still running
+func (w *rerankerWorker) alive() bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// score sends pairs to the worker and waits for their scores
+func (w *rerankerWorker) score(pairs [][]string, normalize bool) ([]float64, error) {
+	ch := make(chan rerankerResponse, 1)
+	w.mu.Lock()
+	if w.pending == nil {
+		w.mu.Unlock()
+		<-w.done
+		return nil, w.err
+	}
+	w.nextID++
+	id := w.nextID
+	w.pending[id] = ch
+	w.mu.Unlock()
+
+	line, err := json.Marshal(rerankerRequest{ID: id, Pairs: pairs, Normalize: normalize})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling input data: %w", err)
+	}
+	w.writeMu.Lock()
+	_, err = w.stdin.Write(append(line, '\n'))
+	w.writeMu.Unlock()
+	if err != nil {
+		// The process is exiting: wait for the reason
+		<-w.done
+		return nil, w.err
+	}
+
+	select {
+	case response := <-ch:
+		if response.Error != "" {
+			return nil, fmt.Errorf("reranker error: %s", response.Error)
+		}
+		if len(response.Scores) != len(pairs) {
+			return nil, fmt.Errorf("reranker returned %d scores for %d pairs", len(response.Scores), len(pairs))
+		}
+		return response.Scores, nil
+	case <-w.done:
+		return nil, w.err
+	}
+}
+
+// stop closes the stdin of the worker, which makes it exit, and kills it if it
+// doesn't in time
+func (w *rerankerWorker) stop() {
+	w.writeMu.Lock()
+	w.stdin.Close()
+	w.writeMu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(rerankerWorkerStopTimeout):
+		w.cmd.Process.Kill()
+		<-w.done
+	}
+}
+
+// rerankerWorkers are the running workers, one per model, shared by all the
+// clients of the process
+var rerankerWorkers = struct {
+	sync.Mutex
+	workers map[string]*rerankerWorker
+}{workers: make(map[string]*rerankerWorker)}
+
+// rerankerWorkerFor returns the running worker of a model, starting one if
+// there is none or the previous one exited
+func rerankerWorkerFor(modelName string, useFP16 bool) (*rerankerWorker, error) {
+	key := modelName + "|" + strconv.FormatBool(useFP16)
+
+	rerankerWorkers.Lock()
+	defer rerankerWorkers.Unlock()
+	if w, ok := rerankerWorkers.workers[key]; ok && w.alive() {
+		return w, nil
+	}
+	w, err := startRerankerWorker(newRerankerWorkerCmd(modelName, useFP16))
+	if err != nil {
+		return nil, err
+	}
+	rerankerWorkers.workers[key] = w
+	return w, nil
+}
+
+// ShutdownRerankerWorkers stops the reranker workers of the process. The CLI
+// and the API server call it before exiting.
+func ShutdownRerankerWorkers() {
+	rerankerWorkers.Lock()
+	defer rerankerWorkers.Unlock()
+	for key, w := range rerankerWorkers.workers {
+		w.stop()
+		delete(rerankerWorkers.workers, key)
+	}
+}
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	mu   sync.Mutex
+	max  int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+	}
+	return len(p), nil
+}
+
+// suffix returns the end of the output for an error message, empty if there is none
+func (b *tailBuffer) suffix() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	output := strings.TrimSpace(string(b.data))
+	if output == "" {
+		return ""
+	}
+	return ", output: " + output
+}
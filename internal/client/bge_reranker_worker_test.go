@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRerankerWorkerHelper is not a test: it stands for the Python worker when
+// the tests start their own binary with RLAMA_RERANKER_HELPER set. A pair's
+// score is the length of its passage; the query "crash" makes it exit.
+func TestRerankerWorkerHelper(t *testing.T) {
+	if os.Getenv("RLAMA_RERANKER_HELPER") == "" {
+		return
+	}
+	reply := func(response rerankerResponse) {
+		line, _ := json.Marshal(response)
+		fmt.Println(string(line))
+	}
+	reply(rerankerResponse{Ready: true})
+
+	lines := bufio.NewScanner(os.Stdin)
+	for lines.Scan() {
+		var request rerankerRequest
+		json.Unmarshal(lines.Bytes(), &request)
+		scores := make([]float64, len(request.Pairs))
+		for i, pair := range request.Pairs {
+			if pair[0] == "crash" {
+				os.Exit(3)
+			}
+			scores[i] = float64(len(pair[1]))
+		}
+		reply(rerankerResponse{ID: request.ID, Scores: scores})
+	}
+	os.Exit(0)
+}
+
+// useHelperRerankerWorker makes the workers run TestRerankerWorkerHelper and
+// returns the number of workers started
+func useHelperRerankerWorker(t *testing.T) *int32 {
+	var started int32
+	previous := newRerankerWorkerCmd
+	newRerankerWorkerCmd = func(modelName string, useFP16 bool) *exec.Cmd {
+		atomic.AddInt32(&started, 1)
+		cmd := exec.Command(os.Args[0], "-test.run=TestRerankerWorkerHelper")
+		cmd.Env = append(os.Environ(), "RLAMA_RERANKER_HELPER=1")
+		return cmd
+	}
+	t.Cleanup(func() {
+		ShutdownRerankerWorkers()
+		newRerankerWorkerCmd = previous
+	})
+	return &started
+}
+
+func TestRerankerWorkerIsSharedByConcurrentQueries(t *testing.T) {
+	started := useHelperRerankerWorker(t)
+	first, second := NewBGERerankerClient("test-reranker"), NewBGERerankerClient("test-reranker")
+	if *started != 0 {
+		t.Fatal("creating a client must not start a worker")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := first
+			if i%2 == 1 {
+				client = second
+			}
+			passage := fmt.Sprintf("passage %d", i)
+			scores, err := client.ComputeScores([][]string{{"query", passage}, {"query", "x"}}, true)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if scores[0] != float64(len(passage)) || scores[1] != 1 {
+				t.Errorf("got scores %v for %q", scores, passage)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(started); got != 1 {
+		t.Errorf("expected one worker for all the queries, %d started", got)
+	}
+}
+
+func TestRerankerWorkerIsRestartedAfterACrash(t *testing.T) {
+	started := useHelperRerankerWorker(t)
+	client := NewBGERerankerClient("test-reranker")
+
+	// The request is sent again to a new worker, which crashes as well
+	if _, err := client.ComputeScores([][]string{{"crash", "passage"}}, true); err == nil {
+		t.Fatal("expected an error from a crashing worker")
+	}
+	if got := atomic.LoadInt32(started); got != 2 {
+		t.Errorf("expected the worker to be restarted once, %d started", got)
+	}
+
+	scores, err := client.ComputeScores([][]string{{"query", "four"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores[0] != 4 {
+		t.Errorf("got scores %v", scores)
+	}
+	if got := atomic.LoadInt32(started); got != 3 {
+		t.Errorf("expected a new worker after the crash, %d started", got)
+	}
+}
+
+func TestShutdownRerankerWorkers(t *testing.T) {
+	useHelperRerankerWorker(t)
+	worker, err := rerankerWorkerFor("test-reranker", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ShutdownRerankerWorkers()
+	if worker.alive() {
+		t.Error("the worker still runs after the shutdown")
+	}
+	if worker.cmd.ProcessState == nil || !worker.cmd.ProcessState.Success() {
+		t.Errorf("the worker did not exit cleanly: %v", worker.cmd.ProcessState)
+	}
+}
@@ -1,6 +1,12 @@
 package client
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -10,3 +16,182 @@ func TestNewOllamaClient(t *testing.T) {
 		t.Error("Expected non-nil client")
 	}
 }
+
+func TestGenerateEmbeddingsBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("Expected /api/embed, got %s", r.URL.Path)
+		}
+		var req EmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		resp := EmbedResponse{}
+		for i := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(i), 1})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := &OllamaClient{BaseURL: server.URL, Client: server.Client()}
+	embeddings, err := client.GenerateEmbeddings("model", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(embeddings) != 3 || embeddings[2][0] != 2 {
+		t.Errorf("Unexpected embeddings: %v", embeddings)
+	}
+}
+
+func TestEmbedBatchSplitsFailingBatches(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req EmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Input) > 10 {
+			http.Error(w, `{"error":"out of memory"}`, http.StatusInternalServerError)
+			return
+		}
+		resp := EmbedResponse{}
+		for _, text := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(len(text))})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := &OllamaClient{BaseURL: server.URL, Client: server.Client()}
+	texts := make([]string, 100)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+	embeddings, err := client.EmbedBatch("model", texts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float32(i) {
+			t.Fatalf("Embedding %d is out of order: %v", i, embedding)
+		}
+	}
+	if size := client.embed.size(); size > 10 {
+		t.Errorf("Expected the batch size to shrink to at most 10, got %d", size)
+	}
+
+	// The smaller size is kept: no request fails anymore
+	requests = 0
+	if _, err := client.EmbedBatch("model", texts[:20]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests of 8 texts at most, got %d", requests)
+	}
+}
+
+func TestEmbedBatchFallsBackToSingleRequests(t *testing.T) {
+	paths := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths[r.URL.Path]++
+		if r.URL.Path == "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+		var req EmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Model != "model" {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: []float32{float32(len(req.Prompt))}})
+	}))
+	defer server.Close()
+
+	client := &OllamaClient{BaseURL: server.URL, Client: server.Client()}
+	for round := 0; round < 2; round++ {
+		embeddings, err := client.EmbedBatch("model", []string{"a", "bb", "ccc"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(embeddings) != 3 || embeddings[2][0] != 3 {
+			t.Errorf("Unexpected embeddings: %v", embeddings)
+		}
+	}
+	if paths["/api/embed"] != 1 || paths["/api/embeddings"] != 6 {
+		t.Errorf("Expected /api/embed to be tried once, got %v", paths)
+	}
+
+	// An unknown model is an error on older servers too
+	if _, err := client.EmbedBatch("other", []string{"a"}); err == nil {
+		t.Error("Expected an error for an unknown model")
+	}
+}
+
+func TestOpenAIEmbedBatch(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Expected /v1/embeddings, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no Authorization header without an API key, got %q", auth)
+		}
+		var req OpenAIEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		// Answer in reverse order: the index tells where each embedding goes
+		resp := OpenAIEmbeddingResponse{}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{Index: i, Embedding: []float32{float32(len(req.Input[i]))}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := &OpenAIClient{BaseURL: server.URL + "/v1", Client: server.Client()}
+	texts := make([]string, openAIEmbedBatchSize+6)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+	embeddings, err := client.EmbedBatch("nomic-embed-text", texts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float32(i) {
+			t.Fatalf("Embedding %d is out of order: %v", i, embedding)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestIsPermanentEmbedError(t *testing.T) {
+	cases := []struct {
+		err       error
+		permanent bool
+	}{
+		{&embedStatusError{StatusCode: http.StatusNotFound, Body: "model not found"}, true},
+		{&embedStatusError{StatusCode: http.StatusBadRequest, Body: "input too long"}, true},
+		{&embedStatusError{StatusCode: http.StatusTooManyRequests}, false},
+		{&embedStatusError{StatusCode: http.StatusServiceUnavailable}, false},
+		{fmt.Errorf("batch failed: %w", &embedStatusError{StatusCode: http.StatusInternalServerError}), false},
+		{errors.New("connection refused"), false},
+	}
+	for _, c := range cases {
+		if got := IsPermanentEmbedError(c.err); got != c.permanent {
+			t.Errorf("IsPermanentEmbedError(%v) = %v, want %v", c.err, got, c.permanent)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// EmbeddingProvider generates embeddings: Ollama, or any server implementing the
+// OpenAI /v1/embeddings API (OpenAI, llama.cpp, vLLM, LM Studio...)
+type EmbeddingProvider interface {
+	// EmbedBatch returns the embeddings of texts, in the same order
+	EmbedBatch(model string, texts []string) ([][]float32, error)
+}
+
+// openAIEmbedBatchSize is the number of texts sent in each /embeddings request
+const openAIEmbedBatchSize = 64
+
+// OpenAIEmbeddingRequest is the structure of the request for the /embeddings API
+type OpenAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OpenAIEmbeddingResponse is the structure of the response for the /embeddings API
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// EmbedBatch generates the embeddings of texts with the /embeddings API of the
+// client's base URL, in batches
+func (c *OpenAIClient) EmbedBatch(model string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIEmbedBatchSize {
+		end := start + openAIEmbedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch, err := c.embed(model, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// embed sends a single /embeddings request
+func (c *OpenAIClient) embed(model string, texts []string) ([][]float32, error) {
+	reqJSON, err := json.Marshal(OpenAIEmbeddingRequest{Model: model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/embeddings", c.BaseURL), bytes.NewBuffer(reqJSON))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Local servers usually need no key
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return nil, &embedStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, err
+	}
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddingResp.Data))
+	}
+
+	// The data is not guaranteed to be in the order of the input
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("unexpected embedding index %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
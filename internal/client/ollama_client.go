@@ -19,9 +19,12 @@ const (
 
 // OllamaClient is a client for the Ollama API
 type OllamaClient struct {
-	BaseURL   string
-	Client    *http.Client
-	NumThread int
+	BaseURL          string
+	Client           *http.Client
+	NumThread        int
+	EmbedConcurrency int // Embedding requests sent at once, DefaultEmbedConcurrency when 0
+
+	embed embedState
 }
 
 // EmbeddingRequest is the structure of the request for the /api/embeddings API
@@ -36,6 +39,18 @@ type EmbeddingResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
 
+// EmbedRequest is the structure of the request for the /api/embed API, which embeds several texts at once
+type EmbedRequest struct {
+	Model   string   `json:"model"`
+	Input   []string `json:"input"`
+	Options *Options `json:"options,omitempty"`
+}
+
+// EmbedResponse is the structure of the response for the /api/embed API
+type EmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
 // GenerationRequest is the structure of the request for the /api/generate API
 type GenerationRequest struct {
 	Model    string  `json:"model"`
@@ -178,6 +193,51 @@ func (c *OllamaClient) GenerateEmbedding(model, text string) ([]float32, error)
 	return embeddingResp.Embedding, nil
 }
 
+// GenerateEmbeddings generates the embeddings of several texts in a single request
+func (c *OllamaClient) GenerateEmbeddings(model string, texts []string) ([][]float32, error) {
+	reqBody := EmbedRequest{
+		Model: model,
+		Input: texts,
+	}
+
+	// Add thread configuration for embeddings if configured
+	if c.NumThread > 0 {
+		reqBody.Options = &Options{
+			NumThread: c.NumThread,
+		}
+	}
+
+	reqJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Client.Post(
+		fmt.Sprintf("%s/api/embed", c.BaseURL),
+		"application/json",
+		bytes.NewBuffer(reqJSON),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return nil, &embedStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var embedResp EmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, err
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embedResp.Embeddings))
+	}
+
+	return embedResp.Embeddings, nil
+}
+
 // GenerateCompletion generates a response for the given prompt
 func (c *OllamaClient) GenerateCompletion(model, prompt string) (string, error) {
 	options := Options{
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultEmbedBatchSize is the largest number of texts sent in one /api/embed request
+	DefaultEmbedBatchSize = 64
+
+	// DefaultEmbedConcurrency is the number of embedding requests sent to Ollama at
+	// once when EmbedConcurrency is not set
+	DefaultEmbedConcurrency = 4
+
+	// maxEmbedBatchChars bounds the size of a /api/embed request; a longer text is sent alone
+	maxEmbedBatchChars = 256 * 1024
+
+	// embedGrowAfter is the number of successful batches after which a batch
+	// size reduced by a failure is doubled again
+	embedGrowAfter = 16
+)
+
+// embedState holds what EmbedBatch learnt about the server, shared by all the
+// requests of a client
+type embedState struct {
+	mu        sync.Mutex
+	batchSize int  // Current batch size, 0 until a batch fails
+	successes int  // Batches embedded since batchSize last changed
+	legacy    bool // The server has no /api/embed endpoint
+}
+
+// size returns the number of texts to send in the next batch
+func (s *embedState) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batchSize == 0 {
+		return DefaultEmbedBatchSize
+	}
+	return s.batchSize
+}
+
+// shrink lowers the batch size after the server failed on a larger batch
+func (s *embedState) shrink(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	if s.batchSize == 0 || size < s.batchSize {
+		s.batchSize = size
+		s.successes = 0
+	}
+}
+
+// succeeded records a successful batch, growing a reduced batch size back
+func (s *embedState) succeeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batchSize == 0 || s.batchSize >= DefaultEmbedBatchSize {
+		return
+	}
+	s.successes++
+	if s.successes >= embedGrowAfter {
+		s.batchSize *= 2
+		if s.batchSize > DefaultEmbedBatchSize {
+			s.batchSize = DefaultEmbedBatchSize
+		}
+		s.successes = 0
+	}
+}
+
+// usesLegacy tells whether texts are embedded one at a time with /api/embeddings
+func (s *embedState) usesLegacy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.legacy
+}
+
+// useLegacy switches to /api/embeddings, returning false if it was already used
+func (s *embedState) useLegacy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switched := !s.legacy
+	s.legacy = true
+	return switched
+}
+
+// embedStatusError is the error of an /api/embed request the server answered
+// with an error status
+type embedStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *embedStatusError) Error() string {
+	return fmt.Sprintf("failed to generate embeddings: %s (status: %d)", e.Body, e.StatusCode)
+}
+
+// missingEndpoint tells whether the server doesn't know /api/embed, as opposed
+// to not knowing the model
+func (e *embedStatusError) missingEndpoint() bool {
+	return (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusMethodNotAllowed) &&
+		!strings.Contains(strings.ToLower(e.Body), "model")
+}
+
+// batchFailure tells whether a smaller batch may succeed where this one failed:
+// the server ran out of memory, timed out or found the input too large
+func (e *embedStatusError) batchFailure() bool {
+	return e.StatusCode >= http.StatusInternalServerError ||
+		e.StatusCode == http.StatusRequestEntityTooLarge ||
+		e.StatusCode == http.StatusBadRequest
+}
+
+// IsPermanentEmbedError tells whether sending an embedding request again is
+// pointless: the server rejected it for another reason than a timeout or a
+// rate limit. Connection errors and server errors may be transient.
+func IsPermanentEmbedError(err error) bool {
+	var statusErr *embedStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 &&
+		statusErr.StatusCode != http.StatusRequestTimeout &&
+		statusErr.StatusCode != http.StatusTooManyRequests
+}
+
+// EmbeddingConcurrency returns the number of embedding requests to send to Ollama at once
+func (c *OllamaClient) EmbeddingConcurrency() int {
+	if c.EmbedConcurrency < 1 {
+		return DefaultEmbedConcurrency
+	}
+	return c.EmbedConcurrency
+}
+
+// EmbedBatch generates the embeddings of texts, in order, with as few requests
+// as possible. Texts are sent to /api/embed in batches; a batch the server fails
+// on is split in half and the smaller size is kept for the next batches, growing
+// back after a few successes. Servers older than /api/embed get one
+// /api/embeddings request per text.
+func (c *OllamaClient) EmbedBatch(model string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); {
+		end := embedBatchEnd(texts, start, c.embed.size())
+		batch, err := c.embedSplitting(model, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+		start = end
+	}
+	return embeddings, nil
+}
+
+// embedBatchEnd returns the end of the batch starting at start: at most size
+// texts and maxEmbedBatchChars characters, but at least one text
+func embedBatchEnd(texts []string, start, size int) int {
+	end, chars := start+1, len(texts[start])
+	for end < len(texts) && end-start < size && chars+len(texts[end]) <= maxEmbedBatchChars {
+		chars += len(texts[end])
+		end++
+	}
+	return end
+}
+
+// embedSplitting embeds a batch, splitting it in half while the server fails on it
+func (c *OllamaClient) embedSplitting(model string, texts []string) ([][]float32, error) {
+	if c.embed.usesLegacy() {
+		return c.embedEach(model, texts)
+	}
+
+	embeddings, err := c.GenerateEmbeddings(model, texts)
+	if err == nil {
+		c.embed.succeeded()
+		return embeddings, nil
+	}
+
+	var statusErr *embedStatusError
+	if !errors.As(err, &statusErr) {
+		// Connection errors have nothing to do with the size of the batch
+		return nil, err
+	}
+	if statusErr.missingEndpoint() {
+		if c.embed.useLegacy() {
+			fmt.Printf("⚠️ Ollama at %s has no /api/embed endpoint, embedding one text per request. Upgrade Ollama for faster indexing.\n", c.BaseURL)
+		}
+		return c.embedEach(model, texts)
+	}
+	if len(texts) == 1 || !statusErr.batchFailure() {
+		return nil, err
+	}
+
+	half := len(texts) / 2
+	c.embed.shrink(half)
+	first, err := c.embedSplitting(model, texts[:half])
+	if err != nil {
+		return nil, err
+	}
+	second, err := c.embedSplitting(model, texts[half:])
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// embedEach embeds texts one request at a time with /api/embeddings
+func (c *OllamaClient) embedEach(model string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		embedding, err := c.GenerateEmbedding(model, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
@@ -7,11 +7,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dontizi/rlama/internal/repository"
 )
 
+// DefaultOpenAIBaseURL is the base URL of the OpenAI API
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
 // OpenAIClient is a client for the OpenAI API
 type OpenAIClient struct {
 	BaseURL string
@@ -57,7 +61,7 @@ func NewOpenAIClient() *OpenAIClient {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 
 	return &OpenAIClient{
-		BaseURL: "https://api.openai.com/v1",
+		BaseURL: DefaultOpenAIBaseURL,
 		APIKey:  apiKey,
 		Client:  &http.Client{},
 	}
@@ -72,7 +76,7 @@ func NewOpenAIClientWithProfile(profileName string) (*OpenAIClient, error) {
 	if profileName == "" {
 		apiKey := os.Getenv("OPENAI_API_KEY")
 		return &OpenAIClient{
-			BaseURL: "https://api.openai.com/v1",
+			BaseURL: DefaultOpenAIBaseURL,
 			APIKey:  apiKey,
 			Client:  &http.Client{},
 		}, nil
@@ -93,8 +97,13 @@ func NewOpenAIClientWithProfile(profileName string) (*OpenAIClient, error) {
 	profile.LastUsedAt = time.Now()
 	profileRepo.Save(profile)
 
+	baseURL := DefaultOpenAIBaseURL
+	if profile.BaseURL != "" {
+		baseURL = strings.TrimRight(profile.BaseURL, "/")
+	}
+
 	return &OpenAIClient{
-		BaseURL: "https://api.openai.com/v1",
+		BaseURL: baseURL,
 		APIKey:  profile.APIKey,
 		Client:  &http.Client{},
 	}, nil
@@ -102,7 +111,7 @@ func NewOpenAIClientWithProfile(profileName string) (*OpenAIClient, error) {
 
 // GenerateCompletion generates a response from a prompt with OpenAI
 func (c *OpenAIClient) GenerateCompletion(model, prompt string) (string, error) {
-	if c.APIKey == "" {
+	if c.APIKey == "" && c.BaseURL == DefaultOpenAIBaseURL {
 		return "", fmt.Errorf("OPENAI_API_KEY environment variable not set")
 	}
 
@@ -135,7 +144,9 @@ func (c *OpenAIClient) GenerateCompletion(model, prompt string) (string, error)
 
 	// Add necessary headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	}
 
 	// Send the request
 	resp, err := c.Client.Do(req)
@@ -167,7 +178,7 @@ func (c *OpenAIClient) GenerateCompletion(model, prompt string) (string, error)
 
 // CheckOpenAIAndModel checks if OpenAI is accessible and if the model is available
 func (c *OpenAIClient) CheckOpenAIAndModel(modelName string) error {
-	if c.APIKey == "" {
+	if c.APIKey == "" && c.BaseURL == DefaultOpenAIBaseURL {
 		return fmt.Errorf("⚠️ OPENAI_API_KEY environment variable not set.\n" +
 			"Please set your OpenAI API key before using OpenAI models.")
 	}
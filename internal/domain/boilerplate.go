@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"strings"
+	"unicode"
+)
+
+// BoilerplateLine is a line repeated across the documents of a RAG, such as a
+// page header, a legal disclaimer or a navigation menu. Lines matching it are
+// removed from documents before they are chunked.
+type BoilerplateLine struct {
+	Text        string `json:"text"`        // Normalized form used for matching (see NormalizeBoilerplateLine)
+	Example     string `json:"example"`     // The line as it first appeared
+	Documents   int    `json:"documents"`   // Number of documents containing the line when it was detected
+	Occurrences int    `json:"occurrences"` // Number of times the line was removed
+}
+
+// NormalizeBoilerplateLine lower-cases a line, collapses its whitespace and
+// replaces numbers with '#', so that "Page 3 of 12" and "Page 10 of 12" match
+func NormalizeBoilerplateLine(line string) string {
+	var b strings.Builder
+	space, digit := false, false
+	for _, r := range strings.TrimSpace(line) {
+		switch {
+		case unicode.IsSpace(r):
+			space, digit = true, false
+			continue
+		case unicode.IsDigit(r):
+			if digit {
+				continue
+			}
+			r, digit = '#', true
+		default:
+			r, digit = unicode.ToLower(r), false
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// AddBoilerplate records newly detected boilerplate lines, merging them with
+// the ones already known
+func (r *RagSystem) AddBoilerplate(lines []BoilerplateLine) {
+	known := make(map[string]int, len(r.Boilerplate))
+	for i, line := range r.Boilerplate {
+		known[line.Text] = i
+	}
+	for _, line := range lines {
+		if i, ok := known[line.Text]; ok {
+			r.Boilerplate[i].Documents += line.Documents
+			r.Boilerplate[i].Occurrences += line.Occurrences
+			continue
+		}
+		known[line.Text] = len(r.Boilerplate)
+		r.Boilerplate = append(r.Boilerplate, line)
+	}
+}
+
+// StripBoilerplate removes the known boilerplate lines from a document and
+// returns the number of lines removed
+func (r *RagSystem) StripBoilerplate(doc *Document) int {
+	if len(r.Boilerplate) == 0 {
+		return 0
+	}
+
+	index := make(map[string]int, len(r.Boilerplate))
+	for i, line := range r.Boilerplate {
+		index[line.Text] = i
+	}
+
+	lines := strings.Split(doc.Content, "\n")
+	kept := lines[:0]
+	removed := 0
+	for _, line := range lines {
+		if i, ok := index[NormalizeBoilerplateLine(line)]; ok {
+			r.Boilerplate[i].Occurrences++
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if removed > 0 {
+		doc.Content = strings.Join(kept, "\n")
+		doc.Size = int64(len(doc.Content))
+		doc.Fingerprint = SimHash(doc.Content)
+	}
+	return removed
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "testing"
+
+func TestNormalizeBoilerplateLine(t *testing.T) {
+	cases := map[string]string{
+		"  Page 3 of 12 ":             "page # of #",
+		"Copyright\t2024   ACME Inc.": "copyright # acme inc.",
+		"":                            "",
+	}
+	for line, want := range cases {
+		if got := NormalizeBoilerplateLine(line); got != want {
+			t.Errorf("NormalizeBoilerplateLine(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
@@ -5,48 +5,102 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/dontizi/rlama/pkg/vector"
 )
 
 // Document represents a document indexed in the RAG system
 type Document struct {
-	ID          string    `json:"id"`
-	Path        string    `json:"path"`
-	Name        string    `json:"name"`
-	Content     string    `json:"content"`
-	Metadata    string    `json:"metadata"`
-	Embedding   []float32 `json:"-"` // Do not serialize to JSON
-	CreatedAt   time.Time `json:"created_at"`
-	ContentType string    `json:"content_type"`
-	Size        int64     `json:"size"`
-	URL         string    `json:"url,omitempty"` // Source URL for web documents
+	ID          string           `json:"id"`
+	Path        string           `json:"path"`
+	Name        string           `json:"name"`
+	Content     string           `json:"content"`
+	Metadata    DocumentMetadata `json:"metadata,omitempty"`
+	Embedding   []float32        `json:"-"` // Do not serialize to JSON
+	CreatedAt   time.Time        `json:"created_at"`
+	ContentType string           `json:"content_type"`
+	Size        int64            `json:"size"`
+	URL         string           `json:"url,omitempty"`         // Source URL for web documents
+	Git         *GitSource       `json:"git,omitempty"`         // Source revision for documents read from a git repository
+	Fingerprint uint64           `json:"fingerprint,omitempty"` // SimHash of the content, used to find near-duplicates
+	Aliases     []string         `json:"aliases,omitempty"`     // Paths of near-duplicate copies collapsed into this document
+}
+
+// GitSource describes where a document was read from in a git repository
+type GitSource struct {
+	Repository         string    `json:"repository"`           // Absolute path of the repository root
+	Ref                string    `json:"ref"`                  // Ref as given by the user (branch, tag, commit)
+	Commit             string    `json:"commit"`               // Commit the ref resolved to
+	Path               string    `json:"path"`                 // Path of the file inside the repository
+	Author             string    `json:"author,omitempty"`     // Author of the last commit touching the file
+	LastModifiedCommit string    `json:"last_modified_commit"` // Last commit touching the file
+	LastModifiedAt     time.Time `json:"last_modified_at,omitempty"`
 }
 
 // NewDocument creates a new instance of Document
 func NewDocument(path string, content string) *Document {
-	// Clean the extracted content
-	cleanedContent := cleanExtractedText(content)
+	// Clean the extracted content. Tables keep their rows, numbers included,
+	// and source code keeps its indentation and punctuation-only lines.
+	contentType := guessContentType(path)
+	var cleanedContent string
+	if isTableContentType(contentType) {
+		cleanedContent = strings.TrimSpace(controlChars.ReplaceAllString(content, " "))
+	} else if IsCodeFile(path) {
+		cleanedContent = strings.TrimRight(codeControlChars.ReplaceAllString(content, " "), " \t\r\n")
+	} else {
+		cleanedContent = cleanExtractedText(content)
+	}
+
+	// Detect the language so the text index can use the right analyzer
+	metadata := DocumentMetadata{}
+	metadata.Set(MetaLanguage, vector.DetectLanguage(cleanedContent))
 
 	return &Document{
 		ID:          filepath.Base(path),
 		Path:        path,
 		Name:        filepath.Base(path),
 		Content:     cleanedContent,
-		Metadata:    "",
+		Metadata:    metadata,
 		Embedding:   nil,
 		CreatedAt:   time.Now(),
-		ContentType: guessContentType(path),
+		ContentType: contentType,
 		Size:        int64(len(cleanedContent)),
+		Fingerprint: SimHash(cleanedContent),
+	}
+}
+
+// controlChars matches the non-printable characters removed from extracted text
+var controlChars = regexp.MustCompile(`[\x00-\x09\x0B\x0C\x0E-\x1F\x7F]+`)
+
+// codeControlChars matches the non-printable characters removed from source code, tabs excluded
+var codeControlChars = regexp.MustCompile(`[\x00-\x08\x0B\x0C\x0E-\x1F\x7F]+`)
+
+// IsCodeFile reports whether a path has the extension of a source code file
+func IsCodeFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go", ".js", ".jsx", ".mjs", ".py", ".java", ".c", ".h", ".cpp", ".rs", ".ts", ".tsx", ".rb", ".php":
+		return true
 	}
+	return false
+}
+
+// isTableContentType reports whether documents of this type hold CSV tables
+func isTableContentType(contentType string) bool {
+	switch contentType {
+	case "text/csv", "application/vnd.ms-excel",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return true
+	}
+	return false
 }
 
 // cleanExtractedText cleans the extracted text to improve its quality
 func cleanExtractedText(text string) string {
 	// Replace non-printable characters with spaces
-	re := regexp.MustCompile(`[\x00-\x09\x0B\x0C\x0E-\x1F\x7F]+`)
-	text = re.ReplaceAllString(text, " ")
+	text = controlChars.ReplaceAllString(text, " ")
 
 	// Replace sequences of more than 2 newlines with 2 newlines
-	re = regexp.MustCompile(`\n{3,}`)
+	re := regexp.MustCompile(`\n{3,}`)
 	text = re.ReplaceAllString(text, "\n\n")
 
 	// Replace sequences of more than 2 spaces with 1 space
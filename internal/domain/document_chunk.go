@@ -7,52 +7,109 @@ import (
 
 // DocumentChunk represents a portion of a document with metadata
 type DocumentChunk struct {
-	ID          string    `json:"id"`
-	DocumentID  string    `json:"documentId"`
-	Content     string    `json:"content"`
-	StartPos    int       `json:"start_pos"`
-	EndPos      int       `json:"end_pos"`
-	ChunkIndex  int       `json:"chunk_index"`
-	Embedding   []float32 `json:"-"` // Not serialized to JSON
-	CreatedAt   time.Time `json:"created_at"`
+	ID          string            `json:"id"`
+	DocumentID  string            `json:"documentId"`
+	Content     string            `json:"content"`
+	StartPos    int               `json:"start_pos"`
+	EndPos      int               `json:"end_pos"`
+	ChunkIndex  int               `json:"chunk_index"`
+	Embedding   []float32         `json:"-"` // Not serialized to JSON
+	CreatedAt   time.Time         `json:"created_at"`
 	Metadata    map[string]string `json:"metadata"`
-	ChunkNumber int       `json:"chunkNumber"`
-	TotalChunks int       `json:"totalChunks"`
+	ChunkNumber int               `json:"chunkNumber"`
+	TotalChunks int               `json:"totalChunks"`
+	TokenCount  int               `json:"token_count,omitempty"` // Size of the content in tokens
+	// Header situating the chunk in its document, embedded and indexed with the content
+	ContextHeader string `json:"context_header,omitempty"`
 }
 
+// Metadata keys of the chunks cut along source code declarations
+const (
+	ChunkSymbol       = "symbol"        // Name of the declaration, prefixed by its container
+	ChunkSymbolKind   = "symbol_kind"   // func, method, class, type...
+	ChunkSymbolPart   = "symbol_part"   // Part of a declaration split in several chunks, "1 of 3"
+	ChunkStartLine    = "start_line"    // First line of the declaration in the file, from 1
+	ChunkEndLine      = "end_line"      // Last line of the declaration in the file
+	ChunkCodeLanguage = "code_language" // Programming language of the file
+)
+
+// Metadata keys of the chunks cut along the headings of a document
+const (
+	ChunkBreadcrumb   = "breadcrumb"    // Headings enclosing the chunk, "Install > Linux > Troubleshooting"
+	ChunkHeadingLevel = "heading_level" // Level (1-6) of the innermost of these headings
+)
+
 // NewDocumentChunk creates a new chunk from a document
 func NewDocumentChunk(doc *Document, content string, startPos, endPos, chunkIndex int) *DocumentChunk {
 	// Generate a unique ID for the chunk
 	chunkID := fmt.Sprintf("%s_chunk_%d", doc.ID, chunkIndex)
-	
+
 	// Create metadata for the chunk
 	metadata := map[string]string{
-		"document_name": doc.Name,
-		"document_path": doc.Path,
-		"content_type": doc.ContentType,
+		"document_name":  doc.Name,
+		"document_path":  doc.Path,
+		"content_type":   doc.ContentType,
 		"chunk_position": fmt.Sprintf("%d of %d", chunkIndex+1, 0), // Total will be updated later
 	}
-	
+
+	// Propagate the document metadata without overriding the chunk's own keys
+	for key, value := range doc.Metadata {
+		if _, exists := metadata[key]; !exists {
+			metadata[key] = value
+		}
+	}
+
+	// Keep the source revision of documents read from git
+	if doc.Git != nil {
+		metadata["git_repository"] = doc.Git.Repository
+		metadata["git_commit"] = doc.Git.Commit
+		metadata["git_path"] = doc.Git.Path
+		metadata["git_last_modified_commit"] = doc.Git.LastModifiedCommit
+		if doc.Git.Author != "" {
+			metadata["git_author"] = doc.Git.Author
+		}
+	}
+
 	return &DocumentChunk{
-		ID:          chunkID,
-		DocumentID:  doc.ID,
-		Content:     content,
-		StartPos:    startPos,
-		EndPos:      endPos,
-		ChunkIndex:  chunkIndex,
-		CreatedAt:   time.Now(),
-		Metadata:    metadata,
+		ID:         chunkID,
+		DocumentID: doc.ID,
+		Content:    content,
+		StartPos:   startPos,
+		EndPos:     endPos,
+		ChunkIndex: chunkIndex,
+		CreatedAt:  time.Now(),
+		Metadata:   metadata,
+	}
+}
+
+// IndexedContent returns the text embedded and indexed for text search: the
+// content preceded by the contextual header, if any
+func (c *DocumentChunk) IndexedContent() string {
+	if c.ContextHeader == "" {
+		return c.Content
 	}
+	return c.ContextHeader + "\n\n" + c.Content
 }
 
 // GetMetadataString returns a formatted string of the chunk's metadata
 func (c *DocumentChunk) GetMetadataString() string {
-	return fmt.Sprintf("Source: %s (Section %s)", 
-		c.Metadata["document_name"], 
-		c.Metadata["chunk_position"])
+	// Code chunks point to their lines, as in main.go:120-180
+	if start, end := c.Metadata[ChunkStartLine], c.Metadata[ChunkEndLine]; start != "" && end != "" {
+		location := fmt.Sprintf("%s:%s-%s", c.Metadata["document_name"], start, end)
+		if symbol := c.Metadata[ChunkSymbol]; symbol != "" {
+			return fmt.Sprintf("Source: %s (%s %s)", location, c.Metadata[ChunkSymbolKind], symbol)
+		}
+		return fmt.Sprintf("Source: %s", location)
+	}
+	// Other chunks show the headings they are under
+	source := c.Metadata["document_name"]
+	if breadcrumb := c.Metadata[ChunkBreadcrumb]; breadcrumb != "" {
+		source += " > " + breadcrumb
+	}
+	return fmt.Sprintf("Source: %s (Section %s)", source, c.Metadata["chunk_position"])
 }
 
 // UpdateTotalChunks updates the chunk position metadata with the total chunk count
 func (c *DocumentChunk) UpdateTotalChunks(total int) {
 	c.Metadata["chunk_position"] = fmt.Sprintf("%d of %d", c.ChunkIndex+1, total)
-} 
\ No newline at end of file
+}
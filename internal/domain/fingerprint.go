@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// fingerprintShingleSize is the number of consecutive words hashed together
+const fingerprintShingleSize = 3
+
+// SimHash computes a 64-bit SimHash of a text from its word shingles.
+// Texts that share most of their wording get fingerprints that differ in few
+// bits, so the Hamming distance estimates how different two documents are.
+// Returns 0 for texts without words.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	size := fingerprintShingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+
+	var weights [64]int
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+// FingerprintSimilarity returns the share of identical bits of two SimHash
+// fingerprints, from 0 (opposite) to 1 (identical)
+func FingerprintSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// EnsureFingerprint computes the fingerprint of documents saved before
+// fingerprints existed and returns it
+func (d *Document) EnsureFingerprint() uint64 {
+	if d.Fingerprint == 0 && d.Content != "" {
+		d.Fingerprint = SimHash(d.Content)
+	}
+	return d.Fingerprint
+}
+
+// ModifiedAt returns the best known modification time of the document: the
+// date it declares, the last commit touching it, its file time or its creation time
+func (d *Document) ModifiedAt() time.Time {
+	if t, ok := d.Metadata.Time(MetaModified); ok {
+		return t
+	}
+	if d.Git != nil && !d.Git.LastModifiedAt.IsZero() {
+		return d.Git.LastModifiedAt
+	}
+	if t, ok := d.Metadata.Time(MetaFileModified); ok {
+		return t
+	}
+	return d.CreatedAt
+}
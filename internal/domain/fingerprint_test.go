@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+const fingerprintSample = `RLAMA indexes local documents and answers questions about them with a local model.
+Documents are split into chunks, embedded with Ollama and stored with their vectors.
+At query time the most similar chunks are retrieved, reranked and passed to the model as context.
+The index can be updated incrementally when files change on disk or on a watched website.`
+
+func TestSimHashNearDuplicates(t *testing.T) {
+	original := SimHash(fingerprintSample)
+	withFooter := SimHash(fingerprintSample + "\nCopyright 2024 Example Corp.")
+	different := SimHash("Bake the bread for forty minutes at a high temperature, then let it cool on a rack before slicing it.")
+
+	if similarity := FingerprintSimilarity(original, withFooter); similarity < 0.9 {
+		t.Errorf("Expected a copy with a footer to be similar, got %.2f", similarity)
+	}
+	if similarity := FingerprintSimilarity(original, different); similarity >= 0.9 {
+		t.Errorf("Expected unrelated texts to differ, got %.2f", similarity)
+	}
+	if SimHash(strings.ToUpper(fingerprintSample)) != original {
+		t.Error("Expected the fingerprint to ignore case")
+	}
+	if SimHash(" \n ") != 0 {
+		t.Error("Expected no fingerprint for a text without words")
+	}
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dontizi/rlama/pkg/vector"
+)
+
+// Well-known metadata keys filled by the document loader
+const (
+	MetaTitle        = "title"
+	MetaAuthor       = "author"
+	MetaDescription  = "description"
+	MetaKeywords     = "keywords"
+	MetaLanguage     = "language"
+	MetaCreated      = "created"       // Creation date declared by the document (RFC 3339)
+	MetaModified     = "modified"      // Modification date declared by the document (RFC 3339)
+	MetaFileModified = "file_modified" // Modification time of the file itself (RFC 3339)
+)
+
+// DocumentMetadata holds the structured metadata extracted from a document:
+// front matter, HTML meta tags, office core properties and file times.
+// Values are strings; dates use RFC 3339 and lists are comma-separated.
+type DocumentMetadata map[string]string
+
+// Get returns the value of a key, or "" if it is not set
+func (m DocumentMetadata) Get(key string) string {
+	return m[key]
+}
+
+// Set stores a trimmed value, ignoring empty ones
+func (m DocumentMetadata) Set(key, value string) {
+	value = strings.TrimSpace(value)
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// SetTime stores a date in RFC 3339 format, ignoring zero times
+func (m DocumentMetadata) SetTime(key string, t time.Time) {
+	if !t.IsZero() {
+		m[key] = t.UTC().Format(time.RFC3339)
+	}
+}
+
+// Time parses a date stored with SetTime
+func (m DocumentMetadata) Time(key string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, m[key])
+	return t, err == nil
+}
+
+// Title returns the document title, if any
+func (m DocumentMetadata) Title() string {
+	return m[MetaTitle]
+}
+
+// Author returns the document author, if any
+func (m DocumentMetadata) Author() string {
+	return m[MetaAuthor]
+}
+
+// Language returns the ISO 639-1 code of the document language, if known
+func (m DocumentMetadata) Language() string {
+	return m[MetaLanguage]
+}
+
+// SetLanguage stores a declared language tag such as "fr-FR" as its ISO 639-1 code
+func (m DocumentMetadata) SetLanguage(tag string) {
+	m.Set(MetaLanguage, vector.NormalizeLanguage(tag))
+}
+
+// Keys returns the keys in alphabetical order
+func (m DocumentMetadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UnmarshalJSON accepts the empty string stored by older versions as well as an object
+func (m *DocumentMetadata) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*m = nil
+		return nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*m = values
+	return nil
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDocumentMetadataJSON(t *testing.T) {
+	// RAGs saved by older versions store an empty string
+	var doc Document
+	if err := json.Unmarshal([]byte(`{"id":"a","metadata":""}`), &doc); err != nil {
+		t.Fatalf("Failed to read legacy metadata: %v", err)
+	}
+	if len(doc.Metadata) != 0 {
+		t.Errorf("Expected no metadata, got %v", doc.Metadata)
+	}
+
+	doc.Metadata = DocumentMetadata{}
+	doc.Metadata.Set(MetaTitle, "  Release notes ")
+	doc.Metadata.Set(MetaAuthor, "")
+	doc.Metadata.SetTime(MetaCreated, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+	var decoded Document
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if decoded.Metadata.Title() != "Release notes" || decoded.Metadata.Author() != "" {
+		t.Errorf("Unexpected metadata: %v", decoded.Metadata)
+	}
+	if created, ok := decoded.Metadata.Time(MetaCreated); !ok || created.Year() != 2024 {
+		t.Errorf("Expected the creation date to round-trip, got %q", decoded.Metadata[MetaCreated])
+	}
+
+	chunk := NewDocumentChunk(&decoded, "content", 0, 7, 0)
+	if chunk.Metadata[MetaTitle] != "Release notes" {
+		t.Errorf("Expected the title in chunk metadata, got %v", chunk.Metadata)
+	}
+}
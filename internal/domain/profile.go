@@ -9,6 +9,7 @@ type APIProfile struct {
 	Name       string    `json:"name"`
 	Provider   string    `json:"provider"` // "openai", "anthropic", etc.
 	APIKey     string    `json:"api_key"`
+	BaseURL    string    `json:"base_url,omitempty"` // OpenAI-compatible server (empty = api.openai.com)
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	LastUsedAt time.Time `json:"last_used_at,omitempty"`
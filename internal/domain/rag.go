@@ -30,12 +30,75 @@ type RagSystem struct {
 	WebWatchOptions  WebWatchOptions `json:"web_watch_options,omitempty"`
 	APIProfileName   string          `json:"api_profile_name,omitempty"`  // Name of the API profile to use
 	ChunkingStrategy string          `json:"chunking_strategy,omitempty"` // Type of chunking strategy used
+	EmbeddingModel   string          `json:"embedding_model,omitempty"`   // Model embedding the chunks and queries (empty for RAGs created before it was saved)
+	EmbeddingProfile string          `json:"embedding_profile,omitempty"` // API profile of the OpenAI-compatible server embedding the chunks (empty = Ollama)
+	EmbeddingSize    int             `json:"embedding_size,omitempty"`    // Size of the chunk embeddings (0 for RAGs created before it was saved)
 	// Reranking settings
 	RerankerEnabled   bool    `json:"reranker_enabled,omitempty"`   // Whether to use reranking
 	RerankerModel     string  `json:"reranker_model,omitempty"`     // Model to use for reranking (if different from ModelName)
 	RerankerWeight    float64 `json:"reranker_weight,omitempty"`    // Weight for reranker scores vs vector scores (0-1)
 	RerankerThreshold float64 `json:"reranker_threshold,omitempty"` // Minimum score threshold for reranked results
 	RerankerTopK      int     `json:"reranker_top_k,omitempty"`     // Default: return only top 5 results after reranking
+	// Git repositories indexed with add-git, keyed by repository root
+	GitRepositories map[string]GitRepositoryState `json:"git_repositories,omitempty"`
+	// Lines repeated across documents (headers, footers, menus) removed before chunking
+	Boilerplate []BoilerplateLine `json:"boilerplate,omitempty"`
+	// Personal data redaction applied before chunking, and what it removed
+	Redaction      *RedactionSettings `json:"redaction,omitempty"`
+	RedactionAudit []RedactionRecord  `json:"redaction_audit,omitempty"`
+	// Documents dropped by the "drop" redaction mode: path to hash of their text,
+	// so that the watchers don't drop and audit them again until they change
+	DroppedDocuments map[string]string `json:"dropped_documents,omitempty"`
+	// Header situating each chunk in its document, prepended before embedding
+	ContextualHeaders *ContextualHeaderSettings `json:"contextual_headers,omitempty"`
+	// Handling of near-duplicate documents, nil when they are all indexed
+	Dedup *DedupSettings `json:"dedup,omitempty"`
+	// Documents left out as near-duplicates: path to hash of their text, so
+	// that the watchers and add-docs don't compare them again until they change
+	CollapsedDocuments map[string]string `json:"collapsed_documents,omitempty"`
+	// Prefixes of the embedding model, nil for RAGs created before they were saved
+	EmbeddingPrefixes *EmbeddingPrefixes `json:"embedding_prefixes,omitempty"`
+	// Chunks whose embedding failed, embedded again by the next add-docs or watch check
+	PendingChunks []string `json:"pending_chunks,omitempty"`
+	// Whether the chunks have been added to the in-memory text index
+	textIndexed bool
+}
+
+// GitRepositoryState records the last commit of a repository indexed in the RAG
+type GitRepositoryState struct {
+	Ref         string    `json:"ref"`
+	Commit      string    `json:"commit"`
+	IndexedAt   time.Time `json:"indexed_at"`
+	FailedPaths []string  `json:"failed_paths,omitempty"` // Files of Commit that failed to load, loaded again on the next run
+	// Files collapsed into a near-duplicate document, loaded again only when they change
+	DuplicatePaths []string `json:"duplicate_paths,omitempty"`
+}
+
+// ContextualHeaderSettings configures the header prepended to every chunk before
+// it is embedded and indexed for text search: the document title, the heading
+// breadcrumb and optionally a sentence written by an LLM situating the chunk in
+// the whole document. They are saved with the RAG so that documents added
+// later, including by the watchers, get the same headers.
+type ContextualHeaderSettings struct {
+	Summaries bool   `json:"summaries,omitempty"` // Ask an LLM for a sentence situating each chunk
+	Model     string `json:"model,omitempty"`     // LLM writing the sentences (empty = the RAG's model)
+}
+
+// DedupSettings configures how documents nearly identical to an indexed one are
+// handled. They are saved with the RAG so that add-docs, add-git and the
+// watchers collapse near-duplicates the same way.
+type DedupSettings struct {
+	Policy    string  `json:"policy"`              // skip, keep-newest or alias
+	Threshold float64 `json:"threshold,omitempty"` // Fingerprint similarity above which documents are near-duplicates
+}
+
+// EmbeddingPrefixes are prepended to the texts given to an embedding model
+// trained with instructions, which tell queries from the passages answering
+// them (e.g. "query: " and "passage: " for E5). They are saved with the RAG
+// so that chunks added later and queries are embedded the same way.
+type EmbeddingPrefixes struct {
+	Query   string `json:"query,omitempty"`   // Prepended to queries
+	Passage string `json:"passage,omitempty"` // Prepended to chunks
 }
 
 // DocumentWatchOptions stores settings for directory watching
@@ -46,6 +109,14 @@ type DocumentWatchOptions struct {
 	ChunkSize        int      `json:"chunk_size,omitempty"`
 	ChunkOverlap     int      `json:"chunk_overlap,omitempty"`
 	ChunkingStrategy string   `json:"chunking_strategy,omitempty"`
+	RowsPerChunk     int      `json:"rows_per_chunk,omitempty"`   // Table rows per chunk for CSV and spreadsheets
+	ChunkTokens      int      `json:"chunk_tokens,omitempty"`     // Chunk size in tokens, replaces ChunkSize when set
+	OverlapTokens    int      `json:"overlap_tokens,omitempty"`   // Overlap between chunks in tokens
+	IncludePatterns  []string `json:"include_patterns,omitempty"` // Glob patterns a file must match (gitignore syntax)
+	ExcludePatterns  []string `json:"exclude_patterns,omitempty"` // Additional gitignore-syntax exclusion patterns
+	UseGitignore     bool     `json:"use_gitignore,omitempty"`    // Honour .gitignore files in addition to .rlamaignore
+	ArchiveDepth     int      `json:"archive_depth,omitempty"`    // Nesting of zip/tar archives opened as folders (0 = default, negative = never)
+	MaxArchiveSize   int64    `json:"max_archive_size,omitempty"` // Bytes extracted per top-level archive (0 = default)
 }
 
 // WebWatchOptions stores settings for web watching
@@ -92,6 +163,17 @@ func (r *RagSystem) AddDocument(doc *Document) {
 	r.UpdatedAt = time.Now()
 }
 
+// EmbeddingDimensions returns the size of the embeddings of the chunks, 0 when there are none
+func (r *RagSystem) EmbeddingDimensions() int {
+	if r.EmbeddingSize > 0 {
+		return r.EmbeddingSize
+	}
+	if r.HybridStore == nil {
+		return 0
+	}
+	return r.HybridStore.Dimensions()
+}
+
 // GetDocumentByID retrieves a document by its ID
 func (r *RagSystem) GetDocumentByID(id string) *Document {
 	for _, doc := range r.Documents {
@@ -123,6 +205,27 @@ func (r *RagSystem) RemoveDocument(id string) bool {
 	// Remove from the HybridStore
 	r.HybridStore.Remove(id)
 
+	// Remove the document's chunks
+	var chunks []*DocumentChunk
+	removed := make(map[string]bool)
+	for _, chunk := range r.Chunks {
+		if chunk.DocumentID == id {
+			r.HybridStore.Remove(chunk.ID)
+			removed[chunk.ID] = true
+			continue
+		}
+		chunks = append(chunks, chunk)
+	}
+	r.Chunks = chunks
+
+	var pending []string
+	for _, chunkID := range r.PendingChunks {
+		if !removed[chunkID] {
+			pending = append(pending, chunkID)
+		}
+	}
+	r.PendingChunks = pending
+
 	r.UpdatedAt = time.Now()
 	return true
 }
@@ -132,10 +235,90 @@ func (r *RagSystem) AddChunk(chunk *DocumentChunk) {
 	r.Chunks = append(r.Chunks, chunk)
 	if chunk.Embedding != nil {
 		r.HybridStore.Add(chunk.ID, chunk.Embedding)
+		if r.EmbeddingSize == 0 {
+			r.EmbeddingSize = len(chunk.Embedding)
+		}
+	}
+	if r.textIndexed {
+		r.HybridStore.IndexText(chunkTextData(chunk))
+	}
+	r.UpdatedAt = time.Now()
+}
+
+// AddPendingChunk adds a chunk whose embedding failed. It can be found by its
+// text until EmbedPendingChunk gives it an embedding.
+func (r *RagSystem) AddPendingChunk(chunk *DocumentChunk) {
+	chunk.Embedding = nil
+	r.AddChunk(chunk)
+	r.PendingChunks = append(r.PendingChunks, chunk.ID)
+}
+
+// GetPendingChunks returns the chunks waiting for their embedding
+func (r *RagSystem) GetPendingChunks() []*DocumentChunk {
+	if len(r.PendingChunks) == 0 {
+		return nil
+	}
+	pending := make(map[string]bool, len(r.PendingChunks))
+	for _, chunkID := range r.PendingChunks {
+		pending[chunkID] = true
+	}
+	var chunks []*DocumentChunk
+	for _, chunk := range r.Chunks {
+		if pending[chunk.ID] {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// EmbedPendingChunk stores the embedding of a pending chunk, which is no longer pending
+func (r *RagSystem) EmbedPendingChunk(chunk *DocumentChunk) {
+	r.HybridStore.Add(chunk.ID, chunk.Embedding)
+	if r.EmbeddingSize == 0 {
+		r.EmbeddingSize = len(chunk.Embedding)
+	}
+	for i, chunkID := range r.PendingChunks {
+		if chunkID == chunk.ID {
+			r.PendingChunks = append(r.PendingChunks[:i], r.PendingChunks[i+1:]...)
+			break
+		}
 	}
 	r.UpdatedAt = time.Now()
 }
 
+// EnsureTextIndex adds all chunks, with their metadata, to the text index.
+// The index lives in memory, so it is built on first use after loading.
+func (r *RagSystem) EnsureTextIndex() error {
+	if r.textIndexed {
+		return nil
+	}
+
+	docs := make([]vector.DocumentData, 0, len(r.Chunks))
+	for _, chunk := range r.Chunks {
+		docs = append(docs, chunkTextData(chunk))
+	}
+	if err := r.HybridStore.IndexText(docs...); err != nil {
+		return err
+	}
+	r.textIndexed = true
+	return nil
+}
+
+// chunkTextData converts a chunk for the text index. Chunks saved before language
+// detection existed get their language detected here.
+func chunkTextData(chunk *DocumentChunk) vector.DocumentData {
+	language := chunk.Metadata[MetaLanguage]
+	if language == "" {
+		language = vector.DetectLanguage(chunk.Content)
+	}
+	return vector.DocumentData{
+		ID:       chunk.ID,
+		Content:  chunk.IndexedContent(),
+		Metadata: chunk.Metadata,
+		Language: language,
+	}
+}
+
 // GetChunkByID retrieves a chunk by its ID
 func (r *RagSystem) GetChunkByID(id string) *DocumentChunk {
 	for _, chunk := range r.Chunks {
@@ -148,5 +331,14 @@ func (r *RagSystem) GetChunkByID(id string) *DocumentChunk {
 
 // Search performs a hybrid search using the hybrid store
 func (r *RagSystem) Search(queryVector []float32, queryText string, limit int) ([]vector.HybridSearchResult, error) {
-	return r.HybridStore.HybridSearch(queryVector, queryText, limit)
+	return r.SearchFiltered(queryVector, queryText, limit, nil)
+}
+
+// SearchFiltered performs a hybrid search among the chunks whose metadata
+// matches the filter, e.g. {"author": "smith"}
+func (r *RagSystem) SearchFiltered(queryVector []float32, queryText string, limit int, filter vector.MetadataFilter) ([]vector.HybridSearchResult, error) {
+	if err := r.EnsureTextIndex(); err != nil {
+		return nil, err
+	}
+	return r.HybridStore.HybridSearchFiltered(queryVector, queryText, limit, filter)
 }
@@ -10,3 +10,17 @@ func TestNewRagSystem(t *testing.T) {
 		t.Error("RAG system not initialized correctly")
 	}
 }
+
+func TestRemoveDocumentDropsPendingChunks(t *testing.T) {
+	rag := NewRagSystem("test", "model")
+	rag.AddDocument(&Document{ID: "doc"})
+	rag.AddPendingChunk(&DocumentChunk{ID: "doc_chunk_0", DocumentID: "doc"})
+	if len(rag.GetPendingChunks()) != 1 {
+		t.Fatal("pending chunk not recorded")
+	}
+
+	rag.RemoveDocument("doc")
+	if len(rag.Chunks) != 0 || len(rag.PendingChunks) != 0 {
+		t.Errorf("chunks of the removed document remain: %v, pending %v", rag.Chunks, rag.PendingChunks)
+	}
+}
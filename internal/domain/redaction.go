@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// Redaction modes
+const (
+	RedactMask = "mask" // Replace each match with a placeholder such as [EMAIL]
+	RedactHash = "hash" // Replace each match with a salted hash, so equal values stay linkable
+	RedactDrop = "drop" // Do not index documents containing a match
+)
+
+// RedactionSettings configures the removal of personal data from the documents
+// of a RAG before they are chunked. They are saved with the RAG so that
+// documents added later, including by the watchers, are redacted the same way.
+type RedactionSettings struct {
+	Mode      string             `json:"mode"`                // mask, hash or drop
+	Detectors []string           `json:"detectors,omitempty"` // Built-in detectors to use (empty = all)
+	Patterns  []RedactionPattern `json:"patterns,omitempty"`  // User-defined detectors
+	Salt      string             `json:"salt,omitempty"`      // Salt of the hash mode
+}
+
+// RedactionPattern is a user-defined detector
+type RedactionPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+}
+
+// RedactionRecord is an entry of the redaction audit report: how many values a
+// detector found in a document, and on which lines. The values themselves are
+// never recorded.
+type RedactionRecord struct {
+	DocumentPath string    `json:"document_path"`
+	Detector     string    `json:"detector"`
+	Count        int       `json:"count"`
+	Lines        []int     `json:"lines,omitempty"` // 1-based line numbers in the extracted text
+	Action       string    `json:"action"`          // mask, hash or drop
+	RedactedAt   time.Time `json:"redacted_at"`
+}
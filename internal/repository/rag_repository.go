@@ -63,14 +63,8 @@ func (r *RagRepository) Save(rag *domain.RagSystem) error {
 	ragInfo := *rag // Copy to avoid modifying the original
 	
 	// Serialize and save the info.json file
-	infoJSON, err := json.MarshalIndent(ragInfo, "", "  ")
-	if err != nil {
-		return fmt.Errorf("unable to serialize RAG information: %w", err)
-	}
-	
-	err = os.WriteFile(r.getRagInfoPath(rag.Name), infoJSON, 0644)
-	if err != nil {
-		return fmt.Errorf("unable to save RAG information: %w", err)
+	if err := r.saveInfo(&ragInfo); err != nil {
+		return err
 	}
 	
 	// Save the Vector Store
@@ -82,6 +76,42 @@ func (r *RagRepository) Save(rag *domain.RagSystem) error {
 	return nil
 }
 
+// saveInfo writes the info.json file of a RAG, replacing the previous one at once
+func (r *RagRepository) saveInfo(rag *domain.RagSystem) error {
+	infoJSON, err := json.MarshalIndent(rag, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize RAG information: %w", err)
+	}
+
+	infoPath := r.getRagInfoPath(rag.Name)
+	if err := os.WriteFile(infoPath+".tmp", infoJSON, 0644); err != nil {
+		return fmt.Errorf("unable to save RAG information: %w", err)
+	}
+	if err := os.Rename(infoPath+".tmp", infoPath); err != nil {
+		return fmt.Errorf("unable to save RAG information: %w", err)
+	}
+	return nil
+}
+
+// ReembedPaths returns the files of an unfinished re-embedding of a RAG: the
+// vectors embedded so far and the checkpoint describing them
+func (r *RagRepository) ReembedPaths(ragName string) (vectorPath, checkpointPath string) {
+	ragPath := r.getRagPath(ragName)
+	return filepath.Join(ragPath, "vectors.reembed.json"), filepath.Join(ragPath, "reembed.json")
+}
+
+// ReplaceVectors makes a complete vector file the vectors of a RAG, then saves
+// the RAG information. The file is renamed over the current vectors, so that
+// the RAG never has partial ones; a missing file is taken as already renamed.
+func (r *RagRepository) ReplaceVectors(rag *domain.RagSystem, vectorPath string) error {
+	if _, err := os.Stat(vectorPath); err == nil {
+		if err := os.Rename(vectorPath, r.getRagVectorStorePath(rag.Name)); err != nil {
+			return fmt.Errorf("unable to replace the vectors of RAG '%s': %w", rag.Name, err)
+		}
+	}
+	return r.saveInfo(rag)
+}
+
 // Load loads a RAG system
 func (r *RagRepository) Load(ragName string) (*domain.RagSystem, error) {
 	// Check if the RAG exists
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/dontizi/rlama/internal/client"
@@ -47,17 +51,37 @@ func (s *Server) Start() error {
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 	}
-	
-	return server.ListenAndServe()
+
+	// On Ctrl-C or SIGTERM, finish the queries in progress, then stop the
+	// reranker model they share
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	shutdown := make(chan error, 1)
+	go func() {
+		<-stop
+		log.Printf("Shutting down API server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		err = <-shutdown
+	}
+	client.ShutdownRerankerWorkers()
+	return err
 }
 
 // RagQueryRequest represents the request body for RAG queries
 type RagQueryRequest struct {
-	RagName       string `json:"rag_name"`
-	Model         string `json:"model,omitempty"`
-	Prompt        string `json:"prompt"`
-	ContextSize   int    `json:"context_size,omitempty"`
-	MaxWorkers    int    `json:"max_workers,omitempty"` // Added for parallel processing
+	RagName     string            `json:"rag_name"`
+	Model       string            `json:"model,omitempty"`
+	Prompt      string            `json:"prompt"`
+	ContextSize int               `json:"context_size,omitempty"`
+	MaxWorkers  int               `json:"max_workers,omitempty"` // Added for parallel processing
+	Filter      map[string]string `json:"filter,omitempty"`      // Only search the chunks with these metadata values
 }
 
 // RagQueryResponse represents the response for RAG queries
@@ -142,7 +166,7 @@ func (s *Server) handleRagQuery(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Query the RAG system
-	response, err := s.ragService.Query(rag, req.Prompt, req.ContextSize)
+	response, err := s.ragService.QueryWithFilter(rag, req.Prompt, req.ContextSize, req.Filter)
 	
 	// Restore original model
 	rag.ModelName = originalModel
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// Archive guardrails used when DocumentLoaderOptions leaves them unset
+const (
+	DefaultMaxArchiveDepth       = 3       // Archives nested deeper than this are not opened
+	DefaultMaxArchiveSize  int64 = 1 << 30 // Bytes extracted from a top-level archive, nested ones included
+	maxArchiveEntries            = 50000   // Entries extracted from a single archive
+	maxArchiveRatio              = 100     // Extracted bytes per byte of archive before it is treated as a bomb
+	archiveRatioFloor            = 1 << 20 // The ratio is only enforced past this many extracted bytes
+)
+
+// errArchiveTooLarge is returned when an archive goes over the extraction limits
+var errArchiveTooLarge = errors.New("archive exceeds the extraction limits")
+
+// archiveExpander extracts archives into a temporary folder so their members can go
+// through the regular pipeline, and maps extracted files back to their virtual paths
+type archiveExpander struct {
+	tempDir   string
+	maxDepth  int
+	maxSize   int64
+	remaining map[string]int64  // Extraction budget left, by top-level archive
+	budgetOf  map[string]string // Extracted path -> top-level archive it comes from
+	members   map[string]string // Extracted file -> virtual path (bundle.zip!/docs/intro.md)
+	count     int
+}
+
+// newArchiveExpander creates an expander, or returns nil when archives are disabled
+func newArchiveExpander(options DocumentLoaderOptions) *archiveExpander {
+	if options.ArchiveDepth < 0 {
+		return nil
+	}
+	ae := &archiveExpander{
+		maxDepth:  options.ArchiveDepth,
+		maxSize:   options.MaxArchiveSize,
+		remaining: make(map[string]int64),
+		budgetOf:  make(map[string]string),
+		members:   make(map[string]string),
+	}
+	if ae.maxDepth == 0 {
+		ae.maxDepth = DefaultMaxArchiveDepth
+	}
+	if ae.maxSize <= 0 {
+		ae.maxSize = DefaultMaxArchiveSize
+	}
+	return ae
+}
+
+// isArchive reports whether the file name has a supported archive extension
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// canOpen reports whether the file is an archive that may be opened at this depth
+func (ae *archiveExpander) canOpen(path string, depth int) bool {
+	return ae != nil && depth < ae.maxDepth && isArchive(path)
+}
+
+// extract unpacks an archive into a new temporary folder and returns that folder
+func (ae *archiveExpander) extract(archivePath string) (string, error) {
+	if ae.tempDir == "" {
+		dir, err := os.MkdirTemp("", "rlama-archives-")
+		if err != nil {
+			return "", fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		ae.tempDir = dir
+	}
+	ae.count++
+	dest := filepath.Join(ae.tempDir, fmt.Sprintf("%d", ae.count))
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return "", err
+	}
+
+	// Nested archives share the budget of the top-level archive they come from
+	top, nested := ae.budgetOf[archivePath]
+	if !nested {
+		top = archivePath
+		ae.remaining[top] = ae.maxSize
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return "", err
+	}
+	w := &archiveWriter{
+		dest:        dest,
+		archiveSize: info.Size(),
+		remaining:   ae.remaining[top],
+	}
+
+	name := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(archivePath, w)
+	case strings.HasSuffix(name, ".tar"):
+		err = extractTarFile(archivePath, false, w)
+	default:
+		err = extractTarFile(archivePath, true, w)
+	}
+	ae.remaining[top] = w.remaining
+	if err != nil {
+		os.RemoveAll(dest)
+		return "", err
+	}
+
+	for _, file := range w.files {
+		ae.budgetOf[file] = top
+	}
+	return dest, nil
+}
+
+// addMember records the virtual path of a file extracted from an archive
+func (ae *archiveExpander) addMember(path, virtualPath string) {
+	ae.members[path] = virtualPath
+}
+
+// rewrite points documents and failures loaded from extracted files to their virtual paths
+func (ae *archiveExpander) rewrite(folderPath string, docs []*domain.Document, report *LoadReport) {
+	if ae == nil {
+		return
+	}
+	for _, doc := range docs {
+		virtualPath, ok := ae.members[doc.Path]
+		if !ok {
+			continue
+		}
+		// The base name would collide for same-named files in different folders
+		doc.Path = virtualPath
+		doc.ID = virtualPath
+		if rel, err := filepath.Rel(folderPath, virtualPath); err == nil {
+			doc.Name = rel
+		}
+	}
+	for i, failure := range report.Failures {
+		if virtualPath, ok := ae.members[failure.Path]; ok {
+			report.Failures[i].Path = virtualPath
+		}
+	}
+}
+
+// cleanup removes the extracted files
+func (ae *archiveExpander) cleanup() {
+	if ae != nil && ae.tempDir != "" {
+		os.RemoveAll(ae.tempDir)
+	}
+}
+
+// archiveWriter writes archive members under dest while enforcing the guardrails
+type archiveWriter struct {
+	dest        string
+	archiveSize int64
+	remaining   int64
+	written     int64
+	entries     int
+	files       []string
+}
+
+// safePath resolves a member name inside dest, rejecting absolute paths and ".." escapes
+func (w *archiveWriter) safePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("unsafe path in archive: %s", name)
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	return filepath.Join(w.dest, filepath.FromSlash(clean)), nil
+}
+
+// writeFile copies one regular file out of the archive, keeping its modification time
+func (w *archiveWriter) writeFile(name string, modTime time.Time, r io.Reader) error {
+	w.entries++
+	if w.entries > maxArchiveEntries {
+		return fmt.Errorf("%w: more than %d entries", errArchiveTooLarge, maxArchiveEntries)
+	}
+
+	target, err := w.safePath(name)
+	if err != nil || target == "" {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Never trust the sizes declared in headers: count what is actually written
+	n, err := io.Copy(f, io.LimitReader(r, w.remaining+1))
+	w.written += n
+	w.remaining -= n
+	if err != nil {
+		return err
+	}
+	if w.remaining < 0 {
+		return fmt.Errorf("%w: more than the allowed extracted size", errArchiveTooLarge)
+	}
+	if w.written > archiveRatioFloor && w.written > w.archiveSize*maxArchiveRatio {
+		return fmt.Errorf("%w: compression ratio above %d", errArchiveTooLarge, maxArchiveRatio)
+	}
+
+	f.Close()
+	if !modTime.IsZero() {
+		os.Chtimes(target, modTime, modTime)
+	}
+
+	w.files = append(w.files, target)
+	return nil
+}
+
+// extractZip extracts the regular files of a zip archive
+func extractZip(archivePath string, w *archiveWriter) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening zip archive: %w", err)
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		if !file.Mode().IsRegular() {
+			continue // Directories and symlinks
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+		err = w.writeFile(file.Name, file.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTarFile extracts the regular files of a tar archive, gzipped or not
+func extractTarFile(archivePath string, gzipped bool, w *archiveWriter) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("error opening gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar archive: %w", err)
+		}
+		// Links, devices and directories are skipped; directories are created on demand
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := w.writeFile(header.Name, header.ModTime, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildZip creates a zip archive in memory from name -> content
+func buildZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// buildTarGz creates a gzipped tar archive in memory from name -> content
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// TestLoadArchivesAsFolders checks virtual paths, nested archives, exclusion rules
+// inside archives and the depth limit
+func TestLoadArchivesAsFolders(t *testing.T) {
+	dir := t.TempDir()
+	inner := buildTarGz(t, map[string]string{
+		"notes/inner.txt": "Notes stored in the nested archive.",
+		"deeper.zip":      string(buildZip(t, map[string]string{"deep.txt": "Too deep to be opened."})),
+	})
+	bundle := buildZip(t, map[string]string{
+		"docs/intro.md":   "# Intro\nWelcome to the vendor documentation.",
+		"docs/skip.log":   "Excluded by the pattern.",
+		"image.bin":       "binary",
+		"nested.tar.gz":   string(inner),
+		"../../escape.md": "Must never be written outside the folder.",
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bundle.zip"), bundle, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("Plain file next to the archive."), 0644))
+
+	loader := &DocumentLoader{supportedExtensions: map[string]bool{".txt": true, ".md": true, ".log": true}}
+	options := DocumentLoaderOptions{ArchiveDepth: 2, ExcludePatterns: []string{"*.log"}, Workers: 2}
+
+	report := &LoadReport{}
+	archives := newArchiveExpander(options)
+	defer archives.cleanup()
+
+	files, err := loader.walkFolder(dir, options, report, archives)
+	require.NoError(t, err)
+	docs := loader.runLoadPipeline(dir, files, options, report)
+	archives.rewrite(dir, docs, report)
+
+	// The traversal entry makes the whole bundle fail
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, LoadStageArchive, report.Failures[0].Stage)
+	assert.Contains(t, report.Failures[0].Err.Error(), "unsafe path")
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "escape.md"))
+	assert.True(t, os.IsNotExist(err))
+	require.Len(t, docs, 1)
+	assert.Equal(t, "readme.txt", docs[0].Name)
+
+	// Without the malicious entry the bundle is opened
+	bundle = buildZip(t, map[string]string{
+		"docs/intro.md":  "# Intro\nWelcome to the vendor documentation.",
+		"other/intro.md": "# Intro\nAnother introduction with the same file name.",
+		"docs/skip.log":  "Excluded by the pattern.",
+		"image.bin":      "binary",
+		"nested.tar.gz":  string(inner),
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bundle.zip"), bundle, 0644))
+
+	report = &LoadReport{}
+	files, err = loader.walkFolder(dir, options, report, archives)
+	require.NoError(t, err)
+	docs = loader.runLoadPipeline(dir, files, options, report)
+	archives.rewrite(dir, docs, report)
+	assert.Empty(t, report.Failures)
+
+	var names []string
+	for _, doc := range docs {
+		names = append(names, doc.Name)
+	}
+	assert.ElementsMatch(t, []string{
+		"bundle.zip!/docs/intro.md",
+		"bundle.zip!/nested.tar.gz!/notes/inner.txt",
+		"bundle.zip!/other/intro.md",
+		"readme.txt",
+	}, names)
+	for _, doc := range docs {
+		if doc.Name == "bundle.zip!/docs/intro.md" {
+			assert.Equal(t, filepath.Join(dir, "bundle.zip")+"!/docs/intro.md", doc.Path)
+			assert.Equal(t, doc.Path, doc.ID)
+		}
+		if doc.Name == "bundle.zip!/other/intro.md" {
+			assert.Equal(t, filepath.Join(dir, "bundle.zip")+"!/other/intro.md", doc.ID)
+		}
+	}
+	assert.Contains(t, report.Excluded, filepath.Join(dir, "bundle.zip")+"!/docs/skip.log")
+	assert.Contains(t, report.Unsupported, filepath.Join(dir, "bundle.zip")+"!/nested.tar.gz!/deeper.zip")
+}
+
+// TestArchiveSizeLimit checks that extraction stops at the configured budget
+func TestArchiveSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "bomb.tar.gz")
+	require.NoError(t, os.WriteFile(archivePath, buildTarGz(t, map[string]string{
+		"big.txt": strings.Repeat("a", 4<<20),
+	}), 0644))
+
+	// Highly compressible content trips the ratio check
+	archives := newArchiveExpander(DocumentLoaderOptions{})
+	defer archives.cleanup()
+	_, err := archives.extract(archivePath)
+	assert.ErrorIs(t, err, errArchiveTooLarge)
+
+	// An explicit size budget is enforced too
+	archives = newArchiveExpander(DocumentLoaderOptions{MaxArchiveSize: 1024})
+	defer archives.cleanup()
+	require.NoError(t, os.WriteFile(archivePath, buildTarGz(t, map[string]string{
+		"small.txt": strings.Repeat("b", 2048),
+	}), 0644))
+	_, err = archives.extract(archivePath)
+	assert.ErrorIs(t, err, errArchiveTooLarge)
+
+	assert.Nil(t, newArchiveExpander(DocumentLoaderOptions{ArchiveDepth: -1}))
+}
+
+// TestFileWatcherKeepsArchiveSettings checks that a RAG created without opening
+// archives doesn't start opening them when its folder is watched
+func TestFileWatcherKeepsArchiveSettings(t *testing.T) {
+	rs, _ := newQueryTestService(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("Plain file next to the archive."), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bundle.zip"), buildZip(t, map[string]string{
+		"docs/intro.txt": "Welcome to the vendor documentation.",
+	}), 0644))
+
+	// As saved by rag --archive-depth=-1
+	rag := domain.NewRagSystem("archive-watch", "llama3")
+	rag.EmbeddingModel = "fake-embed"
+	rag.WatchOptions.ArchiveDepth = -1
+	require.NoError(t, rs.ragRepository.Save(rag))
+
+	require.NoError(t, rs.SetupDirectoryWatching("archive-watch", dir, 0, DocumentLoaderOptions{ChunkSize: 1000, ChunkOverlap: 200}))
+	rag, err := rs.LoadRag("archive-watch")
+	require.NoError(t, err)
+	assert.Equal(t, -1, rag.WatchOptions.ArchiveDepth)
+
+	added, err := NewFileWatcher(rs).CheckAndUpdateRag(rag)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	require.Len(t, rag.Documents, 1)
+	assert.Equal(t, "readme.txt", rag.Documents[0].Name)
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// Defaults of the boilerplate detection
+const (
+	DefaultBoilerplateMinDocs = 3   // A line must appear in at least this many documents...
+	DefaultBoilerplateRatio   = 0.2 // ...and in at least this share of the documents
+	boilerplatePageRepeats    = 5   // Lines repeated this often inside one document are page headers or footers
+	minBoilerplateLength      = 10  // Shorter lines (headings, labels) are never treated as boilerplate
+)
+
+// tabularExtensions are formats whose repeated lines are data, not boilerplate
+var tabularExtensions = map[string]bool{
+	".csv": true, ".tsv": true, ".json": true, ".xlsx": true, ".xls": true, ".yaml": true, ".yml": true,
+}
+
+// boilerplateCandidate accumulates the statistics of a normalized line
+type boilerplateCandidate struct {
+	example   string
+	documents int
+	maxRepeat int // Highest number of occurrences in a single document
+}
+
+// removeBoilerplate detects lines repeated across the RAG documents and the
+// incoming ones, records them on the RAG and strips them from the incoming
+// documents. Documents already indexed keep their chunks; lines found earlier
+// are stripped as well. A negative minDocs disables the detection.
+func removeBoilerplate(rag *domain.RagSystem, docs []*domain.Document, minDocs int, ratio float64) {
+	if minDocs < 0 {
+		return
+	}
+	if minDocs == 0 {
+		minDocs = DefaultBoilerplateMinDocs
+	}
+	if ratio <= 0 {
+		ratio = DefaultBoilerplateRatio
+	}
+
+	corpus := make([]*domain.Document, 0, len(rag.Documents)+len(docs))
+	corpus = append(corpus, rag.Documents...)
+	corpus = append(corpus, docs...)
+
+	before := len(rag.Boilerplate)
+	rag.AddBoilerplate(detectBoilerplate(corpus, minDocs, ratio))
+
+	removed := 0
+	for _, doc := range docs {
+		if boilerplateEligible(doc) {
+			removed += rag.StripBoilerplate(doc)
+		}
+	}
+
+	if removed > 0 {
+		fmt.Printf("Removed %d boilerplate line(s) (%d new repeated line(s) detected). Run 'rlama boilerplate %s' to inspect them.\n",
+			removed, len(rag.Boilerplate)-before, rag.Name)
+	}
+}
+
+// detectBoilerplate returns the lines that appear in at least minDocs documents
+// and in at least ratio of them, or that repeat on every page of a document
+func detectBoilerplate(docs []*domain.Document, minDocs int, ratio float64) []domain.BoilerplateLine {
+	candidates := make(map[string]*boilerplateCandidate)
+	eligible := 0
+	for _, doc := range docs {
+		if !boilerplateEligible(doc) {
+			continue
+		}
+		eligible++
+
+		counts := make(map[string]int)
+		for _, line := range strings.Split(doc.Content, "\n") {
+			normalized := domain.NormalizeBoilerplateLine(line)
+			if !boilerplateShaped(normalized) {
+				continue
+			}
+			counts[normalized]++
+			if counts[normalized] == 1 {
+				candidate := candidates[normalized]
+				if candidate == nil {
+					candidate = &boilerplateCandidate{example: strings.TrimSpace(line)}
+					candidates[normalized] = candidate
+				}
+				candidate.documents++
+			}
+		}
+		for normalized, count := range counts {
+			if candidate := candidates[normalized]; count > candidate.maxRepeat {
+				candidate.maxRepeat = count
+			}
+		}
+	}
+
+	minimum := int(ratio * float64(eligible))
+	if minimum < minDocs {
+		minimum = minDocs
+	}
+
+	var lines []domain.BoilerplateLine
+	for normalized, candidate := range candidates {
+		if candidate.documents >= minimum || candidate.maxRepeat >= boilerplatePageRepeats {
+			lines = append(lines, domain.BoilerplateLine{
+				Text:      normalized,
+				Example:   candidate.example,
+				Documents: candidate.documents,
+			})
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Documents != lines[j].Documents {
+			return lines[i].Documents > lines[j].Documents
+		}
+		return lines[i].Text < lines[j].Text
+	})
+	return lines
+}
+
+// boilerplateEligible reports whether repeated lines of a document can be boilerplate.
+// Code and tabular data legitimately repeat lines.
+func boilerplateEligible(doc *domain.Document) bool {
+	ext := strings.ToLower(filepath.Ext(doc.Path))
+	return !domain.IsCodeFile(doc.Path) && !tabularExtensions[ext]
+}
+
+// boilerplateShaped reports whether a normalized line looks like prose rather
+// than a heading, a separator or a row of numbers
+func boilerplateShaped(line string) bool {
+	if len(line) < minBoilerplateLength || strings.HasPrefix(line, "#") {
+		return false
+	}
+	words := 0
+	for _, field := range strings.Fields(line) {
+		letters := 0
+		for _, r := range field {
+			if unicode.IsLetter(r) {
+				letters++
+			}
+		}
+		if letters >= 2 {
+			words++
+		}
+	}
+	return words >= 2
+}
+
+// stripKnownBoilerplate removes the boilerplate already recorded on the RAG from
+// documents added outside of a corpus pass (watchers, git updates)
+func stripKnownBoilerplate(rag *domain.RagSystem, docs []*domain.Document) {
+	for _, doc := range docs {
+		if boilerplateEligible(doc) {
+			rag.StripBoilerplate(doc)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveBoilerplateAcrossDocuments(t *testing.T) {
+	rag := domain.NewRagSystem("test", "model")
+
+	var docs []*domain.Document
+	for i, topic := range []string{"Pricing of the starter plan.", "How refunds are handled.", "Shipping to Europe.", "Our privacy commitments."} {
+		content := "Home | Products | Contact us\n" + topic + "\nWe use cookies to improve your experience."
+		docs = append(docs, domain.NewDocument(fmt.Sprintf("page%d.html", i), content))
+	}
+	// Code repeats lines legitimately and is left alone
+	code := domain.NewDocument("main.go", "Home | Products | Contact us\nfunc main() {}")
+	docs = append(docs, code)
+
+	removeBoilerplate(rag, docs, 0, 0)
+
+	require.Len(t, rag.Boilerplate, 2)
+	assert.Equal(t, "home | products | contact us", rag.Boilerplate[0].Text)
+	assert.Equal(t, 4, rag.Boilerplate[0].Documents)
+	assert.Equal(t, 4, rag.Boilerplate[0].Occurrences)
+	assert.Equal(t, "How refunds are handled.", docs[1].Content)
+	assert.Contains(t, code.Content, "Home | Products")
+
+	// Documents added later lose the known boilerplate too
+	later := domain.NewDocument("page9.html", "We use cookies to improve your experience.\nA new article.")
+	stripKnownBoilerplate(rag, []*domain.Document{later})
+	assert.Equal(t, "A new article.", later.Content)
+}
+
+func TestDetectBoilerplatePageHeaders(t *testing.T) {
+	subjects := []string{"revenue growth", "hiring plans", "office moves", "product roadmap", "customer churn", "security audits"}
+	content := ""
+	for page, subject := range subjects {
+		content += fmt.Sprintf("ACME Corp - Confidential\nThis page covers %s.\nPage %d of 6\n", subject, page+1)
+	}
+	doc := domain.NewDocument("report.pdf", content)
+
+	lines := detectBoilerplate([]*domain.Document{doc}, DefaultBoilerplateMinDocs, DefaultBoilerplateRatio)
+
+	var texts []string
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	assert.ElementsMatch(t, []string{"acme corp - confidential", "page # of #"}, texts)
+}
@@ -32,8 +32,8 @@ type ChunkingEvaluationMetrics struct {
 
 	// Strategy info
 	Strategy     string // Strategy used
-	ChunkSize    int    // Configured chunk size
-	ChunkOverlap int    // Configured overlap
+	ChunkSize    int    // Configured chunk size, in tokens when the configuration has a token budget
+	ChunkOverlap int    // Configured overlap, in the unit of the chunk size
 }
 
 // ChunkingEvaluator evaluates different chunking strategies
@@ -67,10 +67,9 @@ func (ce *ChunkingEvaluator) EvaluateChunkingStrategy(doc *domain.Document, conf
 	metrics := ChunkingEvaluationMetrics{
 		TotalChunks:      len(chunks),
 		Strategy:         config.ChunkingStrategy,
-		ChunkSize:        config.ChunkSize,
-		ChunkOverlap:     config.ChunkOverlap,
 		ProcessingTimeMs: time.Since(startTime).Milliseconds(),
 	}
+	metrics.ChunkSize, metrics.ChunkOverlap = config.sizes()
 
 	if len(chunks) == 0 {
 		return metrics
@@ -249,9 +248,14 @@ func (ce *ChunkingEvaluator) calculateSemanticCoherenceScore(metrics ChunkingEva
 func (ce *ChunkingEvaluator) CompareChunkingStrategies(doc *domain.Document) []ChunkingEvaluationMetrics {
 	var results []ChunkingEvaluationMetrics
 
-	// Define the different strategies and configurations to test
+	// Define the different strategies and configurations to test; the
+	// embedding strategy is compared when sentences can be embedded
 	strategies := []string{"fixed", "semantic", "hybrid", "hierarchical"}
-	chunkSizes := []int{500, 1000, 1500, 2000}
+	embedder := newMemoEmbedder(ce.chunkerService.config.Embedder)
+	if embedder != nil {
+		strategies = append(strategies, "embedding")
+	}
+	chunkSizes := ce.candidateSizes()
 	overlapRates := []float64{0.05, 0.1, 0.2} // as percentage of chunk size
 
 	fmt.Printf("Evaluating %d chunking strategies for document '%s' (%d characters)...\n",
@@ -260,15 +264,9 @@ func (ce *ChunkingEvaluator) CompareChunkingStrategies(doc *domain.Document) []C
 	for _, strategy := range strategies {
 		for _, chunkSize := range chunkSizes {
 			for _, overlapRate := range overlapRates {
-				// Calculate overlap in characters
+				// Calculate overlap in the unit of the chunk size
 				overlap := int(float64(chunkSize) * overlapRate)
-
-				config := ChunkingConfig{
-					ChunkSize:        chunkSize,
-					ChunkOverlap:     overlap,
-					ChunkingStrategy: strategy,
-					IncludeMetadata:  true,
-				}
+				config := ce.candidateConfig(strategy, chunkSize, overlap, embedder)
 
 				// Evaluate this configuration
 				metrics := ce.EvaluateChunkingStrategy(doc, config)
@@ -293,24 +291,66 @@ func (ce *ChunkingEvaluator) CompareChunkingStrategies(doc *domain.Document) []C
 	return results
 }
 
-// GetOptimalChunkingConfig returns the optimal chunking configuration for the given document
+// candidateSizes returns the chunk sizes the evaluations compare, in the unit
+// the evaluated chunker measures chunks in: tokens when it has a token budget,
+// characters otherwise
+func (ce *ChunkingEvaluator) candidateSizes() []int {
+	if ce.chunkerService.inTokens() {
+		return []int{128, 256, 384, 512}
+	}
+	return []int{500, 1000, 1500, 2000}
+}
+
+// candidateConfig returns the configuration evaluated for a strategy, a chunk
+// size and an overlap given in the unit of candidateSizes
+func (ce *ChunkingEvaluator) candidateConfig(strategy string, size, overlap int, embedder TextEmbedder) ChunkingConfig {
+	config := ChunkingConfig{
+		ChunkSize:            size,
+		ChunkOverlap:         overlap,
+		ChunkingStrategy:     strategy,
+		IncludeMetadata:      true,
+		Embedder:             embedder,
+		BreakpointPercentile: ce.chunkerService.config.BreakpointPercentile,
+		MinChunkSize:         ce.chunkerService.config.MinChunkSize,
+	}
+	if ce.chunkerService.inTokens() {
+		config.ChunkSize, config.ChunkOverlap = 0, 0
+		config.ChunkTokens, config.OverlapTokens = size, overlap
+	}
+	return config
+}
+
+// GetOptimalChunkingConfig returns the optimal chunking configuration for the given document.
+// When the chunker has a question set with passages of the document, the
+// configuration retrieving them best is chosen; otherwise the structural metrics decide.
+// The choice is made for each document on its own, so the documents of a folder
+// can be chunked with different configurations. With a token budget the
+// candidates are token sizes and the configuration returned has a token budget.
 func (ce *ChunkingEvaluator) GetOptimalChunkingConfig(doc *domain.Document) ChunkingConfig {
+	if retrieval := ce.chunkerService.config.Retrieval; retrieval != nil {
+		results, err := ce.CompareRetrieval([]*domain.Document{doc}, retrieval)
+		if err != nil {
+			fmt.Printf("Warning: retrieval evaluation of '%s' failed, using structural metrics: %v\n", doc.Name, err)
+		} else if len(results) > 0 {
+			best := results[0]
+			return ce.candidateConfig(best.Strategy, best.ChunkSize, best.ChunkOverlap, nil)
+		}
+	}
+
 	results := ce.CompareChunkingStrategies(doc)
 
 	if len(results) == 0 {
 		// If no results, return default configuration
-		return DefaultChunkingConfig()
+		config := DefaultChunkingConfig()
+		config.ChunkTokens = ce.chunkerService.config.ChunkTokens
+		config.OverlapTokens = ce.chunkerService.config.OverlapTokens
+		return config
 	}
 
 	// Take the best configuration (first after sorting)
 	bestResult := results[0]
 
-	return ChunkingConfig{
-		ChunkSize:        bestResult.ChunkSize,
-		ChunkOverlap:     bestResult.ChunkOverlap,
-		ChunkingStrategy: bestResult.Strategy,
-		IncludeMetadata:  true,
-	}
+	return ce.candidateConfig(bestResult.Strategy, bestResult.ChunkSize, bestResult.ChunkOverlap, nil)
 }
 
 // PrintEvaluationResults displays evaluation results in a readable format
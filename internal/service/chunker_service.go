@@ -2,11 +2,16 @@ package service
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
+	"github.com/dontizi/rlama/internal/config"
 	"github.com/dontizi/rlama/internal/domain"
+	"github.com/dontizi/rlama/pkg/tokenizer"
 )
 
 // ChunkingConfig holds configuration for the document chunking process
@@ -14,7 +19,19 @@ type ChunkingConfig struct {
 	ChunkSize        int    // Target size of each chunk in characters
 	ChunkOverlap     int    // Number of characters to overlap between chunks
 	IncludeMetadata  bool   // Whether to include metadata in chunk content
-	ChunkingStrategy string // Strategy to use: "fixed", "semantic", "hybrid", "hierarchical"
+	ChunkingStrategy string // Strategy to use: "fixed", "semantic", "hybrid", "hierarchical", "embedding"
+	RowsPerChunk     int    // Maximum table rows per chunk for CSV and spreadsheets (0 = DefaultRowsPerChunk)
+	ChunkTokens      int    // Target size of each chunk in tokens, replaces ChunkSize when set
+	OverlapTokens    int    // Number of tokens to overlap between chunks when ChunkTokens is set
+
+	// Embedding strategy settings
+	Embedder             TextEmbedder // Embeds sentences to find topic shifts (nil = semantic chunking instead)
+	BreakpointPercentile float64      // Percentile of sentence similarities below which a chunk ends (0 = DefaultBreakpointPercentile)
+	MinChunkSize         int          // Size a chunk must reach before it can end at a topic shift (0 = a quarter of the chunk size)
+
+	// Retrieval is a question set the "auto" strategy ranks configurations
+	// with, by recall and MRR (nil = structural metrics only)
+	Retrieval *RetrievalEvaluation
 }
 
 // DefaultChunkingConfig returns a default configuration for chunking
@@ -27,29 +44,76 @@ func DefaultChunkingConfig() ChunkingConfig {
 	}
 }
 
+// tokenizerFile is a tiktoken vocabulary in the data directory, such as
+// cl100k_base.tiktoken, used instead of the embedded one when present
+const tokenizerFile = "tokenizer.tiktoken"
+
+var (
+	tokenizerOnce  sync.Once
+	chunkTokenizer *tokenizer.Tokenizer
+)
+
 // ChunkerService handles splitting documents into manageable chunks
 type ChunkerService struct {
-	config ChunkingConfig
+	config    ChunkingConfig
+	tokenizer *tokenizer.Tokenizer
 }
 
 // NewChunkerService creates a new chunker service with the specified config
 func NewChunkerService(config ChunkingConfig) *ChunkerService {
 	return &ChunkerService{
-		config: config,
+		config:    config,
+		tokenizer: loadChunkTokenizer(),
 	}
 }
 
+// loadChunkTokenizer returns the tokenizer measuring chunks: the vocabulary
+// file of the data directory if there is one, the embedded one otherwise
+func loadChunkTokenizer() *tokenizer.Tokenizer {
+	tokenizerOnce.Do(func() {
+		path := filepath.Join(config.GetDataDir(), tokenizerFile)
+		if _, err := os.Stat(path); err == nil {
+			t, err := tokenizer.LoadFile(path)
+			if err == nil {
+				chunkTokenizer = t
+				return
+			}
+			fmt.Printf("Warning: using the built-in tokenizer: %v\n", err)
+		}
+		chunkTokenizer = tokenizer.Default()
+	})
+	return chunkTokenizer
+}
+
 // ChunkDocument splits a document into smaller chunks with metadata
 // based on the selected chunking strategy
 func (cs *ChunkerService) ChunkDocument(doc *domain.Document) []*domain.DocumentChunk {
 	content := doc.Content
 	chunkSize := cs.config.ChunkSize
 	overlap := cs.config.ChunkOverlap
+	if cs.inTokens() {
+		chunkSize = cs.config.ChunkTokens
+		overlap = cs.config.OverlapTokens
+	}
+
+	// Tables are split into groups of complete rows whatever the strategy
+	if isTableFile(doc.Path) {
+		if chunks := cs.createTableChunks(doc, chunkSize); len(chunks) > 0 {
+			fmt.Printf("Split table '%s' into %d chunks of rows\n", doc.Name, len(chunks))
+			return cs.countTokens(chunks)
+		}
+	}
+
+	// Source code is cut along its declarations when its language can be parsed
+	if chunks, ok := cs.createSyntaxChunks(doc, content, chunkSize); ok {
+		fmt.Printf("Split source file '%s' into %d declarations\n", doc.Name, len(chunks))
+		return cs.countTokens(chunks)
+	}
 
 	// For very small documents, just return a single chunk regardless of strategy
-	if len(content) <= chunkSize {
+	if cs.measure(content) <= chunkSize {
 		chunk := domain.NewDocumentChunk(doc, content, 0, len(content), 0)
-		return []*domain.DocumentChunk{chunk}
+		return cs.countTokens([]*domain.DocumentChunk{chunk})
 	}
 
 	// Apply different chunking strategies based on configuration
@@ -58,20 +122,24 @@ func (cs *ChunkerService) ChunkDocument(doc *domain.Document) []*domain.Document
 	switch cs.config.ChunkingStrategy {
 	case "auto":
 		// For auto strategy, use the evaluator to determine optimal configuration
+		// of this document, in tokens when the chunker has a token budget
 		evaluator := NewChunkingEvaluator(cs)
 		optimalConfig := evaluator.GetOptimalChunkingConfig(doc)
 
 		// Create a temporary chunker with the optimal configuration
+		optimalConfig.RowsPerChunk = cs.config.RowsPerChunk
+		optimalConfig.Embedder = cs.config.Embedder
 		tempChunker := NewChunkerService(optimalConfig)
 
 		// Use the optimal chunker to create chunks
 		chunks = tempChunker.ChunkDocument(doc)
 
 		// Store chunking strategy info in chunk metadata
+		optimalSize, optimalOverlap := optimalConfig.sizes()
 		for _, chunk := range chunks {
 			chunk.Metadata["chunking_strategy"] = optimalConfig.ChunkingStrategy
-			chunk.Metadata["chunk_size"] = fmt.Sprintf("%d", optimalConfig.ChunkSize)
-			chunk.Metadata["chunk_overlap"] = fmt.Sprintf("%d", optimalConfig.ChunkOverlap)
+			chunk.Metadata["chunk_size"] = fmt.Sprintf("%d", optimalSize)
+			chunk.Metadata["chunk_overlap"] = fmt.Sprintf("%d", optimalOverlap)
 		}
 
 		// Evaluate to get the metrics
@@ -80,13 +148,15 @@ func (cs *ChunkerService) ChunkDocument(doc *domain.Document) []*domain.Document
 		// Print analysis information
 		fmt.Printf("\nAuto chunking for '%s':\n", doc.Name)
 		fmt.Printf("  Selected strategy: %s\n", optimalConfig.ChunkingStrategy)
-		fmt.Printf("  Chunk size: %d, Overlap: %d\n", optimalConfig.ChunkSize, optimalConfig.ChunkOverlap)
+		fmt.Printf("  Chunk size: %d, Overlap: %d\n", optimalSize, optimalOverlap)
 		fmt.Printf("  Coherence score: %.4f\n", metrics.SemanticCoherenceScore)
 		fmt.Printf("  Chunks created: %d\n", len(chunks))
 	case "fixed":
 		chunks = cs.createFixedSizeChunks(doc, content, chunkSize, overlap)
 	case "semantic":
 		chunks = cs.createSemanticChunks(doc, content, chunkSize, overlap)
+	case "embedding":
+		chunks = cs.createEmbeddingChunks(doc, content, chunkSize, overlap)
 	case "hierarchical":
 		chunks = cs.createHierarchicalChunks(doc, content, chunkSize, overlap)
 	case "hybrid":
@@ -105,6 +175,66 @@ func (cs *ChunkerService) ChunkDocument(doc *domain.Document) []*domain.Document
 	fmt.Printf("Split document '%s' into %d chunks using '%s' strategy\n",
 		doc.Name, len(chunks), cs.config.ChunkingStrategy)
 
+	return cs.countTokens(chunks)
+}
+
+// inTokens reports whether chunk sizes are measured in tokens rather than characters
+func (cs *ChunkerService) inTokens() bool {
+	return cs.config.ChunkTokens > 0
+}
+
+// sizes returns the chunk size and overlap of the configuration in the unit
+// chunks are measured in: tokens with a token budget, characters otherwise
+func (c ChunkingConfig) sizes() (int, int) {
+	if c.ChunkTokens > 0 {
+		return c.ChunkTokens, c.OverlapTokens
+	}
+	return c.ChunkSize, c.ChunkOverlap
+}
+
+// measure returns the size of text in the unit of the chunk size
+func (cs *ChunkerService) measure(text string) int {
+	if cs.inTokens() {
+		return cs.tokenizer.Count(text)
+	}
+	return len(text)
+}
+
+// prefix returns the length in bytes of the start of text that holds size
+// units, at least one character so that callers always make progress
+func (cs *ChunkerService) prefix(text string, size int) int {
+	if cs.inTokens() {
+		if n := cs.tokenizer.Prefix(text, size); n > 0 {
+			return n
+		}
+		_, n := utf8.DecodeRuneInString(text)
+		return n
+	}
+	if size < 1 {
+		size = 1
+	}
+	if size > len(text) {
+		return len(text)
+	}
+	return size
+}
+
+// suffix returns the byte offset at which the last size units of text start
+func (cs *ChunkerService) suffix(text string, size int) int {
+	if cs.inTokens() {
+		return cs.tokenizer.Suffix(text, size)
+	}
+	if size > len(text) {
+		return 0
+	}
+	return len(text) - size
+}
+
+// countTokens records the number of tokens of each chunk
+func (cs *ChunkerService) countTokens(chunks []*domain.DocumentChunk) []*domain.DocumentChunk {
+	for _, chunk := range chunks {
+		chunk.TokenCount = cs.tokenizer.Count(chunk.Content)
+	}
 	return chunks
 }
 
@@ -121,8 +251,7 @@ func (cs *ChunkerService) createHybridChunks(doc *domain.Document, content strin
 		(strings.Contains(content, "<html") && strings.Contains(content, "</html>"))
 
 	// Determine if content is code
-	isCode := ext == ".go" || ext == ".js" || ext == ".py" || ext == ".java" || ext == ".c" ||
-		ext == ".cpp" || ext == ".rs" || ext == ".ts" || ext == ".rb" || ext == ".php"
+	isCode := domain.IsCodeFile(doc.Path)
 
 	// Apply appropriate strategy based on content type
 	if isMarkdown {
@@ -131,7 +260,7 @@ func (cs *ChunkerService) createHybridChunks(doc *domain.Document, content strin
 		return cs.createHTMLBasedChunks(doc, content, chunkSize, overlap)
 	} else if isCode {
 		return cs.createCodeBasedChunks(doc, content, chunkSize, overlap)
-	} else if len(content) > chunkSize*5 { // Very long document
+	} else if cs.measure(content) > chunkSize*5 { // Very long document
 		return cs.createHierarchicalChunks(doc, content, chunkSize, overlap)
 	} else {
 		// Default to paragraph-based chunking for general text
@@ -156,69 +285,70 @@ func (cs *ChunkerService) createSemanticChunks(doc *domain.Document, content str
 	}
 }
 
-// createSectionBasedChunks splits content based on headers and sections
+// createSectionBasedChunks splits content along its heading tree: each section
+// is chunked on its own, so that chunks never straddle sibling sections, and
+// every chunk records the breadcrumb of its section
 func (cs *ChunkerService) createSectionBasedChunks(doc *domain.Document, content string, chunkSize int, overlap int) []*domain.DocumentChunk {
 	var chunks []*domain.DocumentChunk
+	cs.chunkSection(doc, content, buildHeadingTree(content), -1, chunkSize, overlap, &chunks)
+	return chunks
+}
 
-	// Find markdown headers or HTML headers
-	headerPattern := regexp.MustCompile(`(?m)^(#+\s+.+$|<h[1-6]>.+</h[1-6]>)`)
-
-	// Split content by headers
-	sections := headerPattern.Split(content, -1)
-	headers := headerPattern.FindAllString(content, -1)
+// chunkSection chunks the own text of a section, then its subsections. A
+// heading directly followed by a subsection is kept with the subsection's
+// first chunk; from is then the offset at which that heading starts.
+func (cs *ChunkerService) chunkSection(doc *domain.Document, content string, section *headingSection, from int, chunkSize int, overlap int, chunks *[]*domain.DocumentChunk) {
+	start := section.Start()
+	if from >= 0 {
+		start = from
+	}
 
-	// Add a dummy header for the first section if it doesn't have one
-	if len(headers) < len(sections) && len(sections[0]) > 0 {
-		headers = append([]string{"# Introduction"}, headers...)
-	} else if len(headers) > len(sections) {
-		sections = append([]string{""}, sections...)
+	carry := -1
+	if section.Heading.Level > 0 && len(section.Children) > 0 && strings.TrimSpace(content[section.Heading.End:section.BodyEnd]) == "" {
+		carry = start
+	} else {
+		cs.addSectionChunks(doc, content, section, start, chunkSize, overlap, chunks)
 	}
 
-	// Process each section
-	startPos := 0
-	chunkIndex := 0
+	for _, child := range section.Children {
+		cs.chunkSection(doc, content, child, carry, chunkSize, overlap, chunks)
+		carry = -1
+	}
+}
 
-	for i := 0; i < len(sections); i++ {
-		// Skip empty sections
-		if strings.TrimSpace(sections[i]) == "" {
-			continue
-		}
+// addSectionChunks chunks content[start:section.BodyEnd], a section too large
+// for a single chunk being split between paragraphs
+func (cs *ChunkerService) addSectionChunks(doc *domain.Document, content string, section *headingSection, start int, chunkSize int, overlap int, chunks *[]*domain.DocumentChunk) {
+	text := strings.TrimRight(content[start:section.BodyEnd], " \t\r\n")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
 
-		// Combine header with its content
-		var sectionContent string
-		if i < len(headers) {
-			sectionContent = headers[i] + sections[i]
-		} else {
-			sectionContent = sections[i]
+	var sectionChunks []*domain.DocumentChunk
+	if cs.measure(text) > chunkSize*2 {
+		sectionChunks = cs.createParagraphBasedChunks(doc, text, chunkSize, overlap)
+		for _, chunk := range sectionChunks {
+			chunk.StartPos += start
+			chunk.EndPos += start
 		}
+	} else {
+		sectionChunks = []*domain.DocumentChunk{domain.NewDocumentChunk(doc, text, start, start+len(text), 0)}
+	}
 
-		// If section is too large, split it further
-		if len(sectionContent) > chunkSize*2 {
-			// Create sub-chunks for this section
-			sectionChunks := cs.createParagraphBasedChunks(doc, sectionContent, chunkSize, overlap)
-
-			// Update positions and indices
-			for j, chunk := range sectionChunks {
-				chunk.StartPos = startPos + chunk.StartPos
-				chunk.EndPos = startPos + chunk.EndPos
-				chunk.ChunkIndex = chunkIndex + j
-				chunks = append(chunks, chunk)
-			}
-
-			chunkIndex += len(sectionChunks)
-			startPos += len(sectionContent)
-		} else {
-			// Create a single chunk for this section
-			endPos := startPos + len(sectionContent)
-			chunk := domain.NewDocumentChunk(doc, sectionContent, startPos, endPos, chunkIndex)
-			chunks = append(chunks, chunk)
-
-			chunkIndex++
-			startPos = endPos
-		}
+	for _, chunk := range sectionChunks {
+		chunk.ChunkIndex = len(*chunks)
+		chunk.ID = fmt.Sprintf("%s_chunk_%d", doc.ID, chunk.ChunkIndex)
+		setSectionMetadata(chunk, section)
+		*chunks = append(*chunks, chunk)
 	}
+}
 
-	return chunks
+// setSectionMetadata records the breadcrumb and heading level of the section of a chunk
+func setSectionMetadata(chunk *domain.DocumentChunk, section *headingSection) {
+	if len(section.Path) > 0 {
+		chunk.Metadata[domain.ChunkBreadcrumb] = section.Breadcrumb()
+		chunk.Metadata[domain.ChunkHeadingLevel] = fmt.Sprint(section.Heading.Level)
+	}
 }
 
 // createHierarchicalChunks creates a two-level chunking structure
@@ -228,86 +358,56 @@ func (cs *ChunkerService) createHierarchicalChunks(doc *domain.Document, content
 	// For hierarchical chunking, we first split into major sections,
 	// then we further split each section if needed
 
-	// Split into major sections (try headers first, fall back to large chunks)
-	headerPattern := regexp.MustCompile(`(?m)^(#+\s+.+$|<h[1-6]>.+</h[1-6]>)`)
-	hasMajorSections := headerPattern.MatchString(content)
-
-	if hasMajorSections {
-		// Split by headers for major sections
-		sections := headerPattern.Split(content, -1)
-		headers := headerPattern.FindAllString(content, -1)
+	// Split into major sections (try headings first, fall back to large chunks)
+	tree := buildHeadingTree(content)
 
-		// Add a dummy header for the first section if it doesn't have one
-		if len(headers) < len(sections) && len(sections[0]) > 0 {
-			headers = append([]string{"# Introduction"}, headers...)
-		} else if len(headers) > len(sections) {
-			sections = append([]string{""}, sections...)
-		}
-
-		// Process each section
-		startPos := 0
-		chunkIndex := 0
-
-		for i := 0; i < len(sections); i++ {
-			// Skip empty sections
-			if strings.TrimSpace(sections[i]) == "" {
+	if len(tree.Children) > 0 {
+		// The text before the first heading and each top-level section are
+		// parents, chunked again along their subsections when too large
+		majors := append([]*headingSection{{BodyEnd: tree.BodyEnd, End: tree.BodyEnd}}, tree.Children...)
+		for _, major := range majors {
+			sectionContent := strings.TrimRight(content[major.Start():major.End], " \t\r\n")
+			if strings.TrimSpace(sectionContent) == "" {
 				continue
 			}
 
-			// Combine header with its content
-			var sectionContent string
-			if i < len(headers) {
-				sectionContent = headers[i] + sections[i]
-			} else {
-				sectionContent = sections[i]
-			}
-
-			// For each major section, create sub-chunks
-			majorSection := domain.NewDocumentChunk(doc, sectionContent, startPos, startPos+len(sectionContent), chunkIndex)
+			majorSection := domain.NewDocumentChunk(doc, sectionContent, major.Start(), major.Start()+len(sectionContent), len(chunks))
 			majorSection.Metadata["chunk_type"] = "parent_section"
+			setSectionMetadata(majorSection, major)
 			chunks = append(chunks, majorSection)
-			chunkIndex++
 
 			// If section is large enough to need sub-chunks
-			if len(sectionContent) > chunkSize {
-				// Create sub-chunks with paragraph-based approach
-				subChunks := cs.createParagraphBasedChunks(doc, sectionContent, chunkSize, overlap)
-
-				// Update positions and indices for sub-chunks
-				for j, chunk := range subChunks {
-					chunk.StartPos = startPos + chunk.StartPos
-					chunk.EndPos = startPos + chunk.EndPos
-					chunk.ChunkIndex = chunkIndex + j
+			if cs.measure(sectionContent) > chunkSize {
+				subChunks := chunks
+				cs.chunkSection(doc, content, major, -1, chunkSize, overlap, &subChunks)
+				for _, chunk := range subChunks[len(chunks):] {
 					chunk.Metadata["parent_chunk_id"] = majorSection.ID
 					chunk.Metadata["chunk_type"] = "child_section"
-					chunks = append(chunks, chunk)
 				}
-
-				chunkIndex += len(subChunks)
+				chunks = subChunks
 			}
-
-			startPos += len(sectionContent)
 		}
 	} else {
 		// No clear sections, create artificial major chunks
 		majorChunkSize := chunkSize * 3
 
 		// First create large parent chunks with minimal overlap
-		for i := 0; i < len(content); i += majorChunkSize {
-			end := i + majorChunkSize
-			if end > len(content) {
-				end = len(content)
-			}
+		for i, major := 0, 0; i < len(content); major++ {
+			end := i + cs.prefix(content[i:], majorChunkSize)
 
 			// Try to break at paragraph boundaries
 			if end < len(content) {
-				for end > i && content[end] != '\n' {
-					end--
+				breakAt := end
+				for breakAt > i && content[breakAt] != '\n' {
+					breakAt--
+				}
+				if breakAt > i {
+					end = breakAt
 				}
 			}
 
 			majorContent := content[i:end]
-			majorChunk := domain.NewDocumentChunk(doc, majorContent, i, end, i/majorChunkSize)
+			majorChunk := domain.NewDocumentChunk(doc, majorContent, i, end, major)
 			majorChunk.Metadata["chunk_type"] = "parent_section"
 			chunks = append(chunks, majorChunk)
 
@@ -323,6 +423,8 @@ func (cs *ChunkerService) createHierarchicalChunks(doc *domain.Document, content
 				chunk.Metadata["chunk_type"] = "child_section"
 				chunks = append(chunks, chunk)
 			}
+
+			i = end
 		}
 	}
 
@@ -337,7 +439,13 @@ func (cs *ChunkerService) createMarkdownBasedChunks(doc *domain.Document, conten
 
 // createHTMLBasedChunks optimizes chunking for HTML documents
 func (cs *ChunkerService) createHTMLBasedChunks(doc *domain.Document, content string, chunkSize int, overlap int) []*domain.DocumentChunk {
-	// For HTML content, try to respect tag structure
+	// Pages with headings are split along them like markdown, so that every
+	// chunk records the breadcrumb of its section
+	if len(buildHeadingTree(content).Children) > 0 {
+		return cs.createSectionBasedChunks(doc, content, chunkSize, overlap)
+	}
+
+	// Otherwise, try to respect tag structure
 	// This is a simplified implementation - a full HTML parser would be more accurate
 
 	// Look for major HTML structural elements
@@ -377,7 +485,7 @@ func (cs *ChunkerService) createHTMLBasedChunks(doc *domain.Document, content st
 				}
 
 				// If section is too large, split it further
-				if len(sectionContent) > chunkSize*2 {
+				if cs.measure(sectionContent) > chunkSize*2 {
 					// Strip HTML tags for better text chunking
 					sectionChunks := cs.createParagraphBasedChunks(doc, sectionContent, chunkSize, overlap)
 
@@ -468,7 +576,7 @@ func (cs *ChunkerService) createCodeBasedChunks(doc *domain.Document, content st
 				functionContent := content[start:end]
 
 				// If function is too large, split it further
-				if len(functionContent) > chunkSize*2 {
+				if cs.measure(functionContent) > chunkSize*2 {
 					// Split by logical blocks (like try/catch, if/else)
 					subChunks := cs.createFixedSizeChunks(doc, functionContent, chunkSize, overlap)
 
@@ -504,6 +612,17 @@ func (cs *ChunkerService) createFixedSizeChunks(doc *domain.Document, content st
 	var chunks []*domain.DocumentChunk
 	contentLength := len(content)
 
+	if cs.inTokens() {
+		windows := cs.tokenWindows(content, chunkSize, overlap)
+		fmt.Printf("Document '%s' size: %d tokens, creating %d chunks\n",
+			doc.Name, cs.measure(content), len(windows))
+		for i, window := range windows {
+			chunk := domain.NewDocumentChunk(doc, content[window[0]:window[1]], window[0], window[1], i)
+			chunks = append(chunks, chunk)
+		}
+		return chunks
+	}
+
 	// Calculate total chunks needed
 	totalChunks := (contentLength + chunkSize - overlap - 1) / (chunkSize - overlap)
 	if totalChunks < 1 {
@@ -546,6 +665,41 @@ func (cs *ChunkerService) createFixedSizeChunks(doc *domain.Document, content st
 	return chunks
 }
 
+// tokenWindows returns the byte ranges of chunks of at most chunkSize tokens,
+// ending at word boundaries when possible, each starting overlap tokens
+// before the end of the previous one
+func (cs *ChunkerService) tokenWindows(content string, chunkSize int, overlap int) [][2]int {
+	var windows [][2]int
+	for start := 0; start < len(content); {
+		end := start + cs.prefix(content[start:], chunkSize)
+		if end < len(content) {
+			// Try to end at a natural break
+			breakAt := end
+			for breakAt > start && content[breakAt] != ' ' && content[breakAt] != '\n' {
+				breakAt--
+			}
+			if breakAt > start {
+				end = breakAt
+			}
+		}
+		windows = append(windows, [2]int{start, end})
+		if end >= len(content) {
+			break
+		}
+
+		// Start the next chunk at a word boundary within the overlap
+		next := start + cs.suffix(content[start:end], overlap)
+		for next > start && next < end && content[next] != ' ' && content[next] != '\n' {
+			next++
+		}
+		if next <= start || next >= end {
+			next = end
+		}
+		start = next
+	}
+	return windows
+}
+
 // createParagraphBasedChunks creates chunks based on paragraph boundaries
 func (cs *ChunkerService) createParagraphBasedChunks(doc *domain.Document, content string, chunkSize int, overlap int) []*domain.DocumentChunk {
 	var chunks []*domain.DocumentChunk
@@ -563,7 +717,7 @@ func (cs *ChunkerService) createParagraphBasedChunks(doc *domain.Document, conte
 			continue
 		}
 
-		paraSize := len(para) + 2 // +2 for newlines
+		paraSize := cs.measure(para) + cs.measure("\n\n")
 
 		// If this paragraph alone exceeds chunk size, we need to split it
 		if paraSize > chunkSize*2 {
@@ -604,18 +758,15 @@ func (cs *ChunkerService) createParagraphBasedChunks(doc *domain.Document, conte
 			chunkIndex++
 
 			// Handle overlap for the next chunk
-			if overlap > 0 && len(chunkContent) > overlap {
+			if overlap > 0 && cs.measure(chunkContent) > overlap {
 				// Calculate where to start the next chunk with overlap
-				overlapStart := len(chunkContent) - overlap
-				if overlapStart < 0 {
-					overlapStart = 0
-				}
+				overlapStart := cs.suffix(chunkContent, overlap)
 
 				// Start the new chunk with the end of the previous one
 				currentChunk.Reset()
 				overlapText := chunkContent[overlapStart:]
 				currentChunk.WriteString(overlapText)
-				currentSize = len(overlapText)
+				currentSize = cs.measure(overlapText)
 				startPos = endPos - len(overlapText)
 			} else {
 				currentChunk.Reset()
@@ -652,7 +803,14 @@ func (cs *ChunkerService) splitParagraphIntoChunks(doc *domain.Document, paragra
 	sentences := strings.Split(paragraph, ". ")
 
 	// If paragraph doesn't have clear sentences or has very few, use character chunking
-	if len(sentences) < 3 || paraLen/len(sentences) > chunkSize {
+	if cs.inTokens() && (len(sentences) < 3 || cs.measure(paragraph)/len(sentences) > chunkSize) {
+		// Token-based chunking
+		for _, window := range cs.tokenWindows(paragraph, chunkSize, overlap) {
+			chunkIndex := chunkIndexOffset + len(chunks)
+			chunk := domain.NewDocumentChunk(doc, paragraph[window[0]:window[1]], startOffset+window[0], startOffset+window[1], chunkIndex)
+			chunks = append(chunks, chunk)
+		}
+	} else if len(sentences) < 3 || paraLen/len(sentences) > chunkSize {
 		// Character-based chunking
 		for i := 0; i < paraLen; i += (chunkSize - overlap) {
 			end := i + chunkSize
@@ -683,7 +841,7 @@ func (cs *ChunkerService) splitParagraphIntoChunks(doc *domain.Document, paragra
 		sentenceStartPos := startOffset
 
 		for i, sentence := range sentences {
-			sentenceSize := len(sentence) + 2 // +2 for ". "
+			sentenceSize := cs.measure(sentence) + cs.measure(". ")
 
 			// If adding this sentence exceeds the chunk size and we have content
 			if currentSize+sentenceSize > chunkSize && currentSize > 0 {
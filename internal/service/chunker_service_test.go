@@ -0,0 +1,84 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkTokensBoundEveryStrategy(t *testing.T) {
+	var paragraphs []string
+	for i := 0; i < 30; i++ {
+		paragraphs = append(paragraphs, "Retrieval augmented generation splits the documents into chunks. "+
+			"Each chunk is embedded and stored so that the most relevant ones can be found for a question.")
+	}
+	prose := strings.Join(paragraphs, "\n\n")
+	cjk := strings.Repeat("検索拡張生成は文書を小さなチャンクに分割して埋め込みを計算します。", 40)
+
+	for _, strategy := range []string{"fixed", "semantic", "hybrid", "hierarchical"} {
+		for _, content := range []string{prose, cjk} {
+			doc := domain.NewDocument("notes.txt", content)
+			chunker := NewChunkerService(ChunkingConfig{
+				ChunkSize:        100000, // Ignored when ChunkTokens is set
+				ChunkTokens:      120,
+				OverlapTokens:    10,
+				ChunkingStrategy: strategy,
+			})
+
+			chunks := chunker.ChunkDocument(doc)
+			require.Greater(t, len(chunks), 1, strategy)
+			for _, chunk := range chunks {
+				assert.Equal(t, chunker.tokenizer.Count(chunk.Content), chunk.TokenCount)
+				if chunk.Metadata["chunk_type"] != "parent_section" {
+					assert.LessOrEqual(t, chunk.TokenCount, 2*120, strategy)
+				}
+			}
+		}
+	}
+}
+
+func TestFixedTokenChunksOverlap(t *testing.T) {
+	content := strings.Repeat("alpha beta gamma delta epsilon zeta eta theta iota kappa ", 50)
+	doc := domain.NewDocument("words.txt", content)
+	chunker := NewChunkerService(ChunkingConfig{ChunkTokens: 50, OverlapTokens: 10, ChunkingStrategy: "fixed"})
+
+	chunks := chunker.ChunkDocument(doc)
+	require.Greater(t, len(chunks), 2)
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, chunk.TokenCount, 50)
+		assert.Equal(t, content[chunk.StartPos:chunk.EndPos], chunk.Content)
+		if i > 0 {
+			assert.Less(t, chunk.StartPos, chunks[i-1].EndPos, "chunks overlap")
+		}
+	}
+	assert.Equal(t, len(content), chunks[len(chunks)-1].EndPos)
+}
+
+func TestCharacterChunksRecordTokens(t *testing.T) {
+	doc := domain.NewDocument("short.txt", "A short document about embeddings.")
+	chunks := NewChunkerService(DefaultChunkingConfig()).ChunkDocument(doc)
+
+	require.Len(t, chunks, 1)
+	assert.Greater(t, chunks[0].TokenCount, 0)
+	assert.Less(t, chunks[0].TokenCount, len(doc.Content))
+}
+
+func TestTokenChunksOfTextWithoutSpaces(t *testing.T) {
+	content := strings.Repeat("QmFzZTY0IGVuY29kZWQgZGF0YSBoYXMgbm8gc3BhY2Vz", 3000)
+	doc := domain.NewDocument("data.txt", content)
+	chunker := NewChunkerService(ChunkingConfig{ChunkTokens: 200, OverlapTokens: 20, ChunkingStrategy: "hybrid"})
+
+	start := time.Now()
+	chunks := chunker.ChunkDocument(doc)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		if chunk.Metadata["chunk_type"] != "parent_section" {
+			assert.LessOrEqual(t, chunk.TokenCount, 2*200)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// codeSymbol is a top-level declaration, or a member of a declaration, found
+// by the syntax-aware code chunker
+type codeSymbol struct {
+	Name    string
+	Kind    string
+	Start   int    // Byte offset of the first line, doc comment included
+	End     int    // Byte offset just after the last line
+	Context string // Enclosing declaration, repeated at the top of the chunk
+}
+
+// codeLanguages maps source file extensions to the language names recorded on chunks
+var codeLanguages = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".mjs":  "javascript",
+	".ts":   "typescript",
+	".tsx":  "typescript",
+	".rs":   "rust",
+	".java": "java",
+}
+
+// createSyntaxChunks cuts source code along its declarations: one chunk per
+// top-level declaration with its doc comment, large containers being split
+// into their members. Returns false when the language isn't supported or the
+// code can't be parsed.
+func (cs *ChunkerService) createSyntaxChunks(doc *domain.Document, content string, chunkSize int) ([]*domain.DocumentChunk, bool) {
+	language := codeLanguages[strings.ToLower(filepath.Ext(doc.Path))]
+
+	var symbols []codeSymbol
+	header := ""
+	switch language {
+	case "go":
+		var ok bool
+		if header, symbols, ok = parseGoSymbols(doc.Path, content); !ok {
+			return nil, false
+		}
+	case "python":
+		symbols = cs.parsePythonSymbols(content, chunkSize)
+	case "javascript", "typescript", "rust", "java":
+		symbols = cs.parseBraceSymbols(content, language, chunkSize)
+	default:
+		return nil, false
+	}
+	if len(symbols) == 0 {
+		return nil, false
+	}
+
+	return cs.createSymbolChunks(doc, content, language, header, symbols, chunkSize), true
+}
+
+// createSymbolChunks turns symbols into chunks prefixed with the file header and
+// their context. Symbols larger than twice chunkSize are split between lines.
+func (cs *ChunkerService) createSymbolChunks(doc *domain.Document, content, language, header string, symbols []codeSymbol, chunkSize int) []*domain.DocumentChunk {
+	lineStarts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	lineOf := func(offset int) int {
+		return sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > offset })
+	}
+
+	var chunks []*domain.DocumentChunk
+	for _, symbol := range symbols {
+		text := strings.TrimRight(content[symbol.Start:symbol.End], " \t\r\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		prefix := header + symbol.Context
+		if symbol.Kind == "package" {
+			prefix = "" // Already holds the header
+		}
+
+		parts := [][2]int{{symbol.Start, symbol.Start + len(text)}}
+		if cs.measure(text) > chunkSize*2 {
+			size := chunkSize - cs.measure(prefix)
+			if size < chunkSize/2 {
+				size = chunkSize / 2
+			}
+			parts = cs.splitCodeLines(content, symbol.Start, symbol.Start+len(text), size)
+		}
+
+		for i, part := range parts {
+			chunk := domain.NewDocumentChunk(doc, prefix+content[part[0]:part[1]], part[0], part[1], len(chunks))
+			chunk.Metadata[domain.ChunkCodeLanguage] = language
+			chunk.Metadata[domain.ChunkSymbolKind] = symbol.Kind
+			if symbol.Name != "" {
+				chunk.Metadata[domain.ChunkSymbol] = symbol.Name
+			}
+			chunk.Metadata[domain.ChunkStartLine] = fmt.Sprint(lineOf(part[0]))
+			chunk.Metadata[domain.ChunkEndLine] = fmt.Sprint(lineOf(part[1] - 1))
+			if len(parts) > 1 {
+				chunk.Metadata[domain.ChunkSymbolPart] = fmt.Sprintf("%d of %d", i+1, len(parts))
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// splitCodeLines splits content[start:end] into ranges of whole lines of at
+// most size, a single longer line making a range of its own
+func (cs *ChunkerService) splitCodeLines(content string, start, end, size int) [][2]int {
+	var parts [][2]int
+	partStart, partSize := start, 0
+	for lineStart := start; lineStart < end; {
+		lineEnd := end
+		if newline := strings.IndexByte(content[lineStart:end], '\n'); newline >= 0 {
+			lineEnd = lineStart + newline + 1
+		}
+		lineSize := cs.measure(content[lineStart:lineEnd])
+		if partSize+lineSize > size && strings.TrimSpace(content[partStart:lineStart]) != "" {
+			parts = append(parts, [2]int{partStart, partStart + len(strings.TrimRight(content[partStart:lineStart], " \t\r\n"))})
+			partStart, partSize = lineStart, 0
+		}
+		partSize += lineSize
+		lineStart = lineEnd
+	}
+	if strings.TrimSpace(content[partStart:end]) != "" {
+		parts = append(parts, [2]int{partStart, end})
+	}
+	return parts
+}
+
+// parseGoSymbols parses Go source with go/parser. The header holds the package
+// clause and the imports; every other top-level declaration is a symbol
+// starting at its doc comment.
+func parseGoSymbols(path, content string) (string, []codeSymbol, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return "", nil, false
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	var header strings.Builder
+	header.WriteString("package " + file.Name.Name + "\n\n")
+	packageEnd := offset(file.Name.End())
+
+	var symbols []codeSymbol
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			header.WriteString(content[offset(gen.Pos()):offset(gen.End())] + "\n\n")
+			packageEnd = offset(gen.End())
+			continue
+		}
+
+		symbol := codeSymbol{Start: offset(decl.Pos()), End: offset(decl.End())}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			symbol.Kind, symbol.Name = "func", d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol.Kind, symbol.Name = "method", goReceiverName(d.Recv.List[0].Type)+"."+d.Name.Name
+			}
+			if d.Doc != nil {
+				symbol.Start = offset(d.Doc.Pos())
+			}
+		case *ast.GenDecl:
+			symbol.Kind, symbol.Name = d.Tok.String(), goSpecNames(d.Specs)
+			if d.Doc != nil {
+				symbol.Start = offset(d.Doc.Pos())
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	// The package documentation and imports make a chunk of their own
+	if file.Doc != nil || len(symbols) == 0 {
+		packageStart := offset(file.Package)
+		if file.Doc != nil {
+			packageStart = offset(file.Doc.Pos())
+		}
+		pkg := codeSymbol{Name: file.Name.Name, Kind: "package", Start: packageStart, End: packageEnd}
+		symbols = append([]codeSymbol{pkg}, symbols...)
+	}
+	return header.String(), symbols, true
+}
+
+// goReceiverName returns the type name of a method receiver
+func goReceiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return goReceiverName(e.X)
+	case *ast.IndexExpr:
+		return goReceiverName(e.X)
+	case *ast.IndexListExpr:
+		return goReceiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// goSpecNames returns the names declared by type, const or var specs, the
+// first three only for long groups
+func goSpecNames(specs []ast.Spec) string {
+	var names []string
+	for _, spec := range specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				names = append(names, name.Name)
+			}
+		}
+	}
+	if len(names) > 3 {
+		return strings.Join(names[:3], ", ") + ", ..."
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkSymbols returns the kind, symbol and lines of each chunk
+func chunkSymbols(chunks []*domain.DocumentChunk) []string {
+	var symbols []string
+	for _, chunk := range chunks {
+		symbols = append(symbols, chunk.Metadata[domain.ChunkSymbolKind]+" "+chunk.Metadata[domain.ChunkSymbol]+" "+
+			chunk.Metadata[domain.ChunkStartLine]+"-"+chunk.Metadata[domain.ChunkEndLine])
+	}
+	return symbols
+}
+
+func TestGoChunksFollowDeclarations(t *testing.T) {
+	content := `package store
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned for unknown keys
+var ErrNotFound = errors.New("not found")
+
+// Store is a concurrent map
+type Store struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+// Get returns the value of a key
+func (s *Store) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.items[key]; ok {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+func New() *Store {
+	return &Store{items: map[string]string{}}
+}
+`
+	doc := domain.NewDocument("/src/store.go", content)
+	assert.Equal(t, strings.TrimRight(content, "\n"), doc.Content, "code keeps its indentation and braces")
+
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 1000, ChunkOverlap: 100, ChunkingStrategy: "fixed"}).ChunkDocument(doc)
+
+	require.Len(t, chunks, 4)
+	assert.Equal(t, []string{"var ErrNotFound 8-9", "type Store 11-15", "method Store.Get 17-25", "func New 27-29"}, chunkSymbols(chunks))
+	for _, chunk := range chunks {
+		assert.True(t, strings.HasPrefix(chunk.Content, "package store\n\nimport (\n\t\"errors\"\n\t\"sync\"\n)\n\n"))
+		assert.Equal(t, "go", chunk.Metadata[domain.ChunkCodeLanguage])
+	}
+	assert.True(t, strings.HasSuffix(chunks[2].Content, "// Get returns the value of a key\nfunc (s *Store) Get(key string) (string, error) {\n\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\tif value, ok := s.items[key]; ok {\n\t\treturn value, nil\n\t}\n\treturn \"\", ErrNotFound\n}"))
+	assert.Equal(t, "Source: store.go:17-25 (method Store.Get)", chunks[2].GetMetadataString())
+}
+
+func TestGoChunksKeepPackageDocumentation(t *testing.T) {
+	content := "// Package calc adds numbers.\npackage calc\n\nimport \"fmt\"\n\nfunc Add(a, b int) int { return a + b }\n\nfunc Print(n int) { fmt.Println(n) }\n"
+	chunks := NewChunkerService(DefaultChunkingConfig()).ChunkDocument(domain.NewDocument("calc.go", content))
+
+	require.Len(t, chunks, 3)
+	assert.Equal(t, []string{"package calc 1-4", "func Add 6-6", "func Print 8-8"}, chunkSymbols(chunks))
+	assert.Equal(t, "// Package calc adds numbers.\npackage calc\n\nimport \"fmt\"", chunks[0].Content)
+}
+
+func TestGoChunksFallBackOnSyntaxErrors(t *testing.T) {
+	doc := domain.NewDocument("broken.go", "package broken\n\nfunc Oops( {\n")
+	chunks := NewChunkerService(DefaultChunkingConfig()).ChunkDocument(doc)
+
+	require.Len(t, chunks, 1)
+	assert.NotContains(t, chunks[0].Metadata, domain.ChunkSymbol)
+}
+
+func TestPythonChunksFollowIndentation(t *testing.T) {
+	content := `"""Geometry helpers."""
+import math
+
+# Points are tuples
+
+
+@cache
+def distance(a, b):
+    """Distance between two points.
+
+    def not_a_function(): inside the docstring
+    """
+    return math.hypot(a[0] - b[0],
+        a[1] - b[1])
+
+class Shape:
+    sides = 0
+
+    def area(self):
+        return 0
+
+    @property
+    def name(self):
+        return type(self).__name__
+
+
+if __name__ == "__main__":
+    print(distance((0, 0), (3, 4)))
+`
+	doc := domain.NewDocument("geometry.py", content)
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 1000, ChunkOverlap: 100}).ChunkDocument(doc)
+
+	assert.Equal(t, []string{"module  1-4", "function distance 7-14", "class Shape 16-24", "module  27-28"}, chunkSymbols(chunks))
+	assert.True(t, strings.HasPrefix(chunks[1].Content, "@cache\ndef distance(a, b):"))
+
+	// Classes larger than the chunk size are split into their methods
+	chunks = NewChunkerService(ChunkingConfig{ChunkSize: 60, ChunkOverlap: 0}).ChunkDocument(doc)
+	symbols := chunkSymbols(chunks)
+	assert.Contains(t, symbols, "class Shape 16-16")
+	assert.Contains(t, symbols, "fields Shape 17-17")
+	assert.Contains(t, symbols, "method Shape.area 19-20")
+	assert.Contains(t, symbols, "method Shape.name 22-24")
+	for _, chunk := range chunks {
+		if chunk.Metadata[domain.ChunkSymbol] == "Shape.name" {
+			assert.Equal(t, "class Shape:\n    @property\n    def name(self):\n        return type(self).__name__", chunk.Content)
+		}
+	}
+}
+
+func TestTypeScriptChunksFollowBraces(t *testing.T) {
+	content := `import { api } from "./api";
+
+/** A user of the service */
+export interface User {
+  id: string;
+  name: string;
+}
+
+export const greet = (user: User) => {
+  const text = ` + "`Hello ${user.name} }`" + `;
+  return text;
+};
+
+// Loads users
+export async function loadUsers(): Promise<User[]> {
+  const response = await api.get("/users"); // "}" in a comment
+  return response.data;
+}
+`
+	doc := domain.NewDocument("users.ts", content)
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 1000, ChunkOverlap: 100}).ChunkDocument(doc)
+
+	assert.Equal(t, []string{"module  1-1", "interface User 3-7", "function greet 9-12", "function loadUsers 14-18"}, chunkSymbols(chunks))
+	assert.Equal(t, "typescript", chunks[1].Metadata[domain.ChunkCodeLanguage])
+}
+
+func TestTypeScriptChunksSkipRegexLiterals(t *testing.T) {
+	content := `export class B {
+  m() { return /}/ }
+}
+
+export const half = (n: number) => n / 2 / 1;
+
+export function strip(s: string) {
+  return s.replace(/[/{]/g, "");
+}
+`
+	doc := domain.NewDocument("regex.ts", content)
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 1000, ChunkOverlap: 100}).ChunkDocument(doc)
+
+	assert.Equal(t, []string{"class B 1-3", "function half 5-5", "function strip 7-9"}, chunkSymbols(chunks))
+}
+
+func TestRustChunksSplitLargeImpls(t *testing.T) {
+	content := `use std::fmt;
+
+#[derive(Debug)]
+pub struct Point<'a> {
+    label: &'a str,
+    x: i32,
+}
+
+impl<'a> fmt::Display for Point<'a> {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
+        write!(f, "{}: {}", self.label, '}')
+    }
+
+    /// Moves the point
+    pub fn shift(&mut self, dx: i32) {
+        self.x += dx;
+    }
+}
+`
+	doc := domain.NewDocument("point.rs", content)
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 120, ChunkOverlap: 0}).ChunkDocument(doc)
+
+	assert.Equal(t, []string{"module  1-1", "struct Point 3-7", "impl Point 9-9", "method Point.fmt 10-12", "method Point.shift 14-17"}, chunkSymbols(chunks))
+	assert.True(t, strings.HasPrefix(chunks[4].Content, "impl<'a> fmt::Display for Point<'a> {\n    /// Moves the point\n"))
+}
+
+func TestJavaChunksSplitClassesIntoMembers(t *testing.T) {
+	content := `package demo;
+
+import java.util.List;
+
+/**
+ * Keeps a list of names.
+ */
+public class Registry {
+    private final List<String> names;
+
+    public Registry(List<String> names) {
+        this.names = names;
+    }
+
+    @Override
+    public String toString() {
+        return String.join(",", names);
+    }
+}
+`
+	doc := domain.NewDocument("Registry.java", content)
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 50, ChunkOverlap: 0}).ChunkDocument(doc)
+
+	assert.Equal(t, []string{"module  1-3", "class Registry 5-8", "fields Registry 9-9", "method Registry.Registry 11-13", "method Registry.toString 15-18"}, chunkSymbols(chunks))
+	assert.Equal(t, "Source: Registry.java:15-18 (method Registry.toString)", chunks[4].GetMetadataString())
+}
+
+func TestLargeDeclarationsAreSplitBetweenLines(t *testing.T) {
+	var body strings.Builder
+	body.WriteString("def long():\n")
+	for i := 0; i < 60; i++ {
+		body.WriteString("    total = total + 1\n")
+	}
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 200, ChunkOverlap: 0}).ChunkDocument(domain.NewDocument("long.py", body.String()))
+
+	require.Greater(t, len(chunks), 1)
+	assert.Equal(t, "1", chunks[0].Metadata[domain.ChunkStartLine])
+	assert.Equal(t, "61", chunks[len(chunks)-1].Metadata[domain.ChunkEndLine])
+	for i, chunk := range chunks {
+		assert.Equal(t, "long", chunk.Metadata[domain.ChunkSymbol])
+		assert.LessOrEqual(t, len(chunk.Content), 200)
+		assert.Equal(t, fmt.Sprintf("%d of %d", i+1, len(chunks)), chunk.Metadata[domain.ChunkSymbolPart])
+	}
+}
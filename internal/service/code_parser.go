@@ -0,0 +1,601 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeLine is a line of source code as seen by the lightweight parsers
+type codeLine struct {
+	Start     int  // Byte offset of the line
+	End       int  // Byte offset after the newline
+	Depth     int  // Brace depth at the start of the line
+	EndDepth  int  // Brace depth at the end of the line
+	Indent    int  // Width of the leading whitespace
+	Continued bool // Starts inside a string, a comment or an open bracket
+	Code      bool // Holds code outside comments
+	Comment   bool // Holds a comment
+	Last      byte // Last code character of the line
+}
+
+// blank reports whether the line holds neither code nor comment
+func (l codeLine) blank() bool {
+	return !l.Code && !l.Comment && !l.Continued
+}
+
+// declarationPattern recognizes a declaration from its first line, the first
+// group being its name
+type declarationPattern struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+func declaration(kind, pattern string) declarationPattern {
+	return declarationPattern{kind: kind, pattern: regexp.MustCompile(pattern)}
+}
+
+const (
+	jsModifiers   = `(?:export\s+)?(?:default\s+)?(?:declare\s+)?`
+	rustModifiers = `(?:pub(?:\s*\([^)]*\))?\s+)?`
+	javaModifiers = `(?:(?:public|protected|private|abstract|final|static|sealed|non-sealed|strictfp)\s+)*`
+)
+
+var (
+	jsDeclarations = []declarationPattern{
+		declaration("class", `^`+jsModifiers+`(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`),
+		declaration("function", `^`+jsModifiers+`(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`),
+		declaration("interface", `^`+jsModifiers+`interface\s+([A-Za-z_$][\w$]*)`),
+		declaration("type", `^`+jsModifiers+`type\s+([A-Za-z_$][\w$]*)`),
+		declaration("enum", `^`+jsModifiers+`(?:const\s+)?enum\s+([A-Za-z_$][\w$]*)`),
+		declaration("namespace", `^`+jsModifiers+`(?:namespace|module)\s+([A-Za-z_$][\w$.]*)\s*\{`),
+		declaration("function", `^`+jsModifiers+`(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\(|[A-Za-z_$][\w$]*\s*=>)`),
+		declaration("variable", `^`+jsModifiers+`(?:const|let|var)\s+([A-Za-z_$][\w$]*)`),
+	}
+	jsMembers = []declarationPattern{
+		declaration("method", `^(?:(?:public|private|protected|static|readonly|abstract|override|async|get|set|declare)\s+)*\*?\s*(#?[A-Za-z_$][\w$]*)\s*[?!]?\s*(?:<[^>]*>)?\s*\(`),
+	}
+
+	rustDeclarations = []declarationPattern{
+		declaration("function", `^`+rustModifiers+`(?:default\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"[^"]*"\s+)?fn\s+(\w+)`),
+		declaration("struct", `^`+rustModifiers+`struct\s+(\w+)`),
+		declaration("enum", `^`+rustModifiers+`enum\s+(\w+)`),
+		declaration("union", `^`+rustModifiers+`union\s+(\w+)`),
+		declaration("trait", `^`+rustModifiers+`(?:unsafe\s+)?trait\s+(\w+)`),
+		declaration("impl", `^(?:unsafe\s+)?impl\b(?:\s*<[^{]*?>)?\s+([^{]+?)\s*(?:\bwhere\b.*)?\{?\s*$`),
+		declaration("module", `^`+rustModifiers+`mod\s+(\w+)\s*\{`),
+		declaration("macro", `^(?:#\[macro_export\]\s*)?macro_rules!\s*(\w+)`),
+		declaration("type", `^`+rustModifiers+`type\s+(\w+)`),
+		declaration("const", `^`+rustModifiers+`const\s+(\w+)`),
+		declaration("static", `^`+rustModifiers+`static\s+(?:mut\s+)?(\w+)`),
+	}
+
+	javaDeclarations = []declarationPattern{
+		declaration("class", `^`+javaModifiers+`class\s+(\w+)`),
+		declaration("interface", `^`+javaModifiers+`@?interface\s+(\w+)`),
+		declaration("enum", `^`+javaModifiers+`enum\s+(\w+)`),
+		declaration("record", `^`+javaModifiers+`record\s+(\w+)`),
+	}
+	javaMembers = []declarationPattern{
+		declaration("method", `^(?:(?:public|protected|private|abstract|final|static|synchronized|native|default|strictfp)\s+)*(?:<[^>]+>\s+)?(?:[\w.$]+(?:<[^()]*>)?(?:\[\])*\s+)?(\w+)\s*\(`),
+	}
+
+	pythonDeclarations = []declarationPattern{
+		declaration("function", `^(?:async\s+)?def\s+(\w+)`),
+		declaration("class", `^class\s+(\w+)`),
+	}
+
+	// leadingAnnotations matches Java and TypeScript annotations written before a declaration
+	leadingAnnotations = regexp.MustCompile(`^(?:@[\w.]+(?:\([^)]*\))?\s*)+`)
+
+	// genericArguments matches the type parameters of a Rust type
+	genericArguments = regexp.MustCompile(`<.*>`)
+)
+
+// braceLanguageDeclarations returns the top-level and member declarations of a brace language
+func braceLanguageDeclarations(language string) ([]declarationPattern, []declarationPattern) {
+	switch language {
+	case "rust":
+		return rustDeclarations, rustDeclarations
+	case "java":
+		return javaDeclarations, append(append([]declarationPattern{}, javaDeclarations...), javaMembers...)
+	default:
+		return jsDeclarations, append(append([]declarationPattern{}, jsDeclarations...), jsMembers...)
+	}
+}
+
+// containerKinds are the declarations split into their members when too large
+var containerKinds = map[string]bool{
+	"class": true, "interface": true, "namespace": true, "record": true,
+	"impl": true, "trait": true, "module": true,
+}
+
+// mergedKinds are the declarations merged with their neighbours when they fit on one line
+var mergedKinds = map[string]bool{"variable": true, "const": true, "static": true, "type": true}
+
+// codeItem is a run of lines making a declaration, a statement or a comment
+type codeItem struct {
+	from, to int // Line indexes
+}
+
+// classifyItem returns the kind and name of the declaration an item starts with
+func classifyItem(content string, lines []codeLine, item codeItem, patterns []declarationPattern) (string, string, int) {
+	for i := item.from; i < item.to; i++ {
+		if !lines[i].Code {
+			continue
+		}
+		text := strings.TrimSpace(content[lines[i].Start:lines[i].End])
+		if strings.HasPrefix(text, "#[") || strings.HasPrefix(text, "#!") {
+			continue // Rust attributes
+		}
+		text = leadingAnnotations.ReplaceAllString(text, "")
+		if text == "" {
+			continue // Annotations on their own line
+		}
+		for _, declaration := range patterns {
+			if match := declaration.pattern.FindStringSubmatch(text); match != nil {
+				return declaration.kind, symbolName(declaration.kind, match[1]), i
+			}
+		}
+		return "", "", i
+	}
+	return "", "", item.from
+}
+
+// symbolName cleans up a declaration name: Rust impls are named after the
+// type they implement for, without type parameters
+func symbolName(kind, name string) string {
+	if kind == "impl" {
+		if i := strings.LastIndex(name, " for "); i >= 0 {
+			name = name[i+len(" for "):]
+		}
+		name = strings.TrimSpace(genericArguments.ReplaceAllString(name, ""))
+	}
+	return name
+}
+
+// symbolLevel collects the symbols of one nesting level, merging consecutive
+// items that aren't declarations
+type symbolLevel struct {
+	symbols []codeSymbol
+	run     *codeSymbol
+	runKind string
+	runName string
+}
+
+// add records a declaration, or extends the current run when kind is empty
+func (sl *symbolLevel) add(symbol codeSymbol) {
+	if symbol.Kind == "" {
+		if sl.run == nil {
+			sl.run = &codeSymbol{Name: sl.runName, Kind: sl.runKind, Start: symbol.Start, Context: symbol.Context}
+		}
+		sl.run.End = symbol.End
+		return
+	}
+	sl.flush()
+	sl.symbols = append(sl.symbols, symbol)
+}
+
+// flush closes the current run
+func (sl *symbolLevel) flush() {
+	if sl.run != nil {
+		sl.symbols = append(sl.symbols, *sl.run)
+		sl.run = nil
+	}
+}
+
+// parseBraceSymbols finds the declarations of JavaScript, TypeScript, Rust and
+// Java code by following its braces
+func (cs *ChunkerService) parseBraceSymbols(content, language string, chunkSize int) []codeSymbol {
+	lines := scanBraceLines(content, language)
+	top, members := braceLanguageDeclarations(language)
+	return cs.collectBraceSymbols(content, language, lines, 0, len(lines), 0, top, members, "", "", chunkSize)
+}
+
+// collectBraceSymbols returns the symbols of the lines [from, to) at depth,
+// splitting large containers into their members
+func (cs *ChunkerService) collectBraceSymbols(content, language string, lines []codeLine, from, to, depth int, patterns, members []declarationPattern, context, container string, chunkSize int) []codeSymbol {
+	level := symbolLevel{runKind: "module"}
+	if container != "" {
+		level.runKind, level.runName = "fields", container
+	}
+
+	for _, item := range braceItems(content, language, lines, from, to, depth) {
+		kind, name, first := classifyItem(content, lines, item, patterns)
+		symbol := codeSymbol{Kind: kind, Start: lines[item.from].Start, End: lines[item.to-1].End, Context: context}
+		if mergedKinds[kind] && item.to-first == 1 {
+			symbol.Kind = ""
+		}
+		if symbol.Kind == "" {
+			level.add(symbol)
+			continue
+		}
+		if container != "" {
+			name = container + "." + name
+			if kind == "function" {
+				symbol.Kind = "method"
+			}
+		}
+		symbol.Name = name
+
+		// Split large containers into their signature and their members
+		open := -1
+		for i := first; i < item.to-1; i++ {
+			if lines[i].EndDepth > depth {
+				open = i
+				break
+			}
+		}
+		if !containerKinds[kind] || open < 0 || cs.measure(content[symbol.Start:symbol.End]) <= chunkSize {
+			level.add(symbol)
+			continue
+		}
+		symbol.End = lines[open].End
+		level.add(symbol)
+		level.flush()
+		signature := content[lines[first].Start:lines[open].End]
+		level.symbols = append(level.symbols, cs.collectBraceSymbols(content, language, lines, open+1, item.to-1, depth+1, members, members, context+signature, name, chunkSize)...)
+	}
+	level.flush()
+	return level.symbols
+}
+
+// braceItems groups the lines [from, to) at depth into items: a declaration or
+// a statement with the comments and attributes right above it, or a comment
+// standing on its own
+func braceItems(content, language string, lines []codeLine, from, to, depth int) []codeItem {
+	var items []codeItem
+	start, comments := -1, -1
+	for i := from; i < to; i++ {
+		l := lines[i]
+		if start < 0 {
+			if l.blank() {
+				if comments >= 0 {
+					items = append(items, codeItem{comments, i})
+					comments = -1
+				}
+				continue
+			}
+			if !l.Code {
+				if comments < 0 {
+					comments = i
+				}
+				continue
+			}
+			start = i
+			if comments >= 0 {
+				start, comments = comments, -1
+			}
+		}
+
+		nextContinued := i+1 < len(lines) && lines[i+1].Continued
+		if l.Code && l.EndDepth <= depth && !nextContinued && braceStatementEnds(content, language, l) {
+			items = append(items, codeItem{start, i + 1})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		items = append(items, codeItem{start, to})
+	} else if comments >= 0 {
+		items = append(items, codeItem{comments, to})
+	}
+	return items
+}
+
+// braceStatementEnds reports whether a line at the item depth ends the item.
+// Java and Rust statements end with a semicolon or a closing brace; JavaScript
+// statements also end with a line that doesn't continue on the next one.
+func braceStatementEnds(content, language string, l codeLine) bool {
+	text := strings.TrimSpace(content[l.Start:l.End])
+	if strings.HasPrefix(text, "@") || strings.HasPrefix(text, "#[") {
+		return false // Attributes belong to the next declaration
+	}
+	if l.Last == ';' || l.Last == '}' {
+		return true
+	}
+	if language == "java" || language == "rust" {
+		return false
+	}
+	return !strings.ContainsRune(",([{=+-*/.&|?:<>!\\", rune(l.Last))
+}
+
+// scanBraceLines splits code into lines, tracking the brace depth outside
+// strings and comments
+func scanBraceLines(content, language string) []codeLine {
+	var lines []codeLine
+	depth := 0
+	mode := byte(0) // 0 in code, '/' in a line comment, '*' in a block comment, 'r' in a regex literal, otherwise the quote of the open string
+	class := false  // In a character class of the regex literal
+	last := byte(0) // Last code character of the previous lines
+	line := codeLine{}
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c == '\n' {
+			line.End, line.EndDepth = i+1, depth
+			lines = append(lines, line)
+			if line.Last != 0 {
+				last = line.Last
+			}
+			// Only Rust strings and template literals span lines
+			if mode == '/' || mode == 'r' || (mode == '"' || mode == '\'') && language != "rust" {
+				mode = 0
+			}
+			line = codeLine{Start: i + 1, Depth: depth, Continued: mode != 0, Comment: mode == '*'}
+			continue
+		}
+
+		next := byte(0)
+		if i+1 < len(content) {
+			next = content[i+1]
+		}
+		switch mode {
+		case 0:
+			switch {
+			case c == '/' && (next == '/' || next == '*'):
+				mode, line.Comment = next, true
+				i++
+			case c == '/' && language != "rust" && language != "java" && opensRegex(content[:i], line.Last, last):
+				mode, class, line.Code, line.Last = 'r', false, true, c
+			case c == '"' || c == '`' && language != "rust" && language != "java" ||
+				c == '\'' && (language != "rust" || isRustCharLiteral(content[i:])):
+				mode, line.Code, line.Last = c, true, c
+			case c == ' ' || c == '\t' || c == '\r':
+			default:
+				if c == '{' {
+					depth++
+				} else if c == '}' && depth > 0 {
+					depth--
+				}
+				line.Code, line.Last = true, c
+			}
+		case '/':
+		case 'r':
+			line.Code = true
+			switch {
+			case c == '\\' && next != '\n':
+				i++
+			case c == '[':
+				class = true
+			case c == ']':
+				class = false
+			case c == '/' && !class:
+				mode, line.Last = 0, c
+			}
+		case '*':
+			if c == '*' && next == '/' {
+				mode = 0
+				i++
+			}
+		default:
+			line.Code = true
+			if c == '\\' && next != '\n' {
+				i++
+			} else if c == mode {
+				mode, line.Last = 0, c
+			}
+		}
+	}
+	if line.Start < len(content) {
+		line.End, line.EndDepth = len(content), depth
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// opensRegex reports whether a slash opens a JavaScript regex literal rather
+// than a division: it follows an operator, an opening bracket, the end of a
+// statement or return. lineLast and last are the last code characters of the
+// line and of the previous lines.
+func opensRegex(before string, lineLast, last byte) bool {
+	prev := lineLast
+	if prev == 0 {
+		prev = last
+	}
+	if prev == 0 || strings.IndexByte("(,=:[!&|?{};", prev) >= 0 {
+		return true
+	}
+	before = strings.TrimRight(before, " \t\r\n")
+	if !strings.HasSuffix(before, "return") {
+		return false
+	}
+	before = strings.TrimSuffix(before, "return")
+	if before == "" {
+		return true
+	}
+	c := before[len(before)-1]
+	return !(c == '_' || c == '$' || c == '.' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9')
+}
+
+// isRustCharLiteral reports whether the quote text starts with opens a
+// character literal rather than a lifetime
+func isRustCharLiteral(text string) bool {
+	if len(text) < 3 {
+		return false
+	}
+	if text[1] == '\\' {
+		return true
+	}
+	_, size := utf8.DecodeRuneInString(text[1:])
+	return 1+size < len(text) && text[1+size] == '\''
+}
+
+// parsePythonSymbols finds the declarations of Python code by following its indentation
+func (cs *ChunkerService) parsePythonSymbols(content string, chunkSize int) []codeSymbol {
+	lines := scanPythonLines(content)
+	return cs.collectPythonSymbols(content, lines, 0, len(lines), 0, "", "", chunkSize)
+}
+
+// collectPythonSymbols returns the symbols of the lines [from, to) indented by
+// indent, splitting large classes into their methods
+func (cs *ChunkerService) collectPythonSymbols(content string, lines []codeLine, from, to, indent int, context, container string, chunkSize int) []codeSymbol {
+	level := symbolLevel{runKind: "module"}
+	if container != "" {
+		level.runKind, level.runName = "fields", container
+	}
+
+	for _, item := range pythonItems(content, lines, from, to, indent) {
+		kind, name, first := classifyItem(content, lines, item, pythonDeclarations)
+		symbol := codeSymbol{Kind: kind, Start: lines[item.from].Start, End: lines[item.to-1].End, Context: context}
+		if kind == "" {
+			level.add(symbol)
+			continue
+		}
+		if container != "" {
+			name = container + "." + name
+			if kind == "function" {
+				symbol.Kind = "method"
+			}
+		}
+		symbol.Name = name
+
+		// The body starts at the first statement indented deeper than the signature
+		body := -1
+		for i := first + 1; i < item.to; i++ {
+			if lines[i].Code && !lines[i].Continued && lines[i].Indent > indent {
+				body = i
+				break
+			}
+		}
+		if kind != "class" || body < 0 || cs.measure(content[symbol.Start:symbol.End]) <= chunkSize {
+			level.add(symbol)
+			continue
+		}
+		symbol.End = lines[body].Start
+		level.add(symbol)
+		level.flush()
+		signature := content[lines[first].Start:lines[body].Start]
+		level.symbols = append(level.symbols, cs.collectPythonSymbols(content, lines, body, item.to, lines[body].Indent, context+signature, name, chunkSize)...)
+	}
+	level.flush()
+	return level.symbols
+}
+
+// pythonItems groups the lines [from, to) into items: a statement starting at
+// indent with its decorators, the comments right above it and its indented
+// body, or a comment standing on its own
+func pythonItems(content string, lines []codeLine, from, to, indent int) []codeItem {
+	var items []codeItem
+	start, comments := -1, -1
+	decorated := false
+	for i := from; i < to; i++ {
+		l := lines[i]
+		outdented := !l.Continued && !l.blank() && l.Indent <= indent
+		decorator := l.Code && strings.HasPrefix(strings.TrimSpace(content[l.Start:l.End]), "@")
+
+		if start >= 0 && outdented {
+			if decorated && l.Code {
+				decorated = decorator
+				continue // The declaration under its decorators
+			}
+			end := i
+			for end > start && lines[end-1].blank() {
+				end--
+			}
+			items = append(items, codeItem{start, end})
+			start = -1
+		}
+
+		if start < 0 {
+			if l.blank() {
+				if comments >= 0 {
+					items = append(items, codeItem{comments, i})
+					comments = -1
+				}
+				continue
+			}
+			if !l.Code && !l.Continued {
+				if comments < 0 {
+					comments = i
+				}
+				continue
+			}
+			start, decorated = i, decorator
+			if comments >= 0 {
+				start, comments = comments, -1
+			}
+		}
+	}
+	if start >= 0 {
+		end := to
+		for end > start && lines[end-1].blank() {
+			end--
+		}
+		items = append(items, codeItem{start, end})
+	} else if comments >= 0 {
+		items = append(items, codeItem{comments, to})
+	}
+	return items
+}
+
+// scanPythonLines splits Python code into lines, tracking indentation, open
+// brackets, strings and comments
+func scanPythonLines(content string) []codeLine {
+	var lines []codeLine
+	brackets := 0
+	quote := ""     // Delimiter of the open string
+	joined := false // The previous line ended with a backslash
+	line := codeLine{}
+	indented := true
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c == '\n' {
+			line.End = i + 1
+			lines = append(lines, line)
+			if len(quote) == 1 {
+				quote = "" // Unterminated single-quoted string
+			}
+			line = codeLine{Start: i + 1, Continued: brackets > 0 || quote != "" || joined}
+			indented, joined = true, false
+			continue
+		}
+		if indented {
+			if c == ' ' || c == '\t' {
+				line.Indent++
+				continue
+			}
+			indented = false
+		}
+		joined = false
+
+		if quote != "" {
+			line.Code = true
+			if c == '\\' && i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			} else if strings.HasPrefix(content[i:], quote) {
+				i += len(quote) - 1
+				quote, line.Last = "", c
+			}
+			continue
+		}
+
+		switch c {
+		case '#':
+			line.Comment = true
+			for i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			}
+		case '"', '\'':
+			quote = string(c)
+			if strings.HasPrefix(content[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+				i += 2
+			}
+			line.Code, line.Last = true, c
+		case ' ', '\t', '\r':
+		case '\\':
+			joined = true
+		default:
+			if strings.IndexByte("([{", c) >= 0 {
+				brackets++
+			} else if strings.IndexByte(")]}", c) >= 0 && brackets > 0 {
+				brackets--
+			}
+			line.Code, line.Last = true, c
+		}
+	}
+	if line.Start < len(content) {
+		line.End = len(content)
+		lines = append(lines, line)
+	}
+	return lines
+}
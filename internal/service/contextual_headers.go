@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dontizi/rlama/internal/client"
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// maxSummaryDocumentSize bounds the document text sent to the LLM writing the
+// contextual summaries, in characters
+const maxSummaryDocumentSize = 30000
+
+// contextSummaryPrompt asks for the sentence situating a chunk. The document
+// comes first so that the LLM server can reuse its cache for the chunks of the
+// same document.
+const contextSummaryPrompt = `<document>
+%s
+</document>
+
+Here is a chunk of the document above:
+<chunk>
+%s
+</chunk>
+
+Write one short sentence situating this chunk within the overall document, to improve search retrieval of the chunk. Answer only with the sentence.`
+
+// NewContextualHeaderSettings returns the contextual header settings selected by
+// the command line, nil when headers are not requested. Summaries and a
+// summary model imply headers.
+func NewContextualHeaderSettings(headers, summaries bool, model string) *domain.ContextualHeaderSettings {
+	if !headers && !summaries && model == "" {
+		return nil
+	}
+	return &domain.ContextualHeaderSettings{Summaries: summaries || model != "", Model: model}
+}
+
+// chunkContextualizer writes the contextual headers of chunks
+type chunkContextualizer struct {
+	llm      client.LLMClient // nil when no summaries are written
+	model    string
+	disabled bool // Summaries failed, headers keep the title and breadcrumb only
+}
+
+// newChunkContextualizer returns the contextualizer configured by the RAG, nil
+// when its chunks don't get contextual headers
+func newChunkContextualizer(ollamaClient *client.OllamaClient, rag *domain.RagSystem) *chunkContextualizer {
+	settings := rag.ContextualHeaders
+	if settings == nil {
+		return nil
+	}
+	contextualizer := &chunkContextualizer{}
+	if settings.Summaries {
+		contextualizer.model = settings.Model
+		if contextualizer.model == "" {
+			contextualizer.model = rag.ModelName
+		}
+		llm, err := newLLMClient(ollamaClient, contextualizer.model, rag.APIProfileName)
+		if err != nil {
+			fmt.Printf("Warning: contextual summaries disabled: %v\n", err)
+		} else {
+			contextualizer.llm = llm
+		}
+	}
+	return contextualizer
+}
+
+// addHeaders sets the contextual header of the chunks of a document
+func (cc *chunkContextualizer) addHeaders(doc *domain.Document, chunks []*domain.DocumentChunk) {
+	if cc == nil {
+		return
+	}
+
+	title := doc.Metadata.Title()
+	if title == "" {
+		title = doc.Name
+	}
+
+	var document string
+	if cc.llm != nil && !cc.disabled {
+		document = doc.Content
+		if len(document) > maxSummaryDocumentSize {
+			end := maxSummaryDocumentSize
+			for end > 0 && !utf8.RuneStart(document[end]) {
+				end--
+			}
+			document = document[:end]
+		}
+		fmt.Printf("Writing contextual summaries for the %d chunks of '%s'...\n", len(chunks), doc.Name)
+	}
+
+	var tree *headingSection
+	for _, chunk := range chunks {
+		lines := []string{"Document: " + title}
+		breadcrumb := chunk.Metadata[domain.ChunkBreadcrumb]
+		if breadcrumb == "" && hasHeadings(doc) {
+			if tree == nil {
+				tree = buildHeadingTree(doc.Content)
+			}
+			breadcrumb = tree.sectionAt(chunk.StartPos).Breadcrumb()
+		}
+		if breadcrumb != "" {
+			lines = append(lines, "Section: "+breadcrumb)
+		}
+		if document != "" && !cc.disabled {
+			if summary := cc.summarize(document, chunk.Content); summary != "" {
+				lines = append(lines, summary)
+			}
+		}
+		chunk.ContextHeader = strings.Join(lines, "\n")
+	}
+}
+
+// summarize asks the LLM for the sentence situating a chunk in its document.
+// The first failure disables the summaries for the rest of the run.
+func (cc *chunkContextualizer) summarize(document, chunk string) string {
+	response, err := cc.llm.GenerateCompletion(cc.model, fmt.Sprintf(contextSummaryPrompt, document, chunk))
+	if err != nil {
+		fmt.Printf("Warning: contextual summaries disabled, %s failed: %v\n", cc.model, err)
+		cc.disabled = true
+		return ""
+	}
+
+	// Keep the first line of the answer
+	summary := strings.TrimSpace(response)
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = strings.TrimSpace(summary[:i])
+	}
+	return summary
+}
+
+// hasHeadings reports whether a document is markdown or HTML, whose headings
+// give the breadcrumb of chunks cut without following them
+func hasHeadings(doc *domain.Document) bool {
+	switch strings.ToLower(filepath.Ext(doc.Path)) {
+	case ".md", ".markdown", ".html", ".htm":
+		return true
+	}
+	return false
+}
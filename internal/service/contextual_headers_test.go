@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// summaryLLM answers the contextual summary prompts
+type summaryLLM struct {
+	prompts []string
+	err     error
+}
+
+func (l *summaryLLM) GenerateCompletion(model, prompt string) (string, error) {
+	l.prompts = append(l.prompts, prompt)
+	if l.err != nil {
+		return "", l.err
+	}
+	return "This chunk is about returns.\nExtra line", nil
+}
+
+func (l *summaryLLM) CheckLLMAndModel(modelName string) error { return nil }
+
+func TestContextualHeadersAddTitleAndBreadcrumb(t *testing.T) {
+	content := "# Policies\n\nIntro.\n\n## Returns\n\n### Refunds\n\nThe limit is 30 days.\n\n## Shipping\n\nFree above 50."
+	doc := domain.NewDocument("policies.md", content)
+	doc.Metadata.Set(domain.MetaTitle, "Store policies")
+
+	refunds := domain.NewDocumentChunk(doc, "The limit is 30 days.", strings.Index(content, "The limit"), 0, 0)
+	shipping := domain.NewDocumentChunk(doc, "Free above 50.", strings.Index(content, "Free"), 0, 1)
+	intro := domain.NewDocumentChunk(doc, "# Policies", 0, 0, 2)
+
+	rag := &domain.RagSystem{ModelName: "llama3", ContextualHeaders: &domain.ContextualHeaderSettings{}}
+	newChunkContextualizer(nil, rag).addHeaders(doc, []*domain.DocumentChunk{refunds, shipping, intro})
+
+	assert.Equal(t, "Document: Store policies\nSection: Policies > Returns > Refunds", refunds.ContextHeader)
+	assert.Equal(t, "Document: Store policies\nSection: Policies > Shipping", shipping.ContextHeader)
+	assert.Equal(t, "Document: Store policies\nSection: Policies", intro.ContextHeader)
+
+	// The content stays as written, the header is only embedded and indexed
+	assert.Equal(t, "The limit is 30 days.", refunds.Content)
+	assert.Equal(t, refunds.ContextHeader+"\n\nThe limit is 30 days.", refunds.IndexedContent())
+}
+
+func TestContextualHeadersWithSummaries(t *testing.T) {
+	doc := domain.NewDocument("notes.txt", "Returns are accepted within 30 days.")
+	chunk := domain.NewDocumentChunk(doc, "within 30 days", 0, 0, 0)
+
+	llm := &summaryLLM{}
+	contextualizer := &chunkContextualizer{llm: llm, model: "llama3"}
+	contextualizer.addHeaders(doc, []*domain.DocumentChunk{chunk})
+
+	assert.Equal(t, "Document: notes.txt\nThis chunk is about returns.", chunk.ContextHeader)
+	require.Len(t, llm.prompts, 1)
+	assert.Contains(t, llm.prompts[0], "<document>\nReturns are accepted within 30 days.\n</document>")
+	assert.Contains(t, llm.prompts[0], "<chunk>\nwithin 30 days\n</chunk>")
+}
+
+func TestContextualSummariesStopAfterAFailure(t *testing.T) {
+	doc := domain.NewDocument("notes.txt", "First part. Second part.")
+	chunks := []*domain.DocumentChunk{
+		domain.NewDocumentChunk(doc, "First part.", 0, 11, 0),
+		domain.NewDocumentChunk(doc, "Second part.", 12, 24, 1),
+	}
+
+	llm := &summaryLLM{err: errors.New("model not found")}
+	contextualizer := &chunkContextualizer{llm: llm, model: "missing"}
+	contextualizer.addHeaders(doc, chunks)
+
+	assert.Len(t, llm.prompts, 1)
+	for _, chunk := range chunks {
+		assert.Equal(t, "Document: notes.txt", chunk.ContextHeader)
+	}
+}
+
+func TestChunksWithoutContextualHeaders(t *testing.T) {
+	assert.Nil(t, NewContextualHeaderSettings(false, false, ""))
+	assert.Equal(t, &domain.ContextualHeaderSettings{Summaries: true, Model: "qwen"}, NewContextualHeaderSettings(false, false, "qwen"))
+
+	rag := &domain.RagSystem{ModelName: "llama3"}
+	doc := domain.NewDocument("notes.txt", "Some text.")
+	chunk := domain.NewDocumentChunk(doc, "Some text.", 0, 10, 0)
+	newChunkContextualizer(nil, rag).addHeaders(doc, []*domain.DocumentChunk{chunk})
+
+	assert.Empty(t, chunk.ContextHeader)
+	assert.Equal(t, "Some text.", chunk.IndexedContent())
+}
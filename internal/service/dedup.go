@@ -0,0 +1,259 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// Near-duplicate policies. Near-duplicates are indexed unless a policy is chosen.
+const (
+	DedupOff        = "off"         // Index every document
+	DedupSkip       = "skip"        // Do not index documents that duplicate an indexed one
+	DedupKeepNewest = "keep-newest" // Keep only the most recently modified copy
+	DedupAlias      = "alias"       // Do not index the copy, record its path as an alias of the indexed one
+)
+
+// DefaultDedupThreshold is the fingerprint similarity above which two documents
+// are considered near-duplicates (at most 6 of the 64 SimHash bits differ)
+const DefaultDedupThreshold = 0.9
+
+// NewDedupSettings builds near-duplicate settings from command line values. An
+// empty policy returns nil, which keeps the settings of the RAG; "off" returns
+// settings disabling the detection.
+func NewDedupSettings(policy string, threshold float64) (*domain.DedupSettings, error) {
+	switch policy {
+	case "":
+		return nil, nil
+	case DedupOff, DedupSkip, DedupKeepNewest, DedupAlias:
+	default:
+		return nil, fmt.Errorf("unknown duplicate policy '%s' (options: %s, %s, %s, %s)",
+			policy, DedupSkip, DedupKeepNewest, DedupAlias, DedupOff)
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("duplicate threshold must be between 0 and 1, got %g", threshold)
+	}
+	return &domain.DedupSettings{Policy: policy, Threshold: threshold}, nil
+}
+
+// applyDedupSettings saves the near-duplicate settings chosen for an ingest on
+// the RAG; nil keeps those of the RAG and the "off" policy removes them
+func applyDedupSettings(rag *domain.RagSystem, settings *domain.DedupSettings) {
+	if settings == nil {
+		return
+	}
+	if settings.Policy == DedupOff {
+		rag.Dedup = nil
+		return
+	}
+	rag.Dedup = settings
+}
+
+// collapseDuplicates applies the near-duplicate settings of the RAG to documents
+// about to be added to it, prints what was collapsed and removes the indexed
+// documents superseded by a newer copy. The documents left out are remembered
+// on the RAG: until they change, later additions leave them out without
+// comparing or reporting them again. The documents whose ID is in replaced are
+// about to be removed, and are not compared.
+func collapseDuplicates(rag *domain.RagSystem, docs []*domain.Document, replaced []string) []*domain.Document {
+	if rag.Dedup == nil {
+		return docs
+	}
+
+	var incoming []*domain.Document
+	for _, doc := range docs {
+		if hash, ok := rag.CollapsedDocuments[doc.Path]; !ok || hash != documentHash(doc) {
+			incoming = append(incoming, doc)
+		}
+	}
+
+	excluded := make(map[string]bool, len(replaced))
+	for _, id := range replaced {
+		excluded[id] = true
+	}
+	unique, report := deduplicateDocuments(rag, incoming, excluded)
+	report.Print()
+	for _, id := range report.Removed {
+		if doc := rag.GetDocumentByID(id); doc != nil {
+			rememberCollapsed(rag, doc)
+		}
+		rag.RemoveDocument(id)
+	}
+
+	kept := make(map[*domain.Document]bool, len(unique))
+	for _, doc := range unique {
+		kept[doc] = true
+	}
+	for _, doc := range incoming {
+		if kept[doc] {
+			delete(rag.CollapsedDocuments, doc.Path)
+		} else {
+			rememberCollapsed(rag, doc)
+		}
+	}
+	return unique
+}
+
+// rememberCollapsed records a document left out as a near-duplicate
+func rememberCollapsed(rag *domain.RagSystem, doc *domain.Document) {
+	if rag.CollapsedDocuments == nil {
+		rag.CollapsedDocuments = make(map[string]string)
+	}
+	rag.CollapsedDocuments[doc.Path] = documentHash(doc)
+}
+
+// assignDocumentIDs gives the documents about to be added to a RAG an ID no
+// other document uses. Documents are named after their file, so copies in other
+// folders take their path as ID: removing one, e.g. when a newer copy supersedes
+// it, must not remove the other or its chunks.
+func assignDocumentIDs(rag *domain.RagSystem, docs []*domain.Document) {
+	paths := make(map[string]string, len(rag.Documents)+len(docs))
+	for _, doc := range rag.Documents {
+		paths[doc.ID] = doc.Path
+	}
+	for _, doc := range docs {
+		if path, used := paths[doc.ID]; used && path != doc.Path {
+			doc.ID = doc.Path
+		}
+		paths[doc.ID] = doc.Path
+	}
+}
+
+// DuplicateMatch describes a document collapsed into another one
+type DuplicateMatch struct {
+	Path        string  // Path of the collapsed document
+	DuplicateOf string  // Path of the document that was kept
+	Similarity  float64 // Fingerprint similarity between the two
+	Action      string  // skip, keep-newest or alias
+}
+
+// DedupReport lists the near-duplicates collapsed while adding documents
+type DedupReport struct {
+	Matches []DuplicateMatch
+	Removed []string // IDs of indexed documents replaced by a newer copy
+}
+
+// Print displays the collapsed documents, if any
+func (r *DedupReport) Print() {
+	if len(r.Matches) == 0 {
+		return
+	}
+
+	fmt.Printf("Collapsed %d near-duplicate document(s):\n", len(r.Matches))
+	for _, match := range r.Matches {
+		verb := "skipped, duplicate of"
+		switch match.Action {
+		case DedupAlias:
+			verb = "aliased to"
+		case DedupKeepNewest:
+			verb = "superseded by"
+		}
+		fmt.Printf("  - %s %s %s (%.0f%% similar)\n", match.Path, verb, match.DuplicateOf, match.Similarity*100)
+	}
+}
+
+// deduplicateDocuments filters near-duplicates out of the incoming documents
+// with the settings of the RAG, comparing them with the documents already in
+// the RAG, except the excluded IDs, and with each other. With DedupKeepNewest
+// an indexed document may lose to a newer incoming copy: it is listed in the
+// report for removal.
+func deduplicateDocuments(rag *domain.RagSystem, incoming []*domain.Document, excluded map[string]bool) ([]*domain.Document, *DedupReport) {
+	report := &DedupReport{}
+	if rag.Dedup == nil || rag.Dedup.Policy == DedupOff {
+		return incoming, report
+	}
+	policy := rag.Dedup.Policy
+	threshold := rag.Dedup.Threshold
+	if threshold <= 0 {
+		threshold = DefaultDedupThreshold
+	}
+
+	// Documents currently kept, indexed ones first
+	kept := make([]*domain.Document, 0, len(rag.Documents)+len(incoming))
+	indexed := make(map[*domain.Document]bool, len(rag.Documents))
+	for _, doc := range rag.Documents {
+		if excluded[doc.ID] {
+			continue
+		}
+		doc.EnsureFingerprint()
+		kept = append(kept, doc)
+		indexed[doc] = true
+	}
+
+	for _, doc := range incoming {
+		original, similarity := findNearDuplicate(kept, doc, threshold)
+		if original == nil {
+			kept = append(kept, doc)
+			continue
+		}
+
+		switch policy {
+		case DedupAlias:
+			// The watchers see the same copies at every check
+			if !slices.Contains(original.Aliases, doc.Path) {
+				original.Aliases = append(original.Aliases, doc.Path)
+			}
+			report.Matches = append(report.Matches, DuplicateMatch{doc.Path, original.Path, similarity, policy})
+
+		case DedupKeepNewest:
+			if !doc.ModifiedAt().After(original.ModifiedAt()) {
+				report.Matches = append(report.Matches, DuplicateMatch{doc.Path, original.Path, similarity, policy})
+				continue
+			}
+			// The incoming copy is newer: it replaces the one kept so far
+			report.Matches = append(report.Matches, DuplicateMatch{original.Path, doc.Path, similarity, policy})
+			for i, k := range kept {
+				if k == original {
+					kept[i] = doc
+					break
+				}
+			}
+			if indexed[original] {
+				report.Removed = append(report.Removed, original.ID)
+			}
+
+		default:
+			report.Matches = append(report.Matches, DuplicateMatch{doc.Path, original.Path, similarity, DedupSkip})
+		}
+	}
+
+	// Keep the incoming documents that survived, in their original order
+	survivors := make(map[*domain.Document]bool, len(kept))
+	for _, doc := range kept {
+		survivors[doc] = true
+	}
+	var unique []*domain.Document
+	for _, doc := range incoming {
+		if survivors[doc] {
+			unique = append(unique, doc)
+		}
+	}
+
+	sort.SliceStable(report.Matches, func(i, j int) bool {
+		return report.Matches[i].DuplicateOf < report.Matches[j].DuplicateOf
+	})
+	return unique, report
+}
+
+// findNearDuplicate returns the most similar document at or above the threshold
+func findNearDuplicate(docs []*domain.Document, doc *domain.Document, threshold float64) (*domain.Document, float64) {
+	fingerprint := doc.EnsureFingerprint()
+	if fingerprint == 0 {
+		return nil, 0
+	}
+
+	var best *domain.Document
+	bestSimilarity := 0.0
+	for _, candidate := range docs {
+		if candidate.Fingerprint == 0 {
+			continue
+		}
+		similarity := domain.FingerprintSimilarity(fingerprint, candidate.Fingerprint)
+		if similarity >= threshold && similarity > bestSimilarity {
+			best, bestSimilarity = candidate, similarity
+		}
+	}
+	return best, bestSimilarity
+}
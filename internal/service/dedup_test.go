@@ -0,0 +1,222 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dedupSample = `RLAMA indexes local documents and answers questions about them with a local model.
+Documents are split into chunks, embedded with Ollama and stored with their vectors.
+At query time the most similar chunks are retrieved, reranked and passed to the model as context.
+The index can be updated incrementally when files change on disk or on a watched website.`
+
+// dedupDocument creates a document modified at the given day of 2024
+func dedupDocument(path, content string, day int) *domain.Document {
+	doc := domain.NewDocument(path, content)
+	doc.ID = path
+	doc.Metadata.SetTime(domain.MetaFileModified, time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC))
+	return doc
+}
+
+func TestDeduplicateDocumentsSkip(t *testing.T) {
+	rag := domain.NewRagSystem("test", "model")
+	rag.AddDocument(dedupDocument("docs/guide.md", dedupSample, 1))
+
+	incoming := []*domain.Document{
+		dedupDocument("mirror/guide.md", dedupSample+"\nCopyright 2024 Example Corp.", 2),
+		dedupDocument("docs/bread.md", "Bake the bread for forty minutes, then let it cool on a rack before slicing it.", 2),
+	}
+
+	rag.Dedup = &domain.DedupSettings{Policy: DedupSkip}
+	unique, report := deduplicateDocuments(rag, incoming, nil)
+	require.Len(t, unique, 1)
+	assert.Equal(t, "docs/bread.md", unique[0].Path)
+	require.Len(t, report.Matches, 1)
+	assert.Equal(t, DuplicateMatch{"mirror/guide.md", "docs/guide.md", report.Matches[0].Similarity, DedupSkip}, report.Matches[0])
+	assert.Empty(t, report.Removed)
+
+	// Near-duplicates are indexed unless a policy is saved on the RAG
+	rag.Dedup = nil
+	unique, _ = deduplicateDocuments(rag, incoming, nil)
+	assert.Len(t, unique, 2)
+}
+
+func TestDeduplicateDocumentsKeepNewest(t *testing.T) {
+	rag := domain.NewRagSystem("test", "model")
+	rag.AddDocument(dedupDocument("v2/guide.md", dedupSample, 5))
+	rag.Dedup = &domain.DedupSettings{Policy: DedupKeepNewest}
+
+	// An older copy loses, a newer one replaces the indexed document
+	unique, report := deduplicateDocuments(rag, []*domain.Document{
+		dedupDocument("v1/guide.md", dedupSample, 1),
+		dedupDocument("v3/guide.md", dedupSample, 9),
+	}, nil)
+
+	require.Len(t, unique, 1)
+	assert.Equal(t, "v3/guide.md", unique[0].Path)
+	assert.Equal(t, []string{"v2/guide.md"}, report.Removed)
+	assert.Len(t, report.Matches, 2)
+}
+
+// TestCollapseDuplicatesKeepsNamesakes checks that a newer copy with the same
+// file name removes only the document it supersedes
+func TestCollapseDuplicatesKeepsNamesakes(t *testing.T) {
+	rag := domain.NewRagSystem("test", "model")
+	rag.Dedup = &domain.DedupSettings{Policy: DedupKeepNewest}
+	unrelated := dedupDocument("manual/guide.md", "Water the plants of the garden every morning before the sun gets too hot.", 1)
+	old := dedupDocument("docs/v1/guide.md", dedupSample, 2)
+	unrelated.ID, old.ID = "guide.md", "guide.md" // Documents are named after their file
+	assignDocumentIDs(rag, []*domain.Document{unrelated, old})
+	for _, doc := range []*domain.Document{unrelated, old} {
+		rag.AddDocument(doc)
+		rag.AddChunk(domain.NewDocumentChunk(doc, doc.Content, 0, len(doc.Content), 0))
+	}
+	assert.NotEqual(t, unrelated.ID, old.ID)
+
+	newer := dedupDocument("docs/v2/guide.md", dedupSample, 9)
+	newer.ID = "guide.md"
+	unique := collapseDuplicates(rag, []*domain.Document{newer}, nil)
+	assignDocumentIDs(rag, unique)
+
+	require.Equal(t, []*domain.Document{newer}, unique)
+	require.Len(t, rag.Documents, 1)
+	assert.Equal(t, "manual/guide.md", rag.Documents[0].Path)
+	require.Len(t, rag.Chunks, 1)
+	assert.Equal(t, unrelated.ID, rag.Chunks[0].DocumentID)
+	assert.NotEqual(t, unrelated.ID, newer.ID)
+}
+
+func TestDeduplicateDocumentsAlias(t *testing.T) {
+	rag := domain.NewRagSystem("test", "model")
+	rag.Dedup = &domain.DedupSettings{Policy: DedupAlias}
+	incoming := []*domain.Document{
+		dedupDocument("docs/guide.md", dedupSample, 1),
+		dedupDocument("copy/guide.md", dedupSample, 2),
+	}
+
+	unique, report := deduplicateDocuments(rag, incoming, nil)
+	require.Len(t, unique, 1)
+	assert.Equal(t, []string{"copy/guide.md"}, unique[0].Aliases)
+	assert.Len(t, report.Matches, 1)
+}
+
+// TestFileWatcherCollapsesDuplicates checks that the watcher applies the
+// settings saved on the RAG and doesn't reload the aliased copies
+func TestFileWatcherCollapsesDuplicates(t *testing.T) {
+	rs, _ := newQueryTestService(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "guide.md"), []byte(dedupSample), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "copy.md"), []byte(dedupSample), 0644))
+
+	rag := domain.NewRagSystem("watch-test", "llama3")
+	rag.EmbeddingModel = "fake-embed"
+	rag.WatchEnabled = true
+	rag.WatchedDir = dir
+	rag.WatchOptions.ChunkSize = 1000
+	rag.WatchOptions.ChunkOverlap = 200
+	rag.Dedup = &domain.DedupSettings{Policy: DedupAlias}
+
+	watcher := NewFileWatcher(rs)
+	added, err := watcher.CheckAndUpdateRag(rag)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	require.Len(t, rag.Documents, 1)
+	assert.Len(t, rag.Documents[0].Aliases, 1)
+
+	// The next check finds nothing new
+	rag.LastWatchedAt = time.Time{}
+	added, err = watcher.CheckAndUpdateRag(rag)
+	require.NoError(t, err)
+	assert.Zero(t, added)
+	assert.Len(t, rag.Documents[0].Aliases, 1)
+}
+
+// TestFileWatcherRemembersSkippedCopies checks that a copy skipped by the
+// watcher is neither compared, reported nor audited again by the next checks
+func TestFileWatcherRemembersSkippedCopies(t *testing.T) {
+	rs, _ := newQueryTestService(t)
+	dir := t.TempDir()
+	content := dedupSample + "\nQuestions go to support@example.com."
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "guide.md"), []byte(content), 0644))
+
+	rag := domain.NewRagSystem("watch-test", "llama3")
+	rag.EmbeddingModel = "fake-embed"
+	rag.WatchEnabled = true
+	rag.WatchedDir = dir
+	rag.WatchOptions.ChunkSize = 1000
+	rag.WatchOptions.ChunkOverlap = 200
+	rag.Dedup = &domain.DedupSettings{Policy: DedupSkip}
+	rag.Redaction = &domain.RedactionSettings{Mode: domain.RedactMask}
+
+	watcher := NewFileWatcher(rs)
+	check := func() (int, string) {
+		rag.LastWatchedAt = time.Time{}
+		var added int
+		output := captureStdout(t, func() {
+			var err error
+			added, err = watcher.CheckAndUpdateRag(rag)
+			require.NoError(t, err)
+		})
+		return added, output
+	}
+
+	added, _ := check()
+	assert.Equal(t, 1, added)
+	audited := len(rag.RedactionAudit)
+	require.Positive(t, audited)
+
+	// The copy is skipped before being redacted
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "copy.md"), []byte(content), 0644))
+	added, output := check()
+	assert.Zero(t, added)
+	assert.Contains(t, output, "Collapsed 1 near-duplicate")
+	assert.Len(t, rag.RedactionAudit, audited)
+	assert.Contains(t, rag.CollapsedDocuments, filepath.Join(dir, "copy.md"))
+
+	// and left out of the next checks
+	added, output = check()
+	assert.Zero(t, added)
+	assert.NotContains(t, output, "near-duplicate")
+	assert.Len(t, rag.RedactionAudit, audited)
+	require.Len(t, rag.Documents, 1)
+	assert.Equal(t, filepath.Join(dir, "guide.md"), rag.Documents[0].Path)
+}
+
+// captureStdout returns what fn prints
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestNewDedupSettings(t *testing.T) {
+	settings, err := NewDedupSettings("", DefaultDedupThreshold)
+	require.NoError(t, err)
+	assert.Nil(t, settings)
+
+	settings, err = NewDedupSettings(DedupAlias, 0.8)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.DedupSettings{Policy: DedupAlias, Threshold: 0.8}, settings)
+
+	_, err = NewDedupSettings("merge", DefaultDedupThreshold)
+	assert.Error(t, err)
+	_, err = NewDedupSettings(DedupSkip, 1.5)
+	assert.Error(t, err)
+}
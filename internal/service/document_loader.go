@@ -2,16 +2,20 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dontizi/rlama/internal/domain"
 	"github.com/dontizi/rlama/internal/utils"
@@ -19,16 +23,38 @@ import (
 
 // DocumentLoaderOptions defines filtering options for document loading
 type DocumentLoaderOptions struct {
-	ExcludeDirs      []string
-	ExcludeExts      []string
-	ProcessExts      []string
-	ChunkSize        int
-	ChunkOverlap     int
-	ChunkingStrategy string  // Chunking strategy: "fixed", "semantic", "hybrid", "hierarchical"
-	APIProfileName   string  // Name of the API profile to use
-	EnableReranker   bool    // Whether to enable reranking - now true by default
-	RerankerModel    string  // Model to use for reranking
-	RerankerWeight   float64 // Weight for reranker scores (0-1)
+	ExcludeDirs       []string
+	ExcludeExts       []string
+	ProcessExts       []string
+	ChunkSize         int
+	ChunkOverlap      int
+	RowsPerChunk      int                              // Table rows per chunk for CSV and spreadsheets (0 = DefaultRowsPerChunk)
+	ChunkTokens       int                              // Chunk size in tokens, replaces ChunkSize when set
+	OverlapTokens     int                              // Overlap between chunks in tokens when ChunkTokens is set
+	ChunkingStrategy  string                           // Chunking strategy: "fixed", "semantic", "hybrid", "hierarchical", "embedding"
+	APIProfileName    string                           // Name of the API profile to use
+	EmbeddingModel    string                           // Model embedding the chunks of a new RAG (empty = DefaultEmbeddingModel)
+	EmbeddingProfile  string                           // API profile of the OpenAI-compatible server embedding the chunks of a new RAG (empty = Ollama)
+	EmbeddingPrefixes *domain.EmbeddingPrefixes        // Query and passage prefixes of a new RAG (nil = those its embedding model is known to expect)
+	EnableReranker    bool                             // Whether to enable reranking - now true by default
+	RerankerModel     string                           // Model to use for reranking
+	RerankerWeight    float64                          // Weight for reranker scores (0-1)
+	IncludePatterns   []string                         // Glob patterns a file must match to be loaded (gitignore syntax)
+	ExcludePatterns   []string                         // Additional gitignore-syntax patterns to exclude
+	UseGitignore      bool                             // Honour .gitignore files in addition to .rlamaignore
+	Workers           int                              // Number of files extracted in parallel (0 = number of CPUs)
+	FileTimeout       time.Duration                    // Maximum extraction time per file (0 = DefaultFileTimeout, negative = no limit)
+	ArchiveDepth      int                              // Nesting of zip/tar archives opened as folders (0 = DefaultMaxArchiveDepth, negative = never)
+	MaxArchiveSize    int64                            // Bytes extracted per top-level archive (0 = DefaultMaxArchiveSize)
+	Dedup             *domain.DedupSettings            // Near-duplicate handling saved on the RAG (nil = keep the RAG settings)
+	BoilerplateDocs   int                              // Documents a line must appear in to be boilerplate (0 = DefaultBoilerplateMinDocs, negative = keep boilerplate)
+	BoilerplateRatio  float64                          // Share of the documents a line must appear in to be boilerplate (0 = DefaultBoilerplateRatio)
+	Redaction         *domain.RedactionSettings        // Personal data redaction saved on the RAG (nil = keep the RAG settings)
+	ContextualHeaders *domain.ContextualHeaderSettings // Contextual chunk headers saved on the RAG (nil = keep the RAG settings)
+	EvalQuestions     []RetrievalQuestion              // Question set the "auto" strategy ranks chunking configurations with
+	Stdin             io.Reader                        // Content of the StdinSource
+	StdinName         string                           // Name of the document read from Stdin (default "stdin-" and a hash of its content)
+	StdinContentType  string                           // Content type of the document read from Stdin, selects its extractor
 }
 
 // NewDocumentLoaderOptions creates default document loader options with reranking enabled
@@ -68,6 +94,8 @@ func NewDocumentLoader() *DocumentLoader {
 			".go":     true,
 			".py":     true,
 			".js":     true,
+			".jsx":    true,
+			".mjs":    true,
 			".java":   true,
 			".c":      true,
 			".cpp":    true,
@@ -137,28 +165,25 @@ func findExternalExtractor() string {
 }
 
 // LoadDocumentsFromFolderWithOptions loads documents with filtering options
+// and prints a summary of the files that could not be loaded
 func (dl *DocumentLoader) LoadDocumentsFromFolderWithOptions(folderPath string, options DocumentLoaderOptions) ([]*domain.Document, error) {
-	var documents []*domain.Document
-	var supportedFiles []string
-	var unsupportedFiles []string
-	var excludedFiles []string
+	documents, report, err := dl.LoadDocumentsFromFolderWithReport(folderPath, options)
+	if report != nil {
+		report.PrintFailures()
+	}
+	return documents, err
+}
 
+// LoadDocumentsFromFolderWithReport loads documents with filtering options and returns
+// a report describing excluded, unsupported and failed files alongside the documents
+func (dl *DocumentLoader) LoadDocumentsFromFolderWithReport(folderPath string, options DocumentLoaderOptions) ([]*domain.Document, *LoadReport, error) {
 	// Normalize extensions for easier comparison
-	for i, ext := range options.ExcludeExts {
-		if !strings.HasPrefix(ext, ".") {
-			options.ExcludeExts[i] = "." + ext
-		}
-	}
-	for i, ext := range options.ProcessExts {
-		if !strings.HasPrefix(ext, ".") {
-			options.ProcessExts[i] = "." + ext
-		}
-	}
+	normalizeExtensions(&options)
 
 	// Ensure folderPath is absolute
 	absPath, err := filepath.Abs(folderPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to resolve absolute path: %w", err)
+		return nil, nil, fmt.Errorf("unable to resolve absolute path: %w", err)
 	}
 	folderPath = absPath
 
@@ -167,177 +192,294 @@ func (dl *DocumentLoader) LoadDocumentsFromFolderWithOptions(folderPath string,
 	if os.IsNotExist(err) {
 		// Try to create the folder
 		if err := os.MkdirAll(folderPath, 0755); err != nil {
-			return nil, fmt.Errorf("folder '%s' does not exist and cannot be created: %w", folderPath, err)
+			return nil, nil, fmt.Errorf("folder '%s' does not exist and cannot be created: %w", folderPath, err)
 		}
 		fmt.Printf("Folder '%s' has been created.\n", folderPath)
 		// Get information about the newly created folder
 		info, err = os.Stat(folderPath)
 		if err != nil {
-			return nil, fmt.Errorf("unable to access folder '%s': %w", folderPath, err)
+			return nil, nil, fmt.Errorf("unable to access folder '%s': %w", folderPath, err)
 		}
 	} else if err != nil {
-		return nil, fmt.Errorf("unable to access folder '%s': %w", folderPath, err)
+		return nil, nil, fmt.Errorf("unable to access folder '%s': %w", folderPath, err)
 	}
 
 	if !info.IsDir() {
-		return nil, fmt.Errorf("the specified path is not a folder: %s", folderPath)
+		return nil, nil, fmt.Errorf("the specified path is not a folder: %s", folderPath)
 	}
 
-	// Preliminary file check - recursively walk the directory
-	err = filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("Warning: error accessing path %s: %v\n", path, err)
-			return nil // Skip this file but continue walking
-		}
+	// Stage 1: walk the directory and classify files
+	report := &LoadReport{}
+	archives := newArchiveExpander(options)
+	defer archives.cleanup()
+	supportedFiles, err := dl.walkFolder(folderPath, options, report, archives)
+	if err != nil {
+		return nil, report, fmt.Errorf("error while analyzing folder: %w", err)
+	}
 
-		// Check if this directory should be excluded
-		if info.IsDir() {
-			for _, excludeDir := range options.ExcludeDirs {
-				if strings.Contains(path, excludeDir) {
-					fmt.Printf("Excluding directory: %s\n", path)
-					return filepath.SkipDir
-				}
+	// Display info about found files
+	if len(supportedFiles) == 0 {
+		if len(report.Unsupported) == 0 && len(report.Excluded) == 0 {
+			return nil, report, fmt.Errorf("folder '%s' is empty or contains only hidden files. Please add documents before creating a RAG", folderPath)
+		} else if len(report.Excluded) > 0 {
+			return nil, report, fmt.Errorf("no supported files found in '%s' after applying exclusion rules. %d unsupported, %d excluded",
+				folderPath, len(report.Unsupported), len(report.Excluded))
+		} else {
+			extensionsMsg := "Supported extensions: "
+			for ext := range dl.supportedExtensions {
+				extensionsMsg += ext + " "
 			}
-			return nil
+			return nil, report, fmt.Errorf("no supported files found in '%s'. %d unsupported files detected.\n%s",
+				folderPath, len(report.Unsupported), extensionsMsg)
 		}
+	}
 
-		// Ignore hidden files (starting with .)
-		if strings.HasPrefix(filepath.Base(path), ".") {
-			return nil
+	fmt.Printf("Found %d supported files, %d unsupported files, and %d excluded files.\n",
+		len(supportedFiles), len(report.Unsupported), len(report.Excluded))
+
+	// Try to install dependencies if possible
+	dl.tryInstallDependencies(supportedFiles)
+
+	// Stages 2 and 3: extract and clean with a bounded worker pool
+	documents := dl.runLoadPipeline(folderPath, supportedFiles, options, report)
+	archives.rewrite(folderPath, documents, report)
+	for _, doc := range documents {
+		fmt.Printf("Document added: %s (%d characters)\n", doc.Name, len(doc.Content))
+	}
+	report.Loaded = len(documents)
+
+	if len(documents) == 0 {
+		return nil, report, fmt.Errorf("no documents with valid content found in folder '%s'", folderPath)
+	}
+
+	return documents, report, nil
+}
+
+// normalizeExtensions makes sure every extension filter starts with a dot
+func normalizeExtensions(options *DocumentLoaderOptions) {
+	for i, ext := range options.ExcludeExts {
+		if !strings.HasPrefix(ext, ".") {
+			options.ExcludeExts[i] = "." + ext
+		}
+	}
+	for i, ext := range options.ProcessExts {
+		if !strings.HasPrefix(ext, ".") {
+			options.ProcessExts[i] = "." + ext
 		}
+	}
+}
 
-		ext := strings.ToLower(filepath.Ext(path))
+// walkFolder recursively walks folderPath and returns the supported files in walk order.
+// Excluded and unsupported files as well as access errors are recorded in the report.
+// Archives are opened as virtual folders when archives is not nil.
+func (dl *DocumentLoader) walkFolder(folderPath string, options DocumentLoaderOptions, report *LoadReport, archives *archiveExpander) ([]string, error) {
+	matcher := NewIgnoreMatcher(options.IncludePatterns, options.ExcludePatterns, options.UseGitignore)
+	return dl.walkTree(folderPath, "", folderPath, 0, options, matcher, report, archives)
+}
 
-		// Check if the extension is in the exclude list
-		for _, excludeExt := range options.ExcludeExts {
-			if ext == excludeExt {
-				excludedFiles = append(excludedFiles, path)
-				return nil
+// walkTree walks root, whose path relative to the loaded folder is relBase. Inside
+// archives (depth > 0) files are displayed as displayBase + "/" + their path in the archive.
+func (dl *DocumentLoader) walkTree(root, relBase, displayBase string, depth int, options DocumentLoaderOptions, matcher *IgnoreMatcher, report *LoadReport, archives *archiveExpander) ([]string, error) {
+	var supportedFiles []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		relPath := relBase
+		displayPath := displayBase
+		if path != root {
+			if rel, err := filepath.Rel(root, path); err == nil {
+				relPath = joinRelPath(relBase, filepath.ToSlash(rel))
+				displayPath = path
+				if depth > 0 {
+					displayPath = displayBase + "/" + filepath.ToSlash(rel)
+				}
 			}
 		}
 
-		// If we're only processing specific extensions
-		if len(options.ProcessExts) > 0 {
-			shouldProcess := false
-			for _, processExt := range options.ProcessExts {
-				if ext == processExt {
-					shouldProcess = true
-					break
-				}
+		if err != nil {
+			report.addFailure(displayPath, LoadStageWalk, err)
+			return nil // Skip this file but continue walking
+		}
+
+		// Check if this directory should be excluded
+		if info.IsDir() {
+			if relPath != relBase && dl.isExcludedDir(displayPath, relPath, options, matcher) {
+				fmt.Printf("Excluding directory: %s\n", displayPath)
+				return filepath.SkipDir
 			}
+			// Pick up the .rlamaignore/.gitignore rules of this directory
+			matcher.LoadDir(path, relPath)
+			return nil
+		}
 
-			if !shouldProcess {
-				excludedFiles = append(excludedFiles, path)
+		// Descend into archives as if they were directories
+		if archives.canOpen(path, depth) {
+			if strings.HasPrefix(info.Name(), ".") || dl.isExcludedArchive(displayPath, relPath, options, matcher) {
+				report.Excluded = append(report.Excluded, displayPath)
 				return nil
 			}
+			dir, err := archives.extract(path)
+			if err != nil {
+				report.addFailure(displayPath, LoadStageArchive, err)
+				return nil
+			}
+			files, err := dl.walkTree(dir, relPath, displayPath+"!", depth+1, options, matcher, report, archives)
+			supportedFiles = append(supportedFiles, files...)
+			return err
 		}
 
-		if dl.supportedExtensions[ext] {
+		switch dl.classifyFile(relPath, options, matcher) {
+		case fileSupported:
 			supportedFiles = append(supportedFiles, path)
-		} else {
-			unsupportedFiles = append(unsupportedFiles, path)
+			if depth > 0 {
+				archives.addMember(path, displayPath)
+			}
+		case fileUnsupported:
+			report.Unsupported = append(report.Unsupported, displayPath)
+		case fileExcluded:
+			report.Excluded = append(report.Excluded, displayPath)
 		}
 		return nil
 	})
 
-	if err != nil {
-		return nil, fmt.Errorf("error while analyzing folder: %w", err)
+	return supportedFiles, err
+}
+
+// joinRelPath joins slash-separated relative paths
+func joinRelPath(base, rel string) string {
+	if base == "" {
+		return rel
 	}
+	return base + "/" + rel
+}
 
-	// Display info about found files
-	if len(supportedFiles) == 0 {
-		if len(unsupportedFiles) == 0 && len(excludedFiles) == 0 {
-			return nil, fmt.Errorf("folder '%s' is empty or contains only hidden files. Please add documents before creating a RAG", folderPath)
-		} else if len(excludedFiles) > 0 {
-			return nil, fmt.Errorf("no supported files found in '%s' after applying exclusion rules. %d unsupported, %d excluded",
-				folderPath, len(unsupportedFiles), len(excludedFiles))
-		} else {
-			extensionsMsg := "Supported extensions: "
-			for ext := range dl.supportedExtensions {
-				extensionsMsg += ext + " "
-			}
-			return nil, fmt.Errorf("no supported files found in '%s'. %d unsupported files detected.\n%s",
-				folderPath, len(unsupportedFiles), extensionsMsg)
+// fileClass is the outcome of filtering a file
+type fileClass int
+
+const (
+	fileHidden fileClass = iota
+	fileExcluded
+	fileUnsupported
+	fileSupported
+)
+
+// isExcludedDir reports whether a directory is skipped by --exclude-dir or by ignore patterns
+func (dl *DocumentLoader) isExcludedDir(path, relPath string, options DocumentLoaderOptions, matcher *IgnoreMatcher) bool {
+	for _, excludeDir := range options.ExcludeDirs {
+		if strings.Contains(path, excludeDir) {
+			return true
 		}
 	}
+	return matcher.Ignored(relPath, true)
+}
 
-	fmt.Printf("Found %d supported files, %d unsupported files, and %d excluded files.\n",
-		len(supportedFiles), len(unsupportedFiles), len(excludedFiles))
+// isExcludedArchive reports whether an archive is skipped. Archives are matched like
+// directories, and --exclude-ext also applies to their extension.
+func (dl *DocumentLoader) isExcludedArchive(path, relPath string, options DocumentLoaderOptions, matcher *IgnoreMatcher) bool {
+	for _, excludeExt := range options.ExcludeExts {
+		if strings.HasSuffix(strings.ToLower(path), excludeExt) {
+			return true
+		}
+	}
+	return dl.isExcludedDir(path, relPath, options, matcher)
+}
 
-	// Try to install dependencies if possible
-	dl.tryInstallDependencies()
+// classifyFile applies the hidden-file, pattern and extension rules to a file
+func (dl *DocumentLoader) classifyFile(relPath string, options DocumentLoaderOptions, matcher *IgnoreMatcher) fileClass {
+	// Ignore hidden files (starting with .)
+	if strings.HasPrefix(pathBase(relPath), ".") {
+		return fileHidden
+	}
 
-	// Process supported files
-	for _, path := range supportedFiles {
-		ext := strings.ToLower(filepath.Ext(path))
+	// Check the ignore files and the include/exclude patterns
+	if matcher.Ignored(relPath, false) {
+		return fileExcluded
+	}
 
-		// Text extraction using multiple methods
-		textContent, err := dl.extractText(path, ext)
-		if err != nil {
-			fmt.Printf("Warning: unable to extract text from %s: %v\n", path, err)
-			fmt.Println("Attempting extraction as raw text...")
+	ext := strings.ToLower(filepath.Ext(relPath))
 
-			// Try reading as a text file
-			rawContent, err := ioutil.ReadFile(path)
-			if err != nil {
-				fmt.Printf("Failed to read raw %s: %v\n", path, err)
-				continue
+	// Check if the extension is in the exclude list
+	for _, excludeExt := range options.ExcludeExts {
+		if ext == excludeExt {
+			return fileExcluded
+		}
+	}
+
+	// If we're only processing specific extensions
+	if len(options.ProcessExts) > 0 {
+		shouldProcess := false
+		for _, processExt := range options.ProcessExts {
+			if ext == processExt {
+				shouldProcess = true
+				break
 			}
+		}
 
-			textContent = string(rawContent)
+		if !shouldProcess {
+			return fileExcluded
 		}
+	}
 
-		// Check that the content is not empty
-		if strings.TrimSpace(textContent) == "" {
-			fmt.Printf("Warning: no text extracted from %s\n", path)
+	if dl.supportedExtensions[ext] {
+		return fileSupported
+	}
+	return fileUnsupported
+}
 
-			// For PDFs, try one last method
-			if ext == ".pdf" {
-				fmt.Println("Attempting extraction with OCR (if installed)...")
-				ocrText, err := dl.extractWithOCR(path)
-				if err != nil || strings.TrimSpace(ocrText) == "" {
-					fmt.Println("OCR failed or not available.")
-					continue
-				}
-				textContent = ocrText
-			} else {
-				continue
-			}
-		}
+// extractFile extracts the text of a single file, falling back to raw reading
+// and, for PDFs, to OCR when the regular extractors return nothing
+func (dl *DocumentLoader) extractFile(ctx context.Context, path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
 
-		// Create a document with relative path for better identification
-		relPath, err := filepath.Rel(folderPath, path)
-		if err != nil {
-			relPath = path // Fallback to full path if relative path can't be determined
+	// Text extraction using multiple methods
+	textContent, err := dl.extractText(ctx, path, ext)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
 
-		// Use relPath for document identification, but keep the full path for file access
-		doc := domain.NewDocument(path, textContent)
-		doc.Name = relPath // Use relative path as the document name for better browsing
-		// Don't change doc.ID or doc.Path which need the absolute path
+		// Try reading as a text file
+		rawContent, rawErr := ioutil.ReadFile(path)
+		if rawErr != nil {
+			return "", fmt.Errorf("unable to extract text (%v) or read raw content: %w", err, rawErr)
+		}
 
-		documents = append(documents, doc)
-		fmt.Printf("Document added: %s (%d characters)\n", relPath, len(textContent))
+		textContent = string(rawContent)
 	}
 
-	if len(documents) == 0 {
-		return nil, fmt.Errorf("no documents with valid content found in folder '%s'", folderPath)
+	// Check that the content is not empty
+	if strings.TrimSpace(textContent) == "" {
+		// For PDFs, try one last method
+		if ext != ".pdf" {
+			return "", errNoTextExtracted
+		}
+
+		ocrText, err := dl.extractWithOCR(ctx, path)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("no text layer and OCR failed: %w", err)
+		}
+		if strings.TrimSpace(ocrText) == "" {
+			return "", errNoTextExtracted
+		}
+		textContent = ocrText
 	}
 
-	return documents, nil
+	return textContent, nil
 }
 
 // extractText extracts text from a file using the appropriate method based on type
-func (dl *DocumentLoader) extractText(path string, ext string) (string, error) {
+func (dl *DocumentLoader) extractText(ctx context.Context, path string, ext string) (string, error) {
 	switch ext {
 	case ".pdf":
-		return dl.extractFromPDF(path)
+		return dl.extractFromPDF(ctx, path)
 	case ".docx", ".doc", ".rtf", ".odt":
-		return dl.extractFromDocument(path, ext)
+		return dl.extractFromDocument(ctx, path, ext)
 	case ".pptx", ".ppt":
-		return dl.extractFromPresentation(path, ext)
+		return dl.extractFromPresentation(ctx, path, ext)
 	case ".xlsx", ".xls":
-		return dl.extractFromSpreadsheet(path, ext)
+		return dl.extractFromSpreadsheet(ctx, path, ext)
 	default:
 		// Treat as a text file
 		data, err := ioutil.ReadFile(path)
@@ -349,10 +491,10 @@ func (dl *DocumentLoader) extractText(path string, ext string) (string, error) {
 }
 
 // extractFromPDF extracts text from a PDF using different methods
-func (dl *DocumentLoader) extractFromPDF(path string) (string, error) {
+func (dl *DocumentLoader) extractFromPDF(ctx context.Context, path string) (string, error) {
 	// Method 1: Use pdftotext if available
 	if strings.Contains(dl.extractorPath, "pdftotext") {
-		out, err := exec.Command(dl.extractorPath, "-layout", path, "-").Output()
+		out, err := exec.CommandContext(ctx, dl.extractorPath, "-layout", path, "-").Output()
 		if err == nil && len(out) > 0 {
 			return string(out), nil
 		}
@@ -364,9 +506,9 @@ func (dl *DocumentLoader) extractFromPDF(path string) (string, error) {
 		if err == nil {
 			var out []byte
 			if tool == "pdfinfo" {
-				out, err = exec.Command(toolPath, path).Output()
+				out, err = exec.CommandContext(ctx, toolPath, path).Output()
 			} else {
-				out, err = exec.Command(toolPath, path, "dump_data").Output()
+				out, err = exec.CommandContext(ctx, toolPath, path, "dump_data").Output()
 			}
 			if err == nil && len(out) > 0 {
 				return string(out), nil
@@ -375,15 +517,14 @@ func (dl *DocumentLoader) extractFromPDF(path string) (string, error) {
 	}
 
 	// Method 3: Last attempt, open as binary file and extract strings
-	fmt.Println("Extracting strings from PDF...")
-	return dl.extractStringsFromBinary(path)
+	return dl.extractStringsFromBinary(ctx, path)
 }
 
 // extractFromDocument extracts text from a Word document or similar
-func (dl *DocumentLoader) extractFromDocument(path string, ext string) (string, error) {
+func (dl *DocumentLoader) extractFromDocument(ctx context.Context, path string, ext string) (string, error) {
 	// Method 1: Use textutil on macOS
 	if strings.Contains(dl.extractorPath, "textutil") && (ext == ".docx" || ext == ".doc" || ext == ".rtf") {
-		out, err := exec.Command(dl.extractorPath, "-convert", "txt", "-stdout", path).Output()
+		out, err := exec.CommandContext(ctx, dl.extractorPath, "-convert", "txt", "-stdout", path).Output()
 		if err == nil && len(out) > 0 {
 			return string(out), nil
 		}
@@ -393,7 +534,7 @@ func (dl *DocumentLoader) extractFromDocument(path string, ext string) (string,
 	if ext == ".doc" {
 		catdocPath, err := exec.LookPath("catdoc")
 		if err == nil {
-			out, err := exec.Command(catdocPath, path).Output()
+			out, err := exec.CommandContext(ctx, catdocPath, path).Output()
 			if err == nil && len(out) > 0 {
 				return string(out), nil
 			}
@@ -404,7 +545,7 @@ func (dl *DocumentLoader) extractFromDocument(path string, ext string) (string,
 	if ext == ".rtf" {
 		unrtfPath, err := exec.LookPath("unrtf")
 		if err == nil {
-			out, err := exec.Command(unrtfPath, "--text", path).Output()
+			out, err := exec.CommandContext(ctx, unrtfPath, "--text", path).Output()
 			if err == nil && len(out) > 0 {
 				return string(out), nil
 			}
@@ -412,22 +553,22 @@ func (dl *DocumentLoader) extractFromDocument(path string, ext string) (string,
 	}
 
 	// Method 4: Extract strings
-	return dl.extractStringsFromBinary(path)
+	return dl.extractStringsFromBinary(ctx, path)
 }
 
 // extractFromPresentation extracts text from a PowerPoint presentation
-func (dl *DocumentLoader) extractFromPresentation(path string, ext string) (string, error) {
+func (dl *DocumentLoader) extractFromPresentation(ctx context.Context, path string, ext string) (string, error) {
 	// External tools for PowerPoint are limited
-	return dl.extractStringsFromBinary(path)
+	return dl.extractStringsFromBinary(ctx, path)
 }
 
 // extractFromSpreadsheet extracts text from an Excel spreadsheet
-func (dl *DocumentLoader) extractFromSpreadsheet(path string, ext string) (string, error) {
+func (dl *DocumentLoader) extractFromSpreadsheet(ctx context.Context, path string, ext string) (string, error) {
 	// Try to use xlsx2csv for .xlsx
 	if ext == ".xlsx" {
 		xlsx2csvPath, err := exec.LookPath("xlsx2csv")
 		if err == nil {
-			out, err := exec.Command(xlsx2csvPath, path).Output()
+			out, err := exec.CommandContext(ctx, xlsx2csvPath, path).Output()
 			if err == nil && len(out) > 0 {
 				return string(out), nil
 			}
@@ -438,7 +579,7 @@ func (dl *DocumentLoader) extractFromSpreadsheet(path string, ext string) (strin
 	if ext == ".xls" {
 		xls2csvPath, err := exec.LookPath("xls2csv")
 		if err == nil {
-			out, err := exec.Command(xls2csvPath, path).Output()
+			out, err := exec.CommandContext(ctx, xls2csvPath, path).Output()
 			if err == nil && len(out) > 0 {
 				return string(out), nil
 			}
@@ -446,15 +587,15 @@ func (dl *DocumentLoader) extractFromSpreadsheet(path string, ext string) (strin
 	}
 
 	// Extract strings
-	return dl.extractStringsFromBinary(path)
+	return dl.extractStringsFromBinary(ctx, path)
 }
 
 // extractStringsFromBinary extracts strings from a binary file
-func (dl *DocumentLoader) extractStringsFromBinary(path string) (string, error) {
+func (dl *DocumentLoader) extractStringsFromBinary(ctx context.Context, path string) (string, error) {
 	// Use the 'strings' tool if available (Unix/Linux/macOS)
 	stringsPath, err := exec.LookPath("strings")
 	if err == nil {
-		out, err := exec.Command(stringsPath, path).Output()
+		out, err := exec.CommandContext(ctx, stringsPath, path).Output()
 		if err == nil && len(out) > 0 {
 			return string(out), nil
 		}
@@ -469,7 +610,11 @@ func (dl *DocumentLoader) extractStringsFromBinary(path string) (string, error)
 	var result strings.Builder
 	var currentWord strings.Builder
 
-	for _, b := range data {
+	for i, b := range data {
+		// The file timeout cannot kill Go code: check it every 1 MB
+		if i%(1<<20) == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		if (b >= 32 && b <= 126) || b == '\n' || b == '\t' || b == '\r' {
 			currentWord.WriteByte(b)
 		} else {
@@ -489,7 +634,7 @@ func (dl *DocumentLoader) extractStringsFromBinary(path string) (string, error)
 }
 
 // extractWithOCR attempts to extract text using OCR
-func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
+func (dl *DocumentLoader) extractWithOCR(ctx context.Context, path string) (string, error) {
 	// Check if tesseract is available
 	tesseractPath, err := exec.LookPath("tesseract")
 	if err != nil {
@@ -521,10 +666,8 @@ func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
 		pdftoppmPath, err := exec.LookPath("pdftoppm")
 		if err == nil {
 			// Convert PDF to images with parallel processing
-			fmt.Println("Converting PDF to images for OCR...")
-
 			// First, determine the number of pages in the PDF
-			pagesCmd := exec.Command("pdfinfo", path)
+			pagesCmd := exec.CommandContext(ctx, "pdfinfo", path)
 			output, err := pagesCmd.CombinedOutput()
 			pageCount := 0
 
@@ -540,8 +683,8 @@ func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
 			}
 
 			if pageCount > 0 && pageCount > numWorkers {
-				// Process PDF in parallel batches
-				fmt.Printf("Processing %d pages with %d workers\n", pageCount, numWorkers)
+				// Process PDF in parallel batches. Pages failing to convert are
+				// left out; parallelOCR fails if none could be.
 				var wg sync.WaitGroup
 				semaphore := make(chan struct{}, numWorkers)
 
@@ -553,17 +696,15 @@ func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
 						defer func() { <-semaphore }() // Release
 
 						outputPath := filepath.Join(tempDir, fmt.Sprintf("page-%03d", pageNum))
-						batchCmd := exec.Command(pdftoppmPath, "-png", "-f", fmt.Sprintf("%d", pageNum),
+						batchCmd := exec.CommandContext(ctx, pdftoppmPath, "-png", "-f", fmt.Sprintf("%d", pageNum),
 							"-l", fmt.Sprintf("%d", pageNum), path, outputPath)
-						if err := batchCmd.Run(); err != nil {
-							fmt.Printf("Warning: Failed to convert page %d: %v\n", pageNum, err)
-						}
+						batchCmd.Run()
 					}(i)
 				}
 				wg.Wait()
 			} else {
 				// For smaller PDFs or when pdfinfo isn't available, use the original approach
-				cmd := exec.Command(pdftoppmPath, "-png", path, filepath.Join(tempDir, "page"))
+				cmd := exec.CommandContext(ctx, pdftoppmPath, "-png", path, filepath.Join(tempDir, "page"))
 				if err := cmd.Run(); err != nil {
 					return "", fmt.Errorf("failed to convert PDF to images: %w", err)
 				}
@@ -571,12 +712,12 @@ func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
 
 			// OCR on each image in parallel
 			imgFiles, _ := filepath.Glob(filepath.Join(tempDir, "page-*.png"))
-			return dl.parallelOCR(imgFiles, tesseractPath, outBaseDir, numWorkers)
+			return dl.parallelOCR(ctx, imgFiles, tesseractPath, outBaseDir, numWorkers)
 		}
 	}
 
 	// Direct OCR on the file (for images)
-	cmd := exec.Command(tesseractPath, path, filepath.Join(outBaseDir, "result"), "-l", "eng")
+	cmd := exec.CommandContext(ctx, tesseractPath, path, filepath.Join(outBaseDir, "result"), "-l", "eng")
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("OCR failed: %w", err)
 	}
@@ -591,18 +732,25 @@ func (dl *DocumentLoader) extractWithOCR(path string) (string, error) {
 }
 
 // parallelOCR processes multiple image files with tesseract in parallel
-func (dl *DocumentLoader) parallelOCR(imgFiles []string, tesseractPath, outBaseDir string, numWorkers int) (string, error) {
+func (dl *DocumentLoader) parallelOCR(ctx context.Context, imgFiles []string, tesseractPath, outBaseDir string, numWorkers int) (string, error) {
 	if len(imgFiles) == 0 {
 		return "", fmt.Errorf("no images found to process")
 	}
 
-	fmt.Printf("Processing %d images with OCR using %d workers\n", len(imgFiles), numWorkers)
-
+	// This runs inside a load worker: failures are returned to its report
+	// rather than printed, the first one if no image could be read
 	var mutex sync.Mutex
 	results := make(map[string]string)
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, numWorkers)
-	var processingErr error
+	var firstErr error
+	fail := func(err error) {
+		mutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mutex.Unlock()
+	}
 
 	// Process each image file in parallel
 	for _, imgFile := range imgFiles {
@@ -617,17 +765,16 @@ func (dl *DocumentLoader) parallelOCR(imgFiles []string, tesseractPath, outBaseD
 			outName := strings.TrimSuffix(baseFileName, filepath.Ext(baseFileName))
 			outPath := filepath.Join(outBaseDir, outName)
 
-			fmt.Printf("OCR on %s...\n", baseFileName)
-			cmd := exec.Command(tesseractPath, file, outPath, "-l", "eng")
+			cmd := exec.CommandContext(ctx, tesseractPath, file, outPath, "-l", "eng")
 			if err := cmd.Run(); err != nil {
-				fmt.Printf("Warning: OCR failed for %s: %v\n", baseFileName, err)
+				fail(fmt.Errorf("OCR failed for %s: %w", baseFileName, err))
 				return
 			}
 
 			// Read the extracted text
 			textBytes, err := ioutil.ReadFile(outPath + ".txt")
 			if err != nil {
-				fmt.Printf("Warning: Could not read OCR result for %s: %v\n", baseFileName, err)
+				fail(fmt.Errorf("could not read OCR result for %s: %w", baseFileName, err))
 				return
 			}
 
@@ -640,8 +787,8 @@ func (dl *DocumentLoader) parallelOCR(imgFiles []string, tesseractPath, outBaseD
 
 	wg.Wait()
 
-	if processingErr != nil {
-		return "", processingErr
+	if len(results) == 0 && firstErr != nil {
+		return "", firstErr
 	}
 
 	// Combine all text in the correct order (by filename)
@@ -658,13 +805,29 @@ func (dl *DocumentLoader) parallelOCR(imgFiles []string, tesseractPath, outBaseD
 	return allText.String(), nil
 }
 
-// tryInstallDependencies attempts to install dependencies if necessary
-func (dl *DocumentLoader) tryInstallDependencies() {
-	pythonExecutor := utils.NewPythonExecutor()
+// pythonExtractorPackages are the Python packages extracting the text of each file type
+var pythonExtractorPackages = map[string]string{
+	".pdf":  "pdfminer.six",
+	".docx": "docx2txt",
+	".xlsx": "xlsx2csv",
+}
 
-	fmt.Println("Checking Python text extraction tools...")
-	packages := []string{"pdfminer.six", "docx2txt", "xlsx2csv"}
+// tryInstallDependencies attempts to install the Python extraction tools the
+// files need, if any
+func (dl *DocumentLoader) tryInstallDependencies(files []string) {
+	var packages []string
+	for _, file := range files {
+		pkg, ok := pythonExtractorPackages[strings.ToLower(filepath.Ext(file))]
+		if ok && !slices.Contains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return
+	}
 
+	pythonExecutor := utils.NewPythonExecutor()
+	fmt.Println("Checking Python text extraction tools...")
 	for _, pkg := range packages {
 		if !pythonExecutor.CheckPackageInstalled(pkg) {
 			fmt.Printf("Installing %s...\n", pkg)
@@ -708,7 +871,8 @@ func (dl *DocumentLoader) processContent(path string, content string, options Do
 	return chunks
 }
 
-// extractCSVContent extracts content from a CSV file
+// extractCSVContent extracts content from a CSV file. The content stays CSV so
+// that the chunker can split it into rows.
 func (dl *DocumentLoader) extractCSVContent(path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -717,34 +881,30 @@ func (dl *DocumentLoader) extractCSVContent(path string) (string, error) {
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Accept rows with missing cells
+	reader.LazyQuotes = true
 	records, err := reader.ReadAll()
 	if err != nil {
 		return "", fmt.Errorf("failed to read CSV: %w", err)
 	}
 
+	// Write the records back with consistent quoting
 	var content strings.Builder
-	// Add headers as first line if present
-	if len(records) > 0 {
-		content.WriteString(strings.Join(records[0], " | "))
-		content.WriteString("\n")
-	}
-
-	// Add remaining rows
-	for _, row := range records[1:] {
-		content.WriteString(strings.Join(row, " | "))
-		content.WriteString("\n")
+	writer := csv.NewWriter(&content)
+	if err := writer.WriteAll(records); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
 	}
 
 	return content.String(), nil
 }
 
 // extractExcelContent extracts content from an Excel file
-func (dl *DocumentLoader) extractExcelContent(path string) (string, error) {
+func (dl *DocumentLoader) extractExcelContent(ctx context.Context, path string) (string, error) {
 	// First try using xlsx2csv if available
 	xlsx2csvPath, err := exec.LookPath("xlsx2csv")
 	if err == nil {
 		var output bytes.Buffer
-		cmd := exec.Command(xlsx2csvPath, path)
+		cmd := exec.CommandContext(ctx, xlsx2csvPath, "--all", path) // All sheets, separated by "-------- n - name" lines
 		cmd.Stdout = &output
 		if err := cmd.Run(); err == nil {
 			return output.String(), nil
@@ -758,7 +918,7 @@ import xlsx2csv
 import sys
 try:
     converter = xlsx2csv.Xlsx2csv("%s", skip_empty_lines=True)
-    converter.convert(sys.stdout)
+    converter.convert(sys.stdout, sheetid=0)
 except Exception as e:
     print(f"Error: {e}", file=sys.stderr)
     sys.exit(1)
@@ -773,20 +933,20 @@ except Exception as e:
 }
 
 // extractContent extracts content from a file based on its type
-func (dl *DocumentLoader) extractContent(path string) (string, error) {
+func (dl *DocumentLoader) extractContent(ctx context.Context, path string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(path))
 
 	switch ext {
 	case ".csv":
 		return dl.extractCSVContent(path)
 	case ".xlsx", ".xls":
-		return dl.extractExcelContent(path)
+		return dl.extractExcelContent(ctx, path)
 	case ".pdf":
-		return dl.extractFromPDF(path)
+		return dl.extractFromPDF(ctx, path)
 	case ".docx", ".doc", ".rtf", ".odt":
-		return dl.extractFromDocument(path, ext)
+		return dl.extractFromDocument(ctx, path, ext)
 	case ".pptx", ".ppt":
-		return dl.extractFromPresentation(path, ext)
+		return dl.extractFromPresentation(ctx, path, ext)
 	default:
 		// Treat as a text file
 		data, err := ioutil.ReadFile(path)
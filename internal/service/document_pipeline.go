@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// DefaultFileTimeout is the maximum time spent extracting a single file
+// when DocumentLoaderOptions.FileTimeout is not set. External extractors are
+// killed when it expires; the Go readers check it between steps and while
+// scanning binary files, but a single read of a large file runs to its end.
+const DefaultFileTimeout = 5 * time.Minute
+
+// Load stages reported in FileFailure
+const (
+	LoadStageWalk    = "walk"
+	LoadStageArchive = "archive"
+	LoadStageExtract = "extract"
+	LoadStageClean   = "clean"
+)
+
+// errNoTextExtracted is returned when a file yields no usable text
+var errNoTextExtracted = errors.New("no text extracted")
+
+// FileFailure describes a file that could not be loaded
+type FileFailure struct {
+	Path  string
+	Stage string // Stage where the failure happened: walk, archive, extract or clean
+	Err   error
+}
+
+// LoadReport summarizes the outcome of loading a folder
+type LoadReport struct {
+	Loaded      int           // Number of documents produced
+	Excluded    []string      // Files skipped by the exclusion rules
+	Unsupported []string      // Files with an unsupported extension
+	Failures    []FileFailure // Files that failed to load, in walk order
+}
+
+// addFailure records a failed file
+func (r *LoadReport) addFailure(path, stage string, err error) {
+	r.Failures = append(r.Failures, FileFailure{Path: path, Stage: stage, Err: err})
+}
+
+// PrintFailures displays the failed files, if any
+func (r *LoadReport) PrintFailures() {
+	if len(r.Failures) == 0 {
+		return
+	}
+
+	fmt.Printf("%d file(s) could not be loaded:\n", len(r.Failures))
+	for _, failure := range r.Failures {
+		fmt.Printf("  - %s [%s]: %v\n", failure.Path, failure.Stage, failure.Err)
+	}
+}
+
+// loadJob is a file travelling through the load pipeline
+type loadJob struct {
+	index    int
+	path     string
+	text     string
+	metadata domain.DocumentMetadata
+	doc      *domain.Document
+	stage    string
+	err      error
+}
+
+// runLoadPipeline extracts and cleans the given files with a bounded number of workers.
+// Documents are returned in the same order as files, whatever the completion order;
+// failures are appended to the report in that order too.
+func (dl *DocumentLoader) runLoadPipeline(folderPath string, files []string, options DocumentLoaderOptions, report *LoadReport) []*domain.Document {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	timeout := options.FileTimeout
+	if timeout == 0 {
+		timeout = DefaultFileTimeout
+	}
+
+	fmt.Printf("Extracting %d files with %d workers...\n", len(files), workers)
+
+	jobs := make(chan *loadJob)
+	extracted := make(chan *loadJob)
+	cleaned := make(chan *loadJob)
+
+	// Feed the pipeline in walk order
+	go func() {
+		for i, path := range files {
+			jobs <- &loadJob{index: i, path: path}
+		}
+		close(jobs)
+	}()
+
+	// Extract stage
+	var extractWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		extractWG.Add(1)
+		go func() {
+			defer extractWG.Done()
+			for job := range jobs {
+				job.text, job.metadata, job.err = dl.extractWithTimeout(job.path, timeout)
+				if job.err != nil {
+					job.stage = LoadStageExtract
+				}
+				extracted <- job
+			}
+		}()
+	}
+	go func() {
+		extractWG.Wait()
+		close(extracted)
+	}()
+
+	// Clean stage
+	var cleanWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		cleanWG.Add(1)
+		go func() {
+			defer cleanWG.Done()
+			for job := range extracted {
+				if job.err == nil {
+					job.doc, job.err = newDocumentFromFile(folderPath, job.path, job.text, job.metadata)
+					if job.err != nil {
+						job.stage = LoadStageClean
+					}
+				}
+				job.text = ""
+				cleaned <- job
+			}
+		}()
+	}
+	go func() {
+		cleanWG.Wait()
+		close(cleaned)
+	}()
+
+	// Collect and restore the deterministic order
+	results := make([]*loadJob, 0, len(files))
+	for job := range cleaned {
+		results = append(results, job)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].index < results[j].index
+	})
+
+	var documents []*domain.Document
+	for _, job := range results {
+		if job.err != nil {
+			report.addFailure(job.path, job.stage, job.err)
+			continue
+		}
+		documents = append(documents, job.doc)
+	}
+
+	return documents
+}
+
+// extractWithTimeout extracts the text and metadata of a file, aborting external
+// tools once the timeout expires
+func (dl *DocumentLoader) extractWithTimeout(path string, timeout time.Duration) (string, domain.DocumentMetadata, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	text, err := dl.extractFile(ctx, path)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", nil, fmt.Errorf("extraction timed out after %s", timeout)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if ctx.Err() != nil {
+		return "", nil, fmt.Errorf("extraction timed out after %s", timeout)
+	}
+
+	text, metadata := dl.extractMetadata(ctx, path, text)
+	return text, metadata, nil
+}
+
+// newDocumentFromFile cleans the extracted text and builds the document for a file
+func newDocumentFromFile(folderPath, path, text string, metadata domain.DocumentMetadata) (*domain.Document, error) {
+	// Use relPath for document identification, but keep the full path for file access
+	doc := domain.NewDocument(path, text)
+	if doc.Content == "" {
+		return nil, errors.New("no text left after cleaning")
+	}
+	for key, value := range metadata {
+		if key == domain.MetaLanguage {
+			// A declared language wins over the detected one
+			doc.Metadata.SetLanguage(value)
+			continue
+		}
+		doc.Metadata[key] = value
+	}
+
+	relPath, err := filepath.Rel(folderPath, path)
+	if err != nil {
+		relPath = path // Fallback to full path if relative path can't be determined
+	}
+	doc.Name = relPath // Use relative path as the document name for better browsing
+
+	return doc, nil
+}
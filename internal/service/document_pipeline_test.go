@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunLoadPipelineOrderAndFailures checks that parallel extraction keeps walk order
+// and reports failing files instead of dropping them silently
+func TestRunLoadPipelineOrderAndFailures(t *testing.T) {
+	dir := t.TempDir()
+
+	var files []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("doc-%02d.txt", i))
+		content := fmt.Sprintf("Document number %d with some readable content.", i)
+		if i == 7 {
+			content = "   \n\n  " // Nothing to extract
+		}
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		files = append(files, path)
+	}
+	files = append(files, filepath.Join(dir, "missing.txt"))
+
+	loader := &DocumentLoader{supportedExtensions: map[string]bool{".txt": true}}
+	report := &LoadReport{}
+	docs := loader.runLoadPipeline(dir, files, DocumentLoaderOptions{Workers: 4}, report)
+
+	assert.Len(t, docs, 19)
+	for i, doc := range docs {
+		expected := i
+		if i >= 7 {
+			expected = i + 1
+		}
+		assert.Equal(t, fmt.Sprintf("doc-%02d.txt", expected), doc.Name)
+	}
+
+	if assert.Len(t, report.Failures, 2) {
+		assert.Equal(t, files[7], report.Failures[0].Path)
+		assert.Equal(t, LoadStageExtract, report.Failures[0].Stage)
+		assert.Equal(t, files[20], report.Failures[1].Path)
+	}
+}
+
+// TestExtractStringsFromBinaryStopsOnTimeout checks that the Go fallback of the
+// binary extractors gives up once the file timeout expired
+func TestExtractStringsFromBinaryStopsOnTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slides.ppt")
+	assert.NoError(t, os.WriteFile(path, []byte("\x00\x01Readable slide text\x00"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	loader := &DocumentLoader{}
+	_, err := loader.extractStringsFromBinary(ctx, path)
+	assert.ErrorIs(t, err, context.Canceled)
+}
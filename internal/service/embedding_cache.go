@@ -2,134 +2,294 @@ package service
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/dontizi/rlama/internal/config"
 )
 
-// EmbeddingCache provides caching for embeddings to avoid regeneration of the same content
+// embeddingCacheDir is the folder of the data directory holding cached embeddings
+const embeddingCacheDir = "embedding_cache"
+
+// DefaultEmbeddingCacheMaxBytes is the size of the embedding cache above which
+// the least recently used embeddings are evicted
+const DefaultEmbeddingCacheMaxBytes int64 = 1 << 30
+
+// EmbeddingCacheMaxBytes is the size limit of the embedding cache of the data
+// directory; 0 disables the cache
+var EmbeddingCacheMaxBytes = DefaultEmbeddingCacheMaxBytes
+
+// EmbeddingCache stores embeddings on disk, one file per embedding, addressed by
+// the embedding model and the hash of the text with its whitespace normalised:
+// <dir>/<model>/<2 first hash digits>/<hash>. The modification time of a file
+// is the last time it was used, which eviction goes by.
 type EmbeddingCache struct {
-	cache       map[string]CachedEmbedding
-	mutex       sync.RWMutex
-	maxSize     int           // Taille maximale du cache
-	ttl         time.Duration // Durée de vie des entrées
-	lastCleanup time.Time     // Dernière fois que le cache a été nettoyé
-}
+	dir      string
+	maxBytes int64
 
-// CachedEmbedding represents a cached embedding with metadata
-type CachedEmbedding struct {
-	Embedding  []float32
-	CreatedAt  time.Time
-	AccessedAt time.Time
-	UseCount   int // Pour garder trace des éléments les plus utilisés
+	mu   sync.Mutex
+	size int64 // Bytes stored, -1 until the cache is first written to
 }
 
-// NewEmbeddingCache creates a new embedding cache
-func NewEmbeddingCache(maxSize int, ttl time.Duration) *EmbeddingCache {
-	return &EmbeddingCache{
-		cache:       make(map[string]CachedEmbedding),
-		maxSize:     maxSize,
-		ttl:         ttl,
-		lastCleanup: time.Now(),
-	}
+// EmbeddingCacheEntry is the usage of the cache by one model
+type EmbeddingCacheEntry struct {
+	Model      string
+	Embeddings int
+	Bytes      int64
+	LastUsed   time.Time
 }
 
-// Get retrieves an embedding from the cache
-func (c *EmbeddingCache) Get(text string, modelName string) ([]float32, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+// NewEmbeddingCache creates a cache storing embeddings in dir, evicting the least
+// recently used ones when they take more than maxBytes
+func NewEmbeddingCache(dir string, maxBytes int64) *EmbeddingCache {
+	return &EmbeddingCache{dir: dir, maxBytes: maxBytes, size: -1}
+}
 
-	key := c.generateKey(text, modelName)
-	cached, exists := c.cache[key]
+// EmbeddingCacheDir returns the folder of the embedding cache of the data directory
+func EmbeddingCacheDir() string {
+	return filepath.Join(config.GetDataDir(), embeddingCacheDir)
+}
 
-	if !exists {
-		return nil, false
+// DefaultEmbeddingCache returns the embedding cache of the data directory, nil
+// when it is disabled
+func DefaultEmbeddingCache() *EmbeddingCache {
+	if EmbeddingCacheMaxBytes <= 0 {
+		return nil
 	}
+	return NewEmbeddingCache(EmbeddingCacheDir(), EmbeddingCacheMaxBytes)
+}
 
-	// Vérifier si l'entrée est expirée
-	if time.Since(cached.CreatedAt) > c.ttl {
+// Dir returns the folder of the cache
+func (c *EmbeddingCache) Dir() string {
+	return c.dir
+}
+
+// Get returns the cached embedding of a text, marking it as used
+func (c *EmbeddingCache) Get(text string, modelName string) ([]float32, bool) {
+	path := c.path(text, modelName)
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 || len(data)%4 != 0 {
 		return nil, false
 	}
 
-	// Mettre à jour les statistiques d'accès (sans lock d'écriture pour la performance)
-	cached.AccessedAt = time.Now()
-	cached.UseCount++
-	c.cache[key] = cached
-
-	return cached.Embedding, true
+	embedding := make([]float32, len(data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return embedding, true
 }
 
-// Set adds an embedding to the cache
-func (c *EmbeddingCache) Set(text string, modelName string, embedding []float32) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+// Set stores the embedding of a text, evicting old embeddings if the cache
+// grows past its size limit
+func (c *EmbeddingCache) Set(text string, modelName string, embedding []float32) error {
+	data := make([]byte, len(embedding)*4)
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(value))
+	}
 
-	// Vérifier si le cache doit être nettoyé
-	if time.Since(c.lastCleanup) > c.ttl/2 {
-		c.cleanup()
-		c.lastCleanup = time.Now()
+	path := c.path(text, modelName)
+	var replaced int64 // Size of the embedding overwritten, if the text was already cached
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating embedding cache folder: %w", err)
+	}
+	// Written aside and renamed so that concurrent readers never see half an embedding
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing embedding cache: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing embedding cache: %w", err)
 	}
 
-	// Ajouter au cache
-	key := c.generateKey(text, modelName)
-	c.cache[key] = CachedEmbedding{
-		Embedding:  embedding,
-		CreatedAt:  time.Now(),
-		AccessedAt: time.Now(),
-		UseCount:   1,
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 0 {
+		// Counted once, the new file included
+		entries, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		c.size = 0
+		for _, entry := range entries {
+			c.size += entry.Bytes
+		}
+	} else {
+		c.size += int64(len(data)) - replaced
+	}
+	if c.maxBytes > 0 && c.size > c.maxBytes {
+		// Evict down to 90% of the limit so that the next embeddings don't evict again
+		if _, _, err := c.prune(c.maxBytes*9/10, 0); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// generateKey creates a unique key for the cache
-func (c *EmbeddingCache) generateKey(text string, modelName string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(text))
-	hasher.Write([]byte(modelName))
-	return hex.EncodeToString(hasher.Sum(nil))
+// path returns the file of the embedding of a text by a model
+func (c *EmbeddingCache) path(text string, modelName string) string {
+	hash := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	key := hex.EncodeToString(hash[:])
+	return filepath.Join(c.dir, embeddingCacheModelDir(modelName), key[:2], key)
 }
 
-// cleanup removes expired or least used entries when cache is full
-func (c *EmbeddingCache) cleanup() {
-	now := time.Now()
+// embeddingCacheModelDir returns the folder name of a model, "bge-m3_latest" for
+// "bge-m3:latest". The "@" separating a model from its embedding profile is kept.
+func embeddingCacheModelDir(modelName string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == '@' {
+			return r
+		}
+		return '_'
+	}, modelName)
+}
 
-	// Supprimer les entrées expirées
-	for key, entry := range c.cache {
-		if now.Sub(entry.CreatedAt) > c.ttl {
-			delete(c.cache, key)
+// cachedFile is an embedding file of the cache
+type cachedFile struct {
+	path     string
+	model    string
+	size     int64
+	lastUsed time.Time
+}
+
+// files lists the embedding files of the cache
+func (c *EmbeddingCache) files() ([]cachedFile, error) {
+	var files []cachedFile
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
 		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed meanwhile
+		}
+		rel, _ := filepath.Rel(c.dir, path)
+		files = append(files, cachedFile{
+			path:     path,
+			model:    strings.SplitN(filepath.ToSlash(rel), "/", 2)[0],
+			size:     info.Size(),
+			lastUsed: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedding cache: %w", err)
+	}
+	return files, nil
+}
+
+// Stats returns the usage of the cache by each model, sorted by model
+func (c *EmbeddingCache) Stats() ([]EmbeddingCacheEntry, error) {
+	files, err := c.files()
+	if err != nil {
+		return nil, err
 	}
 
-	// Si le cache est toujours trop grand, supprimer les entrées les moins utilisées
-	if len(c.cache) > c.maxSize {
-		type keyScore struct {
-			key   string
-			score float64 // Combined score (usage and recency)
+	byModel := make(map[string]*EmbeddingCacheEntry)
+	var entries []EmbeddingCacheEntry
+	for _, file := range files {
+		entry, ok := byModel[file.model]
+		if !ok {
+			entry = &EmbeddingCacheEntry{Model: file.model}
+			byModel[file.model] = entry
+		}
+		entry.Embeddings++
+		entry.Bytes += file.size
+		if file.lastUsed.After(entry.LastUsed) {
+			entry.LastUsed = file.lastUsed
 		}
+	}
+	for _, entry := range byModel {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Model < entries[j].Model })
+	return entries, nil
+}
 
-		scores := make([]keyScore, 0, len(c.cache))
+// Prune removes the embeddings unused for longer than maxAge, then the least
+// recently used ones until the cache takes at most maxBytes. A zero limit is
+// ignored. It returns the number of embeddings and bytes removed.
+func (c *EmbeddingCache) Prune(maxBytes int64, maxAge time.Duration) (int, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prune(maxBytes, maxAge)
+}
 
-		// Calculate a score for each entry (combined usage and recency)
-		for key, entry := range c.cache {
-			recencyScore := float64(now.Sub(entry.AccessedAt)) / float64(c.ttl)
-			usageScore := 1.0 / float64(1+entry.UseCount) // Higher usage = smaller score
-			combinedScore := recencyScore * usageScore    // Smaller = better
+func (c *EmbeddingCache) prune(maxBytes int64, maxAge time.Duration) (int, int64, error) {
+	files, err := c.files()
+	if err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].lastUsed.Before(files[j].lastUsed) })
 
-			scores = append(scores, keyScore{key, combinedScore})
-		}
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
 
-		// Sort by score
-		for i := 0; i < len(scores); i++ {
-			for j := i + 1; j < len(scores); j++ {
-				if scores[i].score < scores[j].score {
-					scores[i], scores[j] = scores[j], scores[i]
-				}
-			}
+	removed, freed := 0, int64(0)
+	for _, file := range files {
+		expired := maxAge > 0 && time.Since(file.lastUsed) > maxAge
+		if !expired && (maxBytes <= 0 || total-freed <= maxBytes) {
+			continue
 		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return removed, freed, fmt.Errorf("error removing cached embedding: %w", err)
+		}
+		removed++
+		freed += file.size
+	}
+	c.size = total - freed
+	return removed, freed, nil
+}
 
-		// Remove entries with the highest score (least useful)
-		toRemove := len(c.cache) - c.maxSize
-		for i := 0; i < toRemove; i++ {
-			delete(c.cache, scores[i].key)
+// Clear removes the cached embeddings of a model, those it made through every
+// embedding profile included, or of all models when it is empty
+func (c *EmbeddingCache) Clear(modelName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirs := []string{c.dir}
+	if modelName != "" {
+		dir := filepath.Join(c.dir, embeddingCacheModelDir(modelName))
+		profiles, err := filepath.Glob(dir + "@*")
+		if err != nil {
+			return fmt.Errorf("error clearing embedding cache: %w", err)
+		}
+		dirs = append([]string{dir}, profiles...)
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("error clearing embedding cache: %w", err)
 		}
 	}
+	c.size = -1
+	return nil
 }
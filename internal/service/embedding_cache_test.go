@@ -0,0 +1,111 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddingCacheStoresByModelAndNormalisedText(t *testing.T) {
+	cache := NewEmbeddingCache(t.TempDir(), 0)
+
+	_, ok := cache.Get("some text", "bge-m3")
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set("some  text\n", "bge-m3", []float32{0.5, -1, 2}))
+	embedding, ok := cache.Get(" some text", "bge-m3")
+	require.True(t, ok)
+	assert.Equal(t, []float32{0.5, -1, 2}, embedding)
+
+	_, ok = cache.Get("some text", "bge-m3:latest")
+	assert.False(t, ok, "embeddings are per model")
+	_, ok = cache.Get("Some text", "bge-m3")
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set("other", "bge-m3:latest", []float32{1}))
+	entries, err := cache.Stats()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "bge-m3", entries[0].Model)
+	assert.Equal(t, 1, entries[0].Embeddings)
+	assert.Equal(t, int64(12), entries[0].Bytes)
+	assert.Equal(t, "bge-m3_latest", entries[1].Model)
+
+	require.NoError(t, cache.Clear("bge-m3:latest"))
+	entries, err = cache.Stats()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Clearing a model clears the embeddings it made through embedding profiles
+	require.NoError(t, cache.Set("text", "bge-m3@openai", []float32{1}))
+	require.NoError(t, cache.Set("text", "bge-m3-large", []float32{1}))
+	require.NoError(t, cache.Clear("bge-m3"))
+	entries, err = cache.Stats()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bge-m3-large", entries[0].Model)
+
+	require.NoError(t, cache.Clear(""))
+	entries, err = cache.Stats()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestEmbeddingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewEmbeddingCache(t.TempDir(), 0)
+	embedding := make([]float32, 25) // 100 bytes
+	old := time.Now().Add(-48 * time.Hour)
+	for i, text := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, cache.Set(text, "model", embedding))
+		used := old.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(cache.path(text, "model"), used, used))
+	}
+	// Reading an embedding makes it the most recently used
+	_, ok := cache.Get("a", "model")
+	require.True(t, ok)
+
+	removed, freed, err := cache.Prune(250, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, int64(200), freed)
+	for text, kept := range map[string]bool{"a": true, "b": false, "c": false, "d": true} {
+		_, ok := cache.Get(text, "model")
+		assert.Equal(t, kept, ok, text)
+	}
+
+	// Entries unused for too long are removed whatever the size
+	require.NoError(t, os.Chtimes(cache.path("d", "model"), old, old))
+	removed, _, err = cache.Prune(0, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	// Writing past the size limit evicts down to 90% of it
+	limited := NewEmbeddingCache(t.TempDir(), 300)
+	for _, text := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, limited.Set(text, "model", embedding))
+	}
+	entries, err := limited.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), entries[0].Bytes)
+}
+
+func TestEmbeddingCacheOverwritesWithoutEvicting(t *testing.T) {
+	embedding := make([]float32, 25) // 100 bytes
+	cache := NewEmbeddingCache(t.TempDir(), 300)
+	for _, text := range []string{"a", "b", "c"} {
+		require.NoError(t, cache.Set(text, "model", embedding))
+	}
+
+	// Embedding the same text again replaces its file, the cache doesn't grow
+	for i := 0; i < 5; i++ {
+		require.NoError(t, cache.Set("a", "model", embedding))
+	}
+	assert.Equal(t, int64(300), cache.size)
+	for _, text := range []string{"a", "b", "c"} {
+		_, ok := cache.Get(text, "model")
+		assert.True(t, ok, text)
+	}
+}
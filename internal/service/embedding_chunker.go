@@ -0,0 +1,237 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// DefaultBreakpointPercentile is the percentile of the similarities between
+// consecutive sentences below which the "embedding" strategy starts a new chunk
+const DefaultBreakpointPercentile = 10.0
+
+// sentenceBoundary matches the end of a sentence: final punctuation followed by
+// whitespace, CJK final punctuation, or a blank line
+var sentenceBoundary = regexp.MustCompile(`[.!?]+["'”’)\]]*\s+|[。！？]+\s*|\n\s*\n`)
+
+// TextEmbedder embeds texts in batches for the embedding-based chunking strategy
+type TextEmbedder interface {
+	EmbedTexts(texts []string) ([][]float32, error)
+}
+
+// modelEmbedder embeds texts with the embedding model of a RAG
+type modelEmbedder struct {
+	embeddingService *EmbeddingService
+	embeddingModel   string
+}
+
+// NewModelEmbedder creates a TextEmbedder using an embedding model
+func NewModelEmbedder(embeddingService *EmbeddingService, embeddingModel string) TextEmbedder {
+	return &modelEmbedder{embeddingService: embeddingService, embeddingModel: embeddingModel}
+}
+
+// EmbedTexts generates the embeddings of texts
+func (me *modelEmbedder) EmbedTexts(texts []string) ([][]float32, error) {
+	return me.embeddingService.GenerateTextEmbeddings(texts, me.embeddingModel)
+}
+
+// chunkEmbedder returns the TextEmbedder a chunking strategy needs, nil if it needs none
+func chunkEmbedder(embeddingService *EmbeddingService, strategy, embeddingModel string) TextEmbedder {
+	if strategy != "embedding" {
+		return nil
+	}
+	return NewModelEmbedder(embeddingService, embeddingModel)
+}
+
+// memoEmbedder remembers embeddings so that evaluating several configurations
+// of the embedding strategy embeds each sentence once
+type memoEmbedder struct {
+	embedder TextEmbedder
+	cache    map[string][]float32
+}
+
+// newMemoEmbedder wraps an embedder with a cache, nil stays nil
+func newMemoEmbedder(embedder TextEmbedder) TextEmbedder {
+	if embedder == nil {
+		return nil
+	}
+	if _, ok := embedder.(*memoEmbedder); ok {
+		return embedder
+	}
+	return &memoEmbedder{embedder: embedder, cache: make(map[string][]float32)}
+}
+
+// EmbedTexts embeds the texts not seen before
+func (me *memoEmbedder) EmbedTexts(texts []string) ([][]float32, error) {
+	var missing []string
+	for _, text := range texts {
+		if _, ok := me.cache[text]; !ok {
+			missing = append(missing, text)
+		}
+	}
+	if len(missing) > 0 {
+		embeddings, err := me.embedder.EmbedTexts(missing)
+		if err != nil {
+			return nil, err
+		}
+		for i, text := range missing {
+			me.cache[text] = embeddings[i]
+		}
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = me.cache[text]
+	}
+	return embeddings, nil
+}
+
+// createEmbeddingChunks splits content into sentences, embeds each sentence with
+// its neighbours and starts a new chunk where the similarity between consecutive
+// sentences drops below the configured percentile. Chunks stay between the
+// minimum chunk size and chunkSize. Falls back to semantic chunking when
+// sentences can't be embedded.
+func (cs *ChunkerService) createEmbeddingChunks(doc *domain.Document, content string, chunkSize int, overlap int) []*domain.DocumentChunk {
+	sentences := splitSentences(content)
+	if cs.config.Embedder == nil || len(sentences) < 3 {
+		return cs.createSemanticChunks(doc, content, chunkSize, overlap)
+	}
+
+	// Embed every sentence with its neighbours for a steadier signal
+	texts := make([]string, len(sentences))
+	for i := range sentences {
+		from, to := i-1, i+1
+		if from < 0 {
+			from = 0
+		}
+		if to >= len(sentences) {
+			to = len(sentences) - 1
+		}
+		texts[i] = content[sentences[from][0]:sentences[to][1]]
+	}
+	embeddings, err := cs.config.Embedder.EmbedTexts(texts)
+	if err == nil && len(embeddings) != len(texts) {
+		err = fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not embed the sentences of '%s', using semantic chunking: %v\n", doc.Name, err)
+		return cs.createSemanticChunks(doc, content, chunkSize, overlap)
+	}
+
+	similarities := make([]float64, len(sentences)-1)
+	for i := range similarities {
+		similarities[i] = embeddingSimilarity(embeddings[i], embeddings[i+1])
+	}
+	percentile := cs.config.BreakpointPercentile
+	if percentile <= 0 {
+		percentile = DefaultBreakpointPercentile
+	}
+	threshold := percentileOf(similarities, percentile)
+
+	minSize := cs.config.MinChunkSize
+	if minSize <= 0 {
+		minSize = chunkSize / 4
+	}
+
+	// Group sentences, breaking at low similarity once the minimum size is
+	// reached and before the maximum size is exceeded
+	var groups [][2]int
+	start, size := sentences[0][0], 0
+	for i, sentence := range sentences {
+		size += cs.measure(content[sentence[0]:sentence[1]])
+		breakHere := i == len(sentences)-1
+		if !breakHere {
+			next := sentences[i+1]
+			breakHere = size >= minSize && similarities[i] < threshold ||
+				size+cs.measure(content[next[0]:next[1]]) > chunkSize
+		}
+		if breakHere {
+			groups = append(groups, [2]int{start, sentence[1]})
+			start, size = sentence[1], 0
+		}
+	}
+
+	// Merge a last group below the minimum size into the previous one when it fits
+	if n := len(groups); n > 1 && cs.measure(content[groups[n-1][0]:groups[n-1][1]]) < minSize &&
+		cs.measure(content[groups[n-2][0]:groups[n-1][1]]) <= chunkSize {
+		groups[n-2][1] = groups[n-1][1]
+		groups = groups[:n-1]
+	}
+
+	var chunks []*domain.DocumentChunk
+	for _, group := range groups {
+		text := strings.TrimRight(content[group[0]:group[1]], " \t\r\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		// A single sentence longer than the maximum size is split further
+		if cs.measure(text) > chunkSize {
+			chunks = append(chunks, cs.splitParagraphIntoChunks(doc, text, chunkSize, overlap, group[0], len(chunks))...)
+			continue
+		}
+		chunks = append(chunks, domain.NewDocumentChunk(doc, text, group[0], group[0]+len(text), len(chunks)))
+	}
+
+	return chunks
+}
+
+// splitSentences returns the byte ranges of the sentences of content, each
+// including the whitespace that follows it
+func splitSentences(content string) [][2]int {
+	var sentences [][2]int
+	start := 0
+	for _, boundary := range sentenceBoundary.FindAllStringIndex(content, -1) {
+		if strings.TrimSpace(content[start:boundary[1]]) != "" {
+			sentences = append(sentences, [2]int{start, boundary[1]})
+			start = boundary[1]
+		}
+	}
+	if strings.TrimSpace(content[start:]) != "" {
+		sentences = append(sentences, [2]int{start, len(content)})
+	} else if len(sentences) > 0 {
+		sentences[len(sentences)-1][1] = len(content)
+	}
+	return sentences
+}
+
+// embeddingSimilarity returns the cosine similarity of two embeddings
+func embeddingSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// percentileOf returns the p-th percentile (0-100) of values, interpolating between ranks
+func percentileOf(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	if rank <= 0 {
+		return sorted[0]
+	}
+	if rank >= float64(len(sorted)-1) {
+		return sorted[len(sorted)-1]
+	}
+	lower := int(rank)
+	fraction := rank - float64(lower)
+	return sorted[lower] + fraction*(sorted[lower+1]-sorted[lower])
+}
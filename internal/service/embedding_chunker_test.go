@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topicEmbedder embeds texts on one axis per topic keyword they mention
+type topicEmbedder struct {
+	topics []string
+	calls  int
+	texts  int
+}
+
+func (te *topicEmbedder) EmbedTexts(texts []string) ([][]float32, error) {
+	te.calls++
+	te.texts += len(texts)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = make([]float32, len(te.topics))
+		for j, topic := range te.topics {
+			embeddings[i][j] = float32(strings.Count(strings.ToLower(text), topic))
+		}
+	}
+	return embeddings, nil
+}
+
+type failingEmbedder struct{}
+
+func (failingEmbedder) EmbedTexts(texts []string) ([][]float32, error) {
+	return nil, errors.New("embedding model unavailable")
+}
+
+func topicDocument() *domain.Document {
+	var sentences []string
+	for i := 0; i < 8; i++ {
+		sentences = append(sentences, "The cat sleeps on the warm windowsill all afternoon.")
+	}
+	for i := 0; i < 8; i++ {
+		sentences = append(sentences, "The rocket engine burns liquid oxygen during launch.")
+	}
+	for i := 0; i < 8; i++ {
+		sentences = append(sentences, "The bread dough rises slowly overnight in the kitchen.")
+	}
+	return domain.NewDocument("topics.txt", strings.Join(sentences, " "))
+}
+
+func TestEmbeddingChunksBreakAtTopicShifts(t *testing.T) {
+	doc := topicDocument()
+	embedder := &topicEmbedder{topics: []string{"cat", "rocket", "bread"}}
+	chunker := NewChunkerService(ChunkingConfig{
+		ChunkSize:        1000,
+		ChunkingStrategy: "embedding",
+		Embedder:         embedder,
+	})
+
+	chunks := chunker.ChunkDocument(doc)
+
+	require.Len(t, chunks, 3)
+	assert.True(t, strings.HasPrefix(chunks[0].Content, "The cat"))
+	assert.NotContains(t, chunks[0].Content, "rocket")
+	assert.True(t, strings.HasPrefix(chunks[1].Content, "The rocket"))
+	assert.NotContains(t, chunks[1].Content, "bread")
+	assert.True(t, strings.HasPrefix(chunks[2].Content, "The bread"))
+	for _, chunk := range chunks {
+		assert.Equal(t, doc.Content[chunk.StartPos:chunk.EndPos], chunk.Content)
+	}
+	assert.Equal(t, 1, embedder.calls, "sentences are embedded in one batch")
+}
+
+func TestEmbeddingChunksRespectMinAndMaxSizes(t *testing.T) {
+	doc := topicDocument()
+
+	// The maximum size wins over similarity
+	chunker := NewChunkerService(ChunkingConfig{
+		ChunkSize:        200,
+		ChunkingStrategy: "embedding",
+		Embedder:         &topicEmbedder{topics: []string{"cat", "rocket", "bread"}},
+	})
+	for _, chunk := range chunker.ChunkDocument(doc) {
+		assert.LessOrEqual(t, len(chunk.Content), 200)
+	}
+
+	// Topic shifts before the minimum size are ignored
+	chunker = NewChunkerService(ChunkingConfig{
+		ChunkSize:        1000,
+		MinChunkSize:     600,
+		ChunkingStrategy: "embedding",
+		Embedder:         &topicEmbedder{topics: []string{"cat", "rocket", "bread"}},
+	})
+	chunks := chunker.ChunkDocument(doc)
+	require.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.GreaterOrEqual(t, len(chunk.Content), 400)
+	}
+}
+
+func TestEmbeddingChunksFallBackWithoutEmbeddings(t *testing.T) {
+	doc := topicDocument()
+	chunker := NewChunkerService(ChunkingConfig{
+		ChunkSize:        500,
+		ChunkingStrategy: "embedding",
+		Embedder:         failingEmbedder{},
+	})
+
+	chunks := chunker.ChunkDocument(doc)
+	assert.NotEmpty(t, chunks)
+}
+
+func TestEvaluatorComparesEmbeddingStrategy(t *testing.T) {
+	doc := topicDocument()
+	embedder := &topicEmbedder{topics: []string{"cat", "rocket", "bread"}}
+	config := DefaultChunkingConfig()
+	config.Embedder = embedder
+	evaluator := NewChunkingEvaluator(NewChunkerService(config))
+
+	results := evaluator.CompareChunkingStrategies(doc)
+
+	strategies := make(map[string]bool)
+	for _, result := range results {
+		strategies[result.Strategy] = true
+	}
+	assert.True(t, strategies["embedding"])
+	assert.Equal(t, len(splitSentences(doc.Content)), embedder.texts, "each sentence is embedded once across configurations")
+
+	// Without an embedder the strategy is not compared
+	results = NewChunkingEvaluator(NewChunkerService(DefaultChunkingConfig())).CompareChunkingStrategies(doc)
+	for _, result := range results {
+		assert.NotEqual(t, "embedding", result.Strategy)
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	content := "First sentence. Second one!  Third?\n\nA paragraph without a period\n\nLast 文です。次"
+	var sentences []string
+	for _, span := range splitSentences(content) {
+		sentences = append(sentences, strings.TrimSpace(content[span[0]:span[1]]))
+	}
+	assert.Equal(t, []string{"First sentence.", "Second one!", "Third?", "A paragraph without a period", "Last 文です。", "次"}, sentences)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// retrievalInstruction is the query instruction of the BGE English models and
+// the models trained like them
+const retrievalInstruction = "Represent this sentence for searching relevant passages: "
+
+// knownEmbeddingPrefixes are the prefixes expected by embedding models trained
+// with instructions. The first pattern contained in the name of a model applies.
+var knownEmbeddingPrefixes = []struct {
+	pattern  string
+	prefixes domain.EmbeddingPrefixes
+}{
+	{"nomic-embed-text", domain.EmbeddingPrefixes{Query: "search_query: ", Passage: "search_document: "}},
+	{"snowflake-arctic-embed2", domain.EmbeddingPrefixes{Query: "query: "}},
+	{"arctic-embed-l-v2", domain.EmbeddingPrefixes{Query: "query: "}},
+	{"arctic-embed-m-v2", domain.EmbeddingPrefixes{Query: "query: "}},
+	{"arctic-embed", domain.EmbeddingPrefixes{Query: retrievalInstruction}},
+	{"bge-m3", domain.EmbeddingPrefixes{}}, // Trained without instructions
+	{"bge-", domain.EmbeddingPrefixes{Query: retrievalInstruction}},
+	{"mxbai-embed-large", domain.EmbeddingPrefixes{Query: retrievalInstruction}},
+	{"e5-", domain.EmbeddingPrefixes{Query: "query: ", Passage: "passage: "}},
+}
+
+// DefaultEmbeddingPrefixes returns the prefixes an embedding model expects, none
+// for the models it doesn't know. The tag and the namespace of the model name
+// are ignored: "jeffh/intfloat-multilingual-e5-large:f16" is an E5 model.
+func DefaultEmbeddingPrefixes(embeddingModel string) domain.EmbeddingPrefixes {
+	name := strings.ToLower(embeddingModel)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	name = path.Base(name)
+	for _, known := range knownEmbeddingPrefixes {
+		if strings.Contains(name, known.pattern) {
+			return known.prefixes
+		}
+	}
+	return domain.EmbeddingPrefixes{}
+}
+
+// embeddingPrefixesOrDefault returns the prefixes chosen for a RAG embedded by
+// a model, those the model expects when none were
+func embeddingPrefixesOrDefault(prefixes *domain.EmbeddingPrefixes, embeddingModel string) domain.EmbeddingPrefixes {
+	if prefixes == nil {
+		return DefaultEmbeddingPrefixes(embeddingModel)
+	}
+	return *prefixes
+}
+
+// printEmbeddingPrefixes shows the prefixes a RAG embeds with, if any
+func printEmbeddingPrefixes(prefixes domain.EmbeddingPrefixes, embeddingModel string) {
+	if prefixes == (domain.EmbeddingPrefixes{}) {
+		return
+	}
+	fmt.Printf("Embedding with %s prefixes: query %q, passage %q\n", embeddingModel, prefixes.Query, prefixes.Passage)
+}
+
+// WithPrefixes returns the service prepending prefixes to the queries and the
+// chunks it embeds, the service itself for empty prefixes. It shares the
+// provider and the cache of the service.
+func (es *EmbeddingService) WithPrefixes(prefixes domain.EmbeddingPrefixes) *EmbeddingService {
+	if prefixes == es.prefixes {
+		return es
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if prefixed, ok := es.prefixed[prefixes]; ok {
+		return prefixed
+	}
+
+	prefixed := NewEmbeddingServiceWithProvider(es.provider)
+	prefixed.ollamaClient = es.ollamaClient
+	prefixed.profile = es.profile
+	prefixed.maxWorkers = es.maxWorkers
+	prefixed.cache = es.cache
+	prefixed.prefixes = prefixes
+	for model, dimensions := range es.dimensions {
+		prefixed.dimensions[model] = dimensions
+	}
+	es.prefixed[prefixes] = prefixed
+	return prefixed
+}
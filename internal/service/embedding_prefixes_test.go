@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultEmbeddingPrefixes(t *testing.T) {
+	e5 := domain.EmbeddingPrefixes{Query: "query: ", Passage: "passage: "}
+	cases := map[string]domain.EmbeddingPrefixes{
+		"nomic-embed-text:latest":                  {Query: "search_query: ", Passage: "search_document: "},
+		"jeffh/intfloat-multilingual-e5-large:f16": e5,
+		"E5-Large-V2":                              e5,
+		"snowflake-arctic-embed2":                  {Query: "query: "},
+		"snowflake-arctic-embed:335m":              {Query: retrievalInstruction},
+		"bge-large-en-v1.5":                        {Query: retrievalInstruction},
+		"bge-m3":                                   {},
+		"llama3":                                   {},
+	}
+	for model, expected := range cases {
+		assert.Equal(t, expected, DefaultEmbeddingPrefixes(model), model)
+	}
+}
+
+func TestPrefixesAreAppliedAsymmetrically(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"e5-large": 4})
+	embeddingService.SetCache(nil)
+	rag := domain.NewRagSystem("prefixes", "llama3")
+	rag.EmbeddingPrefixes = &domain.EmbeddingPrefixes{Query: "query: ", Passage: "passage: "}
+	ragEmbedding, err := embeddingService.ForRag(rag)
+	require.NoError(t, err)
+
+	_, err = ragEmbedding.GenerateChunkEmbeddings([]*domain.DocumentChunk{{ID: "a", Content: "a passage"}}, "e5-large")
+	require.NoError(t, err)
+	_, err = ragEmbedding.GenerateQueryEmbedding("a question", "e5-large")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"embedding model check", "passage: a passage", "query: a question"}, fake.inputs)
+
+	// RAGs created before the prefixes were saved are embedded without any
+	rag.EmbeddingPrefixes = nil
+	ragEmbedding, err = embeddingService.ForRag(rag)
+	require.NoError(t, err)
+	_, err = ragEmbedding.GenerateQueryEmbedding("a question", "e5-large")
+	require.NoError(t, err)
+	assert.Equal(t, "a question", fake.inputs[len(fake.inputs)-1])
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/dontizi/rlama/internal/client"
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+const (
+	// DefaultEmbeddingRetries is the number of times a failed embedding request is sent again
+	DefaultEmbeddingRetries = 3
+
+	// DefaultEmbeddingFailureBudget is the share of the chunks of an ingest whose
+	// embedding may fail without aborting it; they are kept as pending
+	DefaultEmbeddingFailureBudget = 0.1
+
+	// maxEmbeddingRetryDelay bounds the wait between two attempts
+	maxEmbeddingRetryDelay = 30 * time.Second
+)
+
+var (
+	// EmbeddingRetries is the number of times a failed embedding request is sent again
+	EmbeddingRetries = DefaultEmbeddingRetries
+
+	// EmbeddingFailureBudget is the share of the chunks of an ingest, between 0
+	// and 1, whose embedding may fail without aborting it
+	EmbeddingFailureBudget = DefaultEmbeddingFailureBudget
+
+	// embeddingRetryDelay is the wait before the first retry, doubled after each one
+	embeddingRetryDelay = time.Second
+)
+
+// embedRetrying sends an embedding request, sending it again after transient
+// failures. The wait doubles after each attempt and is drawn between half and
+// all of it, so that concurrent workers don't retry in step.
+func (es *EmbeddingService) embedRetrying(embeddingModel string, texts []string) ([][]float32, error) {
+	delay := embeddingRetryDelay
+	for attempt := 0; ; attempt++ {
+		embeddings, err := es.provider.EmbedBatch(embeddingModel, texts)
+		if err == nil || attempt >= EmbeddingRetries || client.IsPermanentEmbedError(err) {
+			return embeddings, err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		fmt.Printf("\n⚠️ Embedding request failed (%v), retrying in %s (%d/%d)...\n",
+			err, wait.Round(time.Millisecond), attempt+1, EmbeddingRetries)
+		time.Sleep(wait)
+		delay *= 2
+		if delay > maxEmbeddingRetryDelay {
+			delay = maxEmbeddingRetryDelay
+		}
+	}
+}
+
+// embeddingFailureBudget returns the number of chunks out of total whose embedding may fail
+func embeddingFailureBudget(total int) int {
+	if EmbeddingFailureBudget <= 0 {
+		return 0
+	}
+	return int(float64(total) * EmbeddingFailureBudget)
+}
+
+// addEmbeddedChunks adds chunks to a RAG, those whose embedding failed as pending
+func addEmbeddedChunks(rag *domain.RagSystem, chunks []*domain.DocumentChunk, failed []*domain.DocumentChunk) {
+	pending := make(map[*domain.DocumentChunk]bool, len(failed))
+	for _, chunk := range failed {
+		pending[chunk] = true
+	}
+	for _, chunk := range chunks {
+		if pending[chunk] {
+			rag.AddPendingChunk(chunk)
+		} else {
+			rag.AddChunk(chunk)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Printf("⚠️ %d chunks could not be embedded and are pending: the next add-docs or watch check embeds them again.\n", len(failed))
+	}
+}
+
+// embedPendingChunks embeds again the chunks of a RAG whose embedding failed
+// during a previous ingest. Those failing again stay pending.
+func embedPendingChunks(rag *domain.RagSystem, embeddingService *EmbeddingService, embeddingModel string) {
+	pending := rag.GetPendingChunks()
+	if len(pending) == 0 {
+		return
+	}
+
+	fmt.Printf("Embedding %d pending chunks...\n", len(pending))
+	failed, err := embeddingService.GenerateChunkEmbeddings(pending, embeddingModel)
+	if err != nil {
+		fmt.Printf("⚠️ The pending chunks could not be embedded, they stay pending: %v\n", err)
+		return
+	}
+
+	stillPending := make(map[*domain.DocumentChunk]bool, len(failed))
+	for _, chunk := range failed {
+		stillPending[chunk] = true
+	}
+	for _, chunk := range pending {
+		if !stillPending[chunk] {
+			rag.EmbedPendingChunk(chunk)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Printf("⚠️ %d chunks are still pending.\n", len(failed))
+	}
+}
@@ -10,202 +10,389 @@ import (
 	"github.com/dontizi/rlama/internal/domain"
 )
 
-// EmbeddingService manages the generation of embeddings for documents
+// DefaultEmbeddingModel is the embedding model of RAGs created without --embedding-model
+const DefaultEmbeddingModel = "snowflake-arctic-embed2"
+
+// EmbeddingService manages the generation of embeddings for documents. Every
+// method embeds with exactly the model it is given: mixing the embeddings of
+// two models in a RAG would make its search meaningless.
 type EmbeddingService struct {
-	ollamaClient *client.OllamaClient
-	maxWorkers   int // Number of parallel workers for embedding generation
+	provider     client.EmbeddingProvider
+	ollamaClient *client.OllamaClient // Pulls missing models; nil when the provider is not Ollama
+	profile      string               // API profile of the provider, empty for Ollama
+	maxWorkers   int                  // Number of embedding requests sent at once
+	cache        *EmbeddingCache
+	prefixes     domain.EmbeddingPrefixes // Prepended to queries and chunks
+
+	cacheWarning sync.Once
+
+	mu         sync.Mutex
+	dimensions map[string]int                                 // Embedding size of the models checked so far
+	profiles   map[string]*EmbeddingService                   // Services of the API profiles used so far
+	prefixed   map[domain.EmbeddingPrefixes]*EmbeddingService // Services of the prefixes used so far
 }
 
-// NewEmbeddingService creates a new instance of EmbeddingService
+// NewEmbeddingService creates a new instance of EmbeddingService embedding with Ollama
 func NewEmbeddingService(ollamaClient *client.OllamaClient) *EmbeddingService {
 	if ollamaClient == nil {
 		ollamaClient = client.NewDefaultOllamaClient()
 	}
+	es := NewEmbeddingServiceWithProvider(ollamaClient)
+	es.ollamaClient = ollamaClient
+	es.maxWorkers = ollamaClient.EmbeddingConcurrency()
+	return es
+}
+
+// NewEmbeddingServiceWithProvider creates an EmbeddingService embedding with any provider
+func NewEmbeddingServiceWithProvider(provider client.EmbeddingProvider) *EmbeddingService {
 	return &EmbeddingService{
-		ollamaClient: ollamaClient,
-		maxWorkers:   3, // Default to 3 workers
+		provider:   provider,
+		maxWorkers: client.DefaultEmbedConcurrency,
+		cache:      DefaultEmbeddingCache(),
+		dimensions: make(map[string]int),
+		profiles:   make(map[string]*EmbeddingService),
+		prefixed:   make(map[domain.EmbeddingPrefixes]*EmbeddingService),
 	}
 }
 
-// SetMaxWorkers sets the maximum number of parallel workers for embedding generation
+// ForProfile returns the service embedding with the OpenAI-compatible server of
+// an API profile, the service itself for an empty profile
+func (es *EmbeddingService) ForProfile(profileName string) (*EmbeddingService, error) {
+	if profileName == "" || profileName == es.profile {
+		return es, nil
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if profileService, ok := es.profiles[profileName]; ok {
+		return profileService, nil
+	}
+
+	openAIClient, err := client.NewOpenAIClientWithProfile(profileName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading embedding profile: %w", err)
+	}
+	profileService := NewEmbeddingServiceWithProvider(openAIClient)
+	profileService.profile = profileName
+	profileService.maxWorkers = es.maxWorkers
+	profileService.cache = es.cache
+	es.profiles[profileName] = profileService
+	return profileService, nil
+}
+
+// ForRag returns the service embedding with the provider and the prefixes of a RAG
+func (es *EmbeddingService) ForRag(rag *domain.RagSystem) (*EmbeddingService, error) {
+	profileService, err := es.ForProfile(rag.EmbeddingProfile)
+	if err != nil || rag.EmbeddingPrefixes == nil {
+		return profileService, err
+	}
+	return profileService.WithPrefixes(*rag.EmbeddingPrefixes), nil
+}
+
+// cacheModel returns the name of a model in the cache: the same model served
+// by two providers may not produce the same embeddings
+func (es *EmbeddingService) cacheModel(embeddingModel string) string {
+	if es.profile == "" {
+		return embeddingModel
+	}
+	return embeddingModel + "@" + es.profile
+}
+
+// SetMaxWorkers sets the number of embedding requests sent at once, at least 1
 func (es *EmbeddingService) SetMaxWorkers(workers int) {
 	if workers < 1 {
 		workers = 1
-	} else if workers > 5 {
-		workers = 5
 	}
 	es.maxWorkers = workers
 }
 
-// GenerateEmbeddings generates embeddings for a list of documents
-func (es *EmbeddingService) GenerateEmbeddings(docs []*domain.Document, modelName string) error {
-	// Try to use snowflake-arctic-embed2 for embeddings first
-	embeddingModel := "snowflake-arctic-embed2"
-	
-	// Process all documents
-	for _, doc := range docs {
-		// Generate embedding with snowflake-arctic-embed2 first
-		embedding, err := es.ollamaClient.GenerateEmbedding(embeddingModel, doc.Content)
-		
-		// If snowflake-arctic-embed2 fails, try to pull it automatically
-		if err != nil {
-			fmt.Printf("⚠️ Could not use %s for embeddings: %v\n", embeddingModel, err)
-			
-			// Attempt to pull the embedding model automatically
-			fmt.Printf("Attempting to pull %s automatically...\n", embeddingModel)
-			pullErr := es.pullEmbeddingModel(embeddingModel)
-			
-			if pullErr == nil {
-				// Try again with the pulled model
-				embedding, err = es.ollamaClient.GenerateEmbedding(embeddingModel, doc.Content)
+// SetCache sets the cache of the embeddings, nil to always ask the provider
+func (es *EmbeddingService) SetCache(cache *EmbeddingCache) {
+	es.cache = cache
+}
+
+// embeddingModelOrDefault returns the embedding model chosen for a new RAG,
+// DefaultEmbeddingModel when none was
+func embeddingModelOrDefault(embeddingModel string) string {
+	if embeddingModel == "" {
+		return DefaultEmbeddingModel
+	}
+	return embeddingModel
+}
+
+// CheckEmbeddingModel checks that a model can embed text, pulling it once if
+// Ollama doesn't have it, and returns the size of its embeddings
+func (es *EmbeddingService) CheckEmbeddingModel(embeddingModel string) (int, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if dimensions, ok := es.dimensions[embeddingModel]; ok {
+		return dimensions, nil
+	}
+
+	check := []string{"embedding model check"}
+	embeddings, err := es.provider.EmbedBatch(embeddingModel, check)
+	if err != nil && es.ollamaClient != nil {
+		fmt.Printf("⚠️ Could not use %s for embeddings: %v\n", embeddingModel, err)
+		if es.pullEmbeddingModel(embeddingModel) == nil {
+			embeddings, err = es.provider.EmbedBatch(embeddingModel, check)
+		}
+	}
+	if err != nil {
+		if es.profile != "" {
+			return 0, fmt.Errorf("embedding model %s is not available with profile '%s': %w", embeddingModel, es.profile, err)
+		}
+		return 0, fmt.Errorf("embedding model %s is not available: %w", embeddingModel, err)
+	}
+	if len(embeddings[0]) == 0 {
+		return 0, fmt.Errorf("embedding model %s returned an empty embedding", embeddingModel)
+	}
+
+	es.dimensions[embeddingModel] = len(embeddings[0])
+	return len(embeddings[0]), nil
+}
+
+// ResolveEmbeddingModel returns the embedding model of a RAG. RAGs created
+// before the model was saved were embedded with DefaultEmbeddingModel or, when
+// it was unavailable, with their chat model: the one producing embeddings of
+// the size of the stored ones is recorded on the RAG, saved with it next time.
+func (es *EmbeddingService) ResolveEmbeddingModel(rag *domain.RagSystem) (string, error) {
+	if rag.EmbeddingModel != "" {
+		return rag.EmbeddingModel, nil
+	}
+	ragEmbedding, err := es.ForRag(rag)
+	if err != nil {
+		return "", err
+	}
+
+	stored := rag.EmbeddingDimensions()
+	for _, candidate := range []string{DefaultEmbeddingModel, rag.ModelName} {
+		dimensions, err := ragEmbedding.CheckEmbeddingModel(candidate)
+		if err == nil && (stored == 0 || dimensions == stored) {
+			rag.EmbeddingModel = candidate
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("cannot tell which model embedded the chunks of RAG '%s': neither %s nor %s produces embeddings of %d dimensions like them",
+		rag.Name, DefaultEmbeddingModel, rag.ModelName, stored)
+}
+
+// embedTexts embeds texts with a model. Embeddings of the size the model
+// produces are taken from the cache; the others are generated, once for texts
+// appearing several times, and cached.
+func (es *EmbeddingService) embedTexts(embeddingModel string, texts []string, dimensions int) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	var missing []string
+	positions := make(map[string][]int) // Positions of each missing text
+	for i, text := range texts {
+		if es.cache != nil {
+			if embedding, ok := es.cache.Get(text, es.cacheModel(embeddingModel)); ok && len(embedding) == dimensions {
+				embeddings[i] = embedding
+				continue
 			}
-			
-			// If pulling failed or embedding still fails, fallback to the specified model
-			if pullErr != nil || err != nil {
-				fmt.Printf("Falling back to %s for embeddings.\n", modelName)
-				embedding, err = es.ollamaClient.GenerateEmbedding(modelName, doc.Content)
-				if err != nil {
-					return fmt.Errorf("error generating embedding for %s: %w", doc.Path, err)
-				}
+		}
+		if _, ok := positions[text]; !ok {
+			missing = append(missing, text)
+		}
+		positions[text] = append(positions[text], i)
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	generated, err := es.embedRetrying(embeddingModel, missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, text := range missing {
+		for _, i := range positions[text] {
+			embeddings[i] = generated[j]
+		}
+		if es.cache != nil && len(generated[j]) == dimensions {
+			if err := es.cache.Set(text, es.cacheModel(embeddingModel), generated[j]); err != nil {
+				es.cacheWarning.Do(func() { fmt.Printf("⚠️ Could not cache embeddings: %v\n", err) })
 			}
 		}
+	}
+	return embeddings, nil
+}
 
-		doc.Embedding = embedding
+// GenerateEmbeddings generates embeddings for a list of documents
+func (es *EmbeddingService) GenerateEmbeddings(docs []*domain.Document, embeddingModel string) error {
+	dimensions, err := es.CheckEmbeddingModel(embeddingModel)
+	if err != nil {
+		return err
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = es.prefixes.Passage + doc.Content
+	}
+	embeddings, err := es.embedTexts(embeddingModel, texts, dimensions)
+	if err != nil {
+		return fmt.Errorf("error generating document embeddings with %s: %w", embeddingModel, err)
+	}
+	for i, doc := range docs {
+		doc.Embedding = embeddings[i]
 	}
 
 	return nil
 }
 
 // GenerateQueryEmbedding generates an embedding for a query
-func (es *EmbeddingService) GenerateQueryEmbedding(query string, modelName string) ([]float32, error) {
-	// Try to use snowflake-arctic-embed2 for embeddings first
-	embeddingModel := "snowflake-arctic-embed2"
-	
-	// Generate embedding with snowflake-arctic-embed2
-	embedding, err := es.ollamaClient.GenerateEmbedding(embeddingModel, query)
-	
-	// If snowflake-arctic-embed2 fails, try to pull it (but only if not already tried)
+func (es *EmbeddingService) GenerateQueryEmbedding(query string, embeddingModel string) ([]float32, error) {
+	dimensions, err := es.CheckEmbeddingModel(embeddingModel)
 	if err != nil {
-		// We don't need to show the warning again if already shown in GenerateEmbeddings
-		// Attempt to pull the model (this is a no-op if we already tried)
-		pullErr := es.pullEmbeddingModel(embeddingModel)
-		
-		if pullErr == nil {
-			// Try again with the pulled model
-			embedding, err = es.ollamaClient.GenerateEmbedding(embeddingModel, query)
-		}
-		
-		// If pulling failed or embedding still fails, fallback to the specified model
-		if pullErr != nil || err != nil {
-			embedding, err = es.ollamaClient.GenerateEmbedding(modelName, query)
-			if err != nil {
-				return nil, fmt.Errorf("error generating embedding for query: %w", err)
-			}
+		return nil, err
+	}
+
+	embeddings, err := es.embedTexts(embeddingModel, []string{es.prefixes.Query + query}, dimensions)
+	if err != nil {
+		return nil, fmt.Errorf("error generating embedding for query with %s: %w", embeddingModel, err)
+	}
+	return embeddings[0], nil
+}
+
+// GenerateRagQueryEmbedding generates the embedding of a query with the model
+// that embedded the chunks of a RAG
+func (es *EmbeddingService) GenerateRagQueryEmbedding(rag *domain.RagSystem, query string) ([]float32, error) {
+	ragEmbedding, err := es.ForRag(rag)
+	if err != nil {
+		return nil, err
+	}
+	embeddingModel, err := ragEmbedding.ResolveEmbeddingModel(rag)
+	if err != nil {
+		return nil, err
+	}
+	return ragEmbedding.GenerateQueryEmbedding(query, embeddingModel)
+}
+
+// GenerateChunkEmbeddings generates embeddings for document chunks, sending
+// batches of chunks to the provider with several workers. A batch still failing
+// after its retries doesn't stop the others: its chunks are returned as failed,
+// unless more chunks than the failure budget allows fail, which is an error.
+func (es *EmbeddingService) GenerateChunkEmbeddings(chunks []*domain.DocumentChunk, embeddingModel string) ([]*domain.DocumentChunk, error) {
+	dimensions, err := es.CheckEmbeddingModel(embeddingModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches [][]*domain.DocumentChunk
+	for start := 0; start < len(chunks); start += client.DefaultEmbedBatchSize {
+		end := start + client.DefaultEmbedBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
 		}
+		batches = append(batches, chunks[start:end])
+	}
+	workers := es.maxWorkers
+	if workers > len(batches) {
+		workers = len(batches)
 	}
 
-	return embedding, nil
-}
-
-// GenerateChunkEmbeddings generates embeddings for document chunks in parallel
-func (es *EmbeddingService) GenerateChunkEmbeddings(chunks []*domain.DocumentChunk, modelName string) error {
-	// Try to use snowflake-arctic-embed2 for embeddings first
-	embeddingModel := "snowflake-arctic-embed2"
-	
-	// Create a wait group to synchronize goroutines
-	var wg sync.WaitGroup
-	
-	// Create a channel to limit concurrency
-	semaphore := make(chan struct{}, es.maxWorkers)
-	
-	// Create a channel for errors
-	errorChan := make(chan error, len(chunks))
-	
-	// Create a mutex for printing progress
-	var progressMutex sync.Mutex
-	var completedChunks int
-	
-	// Check if we need to pull the model (attempt only once)
-	modelChecked := false
-	var modelCheckMutex sync.Mutex
-	
-	// Process chunks in parallel
-	for i, chunk := range chunks {
-		// Add to wait group before starting goroutine
+	// Exceeding the failure budget stops the distribution of batches
+	budget := embeddingFailureBudget(len(chunks))
+	var (
+		failed    []*domain.DocumentChunk
+		lastErr   error
+		stopOnce  sync.Once
+		stop      = make(chan struct{})
+		queue     = make(chan []*domain.DocumentChunk)
+		wg        sync.WaitGroup
+		progress  sync.Mutex
+		completed int
+	)
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		
-		// Start a goroutine to process this chunk
-		go func(index int, ch *domain.DocumentChunk) {
+		go func() {
 			defer wg.Done()
-			
-			// Acquire semaphore slot (this limits concurrency)
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-			
-			// Generate embedding
-			embedding, err := es.ollamaClient.GenerateEmbedding(embeddingModel, ch.Content)
-			
-			// If the model fails and we haven't checked it yet
-			if err != nil {
-				modelCheckMutex.Lock()
-				shouldCheck := !modelChecked
-				modelChecked = true
-				modelCheckMutex.Unlock()
-				
-				if shouldCheck {
-					// Only print the warning and attempt to pull once
-					fmt.Printf("\n⚠️ Could not use %s for embeddings: %v\n", embeddingModel, err)
-					fmt.Printf("Attempting to pull %s automatically...\n", embeddingModel)
-					pullErr := es.pullEmbeddingModel(embeddingModel)
-					
-					if pullErr == nil {
-						// Try again with the pulled model
-						embedding, err = es.ollamaClient.GenerateEmbedding(embeddingModel, ch.Content)
-					}
-					
-					if pullErr != nil || err != nil {
-						fmt.Printf("Falling back to %s for embeddings.\n", modelName)
-					}
-				}
-				
-				// Use the specified model instead if the embedding model failed
+			for batch := range queue {
+				err := es.embedChunkBatch(batch, embeddingModel, dimensions)
+
+				progress.Lock()
 				if err != nil {
-					embedding, err = es.ollamaClient.GenerateEmbedding(modelName, ch.Content)
-					if err != nil {
-						errorChan <- fmt.Errorf("error generating embedding for chunk %s: %w", ch.ID, err)
-						return
+					failed = append(failed, batch...)
+					lastErr = err
+					if len(failed) > budget {
+						stopOnce.Do(func() { close(stop) })
+					} else {
+						fmt.Printf("\n⚠️ %v\n", err)
 					}
+				} else {
+					completed += len(batch)
+					fmt.Printf("Generating embeddings: %d/%d chunks processed (%d%%)   \r",
+						completed, len(chunks), completed*100/len(chunks))
 				}
+				progress.Unlock()
 			}
-			
-			// Update the chunk with the embedding
-			ch.Embedding = embedding
-			
-			// Update progress
-			progressMutex.Lock()
-			completedChunks++
-			fmt.Printf("Generating embeddings: %d/%d chunks processed (%d%%)   \r", 
-				completedChunks, len(chunks), (completedChunks * 100 / len(chunks)))
-			progressMutex.Unlock()
-			
-		}(i, chunk)
-	}
-	
-	// Wait for all goroutines to complete
+		}()
+	}
+
+distribute:
+	for _, batch := range batches {
+		select {
+		case queue <- batch:
+		case <-stop:
+			break distribute
+		}
+	}
+	close(queue)
 	wg.Wait()
-	close(errorChan)
-	
-	// Check if any errors occurred
-	for err := range errorChan {
-		return err // Return the first error encountered
+	if len(failed) > budget {
+		return nil, fmt.Errorf("the embedding of %d chunks failed, more than the failure budget of %d: %w",
+			len(failed), budget, lastErr)
 	}
-	
+
 	fmt.Println() // Add a newline after progress indicator
-	fmt.Printf("Successfully generated embeddings for %d chunks using %d parallel workers\n", 
-		len(chunks), es.maxWorkers)
+	if len(failed) > 0 {
+		fmt.Printf("Generated embeddings for %d of %d chunks with %s using %d parallel workers, %d failed\n",
+			completed, len(chunks), embeddingModel, workers, len(failed))
+		return failed, nil
+	}
+	fmt.Printf("Successfully generated embeddings for %d chunks with %s using %d parallel workers\n",
+		len(chunks), embeddingModel, workers)
+	return nil, nil
+}
+
+// embedChunkBatch embeds a batch of chunks, checking the size of every embedding
+func (es *EmbeddingService) embedChunkBatch(batch []*domain.DocumentChunk, embeddingModel string, dimensions int) error {
+	texts := make([]string, len(batch))
+	for i, chunk := range batch {
+		texts[i] = es.prefixes.Passage + chunk.IndexedContent()
+	}
+
+	embeddings, err := es.embedTexts(embeddingModel, texts, dimensions)
+	if err != nil {
+		return fmt.Errorf("error generating embeddings for chunks %s to %s with %s: %w",
+			batch[0].ID, batch[len(batch)-1].ID, embeddingModel, err)
+	}
+	// Checked before any is set, so that a failed batch gets no embedding
+	for i, chunk := range batch {
+		if len(embeddings[i]) != dimensions {
+			return fmt.Errorf("%s returned an embedding of %d dimensions instead of %d for chunk %s",
+				embeddingModel, len(embeddings[i]), dimensions, chunk.ID)
+		}
+	}
+	for i, chunk := range batch {
+		chunk.Embedding = embeddings[i]
+	}
 	return nil
 }
 
+// GenerateTextEmbeddings generates the embeddings of texts in batches, without
+// prefixes: they are compared with each other, not with queries
+func (es *EmbeddingService) GenerateTextEmbeddings(texts []string, embeddingModel string) ([][]float32, error) {
+	dimensions, err := es.CheckEmbeddingModel(embeddingModel)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings, err := es.embedTexts(embeddingModel, texts, dimensions)
+	if err != nil {
+		return nil, fmt.Errorf("error generating embeddings with %s: %w", embeddingModel, err)
+	}
+	return embeddings, nil
+}
+
 // Track if we've already tried to pull the model to avoid multiple attempts
 var attemptedModelPull = make(map[string]bool)
 
@@ -215,22 +402,22 @@ func (es *EmbeddingService) pullEmbeddingModel(modelName string) error {
 	if attemptedModelPull[modelName] {
 		return fmt.Errorf("already attempted to pull model")
 	}
-	
+
 	// Mark that we've attempted to pull this model
 	attemptedModelPull[modelName] = true
-	
+
 	// Check if Ollama CLI is available
 	cmd := exec.Command("ollama", "list")
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("ollama command not available: %w", err)
 	}
-	
+
 	fmt.Printf("Pulling %s model (this may take a while)...\n", modelName)
-	
+
 	// Run the ollama pull command
 	cmd = exec.Command("ollama", "pull", modelName)
 	cmd.Stdout = os.Stdout // Display output to the user
 	cmd.Stderr = os.Stderr
-	
+
 	return cmd.Run()
-} 
\ No newline at end of file
+}
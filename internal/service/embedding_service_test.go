@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dontizi/rlama/internal/client"
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/dontizi/rlama/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEmbeddingServer serves /api/embed and /api/embeddings for models with a
+// fixed embedding size and counts the requests per model; other models are unknown.
+// Requests embedding the text failOn fail, only the first failures times when it is set.
+type fakeEmbeddingServer struct {
+	dimensions map[string]int
+	mu         sync.Mutex
+	models     map[string]int
+	failOn     string
+	failures   int
+	inputs     []string // Texts embedded, in the order received
+}
+
+func newFakeEmbeddingService(t *testing.T, dimensions map[string]int) (*EmbeddingService, *fakeEmbeddingServer) {
+	// Embeddings are cached in a data directory of the test
+	t.Setenv("RLAMA_DATA_DIR", t.TempDir())
+	previousDelay := embeddingRetryDelay
+	embeddingRetryDelay = time.Millisecond
+	t.Cleanup(func() { embeddingRetryDelay = previousDelay })
+
+	fake := &fakeEmbeddingServer{dimensions: dimensions, models: make(map[string]int)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req client.EmbedRequest
+		require.Equal(t, "/api/embed", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		fake.mu.Lock()
+		fake.models[req.Model]++
+		fake.inputs = append(fake.inputs, req.Input...)
+		fail := false
+		for _, input := range req.Input {
+			fail = fail || input != "" && input == fake.failOn
+		}
+		if fail && fake.failures > 0 {
+			fake.failures--
+			if fake.failures == 0 {
+				fake.failOn = ""
+			}
+		}
+		fake.mu.Unlock()
+		if fail {
+			http.Error(w, `{"error":"embedding failed"}`, http.StatusInternalServerError)
+			return
+		}
+
+		size, ok := fake.dimensions[req.Model]
+		if !ok {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		resp := client.EmbedResponse{}
+		for range req.Input {
+			resp.Embeddings = append(resp.Embeddings, make([]float32, size))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	// Models unknown to the server are not pulled during the tests
+	for model := range map[string]bool{DefaultEmbeddingModel: true, "llama3": true, "missing-embed": true} {
+		attemptedModelPull[model] = true
+	}
+	return NewEmbeddingService(&client.OllamaClient{BaseURL: server.URL, Client: server.Client()}), fake
+}
+
+func TestChunkEmbeddingsUseOnlyTheGivenModel(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4, "llama3": 8})
+	chunks := []*domain.DocumentChunk{{ID: "a", Content: "first"}, {ID: "b", Content: "second"}}
+
+	failed, err := embeddingService.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Len(t, chunks[0].Embedding, 4)
+	assert.Len(t, chunks[1].Embedding, 4)
+	assert.Equal(t, map[string]int{"bge-m3": 2}, fake.models, "one check and one batch")
+
+	// A missing model is an error, never a fallback to another one
+	_, err = embeddingService.GenerateChunkEmbeddings(chunks, "missing-embed")
+	assert.ErrorContains(t, err, "embedding model missing-embed is not available")
+	assert.NotContains(t, fake.models, "llama3")
+}
+
+func TestChunkEmbeddingsAreBatched(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4})
+	embeddingService.SetMaxWorkers(10)
+	assert.Equal(t, 10, embeddingService.maxWorkers, "the concurrency is not capped")
+
+	chunks := make([]*domain.DocumentChunk, 3*client.DefaultEmbedBatchSize+1)
+	for i := range chunks {
+		chunks[i] = &domain.DocumentChunk{ID: fmt.Sprintf("chunk_%d", i), Content: fmt.Sprintf("text %d", i)}
+	}
+	failed, err := embeddingService.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	for _, chunk := range chunks {
+		assert.Len(t, chunk.Embedding, 4)
+	}
+	assert.Equal(t, 5, fake.models["bge-m3"], "one check and four batches")
+}
+
+func TestEmbeddingsAreCached(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4, "nomic-embed-text": 8})
+	chunks := []*domain.DocumentChunk{{ID: "a", Content: "first"}, {ID: "b", Content: "second"}}
+	_, err := embeddingService.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	_, err = embeddingService.GenerateQueryEmbedding("a question", "bge-m3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, fake.models["bge-m3"])
+
+	// Another service of the same data directory embeds nothing again
+	again := NewEmbeddingService(embeddingService.ollamaClient)
+	chunks = []*domain.DocumentChunk{{ID: "c", Content: "second "}, {ID: "d", Content: "first"}}
+	_, err = again.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	_, err = again.GenerateQueryEmbedding("a  question", "bge-m3")
+	require.NoError(t, err)
+	assert.Len(t, chunks[0].Embedding, 4)
+	assert.Equal(t, 4, fake.models["bge-m3"], "only the model check")
+
+	// The cache is per model
+	_, err = again.GenerateChunkEmbeddings(chunks, "nomic-embed-text")
+	require.NoError(t, err)
+	assert.Len(t, chunks[0].Embedding, 8)
+	assert.Equal(t, 2, fake.models["nomic-embed-text"])
+}
+
+func TestRagEmbeddingProfileUsesOpenAICompatibleServer(t *testing.T) {
+	t.Setenv("RLAMA_DATA_DIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir()) // API profiles are stored in the home directory
+
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/embeddings", r.URL.Path)
+		var req client.OpenAIEmbeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		models = append(models, req.Model)
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [0.1, 0.2, 0.3]}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	profile := domain.NewAPIProfile("local", "openai", "")
+	profile.BaseURL = server.URL + "/v1/"
+	require.NoError(t, repository.NewProfileRepository().Save(profile))
+
+	// The Ollama service of the RAG service hands over to the profile's server
+	ollama, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4})
+	rag := domain.NewRagSystem("docs", "llama3")
+	rag.EmbeddingModel = "nomic-embed-text"
+	rag.EmbeddingProfile = "local"
+
+	embedding, err := ollama.GenerateRagQueryEmbedding(rag, "a question")
+	require.NoError(t, err)
+	assert.Len(t, embedding, 3)
+	assert.Equal(t, []string{"nomic-embed-text", "nomic-embed-text"}, models, "one check and the query")
+	assert.Empty(t, fake.models)
+
+	_, err = ollama.ForProfile("missing")
+	assert.Error(t, err)
+}
+
+func TestResolveEmbeddingModel(t *testing.T) {
+	embeddingService, _ := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4, "llama3": 8})
+
+	rag := domain.NewRagSystem("docs", "llama3")
+	rag.EmbeddingModel = "bge-m3"
+	model, err := embeddingService.ResolveEmbeddingModel(rag)
+	require.NoError(t, err)
+	assert.Equal(t, "bge-m3", model)
+
+	// RAGs saved without a model were embedded with the chat model when the
+	// default embedding model was unavailable
+	legacy := domain.NewRagSystem("legacy", "llama3")
+	legacy.HybridStore.Add("chunk", make([]float32, 8))
+	model, err = embeddingService.ResolveEmbeddingModel(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "llama3", model)
+	assert.Equal(t, "llama3", legacy.EmbeddingModel)
+
+	// Embeddings of a size no available model produces are an error
+	unknown := domain.NewRagSystem("unknown", "llama3")
+	unknown.HybridStore.Add("chunk", make([]float32, 16))
+	_, err = embeddingService.ResolveEmbeddingModel(unknown)
+	assert.Error(t, err)
+}
+
+func TestChunkEmbeddingsAreRetried(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4})
+	chunks := []*domain.DocumentChunk{{ID: "a", Content: "first"}, {ID: "b", Content: "second"}}
+
+	// Two transient failures are absorbed by the retries
+	fake.failOn, fake.failures = "second", 2
+	failed, err := embeddingService.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Len(t, chunks[1].Embedding, 4)
+}
+
+func TestChunkEmbeddingFailureBudget(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4})
+	embeddingService.SetMaxWorkers(1)
+	chunks := make([]*domain.DocumentChunk, 2*client.DefaultEmbedBatchSize)
+	for i := range chunks {
+		chunks[i] = &domain.DocumentChunk{ID: fmt.Sprintf("chunk_%d", i), Content: fmt.Sprintf("text %d", i)}
+	}
+
+	// A batch failing for good is returned, the other one is embedded
+	fake.failOn = "text 3"
+	previousBudget := EmbeddingFailureBudget
+	t.Cleanup(func() { EmbeddingFailureBudget = previousBudget })
+	EmbeddingFailureBudget = 0.5
+	failed, err := embeddingService.GenerateChunkEmbeddings(chunks, "bge-m3")
+	require.NoError(t, err)
+	assert.Len(t, failed, client.DefaultEmbedBatchSize)
+	assert.Nil(t, chunks[3].Embedding)
+	assert.Len(t, chunks[len(chunks)-1].Embedding, 4)
+
+	// Past the budget, the whole ingest fails
+	EmbeddingFailureBudget = 0.1
+	_, err = embeddingService.GenerateChunkEmbeddings(chunks[:client.DefaultEmbedBatchSize], "bge-m3")
+	assert.ErrorContains(t, err, "failure budget")
+}
+
+func TestPendingChunksAreEmbeddedLater(t *testing.T) {
+	embeddingService, _ := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4})
+	rag := domain.NewRagSystem("pending-test", "llama3")
+	rag.EmbeddingModel = "bge-m3"
+	chunks := []*domain.DocumentChunk{
+		{ID: "a", DocumentID: "doc", Content: "first", Embedding: make([]float32, 4)},
+		{ID: "b", DocumentID: "doc", Content: "second"},
+	}
+	addEmbeddedChunks(rag, chunks, chunks[1:])
+	assert.Equal(t, []string{"b"}, rag.PendingChunks)
+
+	// The pending chunks are saved with the RAG
+	ragRepository := repository.NewRagRepository()
+	require.NoError(t, ragRepository.Save(rag))
+	rag, err := ragRepository.Load("pending-test")
+	require.NoError(t, err)
+	require.Len(t, rag.GetPendingChunks(), 1)
+
+	embedPendingChunks(rag, embeddingService, "bge-m3")
+	assert.Empty(t, rag.PendingChunks)
+	assert.Len(t, rag.GetChunkByID("b").Embedding, 4)
+}
@@ -41,30 +41,43 @@ func (fw *FileWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 
 	// Get the last modified time of the directory
 	lastModified := getLastModifiedTime(rag.WatchedDir)
-	
-	// If the directory hasn't been modified since last check, no need to proceed
-	if !lastModified.After(rag.LastWatchedAt) && !rag.LastWatchedAt.IsZero() {
+
+	// If the directory hasn't been modified since last check, no need to
+	// proceed, unless chunks are waiting for their embedding
+	if !lastModified.After(rag.LastWatchedAt) && !rag.LastWatchedAt.IsZero() && len(rag.PendingChunks) == 0 {
 		return 0, nil
 	}
 
 	// Convert watch options to document loader options
 	loaderOptions := DocumentLoaderOptions{
-		ExcludeDirs:  rag.WatchOptions.ExcludeDirs,
-		ExcludeExts:  rag.WatchOptions.ExcludeExts,
-		ProcessExts:  rag.WatchOptions.ProcessExts,
-		ChunkSize:    rag.WatchOptions.ChunkSize,
-		ChunkOverlap: rag.WatchOptions.ChunkOverlap,
-	}
-
-	// Get existing document paths to avoid re-processing
+		ExcludeDirs:     rag.WatchOptions.ExcludeDirs,
+		ExcludeExts:     rag.WatchOptions.ExcludeExts,
+		ProcessExts:     rag.WatchOptions.ProcessExts,
+		IncludePatterns: rag.WatchOptions.IncludePatterns,
+		ExcludePatterns: rag.WatchOptions.ExcludePatterns,
+		UseGitignore:    rag.WatchOptions.UseGitignore,
+		ArchiveDepth:    rag.WatchOptions.ArchiveDepth,
+		MaxArchiveSize:  rag.WatchOptions.MaxArchiveSize,
+		ChunkSize:       rag.WatchOptions.ChunkSize,
+		ChunkOverlap:    rag.WatchOptions.ChunkOverlap,
+		RowsPerChunk:    rag.WatchOptions.RowsPerChunk,
+		ChunkTokens:     rag.WatchOptions.ChunkTokens,
+		OverlapTokens:   rag.WatchOptions.OverlapTokens,
+	}
+
+	// Get existing document paths, and those of the copies aliased to them,
+	// to avoid re-processing
 	existingPaths := make(map[string]bool)
 	for _, doc := range rag.Documents {
 		existingPaths[doc.Path] = true
+		for _, alias := range doc.Aliases {
+			existingPaths[alias] = true
+		}
 	}
 
 	// Create a document loader
 	docLoader := NewDocumentLoader()
-	
+
 	// Load all documents from the directory
 	allDocs, err := docLoader.LoadDocumentsFromFolderWithOptions(rag.WatchedDir, loaderOptions)
 	if err != nil {
@@ -79,6 +92,16 @@ func (fw *FileWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 		}
 	}
 
+	embeddingService, err := NewEmbeddingService(fw.ragService.GetOllamaClient()).ForRag(rag)
+	if err != nil {
+		return 0, err
+	}
+	embeddingModel, err := embeddingService.ResolveEmbeddingModel(rag)
+	if err != nil {
+		return 0, err
+	}
+	embedPendingChunks(rag, embeddingService, embeddingModel)
+
 	if len(newDocs) == 0 {
 		// Update last watched time even if no new documents
 		rag.LastWatchedAt = time.Now()
@@ -88,28 +111,45 @@ func (fw *FileWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 
 	// Create chunker service with options from the RAG
 	chunkerService := NewChunkerService(ChunkingConfig{
-		ChunkSize:    loaderOptions.ChunkSize,
-		ChunkOverlap: loaderOptions.ChunkOverlap,
+		ChunkSize:        loaderOptions.ChunkSize,
+		ChunkOverlap:     loaderOptions.ChunkOverlap,
+		ChunkingStrategy: rag.WatchOptions.ChunkingStrategy,
+		RowsPerChunk:     loaderOptions.RowsPerChunk,
+		ChunkTokens:      loaderOptions.ChunkTokens,
+		OverlapTokens:    loaderOptions.OverlapTokens,
+		Embedder:         chunkEmbedder(embeddingService, rag.WatchOptions.ChunkingStrategy, embeddingModel),
 	})
 
+	// Strip the boilerplate detected when the RAG was built, collapse
+	// near-duplicates with the settings of the RAG, then redact personal data
+	// from the documents kept, so that the copies left out are never audited
+	stripKnownBoilerplate(rag, newDocs)
+	newDocs = collapseDuplicates(rag, newDocs, nil)
+	newDocs, err = redactDocuments(rag, newDocs)
+	if err != nil {
+		return 0, err
+	}
+	assignDocumentIDs(rag, newDocs)
+
 	// Process each new document - chunk and prepare for embeddings
+	contextualizer := newChunkContextualizer(fw.ragService.GetOllamaClient(), rag)
 	var allChunks []*domain.DocumentChunk
 	for _, doc := range newDocs {
 		// Chunk the document
 		chunks := chunkerService.ChunkDocument(doc)
-		
+		contextualizer.addHeaders(doc, chunks)
+
 		// Update total chunks in metadata
 		for i, chunk := range chunks {
 			chunk.ChunkNumber = i
 			chunk.TotalChunks = len(chunks)
 		}
-		
+
 		allChunks = append(allChunks, chunks...)
 	}
 
 	// Generate embeddings for all chunks
-	embeddingService := NewEmbeddingService(fw.ragService.GetOllamaClient())
-	err = embeddingService.GenerateChunkEmbeddings(allChunks, rag.ModelName)
+	failed, err := embeddingService.GenerateChunkEmbeddings(allChunks, embeddingModel)
 	if err != nil {
 		return 0, fmt.Errorf("error generating embeddings for new documents: %w", err)
 	}
@@ -118,14 +158,12 @@ func (fw *FileWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 	for _, doc := range newDocs {
 		rag.AddDocument(doc)
 	}
-	
-	for _, chunk := range allChunks {
-		rag.AddChunk(chunk)
-	}
+
+	addEmbeddedChunks(rag, allChunks, failed)
 
 	// Update last watched time
 	rag.LastWatchedAt = time.Now()
-	
+
 	// Save the updated RAG
 	err = fw.ragService.UpdateRag(rag)
 	if err != nil {
@@ -144,11 +182,11 @@ func getLastModifiedTime(dirPath string) time.Time {
 		if err != nil {
 			return nil // Skip errors
 		}
-		
+
 		if info.ModTime().After(lastModTime) {
 			lastModTime = info.ModTime()
 		}
-		
+
 		return nil
 	})
 
@@ -179,7 +217,7 @@ func (fw *FileWatcher) checkAllRags() {
 	}
 
 	now := time.Now()
-	
+
 	for _, ragName := range rags {
 		rag, err := fw.ragService.LoadRag(ragName)
 		if err != nil {
@@ -200,4 +238,4 @@ func (fw *FileWatcher) checkAllRags() {
 			}
 		}
 	}
-} 
\ No newline at end of file
+}
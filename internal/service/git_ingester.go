@@ -0,0 +1,763 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// GitIngester indexes the files of a local git repository at a given ref
+type GitIngester struct {
+	ragService     RagService
+	documentLoader *DocumentLoader
+}
+
+// GitIngestResult summarizes an add-git run
+type GitIngestResult struct {
+	Repository     string
+	Commit         string
+	PreviousCommit string // Empty on the first run
+	Added          int
+	Updated        int
+	Removed        int
+	Report         *LoadReport
+}
+
+// gitUpdate is the set of changes to apply to a RAG for one repository
+type gitUpdate struct {
+	repo        *gitRepo
+	ref         string
+	commit      string
+	previous    string
+	documents   []*domain.Document // Documents to (re)index
+	removedIDs  []string           // Documents to drop before adding the new ones
+	updated     int                // Number of documents replaced by a newer version
+	failedPaths []string           // Files that failed to load, to retry on the next run
+	duplicates  []string           // Files collapsed into a near-duplicate document
+	report      *LoadReport
+}
+
+// NewGitIngester creates a new git repository ingester
+func NewGitIngester(ragService RagService) *GitIngester {
+	return &GitIngester{
+		ragService:     ragService,
+		documentLoader: NewDocumentLoader(),
+	}
+}
+
+// IngestRepository indexes the repository at ref into the RAG. When the repository was
+// indexed before, only the files changed since the stored commit are processed.
+func (gi *GitIngester) IngestRepository(ragName, repoPath, ref string, options DocumentLoaderOptions) (*GitIngestResult, error) {
+	rag, err := gi.ragService.LoadRag(ragName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading RAG '%s': %w", ragName, err)
+	}
+
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := gi.prepareUpdate(rag, repo, ref, options)
+	if err != nil {
+		return nil, err
+	}
+	update.report.PrintFailures()
+
+	result := &GitIngestResult{
+		Repository:     repo.root,
+		Commit:         update.commit,
+		PreviousCommit: update.previous,
+		Updated:        update.updated,
+		Removed:        len(update.removedIDs) - update.updated,
+		Added:          len(update.documents) - update.updated,
+		Report:         update.report,
+	}
+
+	// Chunk and embed the new versions before touching the RAG
+	var allChunks, failed []*domain.DocumentChunk
+	if len(update.documents) > 0 {
+		// Check the model embedding the RAG, not its chat model
+		embeddingService, err := NewEmbeddingService(gi.ragService.GetOllamaClient()).ForRag(rag)
+		if err != nil {
+			return nil, err
+		}
+		embeddingModel, err := embeddingService.ResolveEmbeddingModel(rag)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := embeddingService.CheckEmbeddingModel(embeddingModel); err != nil {
+			return nil, err
+		}
+
+		chunkingStrategy := rag.ChunkingStrategy
+		if options.ChunkingStrategy != "" {
+			chunkingStrategy = options.ChunkingStrategy
+		}
+		chunkSize := rag.WatchOptions.ChunkSize
+		if options.ChunkSize > 0 {
+			chunkSize = options.ChunkSize
+		}
+		chunkOverlap := rag.WatchOptions.ChunkOverlap
+		if options.ChunkOverlap > 0 {
+			chunkOverlap = options.ChunkOverlap
+		}
+		rowsPerChunk := rag.WatchOptions.RowsPerChunk
+		if options.RowsPerChunk > 0 {
+			rowsPerChunk = options.RowsPerChunk
+		}
+		chunkTokens, overlapTokens := rag.WatchOptions.ChunkTokens, rag.WatchOptions.OverlapTokens
+		if options.ChunkTokens > 0 {
+			chunkTokens, overlapTokens = options.ChunkTokens, options.OverlapTokens
+		}
+
+		chunkerService := NewChunkerService(ChunkingConfig{
+			ChunkSize:        chunkSize,
+			ChunkOverlap:     chunkOverlap,
+			ChunkingStrategy: chunkingStrategy,
+			RowsPerChunk:     rowsPerChunk,
+			ChunkTokens:      chunkTokens,
+			OverlapTokens:    overlapTokens,
+			Embedder:         chunkEmbedder(embeddingService, chunkingStrategy, embeddingModel),
+		})
+
+		stripKnownBoilerplate(rag, update.documents)
+		update.collapseDuplicates(rag)
+		update.documents, err = redactDocuments(rag, update.documents)
+		if err != nil {
+			return nil, err
+		}
+		contextualizer := newChunkContextualizer(gi.ragService.GetOllamaClient(), rag)
+		for _, doc := range update.documents {
+			chunks := chunkerService.ChunkDocument(doc)
+			contextualizer.addHeaders(doc, chunks)
+			for i, chunk := range chunks {
+				chunk.ChunkNumber = i
+				chunk.TotalChunks = len(chunks)
+			}
+			allChunks = append(allChunks, chunks...)
+		}
+
+		fmt.Printf("Generated %d chunks from %d documents. Generating embeddings...\n",
+			len(allChunks), len(update.documents))
+
+		failed, err = embeddingService.GenerateChunkEmbeddings(allChunks, embeddingModel)
+		if err != nil {
+			return nil, fmt.Errorf("error generating embeddings: %w", err)
+		}
+	}
+
+	for _, id := range update.removedIDs {
+		rag.RemoveDocument(id)
+	}
+	for _, doc := range update.documents {
+		rag.AddDocument(doc)
+	}
+	addEmbeddedChunks(rag, allChunks, failed)
+
+	if rag.GitRepositories == nil {
+		rag.GitRepositories = make(map[string]domain.GitRepositoryState)
+	}
+	rag.GitRepositories[repo.root] = domain.GitRepositoryState{
+		Ref:            update.ref,
+		Commit:         update.commit,
+		IndexedAt:      time.Now(),
+		FailedPaths:    update.failedPaths,
+		DuplicatePaths: update.duplicates,
+	}
+	if len(update.failedPaths) > 0 {
+		fmt.Printf("%d file(s) failed to load and will be loaded again on the next run.\n", len(update.failedPaths))
+	}
+
+	if err := gi.ragService.UpdateRag(rag); err != nil {
+		return nil, fmt.Errorf("error saving the updated RAG: %w", err)
+	}
+
+	return result, nil
+}
+
+// prepareUpdate works out which documents of the repository must be removed and
+// which must be loaded to bring the RAG to the commit ref points to
+func (gi *GitIngester) prepareUpdate(rag *domain.RagSystem, repo *gitRepo, ref string, options DocumentLoaderOptions) (*gitUpdate, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := repo.resolveCommit(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &gitUpdate{
+		repo:   repo,
+		ref:    ref,
+		commit: commit,
+		report: &LoadReport{},
+	}
+
+	normalizeExtensions(&options)
+	entries, err := repo.listFiles(commit)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := gi.selectEntries(repo, entries, options, update.report)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documents already indexed from this repository, by path in the repository
+	existing := make(map[string]*domain.Document)
+	for _, doc := range rag.Documents {
+		if doc.Git != nil && doc.Git.Repository == repo.root {
+			existing[doc.Git.Path] = doc
+		}
+	}
+
+	// Files changed since the indexed commit; nil means everything must be loaded
+	var changed map[string]bool
+	duplicates := make(map[string]bool)
+	if state, ok := rag.GitRepositories[repo.root]; ok && state.Commit != "" {
+		for _, p := range state.DuplicatePaths {
+			duplicates[p] = true
+		}
+		update.previous = state.Commit
+		changed, err = repo.changedFiles(state.Commit, commit)
+		if err != nil {
+			fmt.Printf("Could not diff against indexed commit %s (%v), re-indexing the whole repository\n",
+				shortCommit(state.Commit), err)
+			changed = nil
+		}
+		// Files that failed to load last time are not in the diff any more
+		for _, p := range state.FailedPaths {
+			if changed != nil {
+				changed[p] = true
+			}
+		}
+	}
+
+	// New or changed files; replaced maps their path to the document they supersede
+	var toLoad []gitTreeEntry
+	replaced := make(map[string]string)
+	kept := make(map[string]bool, len(selected))
+	for _, entry := range selected {
+		kept[entry.path] = true
+		doc, indexed := existing[entry.path]
+		if (indexed || duplicates[entry.path]) && changed != nil && !changed[entry.path] {
+			if duplicates[entry.path] {
+				update.duplicates = append(update.duplicates, entry.path)
+			}
+			continue
+		}
+		if indexed {
+			replaced[entry.path] = doc.ID
+		}
+		toLoad = append(toLoad, entry)
+	}
+
+	// Files deleted, renamed away or no longer selected
+	var gone []string
+	for p := range existing {
+		if !kept[p] {
+			gone = append(gone, p)
+		}
+	}
+	sort.Strings(gone)
+	for _, p := range gone {
+		update.removedIDs = append(update.removedIDs, existing[p].ID)
+	}
+
+	if len(toLoad) == 0 && len(gone) == 0 {
+		fmt.Printf("Repository %s is up to date at %s\n", repo.root, shortCommit(commit))
+		return update, nil
+	}
+
+	fmt.Printf("Indexing %s at %s: %d file(s) to load, %d to remove\n",
+		repo.root, shortCommit(commit), len(toLoad), len(gone))
+
+	if len(toLoad) > 0 {
+		update.documents, err = gi.loadEntries(repo, ref, commit, toLoad, options, update.report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Files that failed to load keep their previous version instead of disappearing,
+	// and are remembered so that the next run loads them again
+	failed := make(map[string]bool)
+	for _, failure := range update.report.Failures {
+		if kept[failure.Path] && !failed[failure.Path] {
+			failed[failure.Path] = true
+			update.failedPaths = append(update.failedPaths, failure.Path)
+		}
+	}
+	sort.Strings(update.failedPaths)
+	for _, doc := range update.documents {
+		if id, ok := replaced[doc.Git.Path]; ok {
+			update.removedIDs = append(update.removedIDs, id)
+			update.updated++
+		}
+	}
+
+	return update, nil
+}
+
+// collapseDuplicates applies the near-duplicate settings of the RAG to the
+// documents to index and remembers the files left out, whether skipped or
+// superseded by a newer copy, so that the next runs don't load them again
+func (u *gitUpdate) collapseDuplicates(rag *domain.RagSystem) {
+	var indexed []*domain.Document
+	for _, doc := range rag.Documents {
+		if doc.Git != nil && doc.Git.Repository == u.repo.root {
+			indexed = append(indexed, doc)
+		}
+	}
+	loaded := u.documents
+	u.documents = collapseDuplicates(rag, u.documents, u.removedIDs)
+
+	kept := make(map[*domain.Document]bool, len(u.documents))
+	for _, doc := range u.documents {
+		kept[doc] = true
+	}
+	for _, doc := range loaded {
+		if !kept[doc] {
+			u.duplicates = append(u.duplicates, doc.Git.Path)
+		}
+	}
+	for _, doc := range indexed {
+		if rag.GetDocumentByID(doc.ID) == nil && !slices.Contains(u.removedIDs, doc.ID) {
+			u.duplicates = append(u.duplicates, doc.Git.Path)
+		}
+	}
+	sort.Strings(u.duplicates)
+}
+
+// selectEntries applies the ignore files found in the tree and the loader options
+func (gi *GitIngester) selectEntries(repo *gitRepo, entries []gitTreeEntry, options DocumentLoaderOptions, report *LoadReport) ([]gitTreeEntry, error) {
+	matcher := NewIgnoreMatcher(options.IncludePatterns, options.ExcludePatterns, options.UseGitignore)
+
+	// Load the pattern files committed at this ref, shallowest first
+	var ignoreFiles []gitTreeEntry
+	for _, entry := range entries {
+		if matcher.UsesIgnoreFile(pathBase(entry.path)) {
+			ignoreFiles = append(ignoreFiles, entry)
+		}
+	}
+	sort.SliceStable(ignoreFiles, func(i, j int) bool {
+		di, dj := strings.Count(ignoreFiles[i].path, "/"), strings.Count(ignoreFiles[j].path, "/")
+		if di != dj {
+			return di < dj
+		}
+		// .gitignore before .rlamaignore so the latter can override it
+		return pathBase(ignoreFiles[i].path) == GitIgnoreFile && pathBase(ignoreFiles[j].path) != GitIgnoreFile
+	})
+	err := repo.readBlobs(ignoreFiles, func(entry gitTreeEntry, data []byte) error {
+		dir := path.Dir(entry.path)
+		if dir == "." {
+			dir = ""
+		}
+		matcher.AddRules(dir, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []gitTreeEntry
+	excludedDirs := make(map[string]bool)
+	for _, entry := range entries {
+		if gi.inExcludedDir(repo, entry.path, options, matcher, excludedDirs) {
+			report.Excluded = append(report.Excluded, entry.path)
+			continue
+		}
+		switch gi.documentLoader.classifyFile(entry.path, options, matcher) {
+		case fileSupported:
+			selected = append(selected, entry)
+		case fileUnsupported:
+			report.Unsupported = append(report.Unsupported, entry.path)
+		case fileExcluded:
+			report.Excluded = append(report.Excluded, entry.path)
+		}
+	}
+	return selected, nil
+}
+
+// inExcludedDir reports whether one of the parent directories of relPath is excluded
+func (gi *GitIngester) inExcludedDir(repo *gitRepo, relPath string, options DocumentLoaderOptions, matcher *IgnoreMatcher, cache map[string]bool) bool {
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		excluded, ok := cache[dir]
+		if !ok {
+			excluded = gi.documentLoader.isExcludedDir(filepath.Join(repo.root, filepath.FromSlash(dir)), dir, options, matcher)
+			cache[dir] = excluded
+		}
+		if excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// loadEntries writes the selected blobs to a temporary folder and runs them
+// through the regular extraction pipeline
+func (gi *GitIngester) loadEntries(repo *gitRepo, ref, commit string, entries []gitTreeEntry, options DocumentLoaderOptions, report *LoadReport) ([]*domain.Document, error) {
+	tempDir, err := os.MkdirTemp("", "rlama-git-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var files []string
+	pathByFile := make(map[string]string)
+	err = repo.readBlobs(entries, func(entry gitTreeEntry, data []byte) error {
+		file := filepath.Join(tempDir, filepath.FromSlash(entry.path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+		files = append(files, file)
+		pathByFile[file] = entry.path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading files at %s: %w", shortCommit(commit), err)
+	}
+
+	docs := gi.documentLoader.runLoadPipeline(tempDir, files, options, report)
+
+	// Failures point at the repository, not at the temporary copy
+	for i, failure := range report.Failures {
+		if p, ok := pathByFile[failure.Path]; ok {
+			report.Failures[i].Path = p
+		}
+	}
+
+	paths := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		paths = append(paths, pathByFile[doc.Path])
+	}
+	lastCommits, err := repo.lastCommits(commit, paths)
+	if err != nil {
+		fmt.Printf("Warning: could not read file history: %v\n", err)
+	}
+
+	repoName := filepath.Base(repo.root)
+	for i, doc := range docs {
+		relPath := paths[i]
+		doc.ID = gitDocumentID(repo.root, relPath)
+		doc.Name = repoName + "/" + relPath
+		doc.Path = filepath.Join(repo.root, filepath.FromSlash(relPath))
+		doc.Git = &domain.GitSource{
+			Repository: repo.root,
+			Ref:        ref,
+			Commit:     commit,
+			Path:       relPath,
+		}
+		// The temporary copy's mtime is meaningless, the last commit date replaces it
+		delete(doc.Metadata, domain.MetaFileModified)
+		if info, ok := lastCommits[relPath]; ok {
+			doc.Git.LastModifiedCommit = info.hash
+			doc.Git.Author = info.author
+			doc.Git.LastModifiedAt = info.date
+			doc.Metadata.SetTime(domain.MetaFileModified, info.date)
+		}
+	}
+	report.Loaded = len(docs)
+
+	return docs, nil
+}
+
+// gitDocumentID returns the ID of a file of a repository. Repositories are told
+// apart by a hash of their root, as several clones can share a directory name.
+func gitDocumentID(root, relPath string) string {
+	sum := sha1.Sum([]byte(root))
+	return filepath.Base(root) + "@" + hex.EncodeToString(sum[:4]) + "/" + relPath
+}
+
+// shortCommit abbreviates a commit hash for display
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// gitRepo runs git plumbing commands against a local repository
+type gitRepo struct {
+	root string
+}
+
+// gitTreeEntry is a regular file of a commit tree
+type gitTreeEntry struct {
+	path string // Slash-separated path relative to the repository root
+	oid  string // Blob id
+}
+
+// gitCommitInfo is the last commit that touched a file
+type gitCommitInfo struct {
+	hash   string
+	author string
+	date   time.Time
+}
+
+// openGitRepo locates the root of the repository containing repoPath
+func openGitRepo(repoPath string) (*gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is required to index repositories: %w", err)
+	}
+
+	absPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path %s: %w", repoPath, err)
+	}
+
+	out, err := (&gitRepo{root: absPath}).output("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a git repository: %w", repoPath, err)
+	}
+	return &gitRepo{root: filepath.Clean(strings.TrimSpace(string(out)))}, nil
+}
+
+// command prepares a git command running in the repository
+func (g *gitRepo) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append([]string{"-C", g.root, "-c", "core.quotePath=false"}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+// output runs a git command and returns its standard output
+func (g *gitRepo) output(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := g.command(args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// resolveCommit returns the commit hash a ref points to
+func (g *gitRepo) resolveCommit(ref string) (string, error) {
+	out, err := g.output("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown ref '%s' in %s", ref, g.root)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// listFiles returns the regular files of the commit tree. Symlinks and submodules are skipped.
+func (g *gitRepo) listFiles(commit string) ([]gitTreeEntry, error) {
+	out, err := g.output("ls-tree", "-r", "-z", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []gitTreeEntry
+	for _, record := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, filePath, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		entries = append(entries, gitTreeEntry{path: filePath, oid: fields[2]})
+	}
+	return entries, nil
+}
+
+// changedFiles lists the files added, modified or renamed between two commits,
+// by their path in the newer commit. Deleted files are absent from the new tree.
+func (g *gitRepo) changedFiles(from, to string) (map[string]bool, error) {
+	out, err := g.output("diff", "--name-status", "-z", "-M", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+		switch status[0] {
+		case 'R', 'C':
+			// Followed by the old and the new path
+			if i+2 < len(fields) {
+				changed[fields[i+2]] = true
+			}
+			i += 2
+		case 'D':
+			i++
+		default:
+			if i+1 < len(fields) {
+				changed[fields[i+1]] = true
+			}
+			i++
+		}
+	}
+	return changed, nil
+}
+
+// readBlobs streams the content of the entries through a single git cat-file process
+func (g *gitRepo) readBlobs(entries []gitTreeEntry, fn func(entry gitTreeEntry, data []byte) error) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	cmd := g.command("cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting git cat-file: %w", err)
+	}
+	defer cmd.Wait()
+
+	go func() {
+		defer stdin.Close()
+		w := bufio.NewWriter(stdin)
+		for _, entry := range entries {
+			fmt.Fprintln(w, entry.oid)
+		}
+		w.Flush()
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for _, entry := range entries {
+		// <oid> SP <type> SP <size> LF <contents> LF
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", entry.path, err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("error reading %s: %s", entry.path, strings.TrimSpace(header))
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error reading %s: invalid size %q", entry.path, fields[2])
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("error reading %s: %w", entry.path, err)
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return fmt.Errorf("error reading %s: %w", entry.path, err)
+		}
+
+		if err := fn(entry, data); err != nil {
+			io.Copy(io.Discard, reader)
+			return err
+		}
+	}
+	return nil
+}
+
+// lastCommits walks the history from commit and returns the most recent commit
+// touching each path. The walk stops as soon as every path has been found.
+func (g *gitRepo) lastCommits(commit string, paths []string) (map[string]gitCommitInfo, error) {
+	result := make(map[string]gitCommitInfo, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+
+	// NUL separated, as paths with quotes, backslashes, tabs or newlines are
+	// quoted otherwise. Each commit is \x1e<hash>\x1f<author>\x1f<date> between
+	// NULs, followed by its files, the first one after a newline.
+	cmd := g.command("log", "-z", "--format=%x00%x1e%H%x1f%an%x1f%aI%x00", "--name-only", "--no-renames", commit, "--")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return result, err
+	}
+	if err := cmd.Start(); err != nil {
+		return result, fmt.Errorf("error starting git log: %w", err)
+	}
+
+	var current gitCommitInfo
+	firstFile := false
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(scanNulls)
+	for scanner.Scan() {
+		record := scanner.Text()
+		if strings.HasPrefix(record, "\x1e") {
+			parts := strings.SplitN(strings.TrimPrefix(record, "\x1e"), "\x1f", 3)
+			current = gitCommitInfo{hash: parts[0]}
+			if len(parts) == 3 {
+				current.author = parts[1]
+				current.date, _ = time.Parse(time.RFC3339, parts[2])
+			}
+			firstFile = true
+			continue
+		}
+		if record == "" {
+			continue
+		}
+		if firstFile {
+			record = strings.TrimPrefix(record, "\n")
+			firstFile = false
+		}
+		if !wanted[record] {
+			continue
+		}
+		if _, found := result[record]; !found {
+			result[record] = current
+			if len(result) == len(wanted) {
+				break
+			}
+		}
+	}
+
+	// Stop git once everything was found; the killed process error is expected then
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+	cmd.Wait()
+
+	return result, scanner.Err()
+}
+
+// scanNulls is a bufio.SplitFunc returning the NUL terminated records of git -z output
+func scanNulls(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGitIngesterIncrementalUpdate indexes a repository, then checks that a second
+// commit only reloads the modified and renamed files and drops the deleted ones
+func TestGitIngesterIncrementalUpdate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Alice", "GIT_AUTHOR_EMAIL=alice@example.com",
+			"GIT_COMMITTER_NAME=Alice", "GIT_COMMITTER_EMAIL=alice@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(path, content string) {
+		fullPath := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	git("init", "-q")
+	write(".rlamaignore", "drafts/\n")
+	write("README.md", "Project readme with enough words to keep.")
+	write("docs/guide.md", "The guide explains how to use the project.")
+	write("docs/old-name.md", "This page will be renamed in the next commit.")
+	write("docs/remove-me.md", "This page will be deleted in the next commit.")
+	write("drafts/wip.md", "Work in progress that must not be indexed.")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+
+	repo, err := openGitRepo(filepath.Join(dir, "docs"))
+	require.NoError(t, err)
+
+	rag := domain.NewRagSystem("test", "model")
+	ingester := &GitIngester{documentLoader: NewDocumentLoader()}
+	apply := func(update *gitUpdate) {
+		for _, id := range update.removedIDs {
+			rag.RemoveDocument(id)
+		}
+		for _, doc := range update.documents {
+			rag.AddDocument(doc)
+		}
+		if rag.GitRepositories == nil {
+			rag.GitRepositories = make(map[string]domain.GitRepositoryState)
+		}
+		rag.GitRepositories[repo.root] = domain.GitRepositoryState{Ref: update.ref, Commit: update.commit, FailedPaths: update.failedPaths}
+	}
+	loadedPaths := func(update *gitUpdate) []string {
+		var paths []string
+		for _, doc := range update.documents {
+			paths = append(paths, doc.Git.Path)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	first, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"README.md", "docs/guide.md", "docs/old-name.md", "docs/remove-me.md"}, loadedPaths(first))
+	assert.Empty(t, first.removedIDs)
+
+	doc := first.documents[1]
+	repoName := filepath.Base(repo.root)
+	assert.Equal(t, gitDocumentID(repo.root, "docs/guide.md"), doc.ID)
+	assert.Equal(t, repoName+"/docs/guide.md", doc.Name)
+	assert.Equal(t, filepath.Join(repo.root, "docs", "guide.md"), doc.Path)
+	assert.Equal(t, first.commit, doc.Git.Commit)
+	assert.Equal(t, first.commit, doc.Git.LastModifiedCommit)
+	assert.Equal(t, "Alice", doc.Git.Author)
+	assert.Equal(t, "HEAD", doc.Git.Ref)
+	apply(first)
+
+	// Working tree changes that are not committed must be ignored
+	write("docs/guide.md", "The guide was rewritten with new instructions.")
+	git("mv", "docs/old-name.md", "docs/new-name.md")
+	git("rm", "-q", "docs/remove-me.md")
+	git("commit", "-q", "-am", "update docs")
+	write("README.md", "Uncommitted change that must not be read.")
+
+	second, err := ingester.prepareUpdate(rag, repo, "HEAD", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, first.commit, second.previous)
+	assert.Equal(t, []string{"docs/guide.md", "docs/new-name.md"}, loadedPaths(second))
+	assert.ElementsMatch(t, []string{
+		gitDocumentID(repo.root, "docs/guide.md"),
+		gitDocumentID(repo.root, "docs/old-name.md"),
+		gitDocumentID(repo.root, "docs/remove-me.md"),
+	}, second.removedIDs)
+	assert.Equal(t, 1, second.updated)
+	assert.Contains(t, second.documents[0].Content, "rewritten")
+	assert.Equal(t, second.commit, second.documents[0].Git.LastModifiedCommit)
+	apply(second)
+
+	var names []string
+	for _, doc := range rag.Documents {
+		names = append(names, doc.Name)
+	}
+	assert.ElementsMatch(t, []string{
+		repoName + "/README.md",
+		repoName + "/docs/guide.md",
+		repoName + "/docs/new-name.md",
+	}, names)
+	assert.Equal(t, first.commit, rag.GetDocumentByID(gitDocumentID(repo.root, "README.md")).Git.Commit)
+
+	// Nothing changed since the last run
+	third, err := ingester.prepareUpdate(rag, repo, "HEAD", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, third.documents)
+	assert.Empty(t, third.removedIDs)
+}
+
+// TestGitIngesterRetriesFailedFiles checks that a changed file failing to load
+// keeps its previous version and is loaded again by the next run, although the
+// stored commit moved past the change
+func TestGitIngesterRetriesFailedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Bob", "-c", "user.email=bob@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0644))
+	}
+
+	git("init", "-q")
+	write("guide.md", "The first version of the guide.")
+	git("add", "-A")
+	git("commit", "-q", "-m", "one")
+
+	repo, err := openGitRepo(dir)
+	require.NoError(t, err)
+	rag := domain.NewRagSystem("test", "model")
+	ingester := &GitIngester{documentLoader: NewDocumentLoader()}
+	apply := func(update *gitUpdate) {
+		for _, id := range update.removedIDs {
+			rag.RemoveDocument(id)
+		}
+		for _, doc := range update.documents {
+			rag.AddDocument(doc)
+		}
+		rag.GitRepositories = map[string]domain.GitRepositoryState{
+			repo.root: {Ref: update.ref, Commit: update.commit, FailedPaths: update.failedPaths},
+		}
+	}
+
+	first, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	apply(first)
+	id := gitDocumentID(repo.root, "guide.md")
+
+	// Every extraction times out
+	write("guide.md", "The second version of the guide.")
+	git("commit", "-q", "-am", "two")
+	second, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{FileTimeout: time.Nanosecond})
+	require.NoError(t, err)
+	assert.Empty(t, second.documents)
+	assert.Empty(t, second.removedIDs)
+	assert.Equal(t, []string{"guide.md"}, second.failedPaths)
+	apply(second)
+	assert.Contains(t, rag.GetDocumentByID(id).Content, "first version")
+
+	third, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{id}, third.removedIDs)
+	assert.Empty(t, third.failedPaths)
+	apply(third)
+	assert.Contains(t, rag.GetDocumentByID(id).Content, "second version")
+}
+
+// TestGitIngesterRemembersDuplicates checks that a file collapsed into a
+// near-duplicate is not loaded again until it changes
+func TestGitIngesterRemembersDuplicates(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Bob", "-c", "user.email=bob@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0644))
+	}
+
+	git("init", "-q")
+	write("guide.md", dedupSample)
+	write("copy.md", dedupSample)
+	git("add", "-A")
+	git("commit", "-q", "-m", "one")
+
+	repo, err := openGitRepo(dir)
+	require.NoError(t, err)
+	rag := domain.NewRagSystem("test", "model")
+	rag.Dedup = &domain.DedupSettings{Policy: DedupSkip}
+	ingester := &GitIngester{documentLoader: NewDocumentLoader()}
+
+	first, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	require.Len(t, first.documents, 2)
+	first.collapseDuplicates(rag)
+	require.Len(t, first.documents, 1)
+	assert.Len(t, first.duplicates, 1)
+	for _, doc := range first.documents {
+		rag.AddDocument(doc)
+	}
+	rag.GitRepositories = map[string]domain.GitRepositoryState{
+		repo.root: {Ref: first.ref, Commit: first.commit, DuplicatePaths: first.duplicates},
+	}
+
+	// An unrelated change loads neither the indexed file nor its copy
+	write("other.md", "Something else entirely, about the garden and its plants.")
+	git("add", "-A")
+	git("commit", "-q", "-m", "two")
+	second, err := ingester.prepareUpdate(rag, repo, "", DocumentLoaderOptions{})
+	require.NoError(t, err)
+	require.Len(t, second.documents, 1)
+	assert.Equal(t, "other.md", second.documents[0].Git.Path)
+	assert.Equal(t, first.duplicates, second.duplicates)
+}
+
+// TestGitDocumentIDsTellRepositoriesApart checks that clones with the same
+// directory name don't share document IDs
+func TestGitDocumentIDsTellRepositoriesApart(t *testing.T) {
+	first := gitDocumentID("/src/team-a/docs", "README.md")
+	second := gitDocumentID("/src/team-b/docs", "README.md")
+	assert.NotEqual(t, first, second)
+	assert.Contains(t, first, "docs@")
+}
+
+// TestGitChangedFilesParsesRenames checks the -z name-status parsing
+func TestGitChangedFilesParsesRenames(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Bob", "-c", "user.email=bob@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("same content for the rename detection"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+	run("init", "-q")
+	run("add", "-A")
+	run("commit", "-q", "-m", "one")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir with space"), 0755))
+	run("mv", "a.txt", "dir with space/c.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b2"), 0644))
+	run("commit", "-q", "-am", "two")
+
+	repo := &gitRepo{root: dir}
+	changed, err := repo.changedFiles("HEAD~1", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"dir with space/c.txt": true, "b.txt": true}, changed)
+}
+
+// TestGitLastCommitsOfQuotedPaths checks that the last commit of files git
+// quotes, such as names with quotes or tabs, is found
+func TestGitLastCommitsOfQuotedPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Bob", "-c", "user.email=bob@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, `say "hi".md`), []byte("quoted"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.md"), []byte("plain"), 0644))
+	run("init", "-q")
+	run("add", "-A")
+	run("commit", "-q", "-m", "one")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tab\tname.md"), []byte("tab"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.md"), []byte("plain 2"), 0644))
+	run("add", "-A")
+	run("commit", "-q", "-m", "two")
+
+	repo := &gitRepo{root: dir}
+	first := strings.TrimSpace(run("rev-parse", "HEAD~1"))
+	second := strings.TrimSpace(run("rev-parse", "HEAD"))
+	commits, err := repo.lastCommits("HEAD", []string{`say "hi".md`, "tab\tname.md", "plain.md"})
+	require.NoError(t, err)
+	require.Len(t, commits, 3)
+	assert.Equal(t, first, commits[`say "hi".md`].hash)
+	assert.Equal(t, "Bob", commits[`say "hi".md`].author)
+	assert.Equal(t, second, commits["tab\tname.md"].hash)
+	assert.Equal(t, second, commits["plain.md"].hash)
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// atxHeading matches a markdown heading line such as "## Install ##"
+	atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+
+	// setextUnderline matches the line under a setext heading: "===" for level 1, "---" for level 2
+	setextUnderline = regexp.MustCompile(`^ {0,3}(=+|-{2,})[ \t]*$`)
+
+	// codeFence matches the opening or closing line of a fenced code block
+	codeFence = regexp.MustCompile("^ {0,3}(```|~~~)")
+
+	// htmlHeading matches an h1-h6 element
+	htmlHeading = regexp.MustCompile(`(?is)<h([1-6])\b[^>]*>(.*?)</h[1-6]\s*>`)
+
+	// htmlTag matches a tag inside a heading title
+	htmlTag = regexp.MustCompile(`<[^>]*>`)
+)
+
+// documentHeading is a heading of a markdown or HTML document
+type documentHeading struct {
+	Level int
+	Title string
+	Start int // Offset of the heading
+	End   int // Offset after the heading
+}
+
+// headingSection is a node of the heading tree of a document: a heading with
+// the text up to the next heading of the same or a higher level. The root has
+// no heading and holds the text before the first heading.
+type headingSection struct {
+	Heading  documentHeading
+	Path     []string // Titles from the outermost heading down to this one
+	BodyEnd  int      // End of the section's own text, where its first subsection starts
+	End      int      // End of the section, subsections included
+	Children []*headingSection
+}
+
+// Start returns the offset at which the section starts
+func (s *headingSection) Start() int {
+	return s.Heading.Start
+}
+
+// Breadcrumb returns the path of the section: "Install > Linux > Troubleshooting"
+func (s *headingSection) Breadcrumb() string {
+	return strings.Join(s.Path, " > ")
+}
+
+// buildHeadingTree parses the headings of content into a tree of sections
+func buildHeadingTree(content string) *headingSection {
+	root := &headingSection{BodyEnd: len(content), End: len(content)}
+	stack := []*headingSection{root}
+	for _, heading := range parseHeadings(content) {
+		for len(stack) > 1 && stack[len(stack)-1].Heading.Level >= heading.Level {
+			closed := stack[len(stack)-1]
+			closed.End = heading.Start
+			if len(closed.Children) == 0 {
+				closed.BodyEnd = heading.Start
+			}
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		if len(parent.Children) == 0 {
+			parent.BodyEnd = heading.Start
+		}
+
+		section := &headingSection{
+			Heading: heading,
+			Path:    append(append([]string{}, parent.Path...), heading.Title),
+			BodyEnd: len(content),
+			End:     len(content),
+		}
+		parent.Children = append(parent.Children, section)
+		stack = append(stack, section)
+	}
+	return root
+}
+
+// sectionAt returns the innermost section containing an offset
+func (s *headingSection) sectionAt(pos int) *headingSection {
+	for _, child := range s.Children {
+		if pos >= child.Start() && pos < child.End {
+			return child.sectionAt(pos)
+		}
+	}
+	return s
+}
+
+// parseHeadings returns the headings of a document in order: markdown ATX and
+// setext headings outside code fences, and HTML h1-h6 elements
+func parseHeadings(content string) []documentHeading {
+	var headings []documentHeading
+
+	inFence := ""
+	previous, previousStart := "", -1 // Last line, if it can be a setext heading
+	offset := skipFrontMatter(content)
+	for offset < len(content) {
+		end := strings.IndexByte(content[offset:], '\n')
+		next := len(content)
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += offset
+			next = end + 1
+		}
+		line := strings.TrimRight(content[offset:end], "\r")
+
+		if fence := codeFence.FindStringSubmatch(line); fence != nil {
+			if inFence == "" {
+				inFence = fence[1]
+			} else if inFence == fence[1] {
+				inFence = ""
+			}
+			previous, previousStart = "", -1
+		} else if inFence != "" {
+			// Code blocks have no headings
+		} else if match := atxHeading.FindStringSubmatch(line); match != nil {
+			if title := strings.TrimSpace(match[2]); title != "" {
+				headings = append(headings, documentHeading{Level: len(match[1]), Title: title, Start: offset, End: end})
+			}
+			previous, previousStart = "", -1
+		} else if match := setextUnderline.FindStringSubmatch(line); match != nil && previousStart >= 0 {
+			level := 1
+			if match[1][0] == '-' {
+				level = 2
+			}
+			headings = append(headings, documentHeading{Level: level, Title: previous, Start: previousStart, End: end})
+			previous, previousStart = "", -1
+		} else if title := strings.TrimSpace(line); title != "" && !strings.HasPrefix(title, "<") && !strings.HasPrefix(line, "    ") {
+			previous, previousStart = title, offset
+		} else {
+			previous, previousStart = "", -1
+		}
+		offset = next
+	}
+
+	// HTML headings, merged in document order
+	for _, match := range htmlHeading.FindAllStringSubmatchIndex(content, -1) {
+		title := strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(content[match[4]:match[5]], " "))), " ")
+		if title == "" {
+			continue
+		}
+		heading := documentHeading{Level: int(content[match[2]] - '0'), Title: title, Start: match[0], End: match[1]}
+		i := len(headings)
+		for i > 0 && headings[i-1].Start > heading.Start {
+			i--
+		}
+		headings = append(headings[:i], append([]documentHeading{heading}, headings[i:]...)...)
+	}
+	return headings
+}
+
+// skipFrontMatter returns the offset after the YAML front matter of a
+// markdown document, 0 when it has none
+func skipFrontMatter(content string) int {
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return 0
+	}
+	offset := strings.IndexByte(content, '\n') + 1
+	for offset < len(content) {
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content) - offset
+		}
+		if line := strings.TrimSpace(content[offset : offset+end]); line == "---" || line == "..." {
+			return offset + end
+		}
+		offset += end + 1
+	}
+	return 0
+}
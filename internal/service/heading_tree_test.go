@@ -0,0 +1,132 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func headingTitles(headings []documentHeading) []string {
+	var titles []string
+	for _, heading := range headings {
+		titles = append(titles, strings.Repeat("#", heading.Level)+" "+heading.Title)
+	}
+	return titles
+}
+
+func TestParseHeadings(t *testing.T) {
+	content := "---\ntitle: Guide\n---\n" +
+		"Install\n=======\n\nIntro text.\n\n" +
+		"Linux\n-----\n\n" +
+		"```sh\n# not a heading\n```\n\n" +
+		"### Troubleshooting ###\n\nSome text\n\n---\n\n" +
+		"<h2 class=\"x\">Windows &amp; <em>WSL</em></h2>\n<p>Text</p>\n" +
+		"#hashtag is not a heading\n"
+
+	assert.Equal(t, []string{"# Install", "## Linux", "### Troubleshooting", "## Windows & WSL"}, headingTitles(parseHeadings(content)))
+}
+
+func TestHeadingTreeBreadcrumbs(t *testing.T) {
+	content := "Preamble\n# Install\n## Linux\n### Troubleshooting\nFix it.\n## Windows\n# Usage\n"
+	tree := buildHeadingTree(content)
+
+	require.Len(t, tree.Children, 2)
+	assert.Equal(t, strings.Index(content, "# Install"), tree.BodyEnd)
+	install := tree.Children[0]
+	require.Len(t, install.Children, 2)
+	assert.Equal(t, strings.Index(content, "# Usage"), install.End)
+	troubleshooting := install.Children[0].Children[0]
+	assert.Equal(t, strings.Index(content, "## Windows"), troubleshooting.BodyEnd)
+
+	assert.Equal(t, "Install > Linux > Troubleshooting", tree.sectionAt(strings.Index(content, "Fix it")).Breadcrumb())
+	assert.Equal(t, "Install > Windows", tree.sectionAt(strings.Index(content, "## Windows")).Breadcrumb())
+	assert.Equal(t, "", tree.sectionAt(0).Breadcrumb())
+}
+
+func TestSectionChunksFollowHeadingTree(t *testing.T) {
+	content := "Welcome to the guide.\n\n" +
+		"# Install\n\n" +
+		"## Linux\n\nRun the installer. " + strings.Repeat("Linux details. ", 10) + "\n\n" +
+		"### Troubleshooting\n\nCheck the logs.\n\n" +
+		"## Windows\n\n" + strings.Repeat("Windows paragraph with details.\n\n", 12) +
+		"# Usage\n\nRun rlama.\n"
+	doc := domain.NewDocument("guide.md", content)
+
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 150, ChunkOverlap: 0, ChunkingStrategy: "semantic"}).ChunkDocument(doc)
+	require.Greater(t, len(chunks), 5)
+
+	// No invented heading for the text before the first heading
+	assert.Equal(t, "Welcome to the guide.", chunks[0].Content)
+	assert.NotContains(t, chunks[0].Metadata, domain.ChunkBreadcrumb)
+
+	// A heading without text of its own stays with its first subsection
+	assert.True(t, strings.HasPrefix(chunks[1].Content, "# Install\n## Linux\nRun the installer."))
+	assert.Equal(t, "Install > Linux", chunks[1].Metadata[domain.ChunkBreadcrumb])
+	assert.Equal(t, "2", chunks[1].Metadata[domain.ChunkHeadingLevel])
+	assert.Equal(t, "Install > Linux > Troubleshooting", chunks[2].Metadata[domain.ChunkBreadcrumb])
+	assert.Equal(t, "3", chunks[2].Metadata[domain.ChunkHeadingLevel])
+
+	// The large Windows section is split, without straddling its siblings
+	var windows []*domain.DocumentChunk
+	for i, chunk := range chunks {
+		assert.Equal(t, doc.Content[chunk.StartPos:chunk.EndPos], chunk.Content)
+		assert.Equal(t, i, chunk.ChunkIndex)
+		if chunk.Metadata[domain.ChunkBreadcrumb] == "Install > Windows" {
+			windows = append(windows, chunk)
+			assert.NotContains(t, chunk.Content, "Troubleshooting")
+			assert.NotContains(t, chunk.Content, "Usage")
+		}
+	}
+	assert.Greater(t, len(windows), 1)
+
+	last := chunks[len(chunks)-1]
+	assert.Equal(t, "# Usage\nRun rlama.", last.Content)
+	assert.Equal(t, "Usage", last.Metadata[domain.ChunkBreadcrumb])
+
+	last.UpdateTotalChunks(len(chunks))
+	assert.Contains(t, last.GetMetadataString(), "Source: guide.md > Usage (Section ")
+}
+
+func TestHTMLChunksFollowHeadingTree(t *testing.T) {
+	content := "<html><body>\n<div class=\"nav\">Home | Docs</div>\n" +
+		"<h1>Install</h1>\n<p>" + strings.Repeat("Download the installer. ", 6) + "</p>\n" +
+		"<h2>Linux</h2>\n<p>" + strings.Repeat("Run the script as root. ", 6) + "</p>\n" +
+		"<h1>Usage</h1>\n<p>Run rlama.</p>\n</body></html>\n"
+	doc := domain.NewDocument("guide.html", content)
+
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 150, ChunkOverlap: 0, ChunkingStrategy: "hybrid"}).ChunkDocument(doc)
+	require.Len(t, chunks, 4)
+
+	assert.NotContains(t, chunks[0].Metadata, domain.ChunkBreadcrumb)
+	assert.Equal(t, "Install", chunks[1].Metadata[domain.ChunkBreadcrumb])
+	assert.Equal(t, "1", chunks[1].Metadata[domain.ChunkHeadingLevel])
+	assert.Equal(t, "Install > Linux", chunks[2].Metadata[domain.ChunkBreadcrumb])
+	assert.Equal(t, "2", chunks[2].Metadata[domain.ChunkHeadingLevel])
+	assert.Equal(t, "Usage", chunks[3].Metadata[domain.ChunkBreadcrumb])
+
+	chunks[2].UpdateTotalChunks(len(chunks))
+	assert.Contains(t, chunks[2].GetMetadataString(), "Source: guide.html > Install > Linux (Section ")
+}
+
+func TestHierarchicalChunksUseTopLevelSections(t *testing.T) {
+	content := "# Install\n\n" + strings.Repeat("Install text here.\n\n", 8) +
+		"## Linux\n\n" + strings.Repeat("Linux text here.\n\n", 8) +
+		"# Usage\n\nShort.\n"
+	doc := domain.NewDocument("guide.md", content)
+
+	chunks := NewChunkerService(ChunkingConfig{ChunkSize: 100, ChunkOverlap: 0, ChunkingStrategy: "hierarchical"}).ChunkDocument(doc)
+
+	var parents []string
+	for _, chunk := range chunks {
+		if chunk.Metadata["chunk_type"] == "parent_section" {
+			parents = append(parents, chunk.Metadata[domain.ChunkBreadcrumb])
+			continue
+		}
+		assert.Equal(t, "child_section", chunk.Metadata["chunk_type"])
+		assert.True(t, strings.HasPrefix(chunk.Metadata[domain.ChunkBreadcrumb], "Install"))
+	}
+	assert.Equal(t, []string{"Install", "Usage"}, parents)
+}
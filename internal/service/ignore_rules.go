@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Names of the pattern files read while walking a folder
+const (
+	RlamaIgnoreFile = ".rlamaignore"
+	GitIgnoreFile   = ".gitignore"
+)
+
+// ignoreRule is a single gitignore-syntax pattern
+type ignoreRule struct {
+	base    string // Slash-separated directory the rule is relative to ("" for the root)
+	regex   *regexp.Regexp
+	negate  bool // Pattern starts with "!" and re-includes matching paths
+	dirOnly bool // Pattern ends with "/" and only matches directories
+	hasPath bool // Pattern contains a slash and is matched against the path, not the name
+}
+
+// IgnoreMatcher decides which paths of a folder are ignored, following gitignore
+// semantics: patterns are relative to the directory of the file that defines them,
+// deeper files override shallower ones and the last matching pattern wins
+type IgnoreMatcher struct {
+	fileRules     []ignoreRule // Rules read from .rlamaignore/.gitignore files
+	excludeRules  []ignoreRule // Rules given on the command line, applied last
+	includeRules  []ignoreRule // If any, files must match one of these to be kept
+	useGitignore  bool
+	loadedFolders map[string]bool
+}
+
+// NewIgnoreMatcher creates a matcher from command-line include/exclude patterns
+func NewIgnoreMatcher(includePatterns, excludePatterns []string, useGitignore bool) *IgnoreMatcher {
+	m := &IgnoreMatcher{
+		useGitignore:  useGitignore,
+		loadedFolders: make(map[string]bool),
+	}
+	for _, p := range excludePatterns {
+		if rule, ok := parseIgnoreRule(p, ""); ok {
+			m.excludeRules = append(m.excludeRules, rule)
+		}
+	}
+	for _, p := range includePatterns {
+		if rule, ok := parseIgnoreRule(p, ""); ok && !rule.negate {
+			m.includeRules = append(m.includeRules, rule)
+		}
+	}
+	return m
+}
+
+// LoadDir reads the pattern files found in dir. relDir is dir relative to the
+// walked root, using forward slashes ("" for the root itself).
+func (m *IgnoreMatcher) LoadDir(dir, relDir string) {
+	if m.loadedFolders[relDir] {
+		return
+	}
+	m.loadedFolders[relDir] = true
+
+	if m.useGitignore {
+		if data, err := os.ReadFile(filepath.Join(dir, GitIgnoreFile)); err == nil {
+			m.AddRules(relDir, data)
+		}
+	}
+	// .rlamaignore comes after .gitignore so it can override it
+	if data, err := os.ReadFile(filepath.Join(dir, RlamaIgnoreFile)); err == nil {
+		m.AddRules(relDir, data)
+	}
+}
+
+// UsesIgnoreFile reports whether a pattern file with this name is honoured
+func (m *IgnoreMatcher) UsesIgnoreFile(name string) bool {
+	return name == RlamaIgnoreFile || (m.useGitignore && name == GitIgnoreFile)
+}
+
+// AddRules parses the content of a pattern file located in relDir
+func (m *IgnoreMatcher) AddRules(relDir string, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), relDir); ok {
+			m.fileRules = append(m.fileRules, rule)
+		}
+	}
+}
+
+// Ignored reports whether the path (relative to the root, slash-separated) is excluded
+func (m *IgnoreMatcher) Ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rules := range [][]ignoreRule{m.fileRules, m.excludeRules} {
+		for _, rule := range rules {
+			if rule.matches(relPath, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	if ignored || isDir || len(m.includeRules) == 0 {
+		return ignored
+	}
+
+	for _, rule := range m.includeRules {
+		if rule.matches(relPath, isDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches checks whether the rule applies to the path
+func (r ignoreRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	subPath := relPath
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		subPath = strings.TrimPrefix(relPath, r.base+"/")
+	}
+
+	if r.hasPath {
+		return r.regex.MatchString(subPath)
+	}
+	return r.regex.MatchString(pathBase(subPath))
+}
+
+// parseIgnoreRule compiles one gitignore-syntax line. Blank lines and comments yield false.
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to its directory
+	if strings.Contains(line, "/") {
+		rule.hasPath = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	regex, err := regexp.Compile("^" + globToRegex(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.regex = regex
+	return rule, true
+}
+
+// globToRegex converts a gitignore glob to a regular expression body
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**") && i+2 == len(glob):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// pathBase returns the last element of a slash-separated path
+func pathBase(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
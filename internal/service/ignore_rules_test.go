@@ -0,0 +1,104 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWalkFolderHonoursIgnoreFiles checks nested .rlamaignore/.gitignore rules,
+// negation and the command-line include/exclude patterns
+func TestWalkFolderHonoursIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":                "build/\n*.log\n",
+		".rlamaignore":              "# generated docs\ndocs/api/**\n!docs/api/index.md\n",
+		"README.md":                 "readme",
+		"notes.log":                 "log",
+		"build/out.txt":             "built",
+		"node_modules/pkg/index.js": "dep",
+		"docs/guide.md":             "guide",
+		"docs/api/index.md":         "api index",
+		"docs/api/v1/users.md":      "users",
+		"src/main.go":               "package main",
+		"src/.rlamaignore":          "*_test.go\n",
+		"src/main_test.go":          "package main",
+		"src/legacy/old.go":         "package legacy",
+		"src/legacy/.rlamaignore":   "!*_test.go\n",
+		"src/legacy/old_test.go":    "package legacy",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(dir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	loader := NewDocumentLoader()
+	walk := func(options DocumentLoaderOptions) []string {
+		report := &LoadReport{}
+		paths, err := loader.walkFolder(dir, options, report, nil)
+		assert.NoError(t, err)
+		var rel []string
+		for _, p := range paths {
+			r, _ := filepath.Rel(dir, p)
+			rel = append(rel, filepath.ToSlash(r))
+		}
+		sort.Strings(rel)
+		return rel
+	}
+
+	t.Run("RlamaignoreOnly", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"README.md",
+			"build/out.txt",
+			"docs/api/index.md",
+			"docs/guide.md",
+			"node_modules/pkg/index.js",
+			"notes.log",
+			"src/legacy/old.go",
+			"src/legacy/old_test.go",
+			"src/main.go",
+		}, walk(DocumentLoaderOptions{}))
+	})
+
+	t.Run("WithGitignoreAndPatterns", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"docs/api/index.md",
+			"docs/guide.md",
+		}, walk(DocumentLoaderOptions{
+			UseGitignore:    true,
+			IncludePatterns: []string{"*.md"},
+			ExcludePatterns: []string{"node_modules/", "/README.md"},
+		}))
+	})
+}
+
+// TestParseIgnoreRule checks the gitignore glob translation
+func TestParseIgnoreRule(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.md", "a/b/c.md", false, true},
+		{"/*.md", "a/c.md", false, false},
+		{"a/**/z.txt", "a/z.txt", false, true},
+		{"a/**/z.txt", "a/b/c/z.txt", false, true},
+		{"logs/", "logs", false, false},
+		{"logs/", "x/logs", true, true},
+		{"file[0-9].txt", "file7.txt", false, true},
+		{"file[!0-9].txt", "file7.txt", false, false},
+		{"?.go", "ab.go", false, false},
+	}
+
+	for _, c := range cases {
+		rule, ok := parseIgnoreRule(c.pattern, "")
+		if assert.True(t, ok, c.pattern) {
+			assert.Equal(t, c.matches, rule.matches(c.path, c.isDir), "%s vs %s", c.pattern, c.path)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// metadataAliases maps the common front matter and meta tag names to the well-known keys
+var metadataAliases = map[string]string{
+	"title":                  domain.MetaTitle,
+	"og:title":               domain.MetaTitle,
+	"dc.title":               domain.MetaTitle,
+	"author":                 domain.MetaAuthor,
+	"authors":                domain.MetaAuthor,
+	"creator":                domain.MetaAuthor,
+	"dc.creator":             domain.MetaAuthor,
+	"description":            domain.MetaDescription,
+	"summary":                domain.MetaDescription,
+	"og:description":         domain.MetaDescription,
+	"dc.description":         domain.MetaDescription,
+	"keywords":               domain.MetaKeywords,
+	"tags":                   domain.MetaKeywords,
+	"lang":                   domain.MetaLanguage,
+	"language":               domain.MetaLanguage,
+	"date":                   domain.MetaCreated,
+	"created":                domain.MetaCreated,
+	"dc.date":                domain.MetaCreated,
+	"article:published_time": domain.MetaCreated,
+	"lastmod":                domain.MetaModified,
+	"updated":                domain.MetaModified,
+	"modified":               domain.MetaModified,
+	"article:modified_time":  domain.MetaModified,
+}
+
+// metadataDateLayouts are the date formats recognised in metadata values
+var metadataDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02",
+}
+
+// extractMetadata collects the metadata of a file. For markdown files the front
+// matter is parsed and removed from the returned text.
+func (dl *DocumentLoader) extractMetadata(ctx context.Context, path, text string) (string, domain.DocumentMetadata) {
+	metadata := domain.DocumentMetadata{}
+	if info, err := os.Stat(path); err == nil {
+		metadata.SetTime(domain.MetaFileModified, info.ModTime())
+	}
+
+	var values map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".mdx":
+		values, text = parseFrontMatter(text)
+	case ".html", ".htm":
+		if data, err := os.ReadFile(path); err == nil {
+			values = parseHTMLMetadata(string(data))
+		}
+	case ".docx", ".pptx", ".xlsx":
+		values = readOfficeCoreProperties(path)
+	case ".pdf":
+		values = readPDFInfo(ctx, path)
+	}
+
+	addMetadataValues(metadata, values)
+	return text, metadata
+}
+
+// addMetadataValues stores raw values under their well-known key, normalising dates.
+// The first value found for a well-known key wins.
+func addMetadataValues(metadata domain.DocumentMetadata, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToLower(strings.TrimSpace(key))
+		value := strings.TrimSpace(values[key])
+		if alias, ok := metadataAliases[name]; ok {
+			name = alias
+		}
+		if name == "" || value == "" || metadata[name] != "" {
+			continue
+		}
+		if name == domain.MetaCreated || name == domain.MetaModified {
+			if t, ok := parseMetadataDate(value); ok {
+				metadata.SetTime(name, t)
+				continue
+			}
+		}
+		metadata.Set(name, value)
+	}
+}
+
+// parseMetadataDate parses the usual date formats found in documents
+func parseMetadataDate(value string) (time.Time, bool) {
+	for _, layout := range metadataDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return parsePDFDate(value)
+}
+
+// parseFrontMatter splits YAML (---) or TOML (+++) front matter from a markdown text
+func parseFrontMatter(text string) (map[string]string, string) {
+	trimmed := strings.TrimPrefix(text, "\ufeff")
+	var delimiter string
+	switch {
+	case strings.HasPrefix(trimmed, "---\n"), strings.HasPrefix(trimmed, "---\r\n"):
+		delimiter = "---"
+	case strings.HasPrefix(trimmed, "+++\n"), strings.HasPrefix(trimmed, "+++\r\n"):
+		delimiter = "+++"
+	default:
+		return nil, text
+	}
+
+	lines := strings.SplitAfter(trimmed, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line != delimiter && !(delimiter == "---" && line == "...") {
+			continue
+		}
+
+		header := strings.Join(lines[1:i], "")
+		body := strings.Join(lines[i+1:], "")
+		var values map[string]string
+		if delimiter == "---" {
+			values = parseYAMLFrontMatter(header)
+		} else {
+			values = parseTOMLFrontMatter(header)
+		}
+		if values == nil {
+			return nil, text // Not valid front matter, keep the text untouched
+		}
+		return values, body
+	}
+	return nil, text
+}
+
+// parseYAMLFrontMatter flattens a YAML mapping into strings
+func parseYAMLFrontMatter(header string) map[string]string {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(header), &raw); err != nil {
+		return nil
+	}
+	values := make(map[string]string)
+	flattenMetadata(values, "", raw)
+	return values
+}
+
+// flattenMetadata converts nested values into dotted keys and comma-separated lists
+func flattenMetadata(values map[string]string, prefix string, raw map[string]interface{}) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenMetadata(values, key, v)
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				if s := metadataString(item); s != "" {
+					items = append(items, s)
+				}
+			}
+			values[key] = strings.Join(items, ", ")
+		default:
+			values[key] = metadataString(v)
+		}
+	}
+}
+
+// metadataString formats a scalar metadata value
+func metadataString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case map[string]interface{}:
+		// Lists of objects, e.g. authors with a name field
+		if name, ok := v["name"]; ok {
+			return metadataString(name)
+		}
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseTOMLFrontMatter reads the key = value pairs of TOML front matter.
+// Tables become dotted prefixes; multi-line values are not supported.
+func parseTOMLFrontMatter(header string) map[string]string {
+	values := make(map[string]string)
+	prefix := ""
+	scanner := bufio.NewScanner(strings.NewReader(header))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			prefix = strings.Trim(line, "[] ")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		values[key] = parseTOMLValue(strings.TrimSpace(value))
+	}
+	return values
+}
+
+// parseTOMLValue converts a TOML scalar or array into a string
+func parseTOMLValue(value string) string {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		var items []string
+		for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+			if item = parseTOMLValue(strings.TrimSpace(item)); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2 {
+		return value[1 : len(value)-1]
+	}
+	// Drop trailing comments of bare values
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// parseHTMLMetadata reads <title>, <html lang> and the <meta> tags of an HTML page
+func parseHTMLMetadata(page string) map[string]string {
+	values := make(map[string]string)
+	tokenizer := html.NewTokenizer(strings.NewReader(page))
+	inTitle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return values
+		case html.TextToken:
+			if inTitle && values["title"] == "" {
+				values["title"] = strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return values
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = tokenizer.TagAttr()
+				attrs[strings.ToLower(string(key))] = string(val)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "html":
+				if lang := attrs["lang"]; lang != "" {
+					values["lang"] = lang
+				}
+			case "meta":
+				key := attrs["name"]
+				if key == "" {
+					key = attrs["property"]
+				}
+				if key != "" && attrs["content"] != "" {
+					key = strings.ToLower(key)
+					if _, exists := values[key]; !exists {
+						values[key] = attrs["content"]
+					}
+				}
+			case "body":
+				return values
+			}
+		}
+	}
+}
+
+// officeCoreProperties is docProps/core.xml of OOXML files (DOCX, PPTX, XLSX)
+type officeCoreProperties struct {
+	Title          string `xml:"title"`
+	Subject        string `xml:"subject"`
+	Creator        string `xml:"creator"`
+	Keywords       string `xml:"keywords"`
+	Description    string `xml:"description"`
+	Language       string `xml:"language"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+}
+
+// readOfficeCoreProperties reads the core properties stored in an OOXML package
+func readOfficeCoreProperties(path string) map[string]string {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		if file.Name != "docProps/core.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil
+		}
+		defer rc.Close()
+
+		var props officeCoreProperties
+		if err := xml.NewDecoder(rc).Decode(&props); err != nil {
+			return nil
+		}
+		return map[string]string{
+			"title":            props.Title,
+			"subject":          props.Subject,
+			"author":           props.Creator,
+			"keywords":         props.Keywords,
+			"description":      props.Description,
+			"language":         props.Language,
+			"last_modified_by": props.LastModifiedBy,
+			"created":          props.Created,
+			"modified":         props.Modified,
+		}
+	}
+	return nil
+}
+
+// pdfInfoKeys maps the fields of the PDF information dictionary to metadata keys
+var pdfInfoKeys = map[string]string{
+	"Title":        "title",
+	"Author":       "author",
+	"Subject":      "subject",
+	"Keywords":     "keywords",
+	"CreationDate": "created",
+	"ModDate":      "modified",
+}
+
+// pdfInfoPattern matches literal strings of the PDF information dictionary
+var pdfInfoPattern = regexp.MustCompile(`/(Title|Author|Subject|Keywords|CreationDate|ModDate)\s*\(((?:[^()\\]|\\.)*)\)`)
+
+// readPDFInfo reads the PDF information dictionary, using pdfinfo when installed
+func readPDFInfo(ctx context.Context, path string) map[string]string {
+	if pdfinfo, err := exec.LookPath("pdfinfo"); err == nil {
+		out, err := exec.CommandContext(ctx, pdfinfo, "-isodates", path).Output()
+		if err == nil {
+			values := make(map[string]string)
+			for _, line := range strings.Split(string(out), "\n") {
+				field, value, ok := strings.Cut(line, ":")
+				if key, known := pdfInfoKeys[strings.TrimSpace(field)]; ok && known {
+					values[key] = strings.TrimSpace(value)
+				}
+			}
+			return values
+		}
+	}
+
+	// Fall back to scanning the file for an uncompressed information dictionary
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, match := range pdfInfoPattern.FindAllStringSubmatch(string(data), -1) {
+		key := pdfInfoKeys[match[1]]
+		if _, exists := values[key]; !exists {
+			values[key] = strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(match[2])
+		}
+	}
+	return values
+}
+
+// parsePDFDate parses dates like D:20240131120000+01'00'
+func parsePDFDate(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(value, "D:")
+	if len(value) < 8 {
+		return time.Time{}, false
+	}
+	digits := value
+	zone := ""
+	if i := strings.IndexAny(value, "Z+-"); i >= 0 {
+		digits, zone = value[:i], value[i:]
+	}
+	if len(digits) > 14 || len(digits)%2 != 0 {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse("20060102150405"[:len(digits)], digits)
+	if err != nil {
+		return time.Time{}, false
+	}
+	zone = strings.ReplaceAll(zone, "'", "")
+	if len(zone) == 5 {
+		if offset, err := time.Parse("-0700", zone); err == nil {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, offset.Location())
+		}
+	}
+	return t, true
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtractMetadata checks front matter, HTML and office metadata extraction
+func TestExtractMetadata(t *testing.T) {
+	dir := t.TempDir()
+	loader := &DocumentLoader{}
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("YAMLFrontMatter", func(t *testing.T) {
+		content := "---\ntitle: Install guide\nauthors:\n  - Ada\n  - Grace\ndate: 2024-05-01\ntags: [setup, linux]\nweight: 3\n---\n# Install\nRun the installer."
+		path := write("guide.md", content)
+		mtime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+		text, metadata := loader.extractMetadata(context.Background(), path, content)
+		assert.Equal(t, "# Install\nRun the installer.", text)
+		assert.Equal(t, "Install guide", metadata.Title())
+		assert.Equal(t, "Ada, Grace", metadata.Author())
+		assert.Equal(t, "setup, linux", metadata[domain.MetaKeywords])
+		assert.Equal(t, "3", metadata["weight"])
+		assert.Equal(t, "2024-05-01T00:00:00Z", metadata[domain.MetaCreated])
+		assert.Equal(t, "2023-01-02T03:04:05Z", metadata[domain.MetaFileModified])
+	})
+
+	t.Run("TOMLFrontMatter", func(t *testing.T) {
+		content := "+++\ntitle = \"Release notes\"\nlastmod = 2024-02-03T10:00:00Z\ntags = [\"release\", 'v2']\n[params]\nteam = \"docs\"\n+++\nBody"
+		text, metadata := loader.extractMetadata(context.Background(), write("notes.md", content), content)
+		assert.Equal(t, "Body", text)
+		assert.Equal(t, "Release notes", metadata.Title())
+		assert.Equal(t, "release, v2", metadata[domain.MetaKeywords])
+		assert.Equal(t, "docs", metadata["params.team"])
+		assert.Equal(t, "2024-02-03T10:00:00Z", metadata[domain.MetaModified])
+	})
+
+	t.Run("NoFrontMatter", func(t *testing.T) {
+		content := "---\nNot front matter, just a rule above the text."
+		text, metadata := loader.extractMetadata(context.Background(), write("plain.md", content), content)
+		assert.Equal(t, content, text)
+		assert.Empty(t, metadata.Title())
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		content := `<html lang="fr"><head><title> Guide
+			d'installation </title><meta name="author" content="Jean"><meta property="article:published_time" content="2024-06-01T08:00:00+02:00">
+			</head><body><title>ignored</title></body></html>`
+		_, metadata := loader.extractMetadata(context.Background(), write("page.html", content), content)
+		assert.Equal(t, "Guide d'installation", metadata.Title())
+		assert.Equal(t, "Jean", metadata.Author())
+		assert.Equal(t, "fr", metadata[domain.MetaLanguage])
+		assert.Equal(t, "2024-06-01T06:00:00Z", metadata[domain.MetaCreated])
+	})
+
+	t.Run("DOCXCoreProperties", func(t *testing.T) {
+		path := filepath.Join(dir, "report.docx")
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		zw := zip.NewWriter(f)
+		w, err := zw.Create("docProps/core.xml")
+		require.NoError(t, err)
+		_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">
+<dc:title>Quarterly report</dc:title><dc:creator>Finance team</dc:creator>
+<dcterms:created>2024-04-01T09:00:00Z</dcterms:created></cp:coreProperties>`))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		require.NoError(t, f.Close())
+
+		_, metadata := loader.extractMetadata(context.Background(), path, "text")
+		assert.Equal(t, "Quarterly report", metadata.Title())
+		assert.Equal(t, "Finance team", metadata.Author())
+		assert.Equal(t, "2024-04-01T09:00:00Z", metadata[domain.MetaCreated])
+	})
+}
+
+// TestParsePDFDate checks the PDF date format
+func TestParsePDFDate(t *testing.T) {
+	date, ok := parsePDFDate("D:20240131120000+01'00'")
+	require.True(t, ok)
+	assert.Equal(t, "2024-01-31T11:00:00Z", date.UTC().Format(time.RFC3339))
+
+	_, ok = parsePDFDate("yesterday")
+	assert.False(t, ok)
+}
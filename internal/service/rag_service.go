@@ -1,21 +1,29 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/dontizi/rlama/internal/client"
 	"github.com/dontizi/rlama/internal/domain"
 	"github.com/dontizi/rlama/internal/repository"
+	"github.com/dontizi/rlama/pkg/vector"
 )
 
 // RagService interface defines the contract for RAG operations
 type RagService interface {
 	CreateRagWithOptions(modelName, ragName, folderPath string, options DocumentLoaderOptions) error
+	CreateRagFromSources(modelName, ragName string, sources []string, options DocumentLoaderOptions) error
+	CreateRagFromDocuments(modelName, ragName string, docs []*domain.Document, options DocumentLoaderOptions) error
 	GetRagChunks(ragName string, filter ChunkFilter) ([]*domain.DocumentChunk, error)
 	LoadRag(ragName string) (*domain.RagSystem, error)
 	Query(rag *domain.RagSystem, query string, contextSize int) (string, error)
+	QueryWithFilter(rag *domain.RagSystem, query string, contextSize int, filter vector.MetadataFilter) (string, error)
 	AddDocsWithOptions(ragName string, folderPath string, options DocumentLoaderOptions) error
+	AddDocsFromSources(ragName string, sources []string, options DocumentLoaderOptions) error
+	AddDocuments(ragName string, docs []*domain.Document, options DocumentLoaderOptions) error
 	UpdateModel(ragName string, newModel string) error
 	UpdateRag(rag *domain.RagSystem) error
 	UpdateRerankerModel(ragName string, model string) error
@@ -83,32 +91,111 @@ func (rs *RagServiceImpl) GetOllamaClient() *client.OllamaClient {
 
 // CreateRagWithOptions creates a new RAG system with options
 func (rs *RagServiceImpl) CreateRagWithOptions(modelName, ragName, folderPath string, options DocumentLoaderOptions) error {
+	if err := rs.checkNewRag(modelName, ragName, options.EmbeddingModel, options.EmbeddingProfile); err != nil {
+		return err
+	}
+
+	// Load documents with options
+	docs, err := rs.documentLoader.LoadDocumentsFromFolderWithOptions(folderPath, options)
+	if err != nil {
+		return fmt.Errorf("error loading documents: %w", err)
+	}
+
+	if len(docs) == 0 {
+		return fmt.Errorf("no valid documents found in folder %s", folderPath)
+	}
+
+	return rs.createRag(modelName, ragName, docs, options)
+}
+
+// CreateRagFromSources creates a new RAG system from any mix of files, folders,
+// glob patterns and standard input (StdinSource)
+func (rs *RagServiceImpl) CreateRagFromSources(modelName, ragName string, sources []string, options DocumentLoaderOptions) error {
+	if err := rs.checkNewRag(modelName, ragName, options.EmbeddingModel, options.EmbeddingProfile); err != nil {
+		return err
+	}
+
+	docs, err := rs.documentLoader.LoadDocumentsFromSources(sources, options)
+	if err != nil {
+		return fmt.Errorf("error loading documents: %w", err)
+	}
+
+	return rs.createRag(modelName, ragName, docs, options)
+}
+
+// CreateRagFromDocuments creates a new RAG system from documents held in memory,
+// without reading the filesystem. The documents are redacted, deduplicated and
+// chunked like loaded ones.
+func (rs *RagServiceImpl) CreateRagFromDocuments(modelName, ragName string, docs []*domain.Document, options DocumentLoaderOptions) error {
+	if err := rs.checkNewRag(modelName, ragName, options.EmbeddingModel, options.EmbeddingProfile); err != nil {
+		return err
+	}
+
+	if err := prepareDocuments(docs); err != nil {
+		return err
+	}
+
+	return rs.createRag(modelName, ragName, docs, options)
+}
+
+// checkNewRag checks that the models are available and the RAG name is free
+func (rs *RagServiceImpl) checkNewRag(modelName, ragName, embeddingModel, embeddingProfile string) error {
 	// Check if Ollama is available
 	if err := rs.ollamaClient.CheckOllamaAndModel(modelName); err != nil {
 		return err
 	}
+	embeddingService, err := rs.embeddingService.ForProfile(embeddingProfile)
+	if err != nil {
+		return err
+	}
+	if _, err := embeddingService.CheckEmbeddingModel(embeddingModelOrDefault(embeddingModel)); err != nil {
+		return fmt.Errorf("%w; choose the embedding model with --embedding-model", err)
+	}
 
 	// Check if the RAG already exists
 	if rs.ragRepository.Exists(ragName) {
 		return fmt.Errorf("a RAG with name '%s' already exists", ragName)
 	}
+	return nil
+}
 
-	// Load documents with options
-	docs, err := rs.documentLoader.LoadDocumentsFromFolderWithOptions(folderPath, options)
+// createRag chunks and embeds loaded documents and saves them as a new RAG
+func (rs *RagServiceImpl) createRag(modelName, ragName string, docs []*domain.Document, options DocumentLoaderOptions) error {
+	if len(docs) == 0 {
+		return errors.New("no documents to index")
+	}
+
+	// Create the RAG system
+	rag := domain.NewRagSystem(ragName, modelName)
+	rag.EmbeddingModel = embeddingModelOrDefault(options.EmbeddingModel)
+	rag.EmbeddingProfile = options.EmbeddingProfile
+	prefixes := embeddingPrefixesOrDefault(options.EmbeddingPrefixes, rag.EmbeddingModel)
+	rag.EmbeddingPrefixes = &prefixes
+	printEmbeddingPrefixes(prefixes, rag.EmbeddingModel)
+	embeddingService, err := rs.embeddingService.ForRag(rag)
 	if err != nil {
-		return fmt.Errorf("error loading documents: %w", err)
+		return err
 	}
 
+	// Collapse near-duplicate documents, redact personal data from those kept,
+	// then strip lines repeated across documents, detected once redacted
+	applyDedupSettings(rag, options.Dedup)
+	docs = collapseDuplicates(rag, docs, nil)
+	rag.Redaction = options.Redaction
+	docs, err = redactDocuments(rag, docs)
+	if err != nil {
+		return err
+	}
 	if len(docs) == 0 {
-		return fmt.Errorf("no valid documents found in folder %s", folderPath)
+		return errors.New("all documents were dropped by the redaction settings")
 	}
+	removeBoilerplate(rag, docs, options.BoilerplateDocs, options.BoilerplateRatio)
+	assignDocumentIDs(rag, docs)
 
 	fmt.Printf("Successfully loaded %d documents. Chunking documents...\n", len(docs))
-
-	// Create the RAG system
-	rag := domain.NewRagSystem(ragName, modelName)
 	rag.ChunkingStrategy = options.ChunkingStrategy
 	rag.APIProfileName = options.APIProfileName
+	rag.ContextualHeaders = options.ContextualHeaders
 
 	// Configure reranking options - enable by default
 	rag.RerankerEnabled = true // Always enable reranking by default
@@ -145,13 +232,27 @@ func (rs *RagServiceImpl) CreateRagWithOptions(modelName, ragName, folderPath st
 	rag.WatchOptions.ChunkSize = options.ChunkSize
 	rag.WatchOptions.ChunkOverlap = options.ChunkOverlap
 	rag.WatchOptions.ChunkingStrategy = options.ChunkingStrategy
+	rag.WatchOptions.RowsPerChunk = options.RowsPerChunk
+	rag.WatchOptions.ChunkTokens = options.ChunkTokens
+	rag.WatchOptions.OverlapTokens = options.OverlapTokens
+	rag.WatchOptions.IncludePatterns = options.IncludePatterns
+	rag.WatchOptions.ExcludePatterns = options.ExcludePatterns
+	rag.WatchOptions.UseGitignore = options.UseGitignore
+	rag.WatchOptions.ArchiveDepth = options.ArchiveDepth
+	rag.WatchOptions.MaxArchiveSize = options.MaxArchiveSize
 
 	// Create chunker service
 	chunkerService := NewChunkerService(ChunkingConfig{
 		ChunkSize:        options.ChunkSize,
 		ChunkOverlap:     options.ChunkOverlap,
 		ChunkingStrategy: options.ChunkingStrategy,
+		RowsPerChunk:     options.RowsPerChunk,
+		ChunkTokens:      options.ChunkTokens,
+		OverlapTokens:    options.OverlapTokens,
+		Embedder:         chunkEmbedder(embeddingService, options.ChunkingStrategy, rag.EmbeddingModel),
+		Retrieval:        retrievalEvaluation(embeddingService, options.ChunkingStrategy, rag.EmbeddingModel, options.EvalQuestions),
 	})
+	contextualizer := newChunkContextualizer(rs.ollamaClient, rag)
 
 	// Process each document - chunk and generate embeddings
 	var allChunks []*domain.DocumentChunk
@@ -161,6 +262,7 @@ func (rs *RagServiceImpl) CreateRagWithOptions(modelName, ragName, folderPath st
 
 		// Chunk the document
 		chunks := chunkerService.ChunkDocument(doc)
+		contextualizer.addHeaders(doc, chunks)
 
 		// Update total chunks in metadata
 		for i, chunk := range chunks {
@@ -175,15 +277,13 @@ func (rs *RagServiceImpl) CreateRagWithOptions(modelName, ragName, folderPath st
 		len(allChunks), len(docs))
 
 	// Generate embeddings for all chunks
-	err = rs.embeddingService.GenerateChunkEmbeddings(allChunks, modelName)
+	failed, err := embeddingService.GenerateChunkEmbeddings(allChunks, rag.EmbeddingModel)
 	if err != nil {
 		return fmt.Errorf("error generating embeddings: %w", err)
 	}
 
-	// Add all chunks to the RAG
-	for _, chunk := range allChunks {
-		rag.AddChunk(chunk)
-	}
+	// Add all chunks to the RAG, those whose embedding failed as pending
+	addEmbeddedChunks(rag, allChunks, failed)
 
 	// Save the RAG
 	err = rs.ragRepository.Save(rag)
@@ -229,19 +329,16 @@ func (rs *RagServiceImpl) LoadRag(ragName string) (*domain.RagSystem, error) {
 
 // Query performs a query on a RAG system
 func (rs *RagServiceImpl) Query(rag *domain.RagSystem, query string, contextSize int) (string, error) {
-	// Check if Ollama is available
-	var llmClient client.LLMClient
+	return rs.QueryWithFilter(rag, query, contextSize, nil)
+}
 
+// QueryWithFilter performs a query on the chunks of a RAG system whose metadata
+// matches the filter, e.g. {"author": "smith", "language": "fr"}
+func (rs *RagServiceImpl) QueryWithFilter(rag *domain.RagSystem, query string, contextSize int, filter vector.MetadataFilter) (string, error) {
 	// Determine which client to use based on the model
-	if client.IsOpenAIModel(rag.ModelName) {
-		// For OpenAI, use the specified profile or default
-		openAIClient, err := client.NewOpenAIClientWithProfile(rag.APIProfileName)
-		if err != nil {
-			return "", err
-		}
-		llmClient = openAIClient
-	} else {
-		llmClient = rs.ollamaClient
+	llmClient, err := newLLMClient(rs.ollamaClient, rag.ModelName, rag.APIProfileName)
+	if err != nil {
+		return "", err
 	}
 
 	if err := llmClient.CheckLLMAndModel(rag.ModelName); err != nil {
@@ -249,7 +346,7 @@ func (rs *RagServiceImpl) Query(rag *domain.RagSystem, query string, contextSize
 	}
 
 	// Generate embedding for the query
-	queryEmbedding, err := rs.embeddingService.GenerateQueryEmbedding(query, rag.ModelName)
+	queryEmbedding, err := rs.embeddingService.GenerateRagQueryEmbedding(rag, query)
 	if err != nil {
 		return "", fmt.Errorf("error generating embedding for query: %w", err)
 	}
@@ -287,8 +384,14 @@ func (rs *RagServiceImpl) Query(rag *domain.RagSystem, query string, contextSize
 		fmt.Printf("Retrieving %d initial results for reranking...\n", initialRetrievalCount)
 	}
 
-	// Search for the most relevant chunks
-	results := rag.HybridStore.Search(queryEmbedding, initialRetrievalCount)
+	// Search for the most relevant chunks, by meaning and by words
+	results, err := SearchChunks(rag, queryEmbedding, query, initialRetrievalCount, filter)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 && len(filter) > 0 {
+		fmt.Printf("No chunk matches the metadata filter %v\n", map[string]string(filter))
+	}
 
 	// Second-stage retrieval: Re-rank if enabled
 	var rankedResults []RankedResult
@@ -386,20 +489,60 @@ Include references to the source documents in your answer using the format (Sour
 	return response, nil
 }
 
+// SearchChunks returns the chunks closest to a query, combining the similarity
+// of their embedding with the BM25 score of their text. The text search uses
+// the analyzer of the language of the query. Only the chunks whose metadata
+// matches the filter are searched.
+func SearchChunks(rag *domain.RagSystem, queryEmbedding []float32, query string, limit int, filter vector.MetadataFilter) ([]vector.SearchResult, error) {
+	hybridResults, err := rag.SearchFiltered(queryEmbedding, query, limit, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error searching the RAG: %w", err)
+	}
+
+	results := make([]vector.SearchResult, 0, len(hybridResults))
+	for _, result := range hybridResults {
+		results = append(results, vector.SearchResult{ID: result.ID, Score: result.CombinedScore})
+	}
+	return results, nil
+}
+
+// ParseMetadataFilter builds a metadata filter from key=value conditions, such
+// as "author=smith". Keys may be written as text index fields ("metadata.author").
+func ParseMetadataFilter(conditions []string) (vector.MetadataFilter, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	filter := make(vector.MetadataFilter, len(conditions))
+	for _, condition := range conditions {
+		key, value, ok := strings.Cut(condition, "=")
+		key = strings.TrimPrefix(strings.TrimSpace(key), "metadata.")
+		if !ok || key == "" || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid metadata filter '%s', expected key=value", condition)
+		}
+		filter[key] = value
+	}
+	return filter, nil
+}
+
+// newLLMClient returns the client serving a model: OpenAI models use the given
+// API profile or the default one, other models are served by Ollama
+func newLLMClient(ollamaClient *client.OllamaClient, modelName, profileName string) (client.LLMClient, error) {
+	if client.IsOpenAIModel(modelName) {
+		return client.NewOpenAIClientWithProfile(profileName)
+	}
+	return ollamaClient, nil
+}
+
 // AddDocsWithOptions adds documents to a RAG with options
 func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string, options DocumentLoaderOptions) error {
 	// Load the existing RAG system
-	rag, err := rs.LoadRag(ragName)
+	rag, err := rs.loadRagForUpdate(ragName)
 	if err != nil {
-		return fmt.Errorf("error loading RAG '%s': %w", ragName, err)
-	}
-
-	// Check if Ollama is available
-	if err := rs.ollamaClient.CheckOllamaAndModel(rag.ModelName); err != nil {
 		return err
 	}
 
 	// Load new documents with options
+	options = withArchiveSettings(rag, options)
 	newDocs, err := rs.documentLoader.LoadDocumentsFromFolderWithOptions(folderPath, options)
 	if err != nil {
 		return fmt.Errorf("error loading documents: %w", err)
@@ -409,12 +552,94 @@ func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string,
 		return fmt.Errorf("no valid documents found in folder %s", folderPath)
 	}
 
+	return rs.addDocuments(rag, newDocs, options)
+}
+
+// AddDocsFromSources adds documents from any mix of files, folders, glob
+// patterns and standard input (StdinSource) to an existing RAG system
+func (rs *RagServiceImpl) AddDocsFromSources(ragName string, sources []string, options DocumentLoaderOptions) error {
+	rag, err := rs.loadRagForUpdate(ragName)
+	if err != nil {
+		return err
+	}
+
+	options = withArchiveSettings(rag, options)
+	newDocs, err := rs.documentLoader.LoadDocumentsFromSources(sources, options)
+	if err != nil {
+		return fmt.Errorf("error loading documents: %w", err)
+	}
+
+	return rs.addDocuments(rag, newDocs, options)
+}
+
+// AddDocuments adds documents held in memory to an existing RAG system, without
+// reading the filesystem. Documents whose Path is already in the RAG are skipped.
+func (rs *RagServiceImpl) AddDocuments(ragName string, docs []*domain.Document, options DocumentLoaderOptions) error {
+	rag, err := rs.loadRagForUpdate(ragName)
+	if err != nil {
+		return err
+	}
+
+	if err := prepareDocuments(docs); err != nil {
+		return err
+	}
+
+	return rs.addDocuments(rag, docs, options)
+}
+
+// withArchiveSettings fills the archive limits left to their defaults with those
+// saved on the RAG, so that a RAG never opening archives keeps not opening them
+func withArchiveSettings(rag *domain.RagSystem, options DocumentLoaderOptions) DocumentLoaderOptions {
+	if options.ArchiveDepth == 0 {
+		options.ArchiveDepth = rag.WatchOptions.ArchiveDepth
+	}
+	if options.MaxArchiveSize <= 0 {
+		options.MaxArchiveSize = rag.WatchOptions.MaxArchiveSize
+	}
+	return options
+}
+
+// loadRagForUpdate loads a RAG and checks that its model is available
+func (rs *RagServiceImpl) loadRagForUpdate(ragName string) (*domain.RagSystem, error) {
+	rag, err := rs.LoadRag(ragName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading RAG '%s': %w", ragName, err)
+	}
+
+	// Check if Ollama is available
+	if err := rs.ollamaClient.CheckOllamaAndModel(rag.ModelName); err != nil {
+		return nil, err
+	}
+	return rag, nil
+}
+
+// addDocuments chunks and embeds loaded documents and adds them to a RAG
+func (rs *RagServiceImpl) addDocuments(rag *domain.RagSystem, newDocs []*domain.Document, options DocumentLoaderOptions) error {
+	ragName := rag.Name
+	if len(newDocs) == 0 {
+		return errors.New("no documents to add")
+	}
+
+	// New chunks are embedded with the provider and model of the existing ones
+	embeddingService, err := rs.embeddingService.ForRag(rag)
+	if err != nil {
+		return err
+	}
+	embeddingModel, err := embeddingService.ResolveEmbeddingModel(rag)
+	if err != nil {
+		return err
+	}
+	embedPendingChunks(rag, embeddingService, embeddingModel)
+
 	fmt.Printf("Successfully loaded %d new documents. Chunking documents...\n", len(newDocs))
 
 	// Create chunker service with the same options as the RAG or from provided options
 	chunkSize := rag.WatchOptions.ChunkSize
 	chunkOverlap := rag.WatchOptions.ChunkOverlap
 	chunkingStrategy := rag.ChunkingStrategy
+	rowsPerChunk := rag.WatchOptions.RowsPerChunk
+	chunkTokens := rag.WatchOptions.ChunkTokens
+	overlapTokens := rag.WatchOptions.OverlapTokens
 
 	// Override with provided options if specified
 	if options.ChunkSize > 0 {
@@ -426,18 +651,33 @@ func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string,
 	if options.ChunkingStrategy != "" {
 		chunkingStrategy = options.ChunkingStrategy
 	}
+	if options.RowsPerChunk > 0 {
+		rowsPerChunk = options.RowsPerChunk
+	}
+	if options.ChunkTokens > 0 {
+		chunkTokens = options.ChunkTokens
+		overlapTokens = options.OverlapTokens
+	}
 
 	// Create chunker with configured options
 	chunkerService := NewChunkerService(ChunkingConfig{
 		ChunkSize:        chunkSize,
 		ChunkOverlap:     chunkOverlap,
 		ChunkingStrategy: chunkingStrategy,
+		RowsPerChunk:     rowsPerChunk,
+		ChunkTokens:      chunkTokens,
+		OverlapTokens:    overlapTokens,
+		Embedder:         chunkEmbedder(embeddingService, chunkingStrategy, embeddingModel),
+		Retrieval:        retrievalEvaluation(embeddingService, chunkingStrategy, embeddingModel, options.EvalQuestions),
 	})
 
 	// Check for duplicates
 	existingDocPaths := make(map[string]bool)
 	for _, doc := range rag.Documents {
 		existingDocPaths[doc.Path] = true
+		for _, alias := range doc.Aliases {
+			existingDocPaths[alias] = true
+		}
 	}
 
 	var uniqueDocs []*domain.Document
@@ -453,15 +693,43 @@ func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string,
 		existingDocPaths[doc.Path] = true // Mark as processed to avoid future duplicates
 	}
 
-	if len(uniqueDocs) == 0 {
-		return fmt.Errorf("all %d documents already exist in the RAG, none added", skippedDocs)
-	}
-
 	if skippedDocs > 0 {
 		fmt.Printf("Skipped %d documents that were already in the RAG.\n", skippedDocs)
 	}
 
+	// Collapse near-duplicates of indexed documents and of each other once
+	// stripped of the known boilerplate, redact personal data from those kept,
+	// then strip the lines repeated across documents
+	if options.Redaction != nil {
+		if rag.Redaction != nil && rag.Redaction.Salt != "" && options.Redaction.Mode == domain.RedactHash {
+			// Keep hashes of equal values identical across additions
+			options.Redaction.Salt = rag.Redaction.Salt
+		}
+		rag.Redaction = options.Redaction
+	}
+	if options.ContextualHeaders != nil {
+		rag.ContextualHeaders = options.ContextualHeaders
+	}
+	stripKnownBoilerplate(rag, uniqueDocs)
+	applyDedupSettings(rag, options.Dedup)
+	uniqueDocs = collapseDuplicates(rag, uniqueDocs, nil)
+	uniqueDocs, err = redactDocuments(rag, uniqueDocs)
+	if err != nil {
+		return err
+	}
+	removeBoilerplate(rag, uniqueDocs, options.BoilerplateDocs, options.BoilerplateRatio)
+	assignDocumentIDs(rag, uniqueDocs)
+
+	if len(uniqueDocs) == 0 {
+		// Keep the aliases, the copies left out and the redaction audit recorded on the RAG
+		if err := rs.ragRepository.Save(rag); err != nil {
+			return fmt.Errorf("error saving the updated RAG: %w", err)
+		}
+		return fmt.Errorf("all %d documents already exist in the RAG or were dropped, none added", len(newDocs))
+	}
+
 	// Process each unique document - chunk and generate embeddings
+	contextualizer := newChunkContextualizer(rs.ollamaClient, rag)
 	var allChunks []*domain.DocumentChunk
 	for _, doc := range uniqueDocs {
 		// Add the document to the RAG
@@ -469,6 +737,7 @@ func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string,
 
 		// Chunk the document
 		chunks := chunkerService.ChunkDocument(doc)
+		contextualizer.addHeaders(doc, chunks)
 
 		// Update total chunks in metadata
 		for i, chunk := range chunks {
@@ -483,20 +752,27 @@ func (rs *RagServiceImpl) AddDocsWithOptions(ragName string, folderPath string,
 		len(allChunks), len(uniqueDocs))
 
 	// Generate embeddings for all chunks
-	err = rs.embeddingService.GenerateChunkEmbeddings(allChunks, rag.ModelName)
+	failed, err := embeddingService.GenerateChunkEmbeddings(allChunks, embeddingModel)
 	if err != nil {
 		return fmt.Errorf("error generating embeddings: %w", err)
 	}
 
-	// Add all chunks to the RAG
-	for _, chunk := range allChunks {
-		rag.AddChunk(chunk)
-	}
+	// Add all chunks to the RAG, those whose embedding failed as pending
+	addEmbeddedChunks(rag, allChunks, failed)
 
 	// Update the RAG's chunk options based on the most recent settings
 	rag.WatchOptions.ChunkSize = chunkSize
 	rag.WatchOptions.ChunkOverlap = chunkOverlap
+	rag.WatchOptions.RowsPerChunk = rowsPerChunk
+	rag.WatchOptions.ChunkTokens = chunkTokens
+	rag.WatchOptions.OverlapTokens = overlapTokens
 	rag.ChunkingStrategy = chunkingStrategy
+	if options.ArchiveDepth != 0 {
+		rag.WatchOptions.ArchiveDepth = options.ArchiveDepth
+	}
+	if options.MaxArchiveSize > 0 {
+		rag.WatchOptions.MaxArchiveSize = options.MaxArchiveSize
+	}
 
 	// Update reranker settings if specified in options
 	if options.RerankerModel != "" {
@@ -544,17 +820,66 @@ func (rs *RagServiceImpl) ListAllRags() ([]string, error) {
 
 // SetupDirectoryWatching sets up directory watching for a RAG
 func (rs *RagServiceImpl) SetupDirectoryWatching(ragName string, dirPath string, watchInterval int, options DocumentLoaderOptions) error {
-	return nil
+	rag, err := rs.LoadRag(ragName)
+	if err != nil {
+		return fmt.Errorf("error loading RAG: %w", err)
+	}
+
+	absDir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return fmt.Errorf("unable to resolve absolute path: %w", err)
+	}
+
+	rag.WatchedDir = absDir
+	rag.WatchInterval = watchInterval
+	rag.WatchEnabled = true
+
+	// The archive limits of the RAG are kept unless new ones are given
+	options = withArchiveSettings(rag, options)
+	rag.WatchOptions = domain.DocumentWatchOptions{
+		ExcludeDirs:      options.ExcludeDirs,
+		ExcludeExts:      options.ExcludeExts,
+		ProcessExts:      options.ProcessExts,
+		ChunkSize:        options.ChunkSize,
+		ChunkOverlap:     options.ChunkOverlap,
+		ChunkingStrategy: options.ChunkingStrategy,
+		RowsPerChunk:     options.RowsPerChunk,
+		ChunkTokens:      options.ChunkTokens,
+		OverlapTokens:    options.OverlapTokens,
+		IncludePatterns:  options.IncludePatterns,
+		ExcludePatterns:  options.ExcludePatterns,
+		UseGitignore:     options.UseGitignore,
+		ArchiveDepth:     options.ArchiveDepth,
+		MaxArchiveSize:   options.MaxArchiveSize,
+	}
+
+	// Keep the RAG's chunking settings if none were provided
+	if rag.WatchOptions.ChunkingStrategy == "" {
+		rag.WatchOptions.ChunkingStrategy = rag.ChunkingStrategy
+	}
+
+	return rs.ragRepository.Save(rag)
 }
 
 // DisableDirectoryWatching disables directory watching for a RAG
 func (rs *RagServiceImpl) DisableDirectoryWatching(ragName string) error {
-	return nil
+	rag, err := rs.LoadRag(ragName)
+	if err != nil {
+		return fmt.Errorf("error loading RAG: %w", err)
+	}
+
+	rag.WatchEnabled = false
+	return rs.ragRepository.Save(rag)
 }
 
 // CheckWatchedDirectory checks a watched directory for changes
 func (rs *RagServiceImpl) CheckWatchedDirectory(ragName string) (int, error) {
-	return 0, nil
+	rag, err := rs.LoadRag(ragName)
+	if err != nil {
+		return 0, fmt.Errorf("error loading RAG: %w", err)
+	}
+
+	return NewFileWatcher(rs).CheckAndUpdateRag(rag)
 }
 
 // SetupWebWatching sets up web watching for a RAG
@@ -1,10 +1,15 @@
 package service
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/dontizi/rlama/internal/client"
 	"github.com/dontizi/rlama/internal/domain"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestRagRerankerTopK checks that the reranking is configured correctly and limits the results to 5 by default
@@ -104,3 +109,113 @@ func TestRagRerankerTopK(t *testing.T) {
 		rag.RerankerEnabled = true
 	})
 }
+
+// newQueryTestService returns a service whose Ollama server embeds every query
+// as (1, 0, 0) and records the prompts sent for completion
+func newQueryTestService(t *testing.T) (*RagServiceImpl, *[]string) {
+	t.Setenv("RLAMA_DATA_DIR", t.TempDir())
+
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/version":
+			w.Write([]byte(`{"version":"test"}`))
+		case "/api/embed":
+			var req client.EmbedRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			resp := client.EmbedResponse{}
+			for range req.Input {
+				resp.Embeddings = append(resp.Embeddings, []float32{1, 0, 0})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/generate":
+			var req client.GenerationRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			prompts = append(prompts, req.Prompt)
+			json.NewEncoder(w).Encode(client.GenerationResponse{Response: "answer", Done: true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ollamaClient := &client.OllamaClient{BaseURL: server.URL, Client: server.Client()}
+	return NewRagService(ollamaClient).(*RagServiceImpl), &prompts
+}
+
+// addQueryTestChunk adds a one-chunk document with a given embedding
+func addQueryTestChunk(rag *domain.RagSystem, name, content string, embedding []float32) *domain.DocumentChunk {
+	doc := domain.NewDocument(name, content)
+	rag.AddDocument(doc)
+	chunk := domain.NewDocumentChunk(doc, content, 0, len(content), 0)
+	chunk.Embedding = embedding
+	rag.AddChunk(chunk)
+	return chunk
+}
+
+// TestQueryUsesLanguageAwareTextSearch checks that queries combine the vector
+// search with the BM25 search: the French chunk is further from the query
+// embedding but its words match the question through the French stemmer
+func TestQueryUsesLanguageAwareTextSearch(t *testing.T) {
+	rs, prompts := newQueryTestService(t)
+
+	rag := domain.NewRagSystem("query-test", "llama3")
+	rag.EmbeddingModel = "fake-embed"
+	rag.RerankerEnabled = false
+	addQueryTestChunk(rag, "weather.txt", "The weather was sunny all week long in the city.", []float32{1, 0, 0})
+	addQueryTestChunk(rag, "maisons.txt", "Les maisons anciennes sont rénovées chaque année par la ville.", []float32{0.8, 0.6, 0})
+
+	answer, err := rs.Query(rag, "Comment est rénovée la maison ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", answer)
+	require.Len(t, *prompts, 1)
+	assert.Contains(t, (*prompts)[0], "Les maisons anciennes")
+	assert.NotContains(t, (*prompts)[0], "sunny")
+}
+
+// TestSearchChunksWithoutTextMatches checks that the vector ranking and scores
+// are unchanged when no word of the question matches a chunk
+func TestSearchChunksWithoutTextMatches(t *testing.T) {
+	rag := domain.NewRagSystem("vector-test", "llama3")
+	addQueryTestChunk(rag, "a.txt", "The weather was sunny all week.", []float32{1, 0, 0})
+	addQueryTestChunk(rag, "b.txt", "Release notes for the engine.", []float32{0.8, 0.6, 0})
+	addQueryTestChunk(rag, "c.txt", "Installation on Linux.", []float32{0, 1, 0})
+
+	query := []float32{0.9, 0.4, 0}
+	results, err := SearchChunks(rag, query, "xylophone zeppelin", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, rag.HybridStore.Search(query, 2), results)
+}
+
+// TestQueryWithMetadataFilter checks that only the chunks whose metadata
+// matches the filter reach the prompt
+func TestQueryWithMetadataFilter(t *testing.T) {
+	rs, prompts := newQueryTestService(t)
+
+	rag := domain.NewRagSystem("filter-test", "llama3")
+	rag.EmbeddingModel = "fake-embed"
+	rag.RerankerEnabled = false
+	ada := addQueryTestChunk(rag, "ada.md", "Release notes for the analytical engine.", []float32{1, 0, 0})
+	ada.Metadata[domain.MetaAuthor] = "Ada Lovelace"
+	ada.Metadata[domain.MetaKeywords] = "engine, release"
+	alan := addQueryTestChunk(rag, "alan.md", "Release notes for the computing machine.", []float32{0.9, 0.1, 0})
+	alan.Metadata[domain.MetaAuthor] = "Alan Turing"
+
+	filter, err := ParseMetadataFilter([]string{"author=alan turing"})
+	require.NoError(t, err)
+	_, err = rs.QueryWithFilter(rag, "release notes", 5, filter)
+	require.NoError(t, err)
+	assert.Contains(t, (*prompts)[0], "computing machine")
+	assert.NotContains(t, (*prompts)[0], "analytical engine")
+
+	// One item of a list is enough, and keys may be written as index fields
+	filter, err = ParseMetadataFilter([]string{"metadata.keywords=Engine"})
+	require.NoError(t, err)
+	_, err = rs.QueryWithFilter(rag, "release notes", 5, filter)
+	require.NoError(t, err)
+	assert.Contains(t, (*prompts)[1], "analytical engine")
+	assert.NotContains(t, (*prompts)[1], "computing machine")
+
+	_, err = ParseMetadataFilter([]string{"author"})
+	assert.Error(t, err)
+}
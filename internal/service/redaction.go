@@ -0,0 +1,437 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// PIIDetector finds personal data in a text
+type PIIDetector interface {
+	// Name identifies the detector in settings, placeholders and audit reports
+	Name() string
+	// Find returns the byte offsets of the values found in text
+	Find(text string) [][]int
+}
+
+// regexDetector matches a regular expression and optionally validates each
+// match, typically with a checksum
+type regexDetector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// Name returns the detector name
+func (d *regexDetector) Name() string {
+	return d.name
+}
+
+// Find returns the valid matches of the expression
+func (d *regexDetector) Find(text string) [][]int {
+	var matches [][]int
+	for _, loc := range d.re.FindAllStringIndex(text, -1) {
+		if d.valid == nil || d.valid(text[loc[0]:loc[1]]) {
+			matches = append(matches, loc)
+		}
+	}
+	return matches
+}
+
+// builtinDetectors are the detectors available by name, in priority order
+// when two of them match the same text
+var builtinDetectors = []PIIDetector{
+	&regexDetector{
+		name: "email",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	&regexDetector{
+		name:  "iban",
+		re:    regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+		valid: validIBAN,
+	},
+	&regexDetector{
+		name:  "credit-card",
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: validCardNumber,
+	},
+	&regexDetector{
+		name:  "us-ssn",
+		re:    regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		valid: validSSN,
+	},
+	&regexDetector{
+		name:  "fr-nir",
+		re:    regexp.MustCompile(`\b[12] ?\d{2} ?\d{2} ?(?:\d{2}|2A|2B) ?\d{3} ?\d{3} ?\d{2}\b`),
+		valid: validNIR,
+	},
+	&regexDetector{
+		name:  "phone",
+		re:    regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{2,4}){2,5}\b`),
+		valid: validPhone,
+	},
+}
+
+// RegisterPIIDetector makes a detector available by name, alongside the built-in
+// ones. It must be called before documents are loaded.
+func RegisterPIIDetector(detector PIIDetector) {
+	builtinDetectors = append(builtinDetectors, detector)
+}
+
+// BuiltinDetectorNames returns the names of the built-in detectors
+func BuiltinDetectorNames() []string {
+	names := make([]string, len(builtinDetectors))
+	for i, detector := range builtinDetectors {
+		names[i] = detector.Name()
+	}
+	return names
+}
+
+// digitsOf returns the digits of a string
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validIBAN checks the ISO 13616 mod-97 checksum
+func validIBAN(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// validCardNumber checks the length and the Luhn checksum of a card number
+func validCardNumber(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validSSN rejects the area, group and serial numbers never assigned
+func validSSN(match string) bool {
+	parts := strings.Split(match, "-")
+	area := parts[0]
+	return area != "000" && area != "666" && area[0] != '9' && parts[1] != "00" && parts[2] != "0000"
+}
+
+// validNIR checks the key of a French social security number (97 - number mod 97)
+func validNIR(match string) bool {
+	nir := strings.ReplaceAll(match, " ", "")
+	if len(nir) != 15 {
+		return false
+	}
+	// Corsican departments 2A and 2B count as 19 and 18
+	number := strings.NewReplacer("2A", "19", "2B", "18").Replace(nir[:13])
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return false
+	}
+	key, err := strconv.ParseInt(nir[13:], 10, 64)
+	return err == nil && key == 97-value%97
+}
+
+// validPhone accepts 9 to 15 digits written like a phone number: with an
+// international prefix, with separators or as a 10-digit national number
+func validPhone(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 9 || len(digits) > 15 {
+		return false
+	}
+	if strings.HasPrefix(match, "+") || strings.HasPrefix(match, "(") {
+		return true
+	}
+	if strings.ContainsAny(match, " .-") {
+		// Dates and versions are not phone numbers
+		return len(digits) >= 10
+	}
+	return len(digits) == 10 && digits[0] == '0'
+}
+
+// piiMatch is a value found in a text
+type piiMatch struct {
+	start, end int
+	detector   string
+}
+
+// Redactor removes personal data from documents according to RAG settings
+type Redactor struct {
+	mode      string
+	salt      string
+	detectors []PIIDetector
+}
+
+// NewRedactor creates a redactor from settings, checking the mode, the detector
+// names and the user-defined patterns
+func NewRedactor(settings domain.RedactionSettings) (*Redactor, error) {
+	switch settings.Mode {
+	case domain.RedactMask, domain.RedactHash, domain.RedactDrop:
+	default:
+		return nil, fmt.Errorf("unknown redaction mode '%s' (options: %s, %s, %s)",
+			settings.Mode, domain.RedactMask, domain.RedactHash, domain.RedactDrop)
+	}
+
+	redactor := &Redactor{mode: settings.Mode, salt: settings.Salt}
+	if len(settings.Detectors) == 0 {
+		redactor.detectors = append(redactor.detectors, builtinDetectors...)
+	}
+	for _, name := range settings.Detectors {
+		var found PIIDetector
+		for _, detector := range builtinDetectors {
+			if detector.Name() == name {
+				found = detector
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown PII detector '%s' (options: %s)", name, strings.Join(BuiltinDetectorNames(), ", "))
+		}
+		redactor.detectors = append(redactor.detectors, found)
+	}
+
+	for _, pattern := range settings.Patterns {
+		re, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern '%s': %w", pattern.Name, err)
+		}
+		redactor.detectors = append(redactor.detectors, &regexDetector{name: pattern.Name, re: re})
+	}
+
+	return redactor, nil
+}
+
+// NewRedactionSettings builds settings from command line values. Patterns are
+// written name=regex. A random salt is generated for the hash mode.
+func NewRedactionSettings(mode string, detectors []string, patterns []string) (*domain.RedactionSettings, error) {
+	settings := &domain.RedactionSettings{Mode: mode, Detectors: detectors}
+	for _, pattern := range patterns {
+		name, regex, ok := strings.Cut(pattern, "=")
+		if !ok || name == "" || regex == "" {
+			return nil, fmt.Errorf("invalid redaction pattern '%s', expected name=regex", pattern)
+		}
+		settings.Patterns = append(settings.Patterns, domain.RedactionPattern{Name: name, Regex: regex})
+	}
+
+	if mode == domain.RedactHash {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("error generating the redaction salt: %w", err)
+		}
+		settings.Salt = hex.EncodeToString(salt)
+	}
+
+	// Check the settings before they are saved
+	if _, err := NewRedactor(*settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// find returns the non-overlapping values found in text. When matches overlap,
+// the earliest and then the longest wins.
+func (r *Redactor) find(text string) []piiMatch {
+	var matches []piiMatch
+	for _, detector := range r.detectors {
+		for _, loc := range detector.Find(text) {
+			matches = append(matches, piiMatch{loc[0], loc[1], detector.Name()})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var kept []piiMatch
+	end := 0
+	for _, match := range matches {
+		if match.start >= end {
+			kept = append(kept, match)
+			end = match.end
+		}
+	}
+	return kept
+}
+
+// replacement returns the text that replaces a value
+func (r *Redactor) replacement(detector, value string) string {
+	label := strings.ToUpper(strings.ReplaceAll(detector, "-", "_"))
+	if r.mode == domain.RedactHash {
+		sum := sha256.Sum256([]byte(r.salt + value))
+		return "[" + label + ":" + hex.EncodeToString(sum[:5]) + "]"
+	}
+	return "[" + label + "]"
+}
+
+// redactText replaces the values found in text
+func (r *Redactor) redactText(text string, matches []piiMatch) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(text[last:match.start])
+		b.WriteString(r.replacement(match.detector, text[match.start:match.end]))
+		last = match.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Redact removes the personal data of a document, in its content and its
+// metadata, and returns the audit records. It returns false when the
+// document must not be indexed (drop mode).
+func (r *Redactor) Redact(doc *domain.Document) (bool, []domain.RedactionRecord) {
+	byDetector := make(map[string]*domain.RedactionRecord)
+	var order []string
+	record := func(detector string, line int) {
+		rec := byDetector[detector]
+		if rec == nil {
+			rec = &domain.RedactionRecord{
+				DocumentPath: doc.Path,
+				Detector:     detector,
+				Action:       r.mode,
+				RedactedAt:   time.Now(),
+			}
+			byDetector[detector] = rec
+			order = append(order, detector)
+		}
+		rec.Count++
+		if line > 0 && (len(rec.Lines) == 0 || rec.Lines[len(rec.Lines)-1] != line) {
+			rec.Lines = append(rec.Lines, line)
+		}
+	}
+
+	matches := r.find(doc.Content)
+	line, offset := 1, 0
+	for _, match := range matches {
+		line += strings.Count(doc.Content[offset:match.start], "\n")
+		offset = match.start
+		record(match.detector, line)
+	}
+
+	metadataMatches := make(map[string][]piiMatch)
+	for key, value := range doc.Metadata {
+		if found := r.find(value); len(found) > 0 {
+			metadataMatches[key] = found
+			for _, match := range found {
+				record(match.detector, 0)
+			}
+		}
+	}
+
+	records := make([]domain.RedactionRecord, 0, len(order))
+	for _, detector := range order {
+		records = append(records, *byDetector[detector])
+	}
+	if len(records) == 0 {
+		return true, nil
+	}
+	if r.mode == domain.RedactDrop {
+		return false, records
+	}
+
+	doc.Content = r.redactText(doc.Content, matches)
+	doc.Size = int64(len(doc.Content))
+	doc.Fingerprint = domain.SimHash(doc.Content)
+	for key, found := range metadataMatches {
+		doc.Metadata[key] = r.redactText(doc.Metadata[key], found)
+	}
+	return true, records
+}
+
+// documentHash identifies the extracted text of a document left out of the RAG,
+// by the redaction or as a near-duplicate
+func documentHash(doc *domain.Document) string {
+	sum := sha256.Sum256([]byte(doc.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// redactDocuments applies the redaction settings of the RAG to documents about
+// to be chunked, adds what was redacted to the RAG audit report and returns the
+// documents to index
+func redactDocuments(rag *domain.RagSystem, docs []*domain.Document) ([]*domain.Document, error) {
+	if rag.Redaction == nil {
+		return docs, nil
+	}
+	redactor, err := NewRedactor(*rag.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("error in the redaction settings of RAG '%s': %w", rag.Name, err)
+	}
+
+	var kept []*domain.Document
+	values, redacted, dropped := 0, 0, 0
+	for _, doc := range docs {
+		// A document dropped before is only checked again once it changed
+		hash := documentHash(doc)
+		if rag.Redaction.Mode == domain.RedactDrop && rag.DroppedDocuments[doc.Path] == hash {
+			continue
+		}
+
+		keep, records := redactor.Redact(doc)
+		rag.RedactionAudit = append(rag.RedactionAudit, records...)
+		for _, rec := range records {
+			values += rec.Count
+		}
+		if len(records) > 0 {
+			redacted++
+		}
+		if !keep {
+			if rag.DroppedDocuments == nil {
+				rag.DroppedDocuments = make(map[string]string)
+			}
+			rag.DroppedDocuments[doc.Path] = hash
+			dropped++
+			continue
+		}
+		delete(rag.DroppedDocuments, doc.Path)
+		kept = append(kept, doc)
+	}
+
+	if redacted > 0 {
+		fmt.Printf("Redacted %d value(s) in %d document(s)", values, redacted)
+		if dropped > 0 {
+			fmt.Printf(", %d document(s) dropped", dropped)
+		}
+		fmt.Printf(". Run 'rlama redaction %s' for the audit report.\n", rag.Name)
+	}
+	return kept, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactorDetectors(t *testing.T) {
+	redactor, err := NewRedactor(domain.RedactionSettings{Mode: domain.RedactMask})
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"Contact jane.doe@example.com today":           "Contact [EMAIL] today",
+		"IBAN: FR76 3000 6000 0112 3456 7890 189.":     "IBAN: [IBAN].",
+		"Wrong IBAN FR76 3000 6000 0112 3456 7890 188": "Wrong IBAN FR76 3000 6000 0112 3456 7890 188",
+		"Card 4111 1111 1111 1111 expired":             "Card [CREDIT_CARD] expired",
+		"Order 4111 1111 1111 1112 shipped":            "Order 4111 1111 1111 1112 shipped",
+		"SSN 123-45-6789, not 666-45-6789":             "SSN [US_SSN], not 666-45-6789",
+		"NIR 1 84 12 76 451 089 46":                    "NIR [FR_NIR]",
+		"Call +33 6 12 34 56 78 or 0612345678":         "Call [PHONE] or [PHONE]",
+		"Released 2024-01-15, version 1.2.3":           "Released 2024-01-15, version 1.2.3",
+	}
+	for text, want := range cases {
+		doc := domain.NewDocument("notes.txt", text)
+		redactor.Redact(doc)
+		assert.Equal(t, want, doc.Content, text)
+	}
+}
+
+func TestRedactDocumentsAudit(t *testing.T) {
+	settings, err := NewRedactionSettings(domain.RedactHash, []string{"email"}, []string{"employee-id=EMP-\\d{6}"})
+	require.NoError(t, err)
+
+	rag := domain.NewRagSystem("hr", "model")
+	rag.Redaction = settings
+
+	doc := domain.NewDocument("hr/review.txt", "Reviewer: bob@corp.example\nEmployee EMP-123456 wrote to bob@corp.example")
+	other := domain.NewDocument("hr/policy.txt", "No personal data here.")
+	docs, err := redactDocuments(rag, []*domain.Document{doc, other})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	assert.NotContains(t, doc.Content, "bob@corp.example")
+	assert.NotContains(t, doc.Content, "EMP-123456")
+	// The same value gets the same hash
+	first := strings.Index(doc.Content, "[EMAIL:")
+	last := strings.LastIndex(doc.Content, "[EMAIL:")
+	assert.Equal(t, doc.Content[first:first+18], doc.Content[last:last+18])
+
+	require.Len(t, rag.RedactionAudit, 2)
+	assert.Equal(t, "email", rag.RedactionAudit[0].Detector)
+	assert.Equal(t, 2, rag.RedactionAudit[0].Count)
+	assert.Equal(t, []int{1, 2}, rag.RedactionAudit[0].Lines)
+	assert.Equal(t, "employee-id", rag.RedactionAudit[1].Detector)
+
+	// Drop mode keeps documents with personal data out of the RAG
+	rag.Redaction = &domain.RedactionSettings{Mode: domain.RedactDrop}
+	docs, err = redactDocuments(rag, []*domain.Document{
+		domain.NewDocument("a.txt", "Mail alice@example.org"),
+		domain.NewDocument("b.txt", "Nothing to hide in this file."),
+	})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "b.txt", docs[0].Path)
+
+	// A watcher presenting the dropped document again doesn't audit it twice,
+	// unless it changed
+	audited := len(rag.RedactionAudit)
+	docs, err = redactDocuments(rag, []*domain.Document{domain.NewDocument("a.txt", "Mail alice@example.org")})
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+	assert.Len(t, rag.RedactionAudit, audited)
+	docs, err = redactDocuments(rag, []*domain.Document{domain.NewDocument("a.txt", "Nothing left to hide.")})
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Empty(t, rag.DroppedDocuments)
+
+	_, err = NewRedactionSettings("blur", nil, nil)
+	assert.Error(t, err)
+	_, err = NewRedactionSettings(domain.RedactMask, []string{"passport"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dontizi/rlama/internal/client"
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/dontizi/rlama/internal/repository"
+	"github.com/dontizi/rlama/pkg/vector"
+)
+
+// reembedCheckpointInterval is the number of chunks embedded between two checkpoints
+var reembedCheckpointInterval = 1024
+
+// reembedCheckpoint records the progress of a re-embedding, saved next to the
+// vectors embedded so far
+type reembedCheckpoint struct {
+	EmbeddingModel   string                   `json:"embedding_model"`
+	EmbeddingProfile string                   `json:"embedding_profile,omitempty"`
+	Prefixes         domain.EmbeddingPrefixes `json:"prefixes"`
+	Dimensions       int                      `json:"dimensions"`
+	Embedded         int                      `json:"embedded"`
+	Complete         bool                     `json:"complete"` // All chunks are embedded; only the swap remains
+	StartedAt        time.Time                `json:"started_at"`
+	UpdatedAt        time.Time                `json:"updated_at"`
+}
+
+// ReembedService moves the chunks of a RAG to another embedding model. The new
+// vectors are written next to the current ones, which the RAG keeps using
+// until all chunks are embedded.
+type ReembedService struct {
+	embeddingService *EmbeddingService
+	ragRepository    *repository.RagRepository
+}
+
+// NewReembedService creates a new instance of ReembedService
+func NewReembedService(ollamaClient *client.OllamaClient) *ReembedService {
+	return &ReembedService{
+		embeddingService: NewEmbeddingService(ollamaClient),
+		ragRepository:    repository.NewRagRepository(),
+	}
+}
+
+// Reembed embeds the stored chunks of a RAG with another model, an empty
+// profile meaning Ollama and nil prefixes those the model is known to expect.
+// Progress is checkpointed: an interrupted run with the same model resumes
+// where it stopped. The new vectors replace the old ones, and the RAG records
+// the new model, only once every chunk is embedded.
+func (rs *ReembedService) Reembed(ragName, embeddingModel, embeddingProfile string, prefixes *domain.EmbeddingPrefixes) error {
+	vectorPath, checkpointPath := rs.ragRepository.ReembedPaths(ragName)
+	checkpoint, err := loadReembedCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+	resolved := embeddingPrefixesOrDefault(prefixes, embeddingModel)
+	if checkpoint != nil && (checkpoint.EmbeddingModel != embeddingModel || checkpoint.EmbeddingProfile != embeddingProfile ||
+		checkpoint.Prefixes != resolved) {
+		fmt.Printf("Discarding the unfinished re-embedding of RAG '%s' with %s.\n", ragName, checkpoint.EmbeddingModel)
+		if err := removeReembedFiles(vectorPath, checkpointPath); err != nil {
+			return err
+		}
+		checkpoint = nil
+	}
+
+	rag, err := rs.ragRepository.Load(ragName)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil && checkpoint.Complete {
+		if _, err := os.Stat(vectorPath); os.IsNotExist(err) {
+			// Interrupted after the new vectors replaced the old ones
+			return rs.swap(rag, checkpoint, vectorPath, checkpointPath)
+		}
+	}
+
+	profileService, err := rs.embeddingService.ForProfile(embeddingProfile)
+	if err != nil {
+		return err
+	}
+	embeddingService := profileService.WithPrefixes(resolved)
+	printEmbeddingPrefixes(resolved, embeddingModel)
+	dimensions, err := embeddingService.CheckEmbeddingModel(embeddingModel)
+	if err != nil {
+		return err
+	}
+
+	store := vector.NewHNSWStore(dimensions)
+	if checkpoint != nil && checkpoint.Dimensions == dimensions {
+		if err := store.Load(vectorPath); err != nil {
+			return err
+		}
+		fmt.Printf("Resuming the re-embedding of RAG '%s' with %s: %d chunks already embedded.\n", ragName, embeddingModel, store.Len())
+	} else {
+		checkpoint = &reembedCheckpoint{
+			EmbeddingModel:   embeddingModel,
+			EmbeddingProfile: embeddingProfile,
+			Prefixes:         resolved,
+			Dimensions:       dimensions,
+			StartedAt:        time.Now(),
+		}
+	}
+
+	// Documents added meanwhile are embedded too: the RAG is read again
+	// until none of its chunks is missing
+	for {
+		var pending []*domain.DocumentChunk
+		for _, chunk := range rag.Chunks {
+			if _, ok := store.Get(chunk.ID); !ok {
+				// A copy, so that the loaded chunks keep their embeddings
+				copied := *chunk
+				copied.Embedding = nil
+				pending = append(pending, &copied)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		fmt.Printf("Re-embedding %d chunks of RAG '%s' with %s...\n", len(pending), ragName, embeddingModel)
+		for start := 0; start < len(pending); start += reembedCheckpointInterval {
+			end := start + reembedCheckpointInterval
+			if end > len(pending) {
+				end = len(pending)
+			}
+			batch := pending[start:end]
+			failed, err := embeddingService.GenerateChunkEmbeddings(batch, embeddingModel)
+			if err != nil {
+				return fmt.Errorf("error re-embedding RAG '%s' (%d chunks done, run the command again to resume): %w",
+					ragName, store.Len(), err)
+			}
+			for _, chunk := range batch {
+				if chunk.Embedding != nil {
+					store.Add(chunk.ID, chunk.Embedding)
+				}
+			}
+
+			checkpoint.Embedded = store.Len()
+			if err := saveReembedProgress(store, checkpoint, vectorPath, checkpointPath); err != nil {
+				return err
+			}
+			if len(failed) > 0 {
+				// The RAG only switches once every chunk has an embedding
+				return fmt.Errorf("error re-embedding RAG '%s': %d chunks failed (%d chunks done, run the command again to resume)",
+					ragName, len(failed), store.Len())
+			}
+			fmt.Printf("Checkpoint: %d/%d chunks re-embedded\n", checkpoint.Embedded, len(rag.Chunks))
+		}
+
+		if rag, err = rs.ragRepository.Load(ragName); err != nil {
+			return err
+		}
+	}
+
+	// Only the vectors of the current chunks are kept
+	final := vector.NewHNSWStore(dimensions)
+	for _, chunk := range rag.Chunks {
+		embedding, _ := store.Get(chunk.ID)
+		final.Add(chunk.ID, embedding)
+	}
+	checkpoint.Embedded = final.Len()
+	checkpoint.Complete = true
+	if err := saveReembedProgress(final, checkpoint, vectorPath, checkpointPath); err != nil {
+		return err
+	}
+	return rs.swap(rag, checkpoint, vectorPath, checkpointPath)
+}
+
+// swap makes the complete new vectors those of the RAG and records the model
+func (rs *ReembedService) swap(rag *domain.RagSystem, checkpoint *reembedCheckpoint, vectorPath, checkpointPath string) error {
+	previous := rag.EmbeddingModel
+	rag.EmbeddingModel = checkpoint.EmbeddingModel
+	rag.EmbeddingProfile = checkpoint.EmbeddingProfile
+	rag.EmbeddingSize = checkpoint.Dimensions
+	rag.EmbeddingPrefixes = &checkpoint.Prefixes
+	rag.PendingChunks = nil // All the chunks have their new embedding
+	rag.UpdatedAt = time.Now()
+	if err := rs.ragRepository.ReplaceVectors(rag, vectorPath); err != nil {
+		return err
+	}
+	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing re-embedding checkpoint: %w", err)
+	}
+
+	if previous == "" {
+		previous = "an unknown model"
+	}
+	fmt.Printf("RAG '%s' now uses %s (%d dimensions) instead of %s for its %d chunks.\n",
+		rag.Name, checkpoint.EmbeddingModel, checkpoint.Dimensions, previous, checkpoint.Embedded)
+	return nil
+}
+
+// loadReembedCheckpoint reads the checkpoint of an unfinished re-embedding, nil if there is none
+func loadReembedCheckpoint(path string) (*reembedCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading re-embedding checkpoint: %w", err)
+	}
+
+	var checkpoint reembedCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("error reading re-embedding checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// saveReembedProgress writes the vectors embedded so far, then the checkpoint
+// describing them. Both are written aside and renamed, so that an interruption
+// leaves the previous checkpoint intact.
+func saveReembedProgress(store *vector.HNSWStore, checkpoint *reembedCheckpoint, vectorPath, checkpointPath string) error {
+	if err := store.Save(vectorPath + ".tmp"); err != nil {
+		return fmt.Errorf("error saving re-embedded vectors: %w", err)
+	}
+	if err := os.Rename(vectorPath+".tmp", vectorPath); err != nil {
+		return fmt.Errorf("error saving re-embedded vectors: %w", err)
+	}
+
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(checkpointPath+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("error saving re-embedding checkpoint: %w", err)
+	}
+	if err := os.Rename(checkpointPath+".tmp", checkpointPath); err != nil {
+		return fmt.Errorf("error saving re-embedding checkpoint: %w", err)
+	}
+	return nil
+}
+
+// removeReembedFiles deletes the files of an unfinished re-embedding
+func removeReembedFiles(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/config"
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/dontizi/rlama/internal/repository"
+	"github.com/dontizi/rlama/pkg/vector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saveReembedTestRag saves a RAG of chunks embedded by llama3 with 8 dimensions
+func saveReembedTestRag(t *testing.T, chunks int) *repository.RagRepository {
+	rag := domain.NewRagSystem("reembed-test", "llama3")
+	rag.EmbeddingModel = "llama3"
+	for i := 0; i < chunks; i++ {
+		rag.AddChunk(&domain.DocumentChunk{
+			ID:        fmt.Sprintf("chunk_%d", i),
+			Content:   fmt.Sprintf("text %d", i),
+			Embedding: make([]float32, 8),
+		})
+	}
+	ragRepository := repository.NewRagRepository()
+	require.NoError(t, ragRepository.Save(rag))
+	return ragRepository
+}
+
+func TestReembedSwapsTheVectors(t *testing.T) {
+	embeddingService, _ := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4, "llama3": 8})
+	ragRepository := saveReembedTestRag(t, 5)
+	reembedService := &ReembedService{embeddingService: embeddingService, ragRepository: ragRepository}
+
+	require.NoError(t, reembedService.Reembed("reembed-test", "bge-m3", "", nil))
+
+	rag, err := ragRepository.Load("reembed-test")
+	require.NoError(t, err)
+	assert.Equal(t, "bge-m3", rag.EmbeddingModel)
+	assert.Equal(t, 4, rag.EmbeddingDimensions())
+	vectors := vector.NewHNSWStore(4)
+	require.NoError(t, vectors.Load(filepath.Join(config.GetDataDir(), "reembed-test", "vectors.json")))
+	assert.Equal(t, 5, vectors.Len())
+	for _, chunk := range rag.Chunks {
+		embedding, ok := vectors.Get(chunk.ID)
+		require.True(t, ok)
+		assert.Len(t, embedding, 4)
+	}
+
+	vectorPath, checkpointPath := ragRepository.ReembedPaths("reembed-test")
+	assert.NoFileExists(t, vectorPath)
+	assert.NoFileExists(t, checkpointPath)
+}
+
+func TestReembedResumesAfterAFailure(t *testing.T) {
+	embeddingService, fake := newFakeEmbeddingService(t, map[string]int{"bge-m3": 4, "llama3": 8})
+	ragRepository := saveReembedTestRag(t, 5)
+	reembedService := &ReembedService{embeddingService: embeddingService, ragRepository: ragRepository}
+
+	previous := reembedCheckpointInterval
+	reembedCheckpointInterval = 2
+	t.Cleanup(func() { reembedCheckpointInterval = previous })
+
+	// The second checkpoint batch fails: the RAG keeps its old vectors
+	fake.failOn = "text 3"
+	err := reembedService.Reembed("reembed-test", "bge-m3", "", nil)
+	require.ErrorContains(t, err, "2 chunks done")
+
+	rag, err := ragRepository.Load("reembed-test")
+	require.NoError(t, err)
+	assert.Equal(t, "llama3", rag.EmbeddingModel)
+	assert.Equal(t, 8, rag.EmbeddingDimensions())
+
+	vectorPath, checkpointPath := ragRepository.ReembedPaths("reembed-test")
+	checkpoint, err := loadReembedCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, 2, checkpoint.Embedded)
+	assert.FileExists(t, vectorPath)
+
+	// Running again resumes and swaps
+	fake.failOn = ""
+	require.NoError(t, reembedService.Reembed("reembed-test", "bge-m3", "", nil))
+	rag, err = ragRepository.Load("reembed-test")
+	require.NoError(t, err)
+	assert.Equal(t, "bge-m3", rag.EmbeddingModel)
+	assert.Equal(t, 4, rag.EmbeddingDimensions())
+	_, err = os.Stat(checkpointPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/dontizi/rlama/pkg/vector"
+)
+
+// DefaultRetrievalK is the number of chunks retrieved per question when
+// measuring the recall of a chunking configuration
+const DefaultRetrievalK = 5
+
+// RetrievalQuestion is a question of an evaluation set with the passage of the
+// documents answering it
+type RetrievalQuestion struct {
+	Question string `json:"question"`
+	Expected string `json:"expected"`           // Passage answering the question, as written in the document
+	Document string `json:"document,omitempty"` // Name or path of the document holding the passage (any document when empty)
+}
+
+// RetrievalEvaluation checks that the chunks answering a set of questions are retrieved
+type RetrievalEvaluation struct {
+	Questions []RetrievalQuestion
+	Embedder  TextEmbedder             // Embeds the questions and the chunks
+	Prefixes  domain.EmbeddingPrefixes // Prepended to the questions and the chunks, as for the RAG
+	K         int                      // Chunks retrieved per question (0 = DefaultRetrievalK)
+}
+
+// RetrievalMetrics contains the retrieval quality of a chunking configuration
+type RetrievalMetrics struct {
+	Strategy     string
+	ChunkSize    int
+	ChunkOverlap int
+	TotalChunks  int
+
+	Questions int     // Questions whose passage was found in the documents
+	Unlocated int     // Questions whose passage is in none of the documents, not scored
+	K         int     // Chunks retrieved per question
+	RecallAtK float64 // Share of the questions with a chunk holding their passage in the top K
+	MRR       float64 // Mean reciprocal rank of the first chunk holding the passage
+
+	SemanticCoherenceScore float64 // Structural score, breaks ties between configurations
+	ProcessingTimeMs       int64
+}
+
+// LoadRetrievalQuestions reads a question set: a JSON array or JSON lines of
+// {"question": ..., "expected": ..., "document": ...} objects
+func LoadRetrievalQuestions(path string) ([]RetrievalQuestion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading question set: %w", err)
+	}
+
+	var questions []RetrievalQuestion
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &questions); err != nil {
+			return nil, fmt.Errorf("error parsing question set %s: %w", path, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var question RetrievalQuestion
+			if err := json.Unmarshal([]byte(text), &question); err != nil {
+				return nil, fmt.Errorf("error parsing question set %s, line %d: %w", path, line, err)
+			}
+			questions = append(questions, question)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading question set: %w", err)
+		}
+	}
+
+	for i, question := range questions {
+		if strings.TrimSpace(question.Question) == "" || strings.TrimSpace(question.Expected) == "" {
+			return nil, fmt.Errorf("question %d of %s needs a question and an expected passage", i+1, path)
+		}
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("question set %s is empty", path)
+	}
+	return questions, nil
+}
+
+// retrievalEvaluation returns the question set the "auto" strategy ranks
+// configurations with, nil if the strategy or the options need none
+func retrievalEvaluation(embeddingService *EmbeddingService, strategy, embeddingModel string, questions []RetrievalQuestion) *RetrievalEvaluation {
+	if strategy != "auto" || len(questions) == 0 {
+		return nil
+	}
+	return &RetrievalEvaluation{
+		Questions: questions,
+		Embedder:  NewModelEmbedder(embeddingService, embeddingModel),
+		Prefixes:  embeddingService.prefixes,
+	}
+}
+
+// passageLocation is a question with the spans of the documents answering it
+type passageLocation struct {
+	question int
+	spans    []passageSpan
+}
+
+// passageSpan is an occurrence of a passage in a document
+type passageSpan struct {
+	doc   int
+	start int
+	end   int
+}
+
+// locatePassages finds every occurrence of the passage of each question in the
+// documents, ignoring case and whitespace differences, and returns the
+// questions it can't find
+func locatePassages(docs []*domain.Document, questions []RetrievalQuestion) ([]passageLocation, []int) {
+	normalized := make([]string, len(docs))
+	offsets := make([][][2]int, len(docs))
+	for i, doc := range docs {
+		normalized[i], offsets[i] = normalizePassageText(doc.Content)
+	}
+
+	var located []passageLocation
+	var unlocated []int
+	for q, question := range questions {
+		passage, _ := normalizePassageText(question.Expected)
+		location := passageLocation{question: q}
+		for d, doc := range docs {
+			if passage == "" || (question.Document != "" && question.Document != doc.Name && question.Document != doc.Path &&
+				filepath.Base(question.Document) != doc.Name) {
+				continue
+			}
+			for from := 0; ; {
+				i := strings.Index(normalized[d][from:], passage)
+				if i < 0 {
+					break
+				}
+				i += from
+				location.spans = append(location.spans, passageSpan{doc: d, start: offsets[d][i][0], end: offsets[d][i+len(passage)-1][1]})
+				from = i + len(passage)
+			}
+		}
+		if len(location.spans) > 0 {
+			located = append(located, location)
+		} else {
+			unlocated = append(unlocated, q)
+		}
+	}
+	return located, unlocated
+}
+
+// normalizePassageText lowercases text and collapses its whitespace, returning
+// for each byte of the result the span of the original text it comes from
+func normalizePassageText(text string) (string, [][2]int) {
+	var b strings.Builder
+	var offsets [][2]int
+	space := false
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			offsets = append(offsets, [2]int{i, i})
+			space = false
+		}
+		lower := string(unicode.ToLower(r))
+		for j := 0; j < len(lower); j++ {
+			offsets = append(offsets, [2]int{i, i + utf8.RuneLen(r)})
+		}
+		b.WriteString(lower)
+	}
+	return b.String(), offsets
+}
+
+// holdsPassage reports whether a chunk holds an occurrence of the passage: it
+// covers at least half of the occurrence, or at least half of the chunk is the passage
+func holdsPassage(chunk *domain.DocumentChunk, doc int, passage passageLocation) bool {
+	for _, span := range passage.spans {
+		if span.doc != doc {
+			continue
+		}
+		overlap := min(chunk.EndPos, span.end) - max(chunk.StartPos, span.start)
+		if overlap > 0 && 2*overlap >= min(span.end-span.start, chunk.EndPos-chunk.StartPos) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateRetrieval chunks the documents with a configuration, embeds the
+// chunks into a throwaway vector store and measures how well the passages
+// answering the questions are retrieved
+func (ce *ChunkingEvaluator) EvaluateRetrieval(docs []*domain.Document, config ChunkingConfig, evaluation *RetrievalEvaluation) (RetrievalMetrics, error) {
+	located, unlocated := locatePassages(docs, evaluation.Questions)
+	return ce.evaluateRetrieval(docs, config, evaluation, located, len(unlocated))
+}
+
+// evaluateRetrieval measures the retrieval of the located passages
+func (ce *ChunkingEvaluator) evaluateRetrieval(docs []*domain.Document, config ChunkingConfig, evaluation *RetrievalEvaluation, located []passageLocation, unlocated int) (RetrievalMetrics, error) {
+	startTime := time.Now()
+	k := evaluation.K
+	if k <= 0 {
+		k = DefaultRetrievalK
+	}
+	metrics := RetrievalMetrics{
+		Strategy:     config.ChunkingStrategy,
+		Questions:    len(located),
+		Unlocated:    unlocated,
+		K:            k,
+	}
+	metrics.ChunkSize, metrics.ChunkOverlap = config.sizes()
+
+	// Chunk every document, remembering where each chunk comes from
+	chunker := NewChunkerService(config)
+	var chunks []*domain.DocumentChunk
+	var chunkDocs []int
+	var texts []string
+	coherence := 0.0
+	for d, doc := range docs {
+		docChunks := chunker.ChunkDocument(doc)
+		for _, chunk := range docChunks {
+			chunks = append(chunks, chunk)
+			chunkDocs = append(chunkDocs, d)
+			texts = append(texts, evaluation.Prefixes.Passage+chunk.IndexedContent())
+		}
+		coherence += ce.EvaluateChunkingStrategy(doc, config).SemanticCoherenceScore
+	}
+	metrics.TotalChunks = len(chunks)
+	if len(docs) > 0 {
+		metrics.SemanticCoherenceScore = coherence / float64(len(docs))
+	}
+	if len(chunks) == 0 || len(located) == 0 {
+		metrics.ProcessingTimeMs = time.Since(startTime).Milliseconds()
+		return metrics, nil
+	}
+
+	embeddings, err := evaluation.Embedder.EmbedTexts(texts)
+	if err != nil {
+		return metrics, fmt.Errorf("error embedding chunks: %w", err)
+	}
+	store := vector.NewStore()
+	for i, embedding := range embeddings {
+		store.Add(strconv.Itoa(i), embedding)
+	}
+
+	questions := make([]string, len(located))
+	for i, passage := range located {
+		questions[i] = evaluation.Prefixes.Query + evaluation.Questions[passage.question].Question
+	}
+	questionEmbeddings, err := evaluation.Embedder.EmbedTexts(questions)
+	if err != nil {
+		return metrics, fmt.Errorf("error embedding questions: %w", err)
+	}
+
+	// Rank all the chunks for each question and find the first one holding its passage
+	hits, reciprocalRanks := 0, 0.0
+	for i, passage := range located {
+		for rank, result := range store.Search(questionEmbeddings[i], 0) {
+			index, _ := strconv.Atoi(result.ID)
+			if !holdsPassage(chunks[index], chunkDocs[index], passage) {
+				continue
+			}
+			if rank < k {
+				hits++
+			}
+			reciprocalRanks += 1 / float64(rank+1)
+			break
+		}
+	}
+	metrics.RecallAtK = float64(hits) / float64(len(located))
+	metrics.MRR = reciprocalRanks / float64(len(located))
+	metrics.ProcessingTimeMs = time.Since(startTime).Milliseconds()
+	return metrics, nil
+}
+
+// CompareRetrieval evaluates the retrieval of each chunking strategy and size
+// on the documents and returns the results from best to worst: by MRR, then
+// recall, then structural coherence. It returns no results when none of the
+// passages is in the documents.
+func (ce *ChunkingEvaluator) CompareRetrieval(docs []*domain.Document, evaluation *RetrievalEvaluation) ([]RetrievalMetrics, error) {
+	located, unlocated := locatePassages(docs, evaluation.Questions)
+	if len(located) == 0 {
+		return nil, nil
+	}
+
+	// Chunks shared by several configurations and the questions are embedded once
+	memoized := *evaluation
+	memoized.Embedder = newMemoEmbedder(evaluation.Embedder)
+
+	strategies := []string{"fixed", "semantic", "hybrid", "hierarchical"}
+	embedder := newMemoEmbedder(ce.chunkerService.config.Embedder)
+	if embedder != nil {
+		strategies = append(strategies, "embedding")
+	}
+	chunkSizes := ce.candidateSizes()
+
+	fmt.Printf("Evaluating the retrieval of %d questions with %d chunking configurations...\n",
+		len(located), len(strategies)*len(chunkSizes))
+
+	var results []RetrievalMetrics
+	for _, strategy := range strategies {
+		for _, chunkSize := range chunkSizes {
+			config := ce.candidateConfig(strategy, chunkSize, chunkSize/10, embedder)
+			metrics, err := ce.evaluateRetrieval(docs, config, &memoized, located, len(unlocated))
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, metrics)
+
+			fmt.Printf("  Strategy: %-12s | Size: %4d | Recall@%d: %.3f | MRR: %.3f | Chunks: %3d\n",
+				strategy, chunkSize, metrics.K, metrics.RecallAtK, metrics.MRR, metrics.TotalChunks)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].MRR != results[j].MRR {
+			return results[i].MRR > results[j].MRR
+		}
+		if results[i].RecallAtK != results[j].RecallAtK {
+			return results[i].RecallAtK > results[j].RecallAtK
+		}
+		return results[i].SemanticCoherenceScore > results[j].SemanticCoherenceScore
+	})
+	return results, nil
+}
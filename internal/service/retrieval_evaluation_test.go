@@ -0,0 +1,146 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retrievalDocuments() []*domain.Document {
+	paragraph := func(sentence string) string {
+		return strings.TrimSpace(strings.Repeat(sentence+" ", 8))
+	}
+	pets := domain.NewDocument("/docs/pets.txt", paragraph("The cat sleeps on the warm windowsill all afternoon.")+"\n\n"+
+		paragraph("The dog guards the garden gate against the mailman."))
+	kitchen := domain.NewDocument("/docs/kitchen.txt", paragraph("The bread dough rises slowly overnight in the kitchen.")+"\n\n"+
+		paragraph("The rocket shaped cake needs an oven at high heat."))
+	return []*domain.Document{pets, kitchen}
+}
+
+func TestLoadRetrievalQuestions(t *testing.T) {
+	dir := t.TempDir()
+
+	array := filepath.Join(dir, "qa.json")
+	require.NoError(t, os.WriteFile(array, []byte(`[{"question": "Where does the cat sleep?", "expected": "on the warm windowsill"}]`), 0644))
+	questions, err := LoadRetrievalQuestions(array)
+	require.NoError(t, err)
+	assert.Equal(t, []RetrievalQuestion{{Question: "Where does the cat sleep?", Expected: "on the warm windowsill"}}, questions)
+
+	lines := filepath.Join(dir, "qa.jsonl")
+	require.NoError(t, os.WriteFile(lines, []byte("{\"question\": \"a?\", \"expected\": \"b\", \"document\": \"pets.txt\"}\n\n{\"question\": \"c?\", \"expected\": \"d\"}\n"), 0644))
+	questions, err = LoadRetrievalQuestions(lines)
+	require.NoError(t, err)
+	require.Len(t, questions, 2)
+	assert.Equal(t, "pets.txt", questions[0].Document)
+
+	missing := filepath.Join(dir, "missing.jsonl")
+	require.NoError(t, os.WriteFile(missing, []byte(`{"question": "a?"}`), 0644))
+	_, err = LoadRetrievalQuestions(missing)
+	assert.Error(t, err)
+}
+
+func TestLocatePassagesIgnoresCaseAndWhitespace(t *testing.T) {
+	docs := retrievalDocuments()
+	located, unlocated := locatePassages(docs, []RetrievalQuestion{
+		{Question: "Where?", Expected: "THE CAT sleeps  on the\nwarm windowsill"},
+		{Question: "Which document?", Expected: "The bread dough", Document: "pets.txt"},
+		{Question: "Which oven?", Expected: "an oven at high heat", Document: "kitchen.txt"},
+	})
+
+	require.Len(t, located, 2)
+	require.Len(t, located[0].spans, 8, "every occurrence of the passage is located")
+	span := located[0].spans[0]
+	assert.Equal(t, "The cat sleeps on the warm windowsill", docs[0].Content[span.start:span.end])
+	span = located[1].spans[0]
+	assert.Equal(t, 1, span.doc)
+	assert.Equal(t, "an oven at high heat", docs[1].Content[span.start:span.end])
+	assert.Equal(t, []int{1}, unlocated)
+}
+
+func TestEvaluateRetrievalScoresRankOfPassage(t *testing.T) {
+	docs := retrievalDocuments()
+	embedder := &topicEmbedder{topics: []string{"cat", "dog", "bread", "rocket"}}
+	evaluation := &RetrievalEvaluation{
+		Questions: []RetrievalQuestion{
+			{Question: "What does the dog guard?", Expected: "The dog guards the garden gate"},
+			{Question: "When does the bread rise?", Expected: "The bread dough rises slowly overnight"},
+			{Question: "Where does the penguin live?", Expected: "on the ice floe"},
+		},
+		Embedder: embedder,
+		K:        1,
+	}
+	evaluator := NewChunkingEvaluator(NewChunkerService(DefaultChunkingConfig()))
+
+	metrics, err := evaluator.EvaluateRetrieval(docs, ChunkingConfig{ChunkSize: 500, ChunkOverlap: 0, ChunkingStrategy: "fixed"}, evaluation)
+	require.NoError(t, err)
+	assert.Equal(t, 2, metrics.Questions)
+	assert.Equal(t, 1, metrics.Unlocated)
+	assert.Equal(t, 1.0, metrics.RecallAtK)
+	assert.Equal(t, 1.0, metrics.MRR)
+
+	// Evaluation errors are reported
+	evaluation.Embedder = failingEmbedder{}
+	_, err = evaluator.EvaluateRetrieval(docs, ChunkingConfig{ChunkSize: 500, ChunkingStrategy: "fixed"}, evaluation)
+	assert.Error(t, err)
+}
+
+func TestAutoStrategyUsesRetrievalEvaluation(t *testing.T) {
+	docs := retrievalDocuments()
+	embedder := &topicEmbedder{topics: []string{"cat", "dog", "bread", "rocket"}}
+	config := DefaultChunkingConfig()
+	config.Retrieval = &RetrievalEvaluation{
+		Questions: []RetrievalQuestion{{Question: "Where does the cat sleep?", Expected: "the cat sleeps on the warm windowsill"}},
+		Embedder:  embedder,
+	}
+	evaluator := NewChunkingEvaluator(NewChunkerService(config))
+
+	results, err := evaluator.CompareRetrieval(docs[:1], config.Retrieval)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	for i := 1; i < len(results); i++ {
+		assert.GreaterOrEqual(t, results[i-1].MRR, results[i].MRR)
+	}
+
+	best := evaluator.GetOptimalChunkingConfig(docs[0])
+	assert.Equal(t, results[0].Strategy, best.ChunkingStrategy)
+	assert.Equal(t, results[0].ChunkSize, best.ChunkSize)
+	assert.Greater(t, embedder.calls, 0)
+
+	// Documents without any of the passages fall back to the structural metrics
+	embedder.calls = 0
+	evaluator.GetOptimalChunkingConfig(docs[1])
+	assert.Equal(t, 0, embedder.calls)
+}
+
+func TestAutoStrategyComparesTokenSizes(t *testing.T) {
+	docs := retrievalDocuments()
+	config := DefaultChunkingConfig()
+	config.ChunkTokens, config.OverlapTokens = 200, 20
+	config.Retrieval = &RetrievalEvaluation{
+		Questions: []RetrievalQuestion{{Question: "Where does the cat sleep?", Expected: "the cat sleeps on the warm windowsill"}},
+		Embedder:  &topicEmbedder{topics: []string{"cat", "dog", "bread", "rocket"}},
+	}
+	evaluator := NewChunkingEvaluator(NewChunkerService(config))
+
+	results, err := evaluator.CompareRetrieval(docs[:1], config.Retrieval)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	for _, result := range results {
+		assert.Contains(t, []int{128, 256, 384, 512}, result.ChunkSize)
+	}
+
+	// The configuration chosen by retrieval or by structure is applied in tokens
+	best := evaluator.GetOptimalChunkingConfig(docs[0])
+	assert.Equal(t, results[0].ChunkSize, best.ChunkTokens)
+	assert.Equal(t, results[0].ChunkOverlap, best.OverlapTokens)
+	assert.Zero(t, best.ChunkSize)
+
+	structural := evaluator.GetOptimalChunkingConfig(docs[1])
+	assert.Contains(t, []int{128, 256, 384, 512}, structural.ChunkTokens)
+	assert.Zero(t, structural.ChunkSize)
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// StdinSource is the source that reads a single document from DocumentLoaderOptions.Stdin
+const StdinSource = "-"
+
+// contentTypeExtensions gives the extension used to extract a document read
+// from standard input when its name has none
+var contentTypeExtensions = map[string]string{
+	"text/plain":       ".txt",
+	"text/markdown":    ".md",
+	"text/html":        ".html",
+	"text/csv":         ".csv",
+	"application/json": ".json",
+	"application/pdf":  ".pdf",
+	"application/rtf":  ".rtf",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.oasis.opendocument.text":                                   ".odt",
+}
+
+// LoadDocumentsFromSources loads documents from any mix of files, folders and
+// glob patterns, and prints a summary of the files that could not be loaded
+func (dl *DocumentLoader) LoadDocumentsFromSources(sources []string, options DocumentLoaderOptions) ([]*domain.Document, error) {
+	documents, report, err := dl.LoadDocumentsFromSourcesWithReport(sources, options)
+	if report != nil {
+		report.PrintFailures()
+	}
+	return documents, err
+}
+
+// LoadDocumentsFromSourcesWithReport loads documents from any mix of files,
+// folders and glob patterns ("**" matches any number of directories). The
+// StdinSource reads one document from options.Stdin, named options.StdinName.
+// Files are filtered by the same rules as in folders; a file named explicitly
+// is only subject to the extension and pattern rules.
+func (dl *DocumentLoader) LoadDocumentsFromSourcesWithReport(sources []string, options DocumentLoaderOptions) ([]*domain.Document, *LoadReport, error) {
+	if len(sources) == 0 {
+		return nil, nil, errors.New("no documents to load")
+	}
+	normalizeExtensions(&options)
+
+	report := &LoadReport{}
+	archives := newArchiveExpander(options)
+	defer archives.cleanup()
+
+	collected, err := dl.collectSources(sources, options, report, archives)
+	if collected != nil {
+		defer collected.cleanup()
+	}
+	if err != nil {
+		return nil, report, err
+	}
+
+	if len(collected.files) == 0 {
+		return nil, report, fmt.Errorf("no supported files found in %s. %d unsupported, %d excluded",
+			strings.Join(sources, ", "), len(report.Unsupported), len(report.Excluded))
+	}
+
+	fmt.Printf("Found %d supported files, %d unsupported files, and %d excluded files.\n",
+		len(collected.files), len(report.Unsupported), len(report.Excluded))
+
+	// Try to install dependencies if possible
+	dl.tryInstallDependencies(collected.files)
+
+	documents := dl.loadCollected(collected, options, report, archives)
+	for _, doc := range documents {
+		fmt.Printf("Document added: %s (%d characters)\n", doc.Name, len(doc.Content))
+	}
+	report.Loaded = len(documents)
+
+	if len(documents) == 0 {
+		return nil, report, fmt.Errorf("no documents with valid content found in %s", strings.Join(sources, ", "))
+	}
+	return documents, report, nil
+}
+
+// collectedSources are the files found in the sources of a load
+type collectedSources struct {
+	root      string   // Deepest folder containing every source; document names are relative to it
+	files     []string // Supported files, without duplicates
+	stdinPath string   // Temporary file holding standard input, if read
+	cleanup   func()
+}
+
+// collectSources resolves the sources into the files to load
+func (dl *DocumentLoader) collectSources(sources []string, options DocumentLoaderOptions, report *LoadReport, archives *archiveExpander) (*collectedSources, error) {
+	collected := &collectedSources{cleanup: func() {}}
+	var roots []string
+	seen := make(map[string]bool)
+	addFiles := func(paths []string) {
+		for _, path := range paths {
+			if !seen[path] {
+				seen[path] = true
+				collected.files = append(collected.files, path)
+			}
+		}
+	}
+
+	for _, source := range sources {
+		switch {
+		case source == StdinSource:
+			if collected.stdinPath != "" {
+				return collected, errors.New("standard input can only be read once")
+			}
+			path, cleanup, err := writeStdinDocument(options)
+			if err != nil {
+				return collected, err
+			}
+			collected.stdinPath, collected.cleanup = path, cleanup
+			addFiles([]string{path})
+
+		case hasGlobMeta(source):
+			root, matched, err := dl.globFiles(source, options, report, archives)
+			if err != nil {
+				return collected, err
+			}
+			if len(matched) == 0 {
+				fmt.Printf("No files match '%s'.\n", source)
+			}
+			roots = append(roots, root)
+			addFiles(matched)
+
+		default:
+			path, err := filepath.Abs(source)
+			if err != nil {
+				return collected, fmt.Errorf("unable to resolve absolute path: %w", err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return collected, fmt.Errorf("unable to access '%s': %w", source, err)
+			}
+			if info.IsDir() {
+				walked, err := dl.walkFolder(path, options, report, archives)
+				if err != nil {
+					return collected, fmt.Errorf("error while analyzing folder: %w", err)
+				}
+				roots = append(roots, path)
+				addFiles(walked)
+			} else {
+				roots = append(roots, filepath.Dir(path))
+				addFiles(dl.fileSource(path, options, report, archives))
+			}
+		}
+	}
+
+	collected.root = commonDir(roots)
+	return collected, nil
+}
+
+// loadCollected extracts and cleans the collected files and names the documents
+func (dl *DocumentLoader) loadCollected(collected *collectedSources, options DocumentLoaderOptions, report *LoadReport, archives *archiveExpander) []*domain.Document {
+	documents := dl.runLoadPipeline(collected.root, collected.files, options, report)
+	archives.rewrite(collected.root, documents, report)
+
+	if collected.stdinPath != "" {
+		for _, doc := range documents {
+			if doc.Path == collected.stdinPath {
+				nameStdinDocument(doc, options)
+			}
+		}
+		for i, failure := range report.Failures {
+			if failure.Path == collected.stdinPath {
+				report.Failures[i].Path = stdinName(options)
+			}
+		}
+	}
+	return documents
+}
+
+// fileSource returns the supported files of a file given explicitly: the file
+// itself, or the files of an archive
+func (dl *DocumentLoader) fileSource(path string, options DocumentLoaderOptions, report *LoadReport, archives *archiveExpander) []string {
+	matcher := NewIgnoreMatcher(options.IncludePatterns, options.ExcludePatterns, false)
+	name := filepath.Base(path)
+
+	if archives.canOpen(path, 0) {
+		dir, err := archives.extract(path)
+		if err != nil {
+			report.addFailure(path, LoadStageArchive, err)
+			return nil
+		}
+		files, err := dl.walkTree(dir, name, path+"!", 1, options, matcher, report, archives)
+		if err != nil {
+			report.addFailure(path, LoadStageWalk, err)
+		}
+		return files
+	}
+
+	switch dl.classifyFile(name, options, matcher) {
+	case fileSupported:
+		return []string{path}
+	case fileUnsupported:
+		report.Unsupported = append(report.Unsupported, path)
+	default:
+		report.Excluded = append(report.Excluded, path)
+	}
+	return nil
+}
+
+// globFiles returns the folder a glob pattern starts from and the supported
+// files it matches. Patterns without "**" follow the shell rules; with "**"
+// the folder is walked and paths are matched like gitignore patterns.
+func (dl *DocumentLoader) globFiles(pattern string, options DocumentLoaderOptions, report *LoadReport, archives *archiveExpander) (string, []string, error) {
+	pattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to resolve absolute path: %w", err)
+	}
+	root := globRoot(pattern)
+
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		var files []string
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				report.addFailure(match, LoadStageWalk, err)
+				continue
+			}
+			if info.IsDir() {
+				walked, err := dl.walkFolder(match, options, report, archives)
+				if err != nil {
+					return "", nil, fmt.Errorf("error while analyzing folder: %w", err)
+				}
+				files = append(files, walked...)
+				continue
+			}
+			files = append(files, dl.fileSource(match, options, report, archives)...)
+		}
+		return root, files, nil
+	}
+
+	rest, err := filepath.Rel(root, pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	re, err := regexp.Compile("^" + globToRegex(filepath.ToSlash(rest)) + "$")
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+
+	walked, err := dl.walkFolder(root, options, report, archives)
+	if err != nil {
+		return "", nil, fmt.Errorf("error while analyzing folder: %w", err)
+	}
+	var files []string
+	for _, path := range walked {
+		display := path
+		if archives != nil && archives.members[path] != "" {
+			display = archives.members[path]
+		}
+		if rel, err := filepath.Rel(root, display); err == nil && re.MatchString(filepath.ToSlash(rel)) {
+			files = append(files, path)
+		}
+	}
+	return root, files, nil
+}
+
+// hasGlobMeta reports whether a source is a glob pattern
+func hasGlobMeta(source string) bool {
+	return strings.ContainsAny(source, "*?[")
+}
+
+// globRoot returns the longest leading folder of a pattern without wildcards
+func globRoot(pattern string) string {
+	root := pattern
+	for hasGlobMeta(root) {
+		root = filepath.Dir(root)
+	}
+	return root
+}
+
+// commonDir returns the deepest folder containing all the given folders
+func commonDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return string(filepath.Separator)
+	}
+	common := dirs[0]
+	for _, dir := range dirs[1:] {
+		for common != dir && !strings.HasPrefix(dir, strings.TrimSuffix(common, string(filepath.Separator))+string(filepath.Separator)) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// stdinName returns the name of the document read from standard input
+func stdinName(options DocumentLoaderOptions) string {
+	if options.StdinName != "" {
+		return options.StdinName
+	}
+	return "stdin" + contentTypeExtension(options.StdinContentType)
+}
+
+// contentTypeExtension returns the extension matching a content type (".txt" if unknown)
+func contentTypeExtension(contentType string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	if ext, ok := contentTypeExtensions[strings.ToLower(mediaType)]; ok {
+		return ext
+	}
+	return ".txt"
+}
+
+// writeStdinDocument copies standard input to a temporary file whose extension
+// selects the extractor, and returns its path and a cleanup function
+func writeStdinDocument(options DocumentLoaderOptions) (string, func(), error) {
+	if options.Stdin == nil {
+		return "", nil, errors.New("no standard input to read the document from")
+	}
+
+	name := filepath.Base(stdinName(options))
+	if filepath.Ext(name) == "" {
+		name += contentTypeExtension(options.StdinContentType)
+	}
+
+	dir, err := os.MkdirTemp("", "rlama-stdin-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary folder: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error writing standard input: %w", err)
+	}
+	_, err = io.Copy(file, options.Stdin)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error reading standard input: %w", err)
+	}
+	return path, cleanup, nil
+}
+
+// nameStdinDocument replaces the temporary path of the document read from
+// standard input with its given name and content type. Unnamed documents are
+// named after a hash of their content, so that piping another one into the
+// same RAG doesn't collide with the first.
+func nameStdinDocument(doc *domain.Document, options DocumentLoaderOptions) {
+	name := options.StdinName
+	if name == "" {
+		sum := sha256.Sum256([]byte(doc.Content))
+		name = "stdin-" + hex.EncodeToString(sum[:])[:12] + contentTypeExtension(options.StdinContentType)
+	}
+	doc.Path = name
+	doc.Name = name
+	doc.ID = filepath.Base(name)
+	if options.StdinContentType != "" {
+		doc.ContentType = options.StdinContentType
+	}
+}
+
+// prepareDocuments fills in the fields of documents built in memory that the
+// loader sets on loaded ones. Each document needs content and at least one of
+// ID, Name or Path.
+func prepareDocuments(docs []*domain.Document) error {
+	for i, doc := range docs {
+		if doc == nil || strings.TrimSpace(doc.Content) == "" {
+			return fmt.Errorf("document %d has no content", i+1)
+		}
+		name := doc.Name
+		if name == "" {
+			name = doc.Path
+		}
+		if name == "" {
+			name = doc.ID
+		}
+		if name == "" {
+			return fmt.Errorf("document %d has no ID, name or path", i+1)
+		}
+
+		// Take the defaults from a document built the usual way
+		defaults := domain.NewDocument(name, doc.Content)
+		if doc.ID == "" {
+			doc.ID = defaults.ID
+		}
+		if doc.Name == "" {
+			doc.Name = name
+		}
+		if doc.Path == "" {
+			doc.Path = name
+		}
+		if doc.ContentType == "" || doc.ContentType == "application/octet-stream" {
+			doc.ContentType = defaults.ContentType
+			if doc.ContentType == "application/octet-stream" {
+				doc.ContentType = "text/plain"
+			}
+		}
+		if doc.CreatedAt.IsZero() {
+			doc.CreatedAt = defaults.CreatedAt
+		}
+		if doc.Metadata == nil {
+			doc.Metadata = domain.DocumentMetadata{}
+		}
+		if doc.Metadata.Language() == "" {
+			doc.Metadata.Set(domain.MetaLanguage, defaults.Metadata.Language())
+		}
+		doc.Size = int64(len(doc.Content))
+		doc.EnsureFingerprint()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadDocumentsFromSources mixes a single file, a folder, a recursive glob
+// and standard input
+func TestLoadDocumentsFromSources(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("README.md", "Readme of the project with some words.")
+	write("guides/setup.txt", "Setup guide explaining the installation.")
+	write("specs/api/v1.md", "Version one of the API specification.")
+	write("specs/api/notes.txt", "Notes that the glob does not match.")
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	loader := NewDocumentLoader()
+	options := DocumentLoaderOptions{
+		Workers:          2,
+		Stdin:            strings.NewReader("Meeting notes piped from another tool."),
+		StdinName:        "meeting",
+		StdinContentType: "text/markdown",
+	}
+	report := &LoadReport{}
+	collected, err := loader.collectSources([]string{"README.md", "guides", "specs/**/*.md", StdinSource, "README.md"}, options, report, nil)
+	require.NoError(t, err)
+	defer collected.cleanup()
+	assert.Len(t, collected.files, 4)
+
+	docs := loader.loadCollected(collected, options, report, nil)
+	assert.Empty(t, report.Failures)
+
+	var names []string
+	for _, doc := range docs {
+		names = append(names, doc.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"README.md", "guides/setup.txt", "meeting", "specs/api/v1.md"}, names)
+
+	for _, doc := range docs {
+		if doc.Name == "meeting" {
+			assert.Equal(t, "meeting", doc.Path)
+			assert.Equal(t, "text/markdown", doc.ContentType)
+		}
+	}
+
+	_, err = loader.collectSources([]string{"missing.md"}, DocumentLoaderOptions{}, &LoadReport{}, nil)
+	assert.Error(t, err)
+}
+
+// TestUnnamedStdinDocuments checks that documents piped without a name are
+// named after their content, so that a second one isn't taken for the first
+func TestUnnamedStdinDocuments(t *testing.T) {
+	name := func(content string) string {
+		doc := domain.NewDocument("/tmp/rlama-stdin/stdin.txt", content)
+		nameStdinDocument(doc, DocumentLoaderOptions{})
+		assert.Equal(t, doc.Path, doc.ID)
+		return doc.Name
+	}
+
+	first := name("Notes of the Monday meeting.")
+	assert.True(t, strings.HasPrefix(first, "stdin-"), first)
+	assert.True(t, strings.HasSuffix(first, ".txt"), first)
+	assert.NotEqual(t, first, name("Notes of the Tuesday meeting."))
+	assert.Equal(t, first, name("Notes of the Monday meeting."))
+}
+
+func TestPrepareDocuments(t *testing.T) {
+	doc := &domain.Document{Name: "faq.md", Content: "Frequently asked questions and their answers."}
+	require.NoError(t, prepareDocuments([]*domain.Document{doc}))
+
+	assert.Equal(t, "faq.md", doc.ID)
+	assert.Equal(t, "faq.md", doc.Path)
+	assert.Equal(t, "text/markdown", doc.ContentType)
+	assert.Equal(t, "en", doc.Metadata.Language())
+	assert.NotZero(t, doc.Fingerprint)
+	assert.False(t, doc.CreatedAt.IsZero())
+
+	assert.Error(t, prepareDocuments([]*domain.Document{{Name: "empty.md"}}))
+	assert.Error(t, prepareDocuments([]*domain.Document{{Content: "No name at all."}}))
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/dontizi/rlama/internal/domain"
+)
+
+// DefaultRowsPerChunk is the number of table rows grouped in a chunk when
+// ChunkingConfig.RowsPerChunk is not set
+const DefaultRowsPerChunk = 20
+
+// sheetDelimiter starts the lines separating the sheets of a spreadsheet
+// converted by xlsx2csv ("-------- 2 - Prices")
+const sheetDelimiter = "-------- "
+
+// tableSheet is a sheet of CSV text within a document
+type tableSheet struct {
+	name   string
+	text   string
+	offset int // Position of the sheet text in the document content
+}
+
+// isTableFile reports whether a document holds tables extracted as CSV
+func isTableFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".xlsx", ".xls":
+		return true
+	}
+	return false
+}
+
+// createTableChunks splits CSV content into chunks of complete rows. Each row
+// is rendered with its column headers ("Product: X; SLA: 99.9%") so that a
+// chunk is understandable on its own, and the sheet name and row range are
+// stored in the chunk metadata. Returns nil if the content is not a table.
+func (cs *ChunkerService) createTableChunks(doc *domain.Document, chunkSize int) []*domain.DocumentChunk {
+	rowsPerChunk := cs.config.RowsPerChunk
+	if rowsPerChunk <= 0 {
+		rowsPerChunk = DefaultRowsPerChunk
+	}
+
+	var chunks []*domain.DocumentChunk
+	for _, sheet := range splitSheets(doc.Content) {
+		reader := csv.NewReader(strings.NewReader(sheet.text))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		var headers []string
+		var rows []string
+		rowNumber, firstRow, lastRow, start, size := 0, 0, 0, 0, 0
+
+		flush := func(end int) {
+			if len(rows) == 0 {
+				return
+			}
+			chunk := domain.NewDocumentChunk(doc, strings.Join(rows, "\n"), sheet.offset+start, sheet.offset+end, len(chunks))
+			if sheet.name != "" {
+				chunk.Metadata["sheet"] = sheet.name
+			}
+			chunk.Metadata["row_start"] = fmt.Sprintf("%d", firstRow)
+			chunk.Metadata["row_end"] = fmt.Sprintf("%d", lastRow)
+			chunk.Metadata["columns"] = strings.Join(headers, ", ")
+			chunks = append(chunks, chunk)
+			rows = nil
+			size = 0
+			start = end
+		}
+
+		for {
+			offset := int(reader.InputOffset())
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil
+			}
+			rowNumber++
+			if isEmptyRecord(record) {
+				continue
+			}
+
+			if headers == nil {
+				headers = tableHeaders(record)
+				start = int(reader.InputOffset())
+				continue
+			}
+
+			row := renderTableRow(headers, record)
+			rowSize := cs.measure(row + "\n")
+			if len(rows) > 0 && (len(rows) >= rowsPerChunk || chunkSize > 0 && size+rowSize > chunkSize) {
+				flush(offset)
+			}
+			if len(rows) == 0 {
+				firstRow = rowNumber
+			}
+			lastRow = rowNumber
+			rows = append(rows, row)
+			size += rowSize
+		}
+		flush(len(sheet.text))
+	}
+
+	for _, chunk := range chunks {
+		chunk.UpdateTotalChunks(len(chunks))
+	}
+	return chunks
+}
+
+// splitSheets separates the sheets of a converted spreadsheet. Plain CSV
+// content is a single sheet without a name.
+func splitSheets(content string) []tableSheet {
+	var sheets []tableSheet
+	current := tableSheet{}
+	position := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(line, sheetDelimiter) {
+			if strings.TrimSpace(current.text) != "" {
+				sheets = append(sheets, current)
+			}
+			current = tableSheet{name: sheetName(line), offset: position + len(line)}
+		} else {
+			current.text += line
+		}
+		position += len(line)
+	}
+	if strings.TrimSpace(current.text) != "" {
+		sheets = append(sheets, current)
+	}
+	return sheets
+}
+
+// sheetName extracts the name from a delimiter line such as "-------- 2 - Prices"
+func sheetName(line string) string {
+	line = strings.TrimSpace(strings.TrimPrefix(line, sheetDelimiter))
+	if _, name, ok := strings.Cut(line, " - "); ok {
+		return strings.TrimSpace(name)
+	}
+	return line
+}
+
+// tableHeaders names the columns, numbering those without a header
+func tableHeaders(record []string) []string {
+	headers := make([]string, len(record))
+	for i, header := range record {
+		headers[i] = strings.TrimSpace(header)
+		if headers[i] == "" {
+			headers[i] = fmt.Sprintf("Column %d", i+1)
+		}
+	}
+	return headers
+}
+
+// renderTableRow writes a row as "Header: value; Header: value", leaving out empty cells
+func renderTableRow(headers, record []string) string {
+	var parts []string
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		header := fmt.Sprintf("Column %d", i+1)
+		if i < len(headers) {
+			header = headers[i]
+		}
+		parts = append(parts, header+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// isEmptyRecord reports whether every cell of a row is blank
+func isEmptyRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
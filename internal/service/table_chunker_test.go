@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dontizi/rlama/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableChunksKeepRowsWithHeaders(t *testing.T) {
+	content := "Product,SLA,Region\n" +
+		"Alpha,99.9%,EU\n" +
+		"Beta,99.5%,\n" +
+		"\"Gamma, Pro\",99.99%,US\n" +
+		",,\n" +
+		"Delta,98%,APAC\n"
+	doc := domain.NewDocument("products.csv", content)
+
+	chunker := NewChunkerService(ChunkingConfig{ChunkSize: 1000, ChunkOverlap: 200, RowsPerChunk: 2})
+	chunks := chunker.ChunkDocument(doc)
+
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "Product: Alpha; SLA: 99.9%; Region: EU\nProduct: Beta; SLA: 99.5%", chunks[0].Content)
+	assert.Equal(t, "2", chunks[0].Metadata["row_start"])
+	assert.Equal(t, "3", chunks[0].Metadata["row_end"])
+	assert.Equal(t, "Product, SLA, Region", chunks[0].Metadata["columns"])
+	assert.NotContains(t, chunks[0].Metadata, "sheet")
+
+	// The blank row is skipped but still counted in the row numbers
+	assert.Equal(t, "Product: Gamma, Pro; SLA: 99.99%; Region: US\nProduct: Delta; SLA: 98%; Region: APAC", chunks[1].Content)
+	assert.Equal(t, "4", chunks[1].Metadata["row_start"])
+	assert.Equal(t, "6", chunks[1].Metadata["row_end"])
+	assert.Equal(t, "2 of 2", chunks[1].Metadata["chunk_position"])
+}
+
+func TestTableChunksSplitSheets(t *testing.T) {
+	content := "-------- 1 - Products\n" +
+		"Product,Owner\n" +
+		"Alpha,Ana\n" +
+		"-------- 2 - Prices\n" +
+		"Product,Price\n" +
+		"Alpha,10\n" +
+		"Beta,12\n"
+	doc := domain.NewDocument("catalog.xlsx", content)
+
+	chunker := NewChunkerService(ChunkingConfig{ChunkSize: 1000})
+	chunks := chunker.ChunkDocument(doc)
+
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "Products", chunks[0].Metadata["sheet"])
+	assert.Equal(t, "Product: Alpha; Owner: Ana", chunks[0].Content)
+	assert.Equal(t, "Prices", chunks[1].Metadata["sheet"])
+	assert.Equal(t, "Product: Alpha; Price: 10\nProduct: Beta; Price: 12", chunks[1].Content)
+	assert.Equal(t, "2", chunks[1].Metadata["row_start"])
+	assert.Equal(t, "3", chunks[1].Metadata["row_end"])
+}
+
+func TestTableChunksRespectChunkSize(t *testing.T) {
+	content := "Name,Notes\n" +
+		"a,first row with a rather long note\n" +
+		"b,second row with a rather long note\n" +
+		"c,third row with a rather long note\n"
+	doc := domain.NewDocument("notes.csv", content)
+
+	chunker := NewChunkerService(ChunkingConfig{ChunkSize: 60})
+	chunks := chunker.ChunkDocument(doc)
+
+	require.Len(t, chunks, 3)
+	for i, chunk := range chunks {
+		assert.Equal(t, chunk.Metadata["row_start"], chunk.Metadata["row_end"], "chunk %d", i)
+	}
+}
@@ -31,6 +31,17 @@ func (ww *WebWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 
 	fmt.Printf("Checking for updates on %s\n", rag.WatchedURL)
 
+	// Chunks whose embedding failed during a previous check are embedded first
+	embeddingService, err := NewEmbeddingService(ww.ragService.GetOllamaClient()).ForRag(rag)
+	if err != nil {
+		return 0, err
+	}
+	embeddingModel, err := embeddingService.ResolveEmbeddingModel(rag)
+	if err != nil {
+		return 0, err
+	}
+	embedPendingChunks(rag, embeddingService, embeddingModel)
+
 	// Create a webcrawler to fetch the site content
 	webCrawler, err := crawler.NewWebCrawler(
 		rag.WatchedURL,
@@ -130,8 +141,19 @@ func (ww *WebWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 		ChunkOverlap: rag.WebWatchOptions.ChunkOverlap,
 	})
 
+	// Strip the boilerplate (menus, cookie banners) detected when the RAG was
+	// built, collapse near-duplicates with the settings of the RAG, then redact
+	// personal data from the pages kept
+	stripKnownBoilerplate(rag, newDocuments)
+	newDocuments = collapseDuplicates(rag, newDocuments, nil)
+	newDocuments, err = redactDocuments(rag, newDocuments)
+	if err != nil {
+		return 0, err
+	}
+
 	var allChunks []*domain.DocumentChunk
 	var processedDocs []*domain.Document
+	contextualizer := newChunkContextualizer(ww.ragService.GetOllamaClient(), rag)
 
 	// Process each new document directly
 	for i, doc := range newDocuments {
@@ -148,6 +170,7 @@ func (ww *WebWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 
 		// Chunk the document
 		chunks := chunkerService.ChunkDocument(doc)
+		contextualizer.addHeaders(doc, chunks)
 		// Update the chunk metadata
 		for i, chunk := range chunks {
 			chunk.ChunkNumber = i
@@ -157,8 +180,7 @@ func (ww *WebWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 	}
 
 	// Generate embeddings for all chunks
-	embeddingService := NewEmbeddingService(ww.ragService.GetOllamaClient())
-	err = embeddingService.GenerateChunkEmbeddings(allChunks, rag.ModelName)
+	failed, err := embeddingService.GenerateChunkEmbeddings(allChunks, embeddingModel)
 	if err != nil {
 		return 0, fmt.Errorf("error generating embeddings for new documents: %w", err)
 	}
@@ -168,9 +190,7 @@ func (ww *WebWatcher) CheckAndUpdateRag(rag *domain.RagSystem) (int, error) {
 		rag.AddDocument(doc)
 	}
 
-	for _, chunk := range allChunks {
-		rag.AddChunk(chunk)
-	}
+	addEmbeddedChunks(rag, allChunks, failed)
 
 	// Update last watched time
 	rag.LastWebWatchAt = time.Now()
@@ -158,12 +158,20 @@ else:
 
 // ExecuteScript executes a Python script using the proper Python command
 func (pe *PythonExecutor) ExecuteScript(script string, stdin ...string) ([]byte, error) {
-	pythonCmd := pe.GetPythonCommand()
-
-	cmd := exec.Command(pythonCmd, "-c", script)
+	cmd := pe.Command(script)
 	if len(stdin) > 0 {
 		cmd.Stdin = strings.NewReader(stdin[0])
 	}
+	return cmd.CombinedOutput()
+}
+
+// Command returns the command running a Python script with the proper Python
+// command, args being its sys.argv[1:], for scripts the caller talks to while
+// they run
+func (pe *PythonExecutor) Command(script string, args ...string) *exec.Cmd {
+	pythonCmd := pe.GetPythonCommand()
+
+	cmd := exec.Command(pythonCmd, append([]string{"-c", script}, args...)...)
 
 	// Set environment variables to force English locale and avoid French warnings
 	cmd.Env = append(os.Environ(),
@@ -172,8 +180,7 @@ func (pe *PythonExecutor) ExecuteScript(script string, stdin ...string) ([]byte,
 		"LANGUAGE=en_US:en",
 		"PYTHONIOENCODING=utf-8",
 	)
-
-	return cmd.CombinedOutput()
+	return cmd
 }
 
 // GetVirtualEnvPath returns the virtual environment path
@@ -0,0 +1,61 @@
+//go:build ignore
+
+// gen_vocab fetches the embedded BPE vocabulary, OpenAI's cl100k_base
+// published with tiktoken (MIT license):
+//
+//	go run gen_vocab.go -out vocab.tiktoken
+//
+// The download is checked against the SHA-256 tiktoken expects, so the
+// embedded ranks are exactly the ones of cl100k_base.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+const (
+	cl100kBaseURL    = "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken"
+	cl100kBaseSHA256 = "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7"
+)
+
+func main() {
+	out := flag.String("out", "vocab.tiktoken", "Output file")
+	flag.Parse()
+
+	if err := fetch(*out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func fetch(out string) error {
+	resp, err := http.Get(cl100kBaseURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", cl100kBaseURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hash := hex.EncodeToString(sum[:]); hash != cl100kBaseSHA256 {
+		return fmt.Errorf("%s: unexpected SHA-256 %s", cl100kBaseURL, hash)
+	}
+
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote cl100k_base (%d bytes) to %s\n", len(data), out)
+	return nil
+}
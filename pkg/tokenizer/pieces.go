@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// contractions are the English suffixes kept as pieces of their own
+var contractions = []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+
+// Pieces splits text into the pieces BPE merges are applied to, following the
+// cl100k pre-tokenization rules: contractions, words with one leading
+// non-letter, runs of up to three digits, punctuation runs with an optional
+// leading space, newlines and the remaining whitespace. Merges never cross
+// piece boundaries. Pieces longer than maxPieceLength are cut.
+func Pieces(text string) []string {
+	var pieces []string
+	eachPiece(text, func(piece string) bool {
+		pieces = append(pieces, piece)
+		return true
+	})
+	return pieces
+}
+
+// maxPieceLength is the length in bytes above which a piece is cut in parts.
+// Text without spaces, such as CJK sentences or base64 data, would otherwise
+// make a single piece of a whole paragraph or file.
+const maxPieceLength = 256
+
+// eachPiece calls yield with the pieces of text in order, until it returns false
+func eachPiece(text string, yield func(piece string) bool) {
+	for i := 0; i < len(text); {
+		n := pieceLength(text[i:])
+		piece := text[i : i+n]
+		for len(piece) > maxPieceLength {
+			cut := maxPieceLength
+			for cut > 0 && !utf8.RuneStart(piece[cut]) {
+				cut--
+			}
+			if !yield(piece[:cut]) {
+				return
+			}
+			piece = piece[cut:]
+		}
+		if !yield(piece) {
+			return
+		}
+		i += n
+	}
+}
+
+// pieceLength returns the length in bytes of the piece text starts with
+func pieceLength(text string) int {
+	r, size := utf8.DecodeRuneInString(text)
+	next, nextSize := utf8.DecodeRuneInString(text[size:])
+
+	// 's 't 're 've 'm 'll 'd
+	if r == '\'' {
+		for _, suffix := range contractions {
+			if len(text) >= len(suffix) && strings.EqualFold(text[:len(suffix)], suffix) {
+				return len(suffix)
+			}
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if unicode.IsLetter(r) {
+		return size + letters(text[size:])
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) && nextSize > 0 && unicode.IsLetter(next) {
+		return size + nextSize + letters(text[size+nextSize:])
+	}
+
+	// \p{N}{1,3}
+	if unicode.IsNumber(r) {
+		n := size
+		for digits := 1; digits < 3 && n < len(text); digits++ {
+			r, size := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(r) {
+				break
+			}
+			n += size
+		}
+		return n
+	}
+
+	// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+	start := 0
+	if r == ' ' && nextSize > 0 && isSymbol(next) {
+		start = size
+	}
+	if n := symbols(text[start:]); n > 0 {
+		n += start
+		for n < len(text) && (text[n] == '\r' || text[n] == '\n') {
+			n++
+		}
+		return n
+	}
+
+	// Whitespace: \s*[\r\n]+ then \s+(?!\S) then \s+
+	spaces, lastNewline := 0, -1
+	for spaces < len(text) {
+		r, size := utf8.DecodeRuneInString(text[spaces:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		if r == '\r' || r == '\n' {
+			lastNewline = spaces + size
+		}
+		spaces += size
+	}
+	if lastNewline > 0 {
+		return lastNewline
+	}
+	if spaces == len(text) {
+		return spaces
+	}
+	_, lastSize := utf8.DecodeLastRuneInString(text[:spaces])
+	if spaces > lastSize {
+		return spaces - lastSize
+	}
+	if spaces > 0 {
+		return spaces
+	}
+	return size
+}
+
+// letters returns the length of the run of letters text starts with
+func letters(text string) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// symbols returns the length of the run of characters that are neither
+// whitespace, letters nor numbers text starts with
+func symbols(text string) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if !isSymbol(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// isSymbol reports whether r is neither whitespace, a letter nor a number
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
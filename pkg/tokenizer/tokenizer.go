@@ -0,0 +1,270 @@
+// Package tokenizer counts and splits text in the byte-level BPE tokens used
+// by embedding models, with a vocabulary shipped in the binary.
+package tokenizer
+
+//go:generate go run gen_vocab.go -out vocab.tiktoken
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// vocabulary is the embedded BPE vocabulary in tiktoken format: one base64
+// encoded token and its rank per line, the rank giving the merge order.
+// go generate replaces it with cl100k_base.
+//
+//go:embed vocab.tiktoken
+var vocabulary []byte
+
+// Tokenizer is a byte-level BPE tokenizer
+type Tokenizer struct {
+	ranks   map[string]int
+	decoder [][]byte
+}
+
+var (
+	defaultOnce      sync.Once
+	defaultTokenizer *Tokenizer
+)
+
+// Default returns the tokenizer built from the embedded vocabulary
+func Default() *Tokenizer {
+	defaultOnce.Do(func() {
+		t, err := Parse(bytes.NewReader(vocabulary))
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded vocabulary: %v", err))
+		}
+		defaultTokenizer = t
+	})
+	return defaultTokenizer
+}
+
+// LoadFile reads a tokenizer from a tiktoken vocabulary file such as cl100k_base.tiktoken
+func LoadFile(path string) (*Tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vocabulary %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Parse reads a vocabulary in tiktoken format. Every single byte must be a token
+// so that any text can be encoded.
+func Parse(r io.Reader) (*Tokenizer, error) {
+	t := &Tokenizer{ranks: make(map[string]int)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and its rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil || rank < 0 {
+			return nil, fmt.Errorf("line %d: invalid rank %q", line, fields[1])
+		}
+
+		t.ranks[string(token)] = rank
+		for len(t.decoder) <= rank {
+			t.decoder = append(t.decoder, nil)
+		}
+		t.decoder[rank] = token
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for b := 0; b < 256; b++ {
+		if _, ok := t.ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("byte 0x%02x is not a token", b)
+		}
+	}
+	return t, nil
+}
+
+// VocabularySize returns the number of tokens of the vocabulary
+func (t *Tokenizer) VocabularySize() int {
+	return len(t.ranks)
+}
+
+// Encode converts text to token ids
+func (t *Tokenizer) Encode(text string) []int {
+	var ids []int
+	for _, piece := range Pieces(text) {
+		for _, token := range t.merge(piece) {
+			ids = append(ids, t.ranks[token])
+		}
+	}
+	return ids
+}
+
+// Decode converts token ids back to text
+func (t *Tokenizer) Decode(ids []int) string {
+	var buf bytes.Buffer
+	for _, id := range ids {
+		if id >= 0 && id < len(t.decoder) {
+			buf.Write(t.decoder[id])
+		}
+	}
+	return buf.String()
+}
+
+// Count returns the number of tokens of text
+func (t *Tokenizer) Count(text string) int {
+	count := 0
+	for _, piece := range Pieces(text) {
+		count += len(t.merge(piece))
+	}
+	return count
+}
+
+// Prefix returns the length in bytes of the first n tokens of text, shortened
+// so as not to cut a UTF-8 character
+func (t *Tokenizer) Prefix(text string, n int) int {
+	end := 0
+	done := false
+	eachPiece(text, func(piece string) bool {
+		for _, token := range t.merge(piece) {
+			if n <= 0 {
+				done = true
+				return false
+			}
+			end += len(token)
+			n--
+		}
+		return true
+	})
+	if done {
+		return runeStart(text, end)
+	}
+	return len(text)
+}
+
+// Suffix returns the byte offset at which the last n tokens of text start,
+// moved forward so as not to cut a UTF-8 character
+func (t *Tokenizer) Suffix(text string, n int) int {
+	var lengths []int
+	for _, piece := range Pieces(text) {
+		for _, token := range t.merge(piece) {
+			lengths = append(lengths, len(token))
+		}
+	}
+
+	start := len(text)
+	for i := len(lengths) - 1; i >= 0 && n > 0; i, n = i-1, n-1 {
+		start -= lengths[i]
+	}
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return start
+}
+
+// merge applies the BPE merges to a piece of text, lowest rank first and
+// leftmost first among equal ranks. The parts are kept in a linked list and the
+// pairs of adjacent parts in a heap ordered by rank, so that a piece of n bytes
+// is merged in O(n log n).
+func (t *Tokenizer) merge(piece string) []string {
+	if _, ok := t.ranks[piece]; ok {
+		return []string{piece}
+	}
+
+	// end[i] is the end of the part starting at byte i, -1 once it was merged
+	// into the part before it; start[j] is the start of the part ending at byte j
+	n := len(piece)
+	end := make([]int, n)
+	start := make([]int, n+1)
+	for i := 0; i < n; i++ {
+		end[i] = i + 1
+		start[i+1] = i
+	}
+
+	pairs := &pairHeap{}
+	push := func(i int) {
+		if mid := end[i]; mid < n {
+			if rank, ok := t.ranks[piece[i:end[mid]]]; ok {
+				heap.Push(pairs, pair{rank: rank, start: i, mid: mid, end: end[mid]})
+			}
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		push(i)
+	}
+
+	for pairs.Len() > 0 {
+		p := heap.Pop(pairs).(pair)
+		// Skip the pairs one of whose parts was merged since they were pushed
+		if end[p.start] != p.mid || end[p.mid] != p.end {
+			continue
+		}
+		end[p.start] = p.end
+		end[p.mid] = -1
+		start[p.end] = p.start
+
+		push(p.start)
+		if p.start > 0 {
+			push(start[p.start])
+		}
+	}
+
+	var parts []string
+	for i := 0; i < n; i = end[i] {
+		parts = append(parts, piece[i:end[i]])
+	}
+	return parts
+}
+
+// pair is a candidate merge of the parts piece[start:mid] and piece[mid:end]
+type pair struct {
+	rank, start, mid, end int
+}
+
+// pairHeap orders candidate merges by rank, then by position
+type pairHeap []pair
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)   { *h = append(*h, x.(pair)) }
+func (h *pairHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// runeStart moves a byte offset back to the start of the UTF-8 character it is in
+func runeStart(text string, offset int) int {
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	return offset
+}
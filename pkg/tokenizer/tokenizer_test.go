@@ -0,0 +1,147 @@
+package tokenizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPiecesFollowCl100kRules(t *testing.T) {
+	assert.Equal(t, []string{"Hello", ",", " world", "!"}, Pieces("Hello, world!"))
+	assert.Equal(t, []string{"I", "'ll", " see", " you", "'RE"}, Pieces("I'll see you'RE"))
+	assert.Equal(t, []string{"123", "456", "7"}, Pieces("1234567"))
+	assert.Equal(t, []string{"a", " ", " b"}, Pieces("a  b"))
+	assert.Equal(t, []string{"line", "\n\n", "next", "  "}, Pieces("line\n\nnext  "))
+	assert.Equal(t, []string{"func", " main", "()", " {\n", "\t", "}"}, Pieces("func main() {\n\t}"))
+	assert.Equal(t, "日本語のテキスト", strings.Join(Pieces("日本語のテキスト"), ""))
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tok := Default()
+	require.Greater(t, tok.VocabularySize(), 256)
+
+	for _, text := range []string{
+		"The quick brown fox jumps over the lazy dog.",
+		"func (s *Server) Start(ctx context.Context) error {\n\treturn nil\n}",
+		"Les données personnelles sont supprimées avant l'indexation.",
+		"検索拡張生成は文書を小さなチャンクに分割します。",
+		"",
+	} {
+		ids := tok.Encode(text)
+		assert.Equal(t, text, tok.Decode(ids))
+		assert.Equal(t, len(ids), tok.Count(text))
+	}
+}
+
+func TestCountDependsOnScript(t *testing.T) {
+	tok := Default()
+
+	english := "The embedding model reads the documentation of the project."
+	assert.Less(t, tok.Count(english), len(english)/3, "common English words are merged into few tokens")
+
+	japanese := "検索拡張生成は文書を小さなチャンクに分割します。"
+	assert.Greater(t, float64(tok.Count(japanese))/float64(len([]rune(japanese))),
+		float64(tok.Count(english))/float64(len(english)), "CJK text needs more tokens per character")
+}
+
+// cl100kBaseSHA256 is the hash of cl100k_base.tiktoken checked by gen_vocab.go
+const cl100kBaseSHA256 = "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7"
+
+func TestCountsMatchCl100kBase(t *testing.T) {
+	sum := sha256.Sum256(vocabulary)
+	if hex.EncodeToString(sum[:]) != cl100kBaseSHA256 {
+		t.Skip("the embedded vocabulary is not cl100k_base, run go generate ./pkg/tokenizer")
+	}
+	tok := Default()
+
+	assert.Equal(t, 100256, tok.VocabularySize())
+	assert.Equal(t, []int{15339, 1917}, tok.Encode("hello world"))
+	assert.Equal(t, []int{83, 1609, 5963, 374, 2294, 0}, tok.Encode("tiktoken is great!"))
+	assert.Equal(t, []int{17, 489, 220, 17, 284, 220, 19}, tok.Encode("2 + 2 = 4"))
+	assert.Equal(t, 9, tok.Count("お誕生日おめでとう"))
+}
+
+func TestPrefixAndSuffix(t *testing.T) {
+	tok := Default()
+	text := "Retrieval augmented generation splits documents into chunks. 検索拡張生成"
+
+	for n := 0; n <= tok.Count(text); n++ {
+		prefix := tok.Prefix(text, n)
+		assert.LessOrEqual(t, tok.Count(text[:prefix]), n)
+		assert.True(t, strings.HasPrefix(text, text[:prefix]))
+
+		suffix := tok.Suffix(text, n)
+		assert.LessOrEqual(t, tok.Count(text[suffix:]), n)
+	}
+	assert.Equal(t, len(text), tok.Prefix(text, 1000))
+	assert.Equal(t, 0, tok.Suffix(text, 1000))
+}
+
+func TestMergeMatchesNaiveMerge(t *testing.T) {
+	tok := Default()
+
+	for _, piece := range []string{"documentation", " tokenizer", "検索拡張生成は文書を", "aGVsbG8gd29ybGQ=", "))))]]}}"} {
+		assert.Equal(t, naiveMerge(tok, piece), tok.merge(piece), piece)
+	}
+}
+
+// naiveMerge is the reference BPE merge, rescanning every pair after each merge
+func naiveMerge(tok *Tokenizer, piece string) []string {
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := tok.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+func TestLongTextWithoutSpaces(t *testing.T) {
+	tok := Default()
+	cjk := strings.Repeat("検索拡張生成は文書を小さなチャンクに分割します", 1000)
+	base64 := strings.Repeat("QmFzZTY0IGVuY29kZWQgZGF0YSBoYXMgbm8gc3BhY2Vz", 3000)
+
+	for _, text := range []string{cjk, base64} {
+		for _, piece := range Pieces(text) {
+			assert.LessOrEqual(t, len(piece), maxPieceLength)
+		}
+
+		start := time.Now()
+		ids := tok.Encode(text)
+		assert.Equal(t, text, tok.Decode(ids))
+		assert.Equal(t, len(ids), tok.Count(text))
+		prefix := tok.Prefix(text, 100)
+		assert.Equal(t, 100, tok.Count(text[:prefix]))
+		assert.Less(t, time.Since(start), 5*time.Second)
+	}
+}
+
+func BenchmarkCountWithoutSpaces(b *testing.B) {
+	tok := Default()
+	text := strings.Repeat("検索拡張生成は文書を小さなチャンクに分割します", 1000)
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		tok.Count(text)
+	}
+}
+
+func TestParseRequiresEveryByte(t *testing.T) {
+	_, err := Parse(strings.NewReader("YQ== 0\n"))
+	assert.Error(t, err)
+}
@@ -40,6 +40,25 @@ func (s *HNSWStore) Remove(id string) {
 	delete(s.items, id)
 }
 
+// Get returns the vector stored for an ID
+func (s *HNSWStore) Get(id string) ([]float32, bool) {
+	vector, ok := s.items[id]
+	return vector, ok
+}
+
+// Len returns the number of stored vectors
+func (s *HNSWStore) Len() int {
+	return len(s.items)
+}
+
+// Dimensions returns the size of the stored vectors, 0 when the store is empty
+func (s *HNSWStore) Dimensions() int {
+	for _, vector := range s.items {
+		return len(vector)
+	}
+	return 0
+}
+
 // computeCosineSimilarity calculates cosine similarity between two vectors
 func computeCosineSimilarity(a, b []float32) float64 {
 	// Check for empty vectors to prevent index out of range errors
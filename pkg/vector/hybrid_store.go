@@ -4,25 +4,38 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
 )
 
-// DocumentData represents the data structure for Bleve indexing
+// DocumentData represents the data structure for Bleve indexing.
+// Metadata keys are searchable as fields, e.g. "metadata.author:smith".
 type DocumentData struct {
-	ID       string `json:"id"`
-	Content  string `json:"content"`
-	Metadata string `json:"metadata"`
+	ID       string            `json:"id"`
+	Content  string            `json:"content"`
+	Metadata map[string]string `json:"metadata"`
+	Language string            `json:"-"` // ISO 639-1 code of the content, "" if unknown
+	// Content indexed with its language's analyzer, under "localized.<language>"
+	Localized map[string]string `json:"localized,omitempty"`
 }
 
+// DefaultBM25Weight is the share of the BM25 text score in the score of a hybrid
+// search result, the rest being the vector similarity. Both scores are first
+// normalised by the best one of their search.
+const DefaultBM25Weight = 0.3
+
 // EnhancedHybridStore combines HNSW vector search and BM25 text search
 type EnhancedHybridStore struct {
 	VectorStore VectorStoreInterface `json:"-"`
 	TextIndex   bleve.Index          `json:"-"`
 	WeightBM25  float64              `json:"weight_bm25"`
 	// Maps for quick access to content and metadata
-	contentCache  map[string]string `json:"-"`
-	metadataCache map[string]string `json:"-"`
+	contentCache  map[string]string            `json:"-"`
+	metadataCache map[string]map[string]string `json:"-"`
+	languages     map[string]bool              // Languages with a dedicated analyzer present in the index
 }
 
 // Ensure EnhancedHybridStore implements VectorStoreInterface
@@ -44,15 +57,13 @@ func NewEnhancedHybridStore(indexPath string, dimensions int) (*EnhancedHybridSt
 
 	if indexPath == "" || indexPath == ":memory:" {
 		// In-memory index
-		indexMapping := bleve.NewIndexMapping()
-		textIndex, err = bleve.NewMemOnly(indexMapping)
+		textIndex, err = bleve.NewMemOnly(newTextIndexMapping())
 	} else {
 		// Check if index already exists
 		_, err := os.Stat(indexPath)
 		if os.IsNotExist(err) {
 			// Create new index
-			indexMapping := bleve.NewIndexMapping()
-			textIndex, err = bleve.New(indexPath, indexMapping)
+			textIndex, err = bleve.New(indexPath, newTextIndexMapping())
 		} else {
 			// Open existing index
 			textIndex, err = bleve.Open(indexPath)
@@ -66,33 +77,58 @@ func NewEnhancedHybridStore(indexPath string, dimensions int) (*EnhancedHybridSt
 	return &EnhancedHybridStore{
 		VectorStore:   NewHNSWStore(dimensions),
 		TextIndex:     textIndex,
-		WeightBM25:    0.3, // 30% BM25, 70% vector by default
+		WeightBM25:    DefaultBM25Weight,
 		contentCache:  make(map[string]string),
-		metadataCache: make(map[string]string),
+		metadataCache: make(map[string]map[string]string),
+		languages:     make(map[string]bool),
 	}, nil
 }
 
+// newTextIndexMapping creates the text index mapping. Besides the default analysis,
+// the content is indexed once more with the stemmer and stopwords of its language.
+func newTextIndexMapping() *mapping.IndexMappingImpl {
+	localized := bleve.NewDocumentMapping()
+	for lang, analyzer := range languageAnalyzers {
+		field := bleve.NewTextFieldMapping()
+		field.Analyzer = analyzer
+		field.Store = false
+		field.IncludeInAll = false
+		localized.AddFieldMappingsAt(lang, field)
+	}
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping.AddSubDocumentMapping("localized", localized)
+	return indexMapping
+}
+
 // AddDocument adds a document to both the vector and text indexes
-func (hs *EnhancedHybridStore) AddDocument(id string, content string, metadata string, vector []float32) error {
+func (hs *EnhancedHybridStore) AddDocument(id string, content string, metadata map[string]string, vector []float32) error {
 	// Add to vector store
 	hs.VectorStore.Add(id, vector)
 
-	// Add to cache
-	hs.contentCache[id] = content
-	hs.metadataCache[id] = metadata
+	return hs.IndexText(DocumentData{ID: id, Content: content, Metadata: metadata})
+}
+
+// IndexText adds documents to the text index only, in a single batch
+func (hs *EnhancedHybridStore) IndexText(docs ...DocumentData) error {
+	batch := hs.TextIndex.NewBatch()
+	for _, doc := range docs {
+		// Add to cache
+		hs.contentCache[doc.ID] = doc.Content
+		hs.metadataCache[doc.ID] = doc.Metadata
+		if lang := NormalizeLanguage(doc.Language); AnalyzerForLanguage(lang) != "" {
+			doc.Localized = map[string]string{lang: doc.Content}
+			hs.languages[lang] = true
+		}
 
-	// Add to text index
-	doc := DocumentData{
-		ID:       id,
-		Content:  content,
-		Metadata: metadata,
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return fmt.Errorf("error indexing text: %w", err)
+		}
 	}
-	
-	err := hs.TextIndex.Index(id, doc)
-	if err != nil {
+
+	if err := hs.TextIndex.Batch(batch); err != nil {
 		return fmt.Errorf("error indexing text: %w", err)
 	}
-	
 	return nil
 }
 
@@ -114,13 +150,21 @@ func (hs *EnhancedHybridStore) Remove(id string) {
 	hs.TextIndex.Delete(id)
 }
 
+// Dimensions returns the size of the stored vectors, 0 when the store is empty
+func (hs *EnhancedHybridStore) Dimensions() int {
+	if store, ok := hs.VectorStore.(*HNSWStore); ok {
+		return store.Dimensions()
+	}
+	return 0
+}
+
 // GetContent returns a document's content
 func (hs *EnhancedHybridStore) GetContent(id string) string {
 	return hs.contentCache[id]
 }
 
 // GetMetadata returns a document's metadata
-func (hs *EnhancedHybridStore) GetMetadata(id string) string {
+func (hs *EnhancedHybridStore) GetMetadata(id string) map[string]string {
 	return hs.metadataCache[id]
 }
 
@@ -132,13 +176,75 @@ type HybridSearchResult struct {
 	CombinedScore  float64 `json:"combined_score"`
 }
 
+// MetadataFilter restricts a search to the documents whose metadata holds the
+// given values. Values are compared without case, and a comma-separated value
+// such as keywords matches when one of its items does.
+type MetadataFilter map[string]string
+
+// Matches reports whether metadata satisfies every condition of the filter
+func (f MetadataFilter) Matches(metadata map[string]string) bool {
+	for key, want := range f {
+		value, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		if !strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(want)) && !hasListItem(value, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasListItem reports whether a comma-separated list contains an item, without case
+func hasListItem(list, item string) bool {
+	if !strings.Contains(list, ",") {
+		return false
+	}
+	for _, value := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(item)) {
+			return true
+		}
+	}
+	return false
+}
+
 // HybridSearch performs a combined vector and text search
 func (hs *EnhancedHybridStore) HybridSearch(queryVector []float32, queryText string, limit int) ([]HybridSearchResult, error) {
+	return hs.HybridSearchFiltered(queryVector, queryText, limit, nil)
+}
+
+// HybridSearchFiltered performs a combined vector and text search among the
+// text-indexed documents whose metadata matches the filter. An empty filter
+// matches every document.
+func (hs *EnhancedHybridStore) HybridSearchFiltered(queryVector []float32, queryText string, limit int, filter MetadataFilter) ([]HybridSearchResult, error) {
+	textQuery := hs.textQuery(queryText)
+
 	// Execute vector search
-	vectorResults := hs.VectorStore.Search(queryVector, limit*2) // Get more results for fusion
+	var vectorResults []SearchResult
+	if len(filter) == 0 {
+		vectorResults = hs.VectorStore.Search(queryVector, limit*2) // Get more results for fusion
+	} else {
+		allowed := make(map[string]bool)
+		var allowedIDs []string
+		for id, metadata := range hs.metadataCache {
+			if filter.Matches(metadata) {
+				allowed[id] = true
+				allowedIDs = append(allowedIDs, id)
+			}
+		}
+		if len(allowedIDs) == 0 {
+			return nil, nil
+		}
+
+		for _, res := range hs.VectorStore.Search(queryVector, len(hs.metadataCache)) {
+			if allowed[res.ID] && len(vectorResults) < limit*2 {
+				vectorResults = append(vectorResults, res)
+			}
+		}
+		textQuery = bleve.NewConjunctionQuery(textQuery, bleve.NewDocIDQuery(allowedIDs))
+	}
 	
 	// Execute BM25 text search
-	textQuery := bleve.NewQueryStringQuery(queryText)
 	textSearch := bleve.NewSearchRequest(textQuery)
 	textSearch.Size = limit * 2
 	textSearchResults, err := hs.TextIndex.Search(textSearch)
@@ -146,6 +252,18 @@ func (hs *EnhancedHybridStore) HybridSearch(queryVector []float32, queryText str
 		return nil, fmt.Errorf("error during text search: %w", err)
 	}
 	
+	// Without text matches, the vector results are returned as they are
+	if len(textSearchResults.Hits) == 0 {
+		var hybridResults []HybridSearchResult
+		for _, res := range vectorResults {
+			if len(hybridResults) == limit {
+				break
+			}
+			hybridResults = append(hybridResults, HybridSearchResult{ID: res.ID, VectorScore: res.Score, CombinedScore: res.Score})
+		}
+		return hybridResults, nil
+	}
+
 	// Store normalized scores in maps
 	vectorScores := make(map[string]float64)
 	textScores := make(map[string]float64)
@@ -221,6 +339,42 @@ func (hs *EnhancedHybridStore) HybridSearch(queryVector []float32, queryText str
 	return hybridResults, nil
 }
 
+// textQuery builds the BM25 query. Besides the query string syntax, the content is
+// matched with the analyzer of the query's language, or of every indexed language
+// when the query is too short to tell. Questions that are not valid query strings
+// ("what is a:b?") are matched as plain text.
+func (hs *EnhancedHybridStore) textQuery(queryText string) query.Query {
+	var queries []query.Query
+	queryString := bleve.NewQueryStringQuery(queryText)
+	if _, err := queryString.Parse(); err == nil {
+		queries = append(queries, queryString)
+	} else {
+		queries = append(queries, bleve.NewMatchQuery(queryText))
+	}
+
+	var langs []string
+	if lang := DetectLanguage(queryText); lang != "" {
+		langs = []string{lang}
+	} else {
+		for _, lang := range sortedLanguages() {
+			if hs.languages[lang] {
+				langs = append(langs, lang)
+			}
+		}
+	}
+
+	for _, lang := range langs {
+		match := bleve.NewMatchQuery(queryText)
+		match.SetField("localized." + lang)
+		queries = append(queries, match)
+	}
+
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
 // Search implements the basic vector search interface
 func (hs *EnhancedHybridStore) Search(query []float32, limit int) []SearchResult {
 	return hs.VectorStore.Search(query, limit)
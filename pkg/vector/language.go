@@ -0,0 +1,142 @@
+package vector
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+)
+
+// languageAnalyzers maps the detectable languages (ISO 639-1) to their Bleve analyzer
+var languageAnalyzers = map[string]string{
+	"en": en.AnalyzerName,
+	"fr": fr.AnalyzerName,
+	"de": de.AnalyzerName,
+	"es": es.AnalyzerName,
+	"it": it.AnalyzerName,
+	"nl": nl.AnalyzerName,
+	"pt": pt.AnalyzerName,
+}
+
+// languageStopwords are the most frequent words of each language, used to detect it
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "as", "was", "on", "are", "be",
+		"this", "by", "you", "or", "from", "have", "not", "which", "an", "can", "will", "what", "how", "does", "do"},
+	"fr": {"de", "le", "la", "les", "des", "et", "est", "une", "un", "du", "pour", "dans", "que", "qui", "pas", "sur",
+		"au", "avec", "ce", "il", "sont", "ne", "se", "par", "plus", "nous", "vous", "comment", "quel", "quelle", "être"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "zu", "von", "sich", "des",
+		"auf", "für", "im", "dem", "auch", "es", "wird", "sind", "werden", "wie", "oder", "kann", "bei", "nach", "was", "ich"},
+	"es": {"de", "el", "los", "las", "del", "y", "es", "una", "por", "con", "para", "que", "se", "su", "al", "lo",
+		"como", "más", "pero", "sus", "le", "ya", "este", "entre", "cuando", "muy", "sin", "sobre", "también", "cómo", "qué"},
+	"it": {"il", "della", "che", "di", "e", "è", "per", "una", "sono", "non", "gli", "del", "con", "le", "si",
+		"da", "dei", "nel", "alla", "anche", "come", "più", "questo", "ma", "delle", "lo", "essere", "ha", "cosa", "quale"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "niet", "met", "voor", "die", "er",
+		"maar", "om", "aan", "ook", "als", "bij", "door", "wordt", "kan", "naar", "worden", "dit", "hoe", "wat", "ik"},
+	"pt": {"de", "o", "os", "da", "do", "das", "dos", "em", "um", "uma", "para", "não", "com", "que", "é", "se",
+		"na", "no", "por", "mais", "as", "como", "mas", "ao", "ele", "seu", "sua", "ou", "quando", "muito", "também"},
+}
+
+// stopwordLanguages indexes languageStopwords by word
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range languageStopwords {
+		for _, word := range words {
+			index[word] = append(index[word], lang)
+		}
+	}
+	return index
+}()
+
+// maxDetectionWords bounds the number of words examined by DetectLanguage
+const maxDetectionWords = 2000
+
+// DetectLanguage guesses the language of a text from its most frequent words and
+// returns its ISO 639-1 code, or "" when the text gives no clear signal
+func DetectLanguage(text string) string {
+	scores := make(map[string]float64)
+	words := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		// Elisions such as l'article or d'un
+		if i := strings.IndexRune(word, '\''); i >= 0 {
+			prefix := word[:i]
+			if prefix == "l" || prefix == "d" || prefix == "qu" || prefix == "n" || prefix == "c" {
+				scores["fr"] += 0.5
+			}
+			word = word[i+1:]
+		}
+		if word == "" {
+			continue
+		}
+		words++
+		// Words shared by several languages count for each of them, but less
+		if langs := stopwordLanguages[word]; len(langs) > 0 {
+			for _, lang := range langs {
+				scores[lang] += 1 / float64(len(langs))
+			}
+		}
+		scores[languageHint(word)] += 0.5
+		if words >= maxDetectionWords {
+			break
+		}
+	}
+
+	best, bestScore, second := "", 0.0, 0.0
+	for _, lang := range sortedLanguages() {
+		score := scores[lang]
+		if score > bestScore {
+			best, bestScore, second = lang, score, bestScore
+		} else if score > second {
+			second = score
+		}
+	}
+
+	// Require a minimum amount of evidence and a clear winner
+	if bestScore < 1 || bestScore < second*1.2 {
+		return ""
+	}
+	return best
+}
+
+// languageHint returns the language suggested by letters specific to it
+func languageHint(word string) string {
+	switch {
+	case strings.ContainsAny(word, "ßäöü"):
+		return "de"
+	case strings.ContainsAny(word, "ñ¿¡"):
+		return "es"
+	case strings.ContainsAny(word, "ãõ"):
+		return "pt"
+	case strings.ContainsAny(word, "çêëîœ"):
+		return "fr"
+	}
+	return ""
+}
+
+// sortedLanguages returns the detectable languages in a fixed order
+func sortedLanguages() []string {
+	return []string{"en", "fr", "de", "es", "it", "nl", "pt"}
+}
+
+// NormalizeLanguage reduces a language tag such as "fr-FR" or "en_US" to its
+// ISO 639-1 code. Unknown tags are returned lower-cased.
+func NormalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// AnalyzerForLanguage returns the Bleve analyzer for a language code, or "" if
+// the language has no dedicated analyzer
+func AnalyzerForLanguage(lang string) string {
+	return languageAnalyzers[NormalizeLanguage(lang)]
+}
@@ -11,3 +11,93 @@ func TestNewEnhancedHybridStore(t *testing.T) {
 		t.Error("Expected non-nil store")
 	}
 }
+
+func TestHybridStoreIndexesMetadata(t *testing.T) {
+	store, err := NewEnhancedHybridStore(":memory:", 3)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = store.IndexText(
+		DocumentData{ID: "a", Content: "release notes", Metadata: map[string]string{"author": "Ada Lovelace"}},
+		DocumentData{ID: "b", Content: "release checklist", Metadata: map[string]string{"author": "Alan Turing"}},
+	)
+	if err != nil {
+		t.Fatalf("Failed to index text: %v", err)
+	}
+
+	results, err := store.HybridSearch([]float32{1, 0, 0}, "metadata.author:lovelace", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected only document a to match the author field, got %+v", results)
+	}
+	if store.GetMetadata("b")["author"] != "Alan Turing" {
+		t.Error("Expected metadata to be cached")
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"en": "The configuration file is loaded when the service starts and it is checked for errors.",
+		"fr": "Le fichier de configuration est chargé au démarrage du service et il est vérifié pour les erreurs.",
+		"de": "Die Konfigurationsdatei wird beim Start des Dienstes geladen und auf Fehler geprüft.",
+		"":   "kubectl apply -f deployment.yaml",
+	}
+	for want, text := range cases {
+		if got := DetectLanguage(text); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	if got := NormalizeLanguage("fr-FR"); got != "fr" {
+		t.Errorf("NormalizeLanguage(fr-FR) = %q, want fr", got)
+	}
+	if AnalyzerForLanguage("en_US") == "" {
+		t.Error("Expected an analyzer for en_US")
+	}
+}
+
+func TestHybridStoreStemsByLanguage(t *testing.T) {
+	store, err := NewEnhancedHybridStore(":memory:", 3)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	err = store.IndexText(
+		DocumentData{ID: "fr", Content: "Les maisons anciennes sont rénovées chaque année.", Language: "fr"},
+		DocumentData{ID: "en", Content: "The weather was sunny all week.", Language: "en"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to index text: %v", err)
+	}
+
+	// "maison" only matches "maisons" through the French stemmer
+	results, err := store.HybridSearch([]float32{1, 0, 0}, "Comment est rénovée la maison ?", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 || results[0].ID != "fr" {
+		t.Errorf("Expected the French document to match, got %+v", results)
+	}
+}
+
+func TestHybridSearchAcceptsAnyQuestion(t *testing.T) {
+	store, err := NewEnhancedHybridStore(":memory:", 3)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.IndexText(DocumentData{ID: "a", Content: "The retry delay (in seconds) is configurable."}); err != nil {
+		t.Fatalf("Failed to index text: %v", err)
+	}
+
+	// Not a valid query string: the unbalanced parenthesis and the colon
+	results, err := store.HybridSearch([]float32{1, 0, 0}, "retry delay (seconds: what default?", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected the document to match the words of the question, got %+v", results)
+	}
+}